@@ -178,6 +178,7 @@ func (u *updater) setAdjustment(adjust *resmgrAdjustment) (map[string]string, er
 			Resources:    p.Spec.Resources,
 			Classes:      p.Spec.Classes,
 			ToptierLimit: p.Spec.ToptierLimit,
+			StaticPools:  p.Spec.StaticPools,
 		}
 	}
 	encoded, err := json.Marshal(specs)
@@ -68,6 +68,22 @@ func (spec *AdjustmentSpec) GetBlockIOClass() (string, bool) {
 	return *spec.Classes.BlockIO, true
 }
 
+// GetSchedulingClass returns the scheduling class for this adjustment.
+func (spec *AdjustmentSpec) GetSchedulingClass() (string, bool) {
+	if spec.Classes == nil || spec.Classes.Scheduling == nil {
+		return "", false
+	}
+	return *spec.Classes.Scheduling, true
+}
+
+// GetStaticPools returns the static-pools assignment for this adjustment.
+func (spec *AdjustmentSpec) GetStaticPools() (*StaticPools, bool) {
+	if spec.StaticPools == nil {
+		return nil, false
+	}
+	return spec.StaticPools, true
+}
+
 // IsNodeInScope tests if the node is within the scope of this spec.
 func (spec *AdjustmentSpec) IsNodeInScope(node string) bool {
 	if len(spec.Scope) == 0 {
@@ -109,6 +125,8 @@ func (spec *AdjustmentSpec) Compare(other *AdjustmentSpec) bool {
 		return false
 	case spec.ToptierLimit != nil && spec.ToptierLimit.Value() != other.ToptierLimit.Value():
 		return false
+	case !spec.StaticPools.Compare(other.StaticPools):
+		return false
 	}
 	return true
 }
@@ -121,6 +139,9 @@ func (spec *AdjustmentSpec) Verify() error {
 	if err := spec.verifyToptierLimit(); err != nil {
 		return err
 	}
+	if err := spec.verifyStaticPools(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -236,6 +257,26 @@ func (spec *AdjustmentSpec) verifyToptierLimit() error {
 	return nil
 }
 
+// verifyStaticPools verifies the static-pools settings of this spec.
+func (spec *AdjustmentSpec) verifyStaticPools() error {
+	stp := spec.StaticPools
+	if stp == nil {
+		return nil
+	}
+
+	if stp.Pool != nil && *stp.Pool == "" {
+		return apiError("invalid empty static-pools pool")
+	}
+	if stp.Socket != nil && *stp.Socket < -1 {
+		return apiError("invalid static-pools socket %d", *stp.Socket)
+	}
+	if stp.ExclusiveCPUs != nil && *stp.ExclusiveCPUs < 0 {
+		return apiError("invalid static-pools exclusive CPU count %d", *stp.ExclusiveCPUs)
+	}
+
+	return nil
+}
+
 // IsNodeInScope tests if the node is within this scope.
 func (scope *AdjustmentScope) IsNodeInScope(node string) bool {
 	if len(scope.Nodes) == 0 {
@@ -312,14 +353,43 @@ func (c *Classes) Compare(o *Classes) bool {
 		return true
 	case c != nil && o == nil, c == nil && o != nil:
 		return false
-	case c.RDT != nil && o.RDT == nil, c.RDT == nil && o.RDT != nil:
+	}
+	return compareClass(c.RDT, o.RDT) && compareClass(c.BlockIO, o.BlockIO) &&
+		compareClass(c.Scheduling, o.Scheduling)
+}
+
+// Compare checks if the static-pools assignment is identical to another one.
+func (s *StaticPools) Compare(o *StaticPools) bool {
+	switch {
+	case s == nil && o == nil:
+		return true
+	case s != nil && o == nil, s == nil && o != nil:
 		return false
-	case c.BlockIO != nil && o.BlockIO == nil, c.BlockIO == nil && o.BlockIO != nil:
+	}
+	return compareClass(s.Pool, o.Pool) && compareInt(s.Socket, o.Socket) &&
+		compareInt(s.ExclusiveCPUs, o.ExclusiveCPUs)
+}
+
+// compareInt checks if two optional integer settings are identical.
+func compareInt(i, o *int64) bool {
+	switch {
+	case i == nil && o == nil:
+		return true
+	case i != nil && o == nil, i == nil && o != nil:
 		return false
-	case c.RDT == nil && c.BlockIO == nil:
+	}
+	return *i == *o
+}
+
+// compareClass checks if two optional class assignments are identical.
+func compareClass(c, o *string) bool {
+	switch {
+	case c == nil && o == nil:
 		return true
+	case c != nil && o == nil, c == nil && o != nil:
+		return false
 	}
-	return *c.RDT == *o.RDT && *c.BlockIO == *o.BlockIO
+	return *c == *o
 }
 
 // apiError returns a format error specific to this API.
@@ -49,6 +49,7 @@ type AdjustmentSpec struct {
 	Resources    *corev1.ResourceRequirements `json:"resources"`
 	Classes      *Classes                     `json:"classes"`
 	ToptierLimit *resapi.Quantity             `json:"toptierLimit"`
+	StaticPools  *StaticPools                 `json:"staticPools"`
 }
 
 // AdjustmentStatus represents the status of applying an adjustment.
@@ -67,10 +68,18 @@ type AdjustmentScope struct {
 	Containers []*resmgr.Expression `json:"containers"`
 }
 
-// Classes defines RDT and BlockIO class assignments.
+// Classes defines RDT, BlockIO and scheduling class assignments.
 type Classes struct {
-	BlockIO *string `json:"blockio"`
-	RDT     *string `json:"rdt"`
+	BlockIO    *string `json:"blockio"`
+	RDT        *string `json:"rdt"`
+	Scheduling *string `json:"scheduling"`
+}
+
+// StaticPools defines a static-pools policy pool, socket and exclusive CPU assignment.
+type StaticPools struct {
+	Pool          *string `json:"pool"`
+	Socket        *int64  `json:"socket"`
+	ExclusiveCPUs *int64  `json:"exclusiveCPUs"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -164,6 +164,11 @@ func (in *AdjustmentSpec) DeepCopyInto(out *AdjustmentSpec) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.StaticPools != nil {
+		in, out := &in.StaticPools, &out.StaticPools
+		*out = new(StaticPools)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -213,6 +218,11 @@ func (in *Classes) DeepCopyInto(out *Classes) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Scheduling != nil {
+		in, out := &in.Scheduling, &out.Scheduling
+		*out = new(string)
+		**out = **in
+	}
 	return
 }
 
@@ -225,3 +235,34 @@ func (in *Classes) DeepCopy() *Classes {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticPools) DeepCopyInto(out *StaticPools) {
+	*out = *in
+	if in.Pool != nil {
+		in, out := &in.Pool, &out.Pool
+		*out = new(string)
+		**out = **in
+	}
+	if in.Socket != nil {
+		in, out := &in.Socket, &out.Socket
+		*out = new(int64)
+		**out = **in
+	}
+	if in.ExclusiveCPUs != nil {
+		in, out := &in.ExclusiveCPUs, &out.ExclusiveCPUs
+		*out = new(int64)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticPools.
+func (in *StaticPools) DeepCopy() *StaticPools {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticPools)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -57,8 +58,9 @@ type Class struct {
 
 // BlockDeviceInfo holds information on a block device to be configured.
 // As users can specify block devices using wildcards ("/dev/disk/by-id/*SSD*")
-// BlockDeviceInfo.Origin is maintained for traceability: why this
-// block device is included in configuration.
+// or attribute selectors ({Transport=nvme MinSize=1Ti}) BlockDeviceInfo.Origin
+// is maintained for traceability: why this block device is included in
+// configuration.
 // BlockDeviceInfo.DevNode contains resolved device node, like "/dev/sda".
 type BlockDeviceInfo struct {
 	Major   int64
@@ -74,10 +76,14 @@ var log logger.Logger = logger.NewLogger("blockio")
 // corresponding OCI BlockIO parameters. "Static" means that
 // new/current block devices matching device wildcards in these
 // classes are not expanded every time new containers are assigned to
-// these classes. Devices are scanned on only at the beginning and on
-// blockio configuration changes.
+// these classes. Devices are scanned on only at the beginning, on
+// blockio configuration changes and when block devices are added or
+// removed.
 var staticOciBlockIO = map[string]cgroups.OciBlockIOParameters{}
 
+// classLock protects staticOciBlockIO against concurrent device rescans.
+var classLock sync.RWMutex
+
 // currentIOSchedulers contains io-schedulers (found in
 // sysfsBlockDeviceIOSchedulerPaths) of device nodes:
 // {"/dev/sda": "bfq"}
@@ -85,6 +91,9 @@ var currentIOSchedulers map[string]string
 
 // GetClasses returns block I/O class names and associated parameters in sorted slice.
 func GetClasses() []*Class {
+	classLock.RLock()
+	defer classLock.RUnlock()
+
 	classes := make([]*Class, 0, len(staticOciBlockIO))
 	for name, params := range staticOciBlockIO {
 		classes = append(classes, &Class{Name: name, Parameters: params})
@@ -102,6 +111,9 @@ func UpdateOciConfig(ignoreErrors bool) error {
 		log.Warn("configuration validation partly disabled due to IO scheduler detection error %#v", ioSchedulerDetectionError.Error())
 	}
 
+	classLock.Lock()
+	defer classLock.Unlock()
+
 	staticOciBlockIO = map[string]cgroups.OciBlockIOParameters{}
 	// Create static OCI BlockIO structures for each blockio class
 	for class := range opt.Classes {
@@ -113,11 +125,11 @@ func UpdateOciConfig(ignoreErrors bool) error {
 				return err
 			}
 		}
-		// Handle all configurations as static for now. That
-		// is, the list of block devices matching Devices
-		// wildcards will not be updated without new
-		// configNotify(). class.DynamicDevices not supported
-		// yet.
+		// Handle all configurations as static. That is, the
+		// list of block devices matching Devices wildcards will
+		// not be updated without new configNotify() or a block
+		// device being added or removed.
+		sortParameters(&ociBlockIO)
 		staticOciBlockIO[class] = ociBlockIO
 	}
 	return nil
@@ -130,20 +142,27 @@ func SetContainerClass(c cache.Container, class string) error {
 		return blockioError("failed to get Pod for %s", c.PrettyName())
 	}
 
+	return SetCgroupClass(c.PrettyName(), pod.GetCgroupParentDir(), c.GetID(), class)
+}
+
+// SetCgroupClass assigns the container with the given ID and pod cgroup parent to a blockio class.
+func SetCgroupClass(pretty, cgroupParent, id, class string) error {
+	classLock.RLock()
 	ociBlockIO, classIsStatic := staticOciBlockIO[class]
+	classLock.RUnlock()
 	if !classIsStatic {
 		return blockioError("no OCI BlockIO parameters for class %#v", class)
 	}
 
-	blkioCgroupPodDir := cgroups.GetBlkioDir() + "/" + pod.GetCgroupParentDir()
-	containerCgroupDir := utils.GetContainerCgroupDir(blkioCgroupPodDir, c.GetID())
+	blkioCgroupPodDir := cgroups.GetBlkioDir() + "/" + cgroupParent
+	containerCgroupDir := utils.GetContainerCgroupDir(blkioCgroupPodDir, id)
 	if containerCgroupDir == "" {
-		return blockioError("failed to find cgroup directory for container %s under %#v, container id %#v", c.PrettyName(), blkioCgroupPodDir, c.GetID())
+		return blockioError("failed to find cgroup directory for container %s under %#v, container id %#v", pretty, blkioCgroupPodDir, id)
 	}
 
 	err := cgroups.ResetBlkioParameters(containerCgroupDir, ociBlockIO)
 	if err != nil {
-		return blockioError("assigning container %v to class %#v failed: %w", c.PrettyName(), class, err)
+		return blockioError("assigning container %v to class %#v failed: %w", pretty, class, err)
 	}
 
 	return nil
@@ -164,17 +183,7 @@ func getCurrentIOSchedulers() (map[string]string, error) {
 			log.Error("failed to read current IO scheduler %#v: %v\n", schedulerFile, err)
 			continue
 		}
-		schedulerData := strings.Trim(string(schedulerDataB), "\n")
-		currentScheduler := ""
-		if strings.IndexByte(schedulerData, ' ') == -1 {
-			currentScheduler = schedulerData
-		} else {
-			openB := strings.Index(schedulerData, "[")
-			closeB := strings.Index(schedulerData, "]")
-			if -1 < openB && openB < closeB {
-				currentScheduler = schedulerData[openB+1 : closeB]
-			}
-		}
+		currentScheduler := parseIOScheduler(strings.Trim(string(schedulerDataB), "\n"))
 		if currentScheduler == "" {
 			return ios, blockioError("could not parse current scheduler in %#v\n", schedulerFile)
 		}
@@ -184,6 +193,20 @@ func getCurrentIOSchedulers() (map[string]string, error) {
 	return ios, nil
 }
 
+// parseIOScheduler parses the active scheduler from the contents of a scheduler file,
+// like "mq-deadline kyber [bfq] none".
+func parseIOScheduler(schedulerData string) string {
+	if strings.IndexByte(schedulerData, ' ') == -1 {
+		return schedulerData
+	}
+	openB := strings.Index(schedulerData, "[")
+	closeB := strings.Index(schedulerData, "]")
+	if -1 < openB && openB < closeB {
+		return schedulerData[openB+1 : closeB]
+	}
+	return ""
+}
+
 // deviceParametersToOci converts single blockio class parameters into OCI BlockIO structure.
 func devicesParametersToOci(dps []DevicesParameters, currentIOSchedulers map[string]string) (cgroups.OciBlockIOParameters, error) {
 	var errors *multierror.Error
@@ -201,7 +224,7 @@ func devicesParametersToOci(dps []DevicesParameters, currentIOSchedulers map[str
 		errors = multierror.Append(errors, err)
 		throttleWriteIOPS, err = parseAndValidateInt64("ThrottleWriteIOPS", dp.ThrottleWriteIOPS, -1, 0, -1)
 		errors = multierror.Append(errors, err)
-		if dp.Devices == nil {
+		if dp.Devices == nil && dp.DeviceSelectors == nil {
 			if weight > -1 {
 				oci.Weight = weight
 			}
@@ -210,16 +233,33 @@ func devicesParametersToOci(dps []DevicesParameters, currentIOSchedulers map[str
 					dp.ThrottleReadBps, dp.ThrottleWriteBps, dp.ThrottleReadIOPS, dp.ThrottleWriteIOPS))
 			}
 		} else {
-			blockDevices, err := currentPlatform.configurableBlockDevices(dp.Devices)
-			if err != nil {
-				// Problems in matching block device wildcards and resolving symlinks
-				// are worth reporting, but must not block configuring blkio where possible.
-				log.Error(err.Error())
+			blockDevices := []BlockDeviceInfo{}
+			if dp.Devices != nil {
+				blockDevices, err = currentPlatform.configurableBlockDevices(dp.Devices)
+				if err != nil {
+					// Problems in matching block device wildcards and resolving symlinks
+					// are worth reporting, but must not block configuring blkio where possible.
+					log.Error(err.Error())
+				}
 			}
+			if dp.DeviceSelectors != nil {
+				selectors, err := compileSelectors(dp.DeviceSelectors)
+				errors = multierror.Append(errors, err)
+				selected, err := selectedBlockDevices(selectors)
+				if err != nil {
+					// Like unmatched wildcards, unmatched selectors are not configuration errors.
+					log.Error(err.Error())
+				}
+				blockDevices = append(blockDevices, selected...)
+			}
+			blockDevices = uniqueBlockDevices(blockDevices)
 			if len(blockDevices) == 0 {
-				log.Warn("no matches on any of Devices: %v, parameters ignored", dp.Devices)
+				log.Warn("no matches on any of Devices: %v or DeviceSelectors: %v, parameters ignored",
+					dp.Devices, dp.DeviceSelectors)
 			}
 			for _, blockDeviceInfo := range blockDevices {
+				log.Debug("configuring device %#v (%d:%d) %s", blockDeviceInfo.DevNode,
+					blockDeviceInfo.Major, blockDeviceInfo.Minor, blockDeviceInfo.Origin)
 				if weight != -1 {
 					if ios, found := currentIOSchedulers[blockDeviceInfo.DevNode]; found {
 						if ios != "bfq" && ios != "cfq" {
@@ -247,6 +287,25 @@ func devicesParametersToOci(dps []DevicesParameters, currentIOSchedulers map[str
 	return oci, errors.ErrorOrNil()
 }
 
+// uniqueBlockDevices merges block devices with the same major:minor,
+// combining their origins.
+func uniqueBlockDevices(blockDevices []BlockDeviceInfo) []BlockDeviceInfo {
+	unique := make([]BlockDeviceInfo, 0, len(blockDevices))
+	index := make(map[[2]int64]int, len(blockDevices))
+	for _, bdi := range blockDevices {
+		key := [2]int64{bdi.Major, bdi.Minor}
+		if i, ok := index[key]; ok {
+			if bdi.Origin != "" && !strings.Contains(unique[i].Origin, bdi.Origin) {
+				unique[i].Origin = strings.TrimSpace(unique[i].Origin + " " + bdi.Origin)
+			}
+			continue
+		}
+		index[key] = len(unique)
+		unique = append(unique, bdi)
+	}
+	return unique
+}
+
 // parseAndValidateInt64 parses quantities, like "64 M", and validates that they are in given range.
 func parseAndValidateInt64(fieldName string, fieldContent string,
 	defaultValue int64, min int64, max int64) (int64, error) {
@@ -271,6 +330,8 @@ func parseAndValidateInt64(fieldName string, fieldContent string,
 // platformInterface includes functions that access the system. Enables mocking the system.
 type platformInterface interface {
 	configurableBlockDevices(devWildcards []string) ([]BlockDeviceInfo, error)
+	blockDevices() ([]string, error)
+	blockDeviceAttributes() ([]blockDeviceAttributes, error)
 }
 
 // defaultPlatform versions of platformInterface functions access the underlying system.
@@ -264,6 +264,169 @@ func TestDevicesParametersToOci(t *testing.T) {
 	}
 }
 
+// TestDeviceHotplug: unit tests for rescanning devices and notifying about changed classes
+func TestDeviceHotplug(t *testing.T) {
+	currentPlatform = mockPlatform{}
+	mockHotplugged = false
+	opt.Classes = map[string][]DevicesParameters{
+		"fixed": {
+			{
+				Devices:         []string{"/dev/sda"},
+				ThrottleReadBps: "100M",
+			},
+		},
+		"hotplug": {
+			{
+				Devices:         []string{"/dev/sda", "/dev/sdd"},
+				ThrottleReadBps: "200M",
+			},
+		},
+	}
+	defer func() { opt.Classes = nil }()
+
+	if err := UpdateOciConfig(true); err != nil {
+		t.Fatalf("UpdateOciConfig failed: %v", err)
+	}
+
+	notified := []string{}
+	w := &deviceWatch{
+		notify:  func(classes []string) { notified = append(notified, classes...) },
+		devices: "sda,sdb,sdc",
+	}
+
+	w.check()
+	testutils.VerifyDeepEqual(t, "classes changed without hotplug", []string{}, notified)
+
+	mockHotplugged = true
+	w.check()
+	testutils.VerifyDeepEqual(t, "classes changed by hotplug", []string{"hotplug"}, notified)
+	testutils.VerifyDeepEqual(t, "hotplugged parameters", cgroups.OciDeviceRates{
+		{Major: 11, Minor: 12, Rate: 200000000},
+		{Major: 41, Minor: 42, Rate: 200000000},
+	}, staticOciBlockIO["hotplug"].ThrottleReadBpsDevice)
+
+	notified = []string{}
+	w.check()
+	testutils.VerifyDeepEqual(t, "classes changed by settling rescan", []string{}, notified)
+
+	mockHotplugged = false
+	w.check()
+	testutils.VerifyDeepEqual(t, "classes changed by unplug", []string{"hotplug"}, notified)
+	testutils.VerifyDeepEqual(t, "unplugged parameters", cgroups.OciDeviceRates{
+		{Major: 11, Minor: 12, Rate: 200000000},
+	}, staticOciBlockIO["hotplug"].ThrottleReadBpsDevice)
+}
+
+// TestSelectedBlockDevices: unit tests for selecting devices by attributes
+func TestSelectedBlockDevices(t *testing.T) {
+	currentPlatform = mockPlatform{}
+	yes, no := true, false
+	tcases := []struct {
+		name                    string
+		selectors               []DeviceSelector
+		expectedDevNodes        []string
+		expectedOrigins         []string
+		expectedErrorCount      int
+		expectedErrorSubstrings []string
+	}{
+		{
+			name:             "non-rotational",
+			selectors:        []DeviceSelector{{Rotational: &no}},
+			expectedDevNodes: []string{"/dev/nvme0n1", "/dev/vda"},
+		},
+		{
+			name:             "rotational",
+			selectors:        []DeviceSelector{{Rotational: &yes}},
+			expectedDevNodes: []string{"/dev/sda"},
+			expectedOrigins:  []string{"from selector {Rotational=true}"},
+		},
+		{
+			name:             "large nvme",
+			selectors:        []DeviceSelector{{Transport: "nvme", MinSize: "1Ti"}},
+			expectedDevNodes: []string{"/dev/nvme0n1"},
+			expectedOrigins:  []string{"from selector {Transport=nvme MinSize=1Ti}"},
+		},
+		{
+			name:             "size range",
+			selectors:        []DeviceSelector{{MinSize: "1G", MaxSize: "1T"}},
+			expectedDevNodes: []string{"/dev/vda"},
+		},
+		{
+			name:             "model and vendor regexps",
+			selectors:        []DeviceSelector{{Model: "^ST[0-9]+", Vendor: "ATA"}},
+			expectedDevNodes: []string{"/dev/sda"},
+		},
+		{
+			name:             "io scheduler",
+			selectors:        []DeviceSelector{{IOScheduler: "mq-deadline"}},
+			expectedDevNodes: []string{"/dev/vda"},
+		},
+		{
+			name:             "any of many selectors",
+			selectors:        []DeviceSelector{{Transport: "virtio"}, {IOScheduler: "bfq"}, {Transport: "sata"}},
+			expectedDevNodes: []string{"/dev/sda", "/dev/vda"},
+			expectedOrigins: []string{
+				"from selector {IOScheduler=bfq} from selector {Transport=sata}",
+				"from selector {Transport=virtio}",
+			},
+		},
+		{
+			name:                    "no match",
+			selectors:               []DeviceSelector{{Transport: "usb"}},
+			expectedDevNodes:        []string{},
+			expectedErrorCount:      1,
+			expectedErrorSubstrings: []string{"do not match any devices"},
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			selectors, err := compileSelectors(tc.selectors)
+			testutils.VerifyError(t, err, 0, nil)
+			bdis, err := selectedBlockDevices(selectors)
+			testutils.VerifyError(t, err, tc.expectedErrorCount, tc.expectedErrorSubstrings)
+			devNodes := []string{}
+			origins := []string{}
+			for _, bdi := range bdis {
+				devNodes = append(devNodes, bdi.DevNode)
+				origins = append(origins, bdi.Origin)
+			}
+			testutils.VerifyDeepEqual(t, "selected devices", tc.expectedDevNodes, devNodes)
+			if tc.expectedOrigins != nil {
+				testutils.VerifyDeepEqual(t, "origins", tc.expectedOrigins, origins)
+			}
+		})
+	}
+}
+
+// TestUniqueBlockDevices: unit tests for merging devices matched more than once
+func TestUniqueBlockDevices(t *testing.T) {
+	bdis := uniqueBlockDevices([]BlockDeviceInfo{
+		{Major: 8, Minor: 0, DevNode: "/dev/sda", Origin: "from wildcards /dev/sda"},
+		{Major: 259, Minor: 0, DevNode: "/dev/nvme0n1", Origin: "from selector {Transport=nvme}"},
+		{Major: 8, Minor: 0, DevNode: "/dev/sda", Origin: "from selector {Rotational=true}"},
+		{Major: 8, Minor: 0, DevNode: "/dev/sda", Origin: "from wildcards /dev/sda"},
+	})
+	testutils.VerifyDeepEqual(t, "unique devices", []BlockDeviceInfo{
+		{Major: 8, Minor: 0, DevNode: "/dev/sda", Origin: "from wildcards /dev/sda from selector {Rotational=true}"},
+		{Major: 259, Minor: 0, DevNode: "/dev/nvme0n1", Origin: "from selector {Transport=nvme}"},
+	}, bdis)
+}
+
+// TestCompileSelectors: unit tests for validating device selectors
+func TestCompileSelectors(t *testing.T) {
+	_, err := compileSelectors([]DeviceSelector{
+		{MinSize: "lots"},
+		{MinSize: "2T", MaxSize: "1T"},
+		{Model: "[unterminated"},
+		{Vendor: "ok"},
+	})
+	testutils.VerifyError(t, err, 3, []string{
+		"syntax error in \"MinSize\"",
+		"bigger than MaxSize",
+		"invalid Model regexp",
+	})
+}
+
 // mockPlatform implements mock versions of platformInterface functions.
 type mockPlatform struct{}
 
@@ -292,7 +455,43 @@ func (mpf mockPlatform) configurableBlockDevices(devWildcards []string) ([]Block
 				DevNode: devWildcard,
 				Origin:  fmt.Sprintf("from wildcards %v", devWildcard),
 			})
+		} else if devWildcard == "/dev/sdd" && mockHotplugged {
+			blockDevices = append(blockDevices, BlockDeviceInfo{
+				Major:   41,
+				Minor:   42,
+				DevNode: devWildcard,
+				Origin:  fmt.Sprintf("from wildcards %v", devWildcard),
+			})
 		}
 	}
 	return blockDevices, nil
 }
+
+// mockHotplugged is true if the mock hotpluggable block device sdd is present.
+var mockHotplugged bool
+
+// blockDeviceAttributes mock returns a rotational SATA disk, an NVMe and a virtio disk.
+func (mpf mockPlatform) blockDeviceAttributes() ([]blockDeviceAttributes, error) {
+	return []blockDeviceAttributes{
+		{
+			name: "nvme0n1", major: 259, minor: 0, transport: "nvme",
+			size: 2 << 40, model: "Samsung SSD 970", scheduler: "none",
+		},
+		{
+			name: "sda", major: 8, minor: 0, rotational: true, transport: "sata",
+			size: 4000000000000, model: "ST4000DM004", vendor: "ATA", scheduler: "bfq",
+		},
+		{
+			name: "vda", major: 252, minor: 0, transport: "virtio",
+			size: 100 << 30, vendor: "0x1af4", scheduler: "mq-deadline",
+		},
+	}, nil
+}
+
+// blockDevices mock returns sda-sdc, and sdd if it is hotplugged.
+func (mpf mockPlatform) blockDevices() ([]string, error) {
+	if mockHotplugged {
+		return []string{"sda", "sdb", "sdc", "sdd"}, nil
+	}
+	return []string{"sda", "sdb", "sdc"}, nil
+}
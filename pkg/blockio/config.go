@@ -17,6 +17,8 @@ limitations under the License.
 package blockio
 
 import (
+	"time"
+
 	pkgcfg "github.com/intel/cri-resource-manager/pkg/config"
 )
 
@@ -24,16 +26,20 @@ import (
 type options struct {
 	// Classes define weights and throttling parameters for sets of devices.
 	Classes map[string][]DevicesParameters `json:",omitempty"`
+	// DeviceRescanInterval is the interval of checking for added or
+	// removed block devices, 0 disables rescanning.
+	DeviceRescanInterval pkgcfg.Duration `json:",omitempty"`
 }
 
 // DevicesParameters defines Block IO parameters for a set of devices.
 type DevicesParameters struct {
-	Devices           []string `json:",omitempty"`
-	ThrottleReadBps   string   `json:",omitempty"`
-	ThrottleWriteBps  string   `json:",omitempty"`
-	ThrottleReadIOPS  string   `json:",omitempty"`
-	ThrottleWriteIOPS string   `json:",omitempty"`
-	Weight            string   `json:",omitempty"`
+	Devices           []string         `json:",omitempty"`
+	DeviceSelectors   []DeviceSelector `json:",omitempty"`
+	ThrottleReadBps   string           `json:",omitempty"`
+	ThrottleWriteBps  string           `json:",omitempty"`
+	ThrottleReadIOPS  string           `json:",omitempty"`
+	ThrottleWriteIOPS string           `json:",omitempty"`
+	Weight            string           `json:",omitempty"`
 }
 
 // Currently active set of "raw" options
@@ -41,7 +47,9 @@ var opt = defaultOptions().(*options)
 
 // defaultOptions returns a new instance of "raw" options set to their defaults
 func defaultOptions() interface{} {
-	return &options{}
+	return &options{
+		DeviceRescanInterval: pkgcfg.Duration(10 * time.Second),
+	}
 }
 
 func init() {
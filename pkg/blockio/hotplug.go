@@ -0,0 +1,190 @@
+/*
+Copyright 2020 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockio
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/cgroups"
+)
+
+const (
+	// sysfsBlockDevices is the directory listing all block devices in the system.
+	sysfsBlockDevices = "/sys/block"
+)
+
+// DeviceChangeFn is called with the names of the classes whose parameters
+// changed due to block devices being added or removed.
+type DeviceChangeFn func(classes []string)
+
+// deviceWatch polls for block devices being added or removed.
+type deviceWatch struct {
+	sync.Mutex
+	stop    chan struct{}  // channel to stop polling
+	notify  DeviceChangeFn // function to notify about changed classes
+	devices string         // block devices seen at the previous poll
+	settle  bool           // rescan once more after a change
+}
+
+// Our device watch, if running.
+var watch *deviceWatch
+
+// StartDeviceWatch starts polling for added or removed block devices. When
+// devices change the device patterns of all classes are re-expanded and
+// notify is called with the classes whose parameters changed.
+func StartDeviceWatch(notify DeviceChangeFn) {
+	StopDeviceWatch()
+
+	interval := time.Duration(opt.DeviceRescanInterval)
+	if interval <= 0 {
+		log.Info("block device rescanning disabled")
+		return
+	}
+
+	devices, err := currentPlatform.blockDevices()
+	if err != nil {
+		log.Error("block device rescanning disabled: %v", err)
+		return
+	}
+
+	w := &deviceWatch{
+		stop:    make(chan struct{}),
+		notify:  notify,
+		devices: strings.Join(devices, ","),
+	}
+	watch = w
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case _ = <-w.stop:
+				return
+			case _ = <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+// StopDeviceWatch stops polling for added or removed block devices.
+func StopDeviceWatch() {
+	if watch != nil {
+		close(watch.stop)
+		watch = nil
+	}
+}
+
+// check checks for added or removed block devices and rescans if necessary.
+func (w *deviceWatch) check() {
+	w.Lock()
+	defer w.Unlock()
+
+	list, err := currentPlatform.blockDevices()
+	if err != nil {
+		log.Error("failed to list block devices: %v", err)
+		return
+	}
+	devices := strings.Join(list, ",")
+
+	if devices == w.devices && !w.settle {
+		return
+	}
+
+	if devices != w.devices {
+		log.Info("block devices changed, now %s", devices)
+		// Device nodes and symlinks may appear only after the sysfs
+		// entry, so rescan once more at the next poll.
+		w.settle = true
+	} else {
+		w.settle = false
+	}
+	w.devices = devices
+
+	if changed := rescanDevices(); len(changed) > 0 {
+		log.Info("parameters of classes %s changed", strings.Join(changed, ", "))
+		if w.notify != nil {
+			w.notify(changed)
+		}
+	}
+}
+
+// rescanDevices re-expands the device patterns of all classes, returning
+// the names of the classes whose parameters changed.
+func rescanDevices() []string {
+	currentIOSchedulers, err := getCurrentIOSchedulers()
+	if err != nil {
+		log.Warn("configuration validation partly disabled due to IO scheduler detection error %#v", err.Error())
+	}
+
+	classLock.Lock()
+	defer classLock.Unlock()
+
+	changed := []string{}
+	for class := range opt.Classes {
+		ociBlockIO, err := devicesParametersToOci(opt.Classes[class], currentIOSchedulers)
+		if err != nil {
+			log.Error("ignoring: %v", err)
+		}
+		sortParameters(&ociBlockIO)
+		if prev, ok := staticOciBlockIO[class]; ok && reflect.DeepEqual(prev, ociBlockIO) {
+			continue
+		}
+		staticOciBlockIO[class] = ociBlockIO
+		changed = append(changed, class)
+	}
+	sort.Strings(changed)
+
+	return changed
+}
+
+// sortParameters sorts the device parameters by major and minor numbers,
+// making them comparable regardless of the order devices were found in.
+func sortParameters(oci *cgroups.OciBlockIOParameters) {
+	w := oci.WeightDevice
+	sort.Slice(w, func(i, j int) bool {
+		return w[i].Major < w[j].Major || (w[i].Major == w[j].Major && w[i].Minor < w[j].Minor)
+	})
+	for _, r := range []cgroups.OciDeviceRates{
+		oci.ThrottleReadBpsDevice, oci.ThrottleWriteBpsDevice,
+		oci.ThrottleReadIOPSDevice, oci.ThrottleWriteIOPSDevice,
+	} {
+		sort.Slice(r, func(i, j int) bool {
+			return r[i].Major < r[j].Major || (r[i].Major == r[j].Major && r[i].Minor < r[j].Minor)
+		})
+	}
+}
+
+// blockDevices lists the names of all block devices in the system.
+func (dpm defaultPlatform) blockDevices() ([]string, error) {
+	entries, err := ioutil.ReadDir(sysfsBlockDevices)
+	if err != nil {
+		return nil, blockioError("failed to read %#v: %w", sysfsBlockDevices, err)
+	}
+	devices := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		devices = append(devices, entry.Name())
+	}
+	sort.Strings(devices)
+	return devices, nil
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2020 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blockio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	// sysfsSectorSize is the unit of block device sizes in sysfs.
+	sysfsSectorSize = 512
+)
+
+// DeviceSelector selects block devices by their attributes. A device is
+// selected if it matches all attributes set in the selector.
+type DeviceSelector struct {
+	// Rotational selects rotational (true) or non-rotational (false) devices.
+	Rotational *bool `json:",omitempty"`
+	// Transport selects devices by transport: nvme, sata, scsi, virtio, usb...
+	Transport string `json:",omitempty"`
+	// MinSize selects devices at least this large, for instance "1Ti".
+	MinSize string `json:",omitempty"`
+	// MaxSize selects devices at most this large.
+	MaxSize string `json:",omitempty"`
+	// Model selects devices whose model matches this regular expression.
+	Model string `json:",omitempty"`
+	// Vendor selects devices whose vendor matches this regular expression.
+	Vendor string `json:",omitempty"`
+	// IOScheduler selects devices with this active I/O scheduler.
+	IOScheduler string `json:",omitempty"`
+}
+
+// blockDeviceAttributes holds the sysfs attributes of a block device.
+type blockDeviceAttributes struct {
+	name       string
+	major      int64
+	minor      int64
+	rotational bool
+	transport  string
+	size       int64
+	model      string
+	vendor     string
+	scheduler  string
+}
+
+// deviceSelector is a DeviceSelector with parsed sizes and compiled regexps.
+type deviceSelector struct {
+	spec    DeviceSelector
+	minSize int64
+	maxSize int64
+	model   *regexp.Regexp
+	vendor  *regexp.Regexp
+}
+
+// String returns the selector as a string, listing only the set attributes.
+func (s DeviceSelector) String() string {
+	attrs := []string{}
+	if s.Rotational != nil {
+		attrs = append(attrs, "Rotational="+strconv.FormatBool(*s.Rotational))
+	}
+	for _, attr := range []struct{ name, value string }{
+		{"Transport", s.Transport},
+		{"MinSize", s.MinSize},
+		{"MaxSize", s.MaxSize},
+		{"Model", s.Model},
+		{"Vendor", s.Vendor},
+		{"IOScheduler", s.IOScheduler},
+	} {
+		if attr.value != "" {
+			attrs = append(attrs, attr.name+"="+attr.value)
+		}
+	}
+	return "{" + strings.Join(attrs, " ") + "}"
+}
+
+// compileSelector parses and validates a DeviceSelector.
+func compileSelector(spec DeviceSelector) (*deviceSelector, error) {
+	var err error
+	s := &deviceSelector{spec: spec, minSize: -1, maxSize: -1}
+
+	if spec.MinSize != "" {
+		if s.minSize, err = parseSize("MinSize", spec.MinSize); err != nil {
+			return nil, err
+		}
+	}
+	if spec.MaxSize != "" {
+		if s.maxSize, err = parseSize("MaxSize", spec.MaxSize); err != nil {
+			return nil, err
+		}
+	}
+	if s.minSize != -1 && s.maxSize != -1 && s.minSize > s.maxSize {
+		return nil, fmt.Errorf("MinSize (%#v) bigger than MaxSize (%#v)", spec.MinSize, spec.MaxSize)
+	}
+	if spec.Model != "" {
+		if s.model, err = regexp.Compile(spec.Model); err != nil {
+			return nil, fmt.Errorf("invalid Model regexp %#v: %w", spec.Model, err)
+		}
+	}
+	if spec.Vendor != "" {
+		if s.vendor, err = regexp.Compile(spec.Vendor); err != nil {
+			return nil, fmt.Errorf("invalid Vendor regexp %#v: %w", spec.Vendor, err)
+		}
+	}
+
+	return s, nil
+}
+
+// parseSize parses a size quantity, like "1Ti".
+func parseSize(fieldName, fieldContent string) (int64, error) {
+	qty, err := resource.ParseQuantity(fieldContent)
+	if err != nil {
+		return -1, fmt.Errorf("syntax error in %#v (%#v)", fieldName, fieldContent)
+	}
+	if qty.Value() < 0 {
+		return -1, fmt.Errorf("negative %#v (%#v)", fieldName, fieldContent)
+	}
+	return qty.Value(), nil
+}
+
+// matches checks if the device attributes match the selector.
+func (s *deviceSelector) matches(dev blockDeviceAttributes) bool {
+	switch {
+	case s.spec.Rotational != nil && *s.spec.Rotational != dev.rotational:
+		return false
+	case s.spec.Transport != "" && !strings.EqualFold(s.spec.Transport, dev.transport):
+		return false
+	case s.minSize != -1 && dev.size < s.minSize:
+		return false
+	case s.maxSize != -1 && dev.size > s.maxSize:
+		return false
+	case s.model != nil && !s.model.MatchString(dev.model):
+		return false
+	case s.vendor != nil && !s.vendor.MatchString(dev.vendor):
+		return false
+	case s.spec.IOScheduler != "" && s.spec.IOScheduler != dev.scheduler:
+		return false
+	}
+	return true
+}
+
+// compileSelectors parses and validates DeviceSelectors.
+func compileSelectors(specs []DeviceSelector) ([]*deviceSelector, error) {
+	var errors *multierror.Error
+
+	compiled := make([]*deviceSelector, 0, len(specs))
+	for _, spec := range specs {
+		s, err := compileSelector(spec)
+		if err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("device selector %s: %w", spec, err))
+			continue
+		}
+		compiled = append(compiled, s)
+	}
+
+	return compiled, errors.ErrorOrNil()
+}
+
+// selectedBlockDevices finds the block devices matching any of the selectors.
+func selectedBlockDevices(selectors []*deviceSelector) ([]BlockDeviceInfo, error) {
+	var errors *multierror.Error
+
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+
+	devices, err := currentPlatform.blockDeviceAttributes()
+	if err != nil {
+		errors = multierror.Append(errors, err)
+	}
+
+	blockDevices := []BlockDeviceInfo{}
+	for _, dev := range devices {
+		origins := []string{}
+		for _, s := range selectors {
+			if s.matches(dev) {
+				origins = append(origins, fmt.Sprintf("from selector %s", s.spec))
+			}
+		}
+		if len(origins) == 0 {
+			continue
+		}
+		blockDevices = append(blockDevices, BlockDeviceInfo{
+			Major:   dev.major,
+			Minor:   dev.minor,
+			DevNode: "/dev/" + dev.name,
+			Origin:  strings.Join(origins, " "),
+		})
+	}
+	if len(blockDevices) == 0 {
+		specs := make([]string, 0, len(selectors))
+		for _, s := range selectors {
+			specs = append(specs, s.spec.String())
+		}
+		errors = multierror.Append(errors, fmt.Errorf("device selectors %s do not match any devices",
+			strings.Join(specs, ", ")))
+	}
+
+	return blockDevices, errors.ErrorOrNil()
+}
+
+// blockDeviceAttributes reads the attributes of all block devices from sysfs.
+func (dpm defaultPlatform) blockDeviceAttributes() ([]blockDeviceAttributes, error) {
+	var errors *multierror.Error
+
+	names, err := dpm.blockDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]blockDeviceAttributes, 0, len(names))
+	for _, name := range names {
+		dev, err := readBlockDeviceAttributes(name)
+		if err != nil {
+			// A block device may be disconnected. Continue with the others.
+			errors = multierror.Append(errors, err)
+			continue
+		}
+		devices = append(devices, dev)
+	}
+
+	return devices, errors.ErrorOrNil()
+}
+
+// readBlockDeviceAttributes reads the attributes of a single block device from sysfs.
+func readBlockDeviceAttributes(name string) (blockDeviceAttributes, error) {
+	dev := blockDeviceAttributes{name: name}
+	dir := filepath.Join(sysfsBlockDevices, name)
+
+	devNumbers, err := readSysfsAttr(dir, "dev")
+	if err != nil {
+		return dev, err
+	}
+	if _, err := fmt.Sscanf(devNumbers, "%d:%d", &dev.major, &dev.minor); err != nil {
+		return dev, blockioError("failed to parse device numbers %#v of %#v: %w", devNumbers, name, err)
+	}
+
+	if sectors, err := readSysfsAttr(dir, "size"); err == nil {
+		if n, err := strconv.ParseInt(sectors, 10, 64); err == nil {
+			dev.size = n * sysfsSectorSize
+		}
+	}
+	if rotational, err := readSysfsAttr(dir, "queue/rotational"); err == nil {
+		dev.rotational = rotational == "1"
+	}
+	if scheduler, err := readSysfsAttr(dir, "queue/scheduler"); err == nil {
+		dev.scheduler = parseIOScheduler(scheduler)
+	}
+	dev.model, _ = readSysfsAttr(dir, "device/model")
+	dev.vendor, _ = readSysfsAttr(dir, "device/vendor")
+	dev.transport = deviceTransport(dir)
+
+	return dev, nil
+}
+
+// deviceTransport guesses the transport of a block device from its sysfs device path.
+func deviceTransport(dir string) string {
+	path, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(filepath.Base(path), "nvme") || strings.Contains(path, "/nvme/"):
+		return "nvme"
+	case strings.Contains(path, "/virtio"):
+		return "virtio"
+	case strings.Contains(path, "/usb"):
+		return "usb"
+	case strings.Contains(path, "/ata"):
+		return "sata"
+	case strings.Contains(path, "/host"):
+		return "scsi"
+	case strings.Contains(path, "/virtual/"):
+		return "virtual"
+	}
+	return ""
+}
+
+// readSysfsAttr reads a single sysfs attribute, with surrounding whitespace removed.
+func readSysfsAttr(dir, attr string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
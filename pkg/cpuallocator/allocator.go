@@ -35,6 +35,12 @@ const (
 	AllocIdleNodes
 	// AllocIdleCores requests allocation of full idle cores (all threads in core).
 	AllocIdleCores
+	// AllocPreferEfficientCores requests allocation of efficient cores first in hybrid CPUs.
+	AllocPreferEfficientCores
+	// AllocAvoidEfficientCores requests allocation of efficient cores last in hybrid CPUs.
+	AllocAvoidEfficientCores
+	// AllocLeastFragmenting requests allocation of the candidate set leaving the least fragmented free CPUs.
+	AllocLeastFragmenting
 	// AllocDefault is the default allocation preferences.
 	AllocDefault = AllocIdlePackages | AllocIdleCores
 
@@ -59,7 +65,11 @@ type allocatorHelper struct {
 // CPUAllocator is an interface for a generic CPU allocator
 type CPUAllocator interface {
 	AllocateCpus(*cpuset.CPUSet, int, bool) (cpuset.CPUSet, error)
+	AllocateCpusWithFlags(*cpuset.CPUSet, int, bool, AllocFlag) (cpuset.CPUSet, error)
 	ReleaseCpus(*cpuset.CPUSet, int, bool) (cpuset.CPUSet, error)
+	Fragmentation(cpuset.CPUSet) int
+	IdleCoreCpus(cpuset.CPUSet) cpuset.CPUSet
+	CoreSiblings(cpuset.CPUSet) cpuset.CPUSet
 }
 
 type cpuAllocator struct {
@@ -67,6 +77,7 @@ type cpuAllocator struct {
 	sys           sysfs.System  // wrapped sysfs.System instance
 	topologyCache topologyCache // topology lookups
 	priorityCpus  cpuset.CPUSet // set of CPUs having higher priority
+	efficientCpus cpuset.CPUSet // set of efficient cores in hybrid CPUs
 }
 
 // topologyCache caches topology lookups
@@ -94,6 +105,7 @@ func NewCPUAllocator(sys sysfs.System) CPUAllocator {
 	}
 
 	ca.discoverPriorityCpus()
+	ca.discoverEfficientCpus()
 
 	return &ca
 }
@@ -148,6 +160,18 @@ func (ca *cpuAllocator) discoverPriorityCpus() {
 	}
 }
 
+func (ca *cpuAllocator) discoverEfficientCpus() {
+	ca.efficientCpus = cpuset.NewCPUSet()
+	if ca.sys == nil {
+		return
+	}
+
+	ca.efficientCpus = ca.sys.CoreKindCPUs(sysfs.EfficientCore)
+	if ca.efficientCpus.Size() > 0 {
+		log.Debug("discovered efficient cpus: %v", ca.efficientCpus)
+	}
+}
+
 // newAllocatorHelper creates a new CPU allocatorHelper.
 func newAllocatorHelper(sys sysfs.System, topo topologyCache) *allocatorHelper {
 	a := &allocatorHelper{
@@ -339,8 +363,69 @@ func (a *allocatorHelper) takeAny() {
 	}
 }
 
+// Allocate the candidate set of CPUs leaving the least fragmented set of free CPUs.
+func (a *allocatorHelper) takeLeastFragmenting() {
+	a.Debug("* takeLeastFragmenting()...")
+
+	// candidate scopes: all free CPUs, and the free CPUs of each package and node
+	scopes := []cpuset.CPUSet{a.from}
+	for _, id := range a.sys.PackageIDs() {
+		scopes = append(scopes, a.topology.pkg[id].Intersection(a.from))
+	}
+	for _, id := range a.sys.NodeIDs() {
+		scopes = append(scopes, a.topology.node[id].Intersection(a.from))
+	}
+
+	offline := a.sys.Offlined()
+	best, bestPref, bestFrag := cpuset.NewCPUSet(), -1, 0
+	seen := map[string]struct{}{}
+	for _, scope := range scopes {
+		if scope.Size() < a.cnt {
+			continue
+		}
+		if _, ok := seen[scope.String()]; ok {
+			continue
+		}
+		seen[scope.String()] = struct{}{}
+
+		c := newAllocatorHelper(a.sys, a.topology)
+		c.flags = a.flags &^ AllocLeastFragmenting
+		c.from = scope.Clone()
+		c.preferred = a.preferred
+		c.cnt = a.cnt
+		result := c.allocate()
+		if result.Size() != a.cnt {
+			continue
+		}
+
+		pref := result.Intersection(a.preferred).Size()
+		frag := a.topology.fragmentation(a.from.Difference(result), offline)
+		a.Debug(" => candidate %s from scope %s: preferred %d, fragmentation %d",
+			result, scope, pref, frag)
+		if pref > bestPref || (pref == bestPref && frag < bestFrag) {
+			best, bestPref, bestFrag = result, pref, frag
+		}
+	}
+
+	if bestPref < 0 {
+		return
+	}
+
+	a.Debug(" => taking least fragmenting candidate %s...", best)
+	a.result = a.result.Union(best)
+	a.from = a.from.Difference(best)
+	a.cnt = 0
+}
+
 // Perform CPU allocation.
 func (a *allocatorHelper) allocate() cpuset.CPUSet {
+	if a.sys != nil && (a.flags&AllocLeastFragmenting) != 0 {
+		a.takeLeastFragmenting()
+		if a.cnt == 0 {
+			return a.result
+		}
+		a.flags &^= AllocLeastFragmenting
+	}
 	if a.sys != nil {
 		if (a.flags & AllocIdlePackages) != 0 {
 			a.takeIdlePackages()
@@ -361,7 +446,7 @@ func (a *allocatorHelper) allocate() cpuset.CPUSet {
 	return cpuset.NewCPUSet()
 }
 
-func (ca *cpuAllocator) allocateCpus(from *cpuset.CPUSet, cnt int, preferHighPrio bool) (cpuset.CPUSet, error) {
+func (ca *cpuAllocator) allocateCpus(from *cpuset.CPUSet, cnt int, preferHighPrio bool, flags AllocFlag) (cpuset.CPUSet, error) {
 	var result cpuset.CPUSet
 	var err error
 
@@ -370,8 +455,11 @@ func (ca *cpuAllocator) allocateCpus(from *cpuset.CPUSet, cnt int, preferHighPri
 		result, err = cpuset.NewCPUSet(), fmt.Errorf("cpuset %s does not have %d CPUs", from, cnt)
 	case from.Size() == cnt:
 		result, err, *from = from.Clone(), nil, cpuset.NewCPUSet()
+	case (flags&(AllocPreferEfficientCores|AllocAvoidEfficientCores)) != 0 && !ca.efficientCpus.IsEmpty():
+		result, err = ca.allocateByCoreKind(from, cnt, preferHighPrio, flags)
 	default:
 		a := newAllocatorHelper(ca.sys, ca.topologyCache)
+		a.flags = flags
 		a.from = from.Clone()
 		a.cnt = cnt
 
@@ -390,17 +478,109 @@ func (ca *cpuAllocator) allocateCpus(from *cpuset.CPUSet, cnt int, preferHighPri
 	return result, err
 }
 
+// allocateByCoreKind allocates CPUs first from the preferred kind of cores, then from the rest.
+func (ca *cpuAllocator) allocateByCoreKind(from *cpuset.CPUSet, cnt int, preferHighPrio bool, flags AllocFlag) (cpuset.CPUSet, error) {
+	var first, rest cpuset.CPUSet
+
+	if (flags & AllocPreferEfficientCores) != 0 {
+		first = from.Intersection(ca.efficientCpus)
+		rest = from.Difference(ca.efficientCpus)
+	} else {
+		first = from.Difference(ca.efficientCpus)
+		rest = from.Intersection(ca.efficientCpus)
+	}
+	flags &^= AllocPreferEfficientCores | AllocAvoidEfficientCores
+
+	n := cnt
+	if first.Size() < n {
+		n = first.Size()
+	}
+	result := cpuset.NewCPUSet()
+	if n > 0 {
+		cset, err := ca.allocateCpus(&first, n, preferHighPrio, flags)
+		if err != nil {
+			return cpuset.NewCPUSet(), err
+		}
+		result = cset
+	}
+	if n < cnt {
+		more, err := ca.allocateCpus(&rest, cnt-n, preferHighPrio, flags)
+		if err != nil {
+			return cpuset.NewCPUSet(), err
+		}
+		result = result.Union(more)
+	}
+
+	*from = first.Union(rest)
+	ca.Debug("%d cpus by core kind from #%v => #%v", cnt, from.Union(result), result)
+
+	return result, nil
+}
+
 // AllocateCpus allocates a number of CPUs from the given set.
 func (ca *cpuAllocator) AllocateCpus(from *cpuset.CPUSet, cnt int, preferHighPrio bool) (cpuset.CPUSet, error) {
-	result, err := ca.allocateCpus(from, cnt, preferHighPrio)
+	result, err := ca.allocateCpus(from, cnt, preferHighPrio, AllocDefault)
 	return result, err
 }
 
+// AllocateCpusWithFlags allocates a number of CPUs from the given set with the given preferences.
+func (ca *cpuAllocator) AllocateCpusWithFlags(from *cpuset.CPUSet, cnt int, preferHighPrio bool, flags AllocFlag) (cpuset.CPUSet, error) {
+	result, err := ca.allocateCpus(from, cnt, preferHighPrio, flags)
+	return result, err
+}
+
+// Fragmentation returns how fragmented the given set of free CPUs is.
+func (ca *cpuAllocator) Fragmentation(free cpuset.CPUSet) int {
+	offline := cpuset.NewCPUSet()
+	if ca.sys != nil {
+		offline = ca.sys.Offlined()
+	}
+	return ca.topologyCache.fragmentation(free, offline)
+}
+
+// IdleCoreCpus returns the CPUs of the cores with all online threads in the given set.
+func (ca *cpuAllocator) IdleCoreCpus(cpus cpuset.CPUSet) cpuset.CPUSet {
+	if ca.sys == nil {
+		return cpus.Clone()
+	}
+	offline := ca.sys.Offlined()
+	idle := cpuset.NewCPUSet()
+	for _, id := range cpus.ToSlice() {
+		core := ca.topologyCache.core[sysfs.ID(id)].Difference(offline)
+		if core.IsSubsetOf(cpus) {
+			idle = idle.Union(core)
+		}
+	}
+	return idle
+}
+
+// CoreSiblings returns the online hyperthread siblings of the given CPUs not in the set.
+func (ca *cpuAllocator) CoreSiblings(cpus cpuset.CPUSet) cpuset.CPUSet {
+	if ca.sys == nil {
+		return cpuset.NewCPUSet()
+	}
+	offline := ca.sys.Offlined()
+	siblings := cpuset.NewCPUSet()
+	for _, id := range cpus.ToSlice() {
+		siblings = siblings.Union(ca.topologyCache.core[sysfs.ID(id)])
+	}
+	return siblings.Difference(cpus).Difference(offline)
+}
+
+// FullCoreFootprint estimates the number of CPUs taken by allocating cnt CPUs as full cores.
+func FullCoreFootprint(sys sysfs.System, cnt int) int {
+	threads := 1
+	if sys != nil && sys.ThreadCount() > 1 {
+		threads = sys.ThreadCount()
+	}
+	return threads * ((cnt + threads - 1) / threads)
+}
+
 // ReleaseCpus releases a number of CPUs from the given set.
 func (ca *cpuAllocator) ReleaseCpus(from *cpuset.CPUSet, cnt int, preferHighPrio bool) (cpuset.CPUSet, error) {
 	oset := from.Clone()
 
-	result, err := ca.allocateCpus(from, from.Size()-cnt, preferHighPrio)
+	result, err := ca.allocateCpus(from, from.Size()-cnt, preferHighPrio, AllocDefault)
 
 	ca.Debug("ReleaseCpus(#%s, %d) => kept: #%s, released: #%s", oset, cnt, from, result)
 
@@ -425,3 +605,28 @@ func newTopologyCache(sys sysfs.System) topologyCache {
 	}
 	return c
 }
+
+// fragmentation calculates how fragmented a set of free CPUs is. Free CPUs in
+// partially allocated cores can only be allocated as individual threads, so
+// they count double. Free CPUs in partially allocated packages count once.
+func (c topologyCache) fragmentation(free, offline cpuset.CPUSet) int {
+	frag := 0
+
+	for id, cset := range c.core {
+		cset = cset.Difference(offline)
+		if cset.IsEmpty() || cset.ToSlice()[0] != int(id) {
+			continue
+		}
+		if cnt := cset.Intersection(free).Size(); cnt > 0 && cnt < cset.Size() {
+			frag += 2 * cnt
+		}
+	}
+	for _, cset := range c.pkg {
+		cset = cset.Difference(offline)
+		if cnt := cset.Intersection(free).Size(); cnt > 0 && cnt < cset.Size() {
+			frag += cnt
+		}
+	}
+
+	return frag
+}
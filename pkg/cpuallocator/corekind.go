@@ -0,0 +1,58 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpuallocator
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+// ParseCoreKindPreference parses a core type preference for a container. The
+// preference is either a single core kind for all containers or a map of
+// container names to core kinds. The second return value indicates whether
+// the container has any preference.
+func ParseCoreKindPreference(value, container string) (sysfs.CoreKind, bool, error) {
+	if kind, err := sysfs.ParseCoreKind(value); err == nil {
+		return kind, true, nil
+	}
+
+	preferences := map[string]string{}
+	if err := yaml.Unmarshal([]byte(value), &preferences); err != nil {
+		return sysfs.PerformanceCore, false, fmt.Errorf("invalid core type preference %q: %v", value, err)
+	}
+
+	pref, ok := preferences[container]
+	if !ok {
+		return sysfs.PerformanceCore, false, nil
+	}
+
+	kind, err := sysfs.ParseCoreKind(pref)
+	if err != nil {
+		return sysfs.PerformanceCore, false, err
+	}
+
+	return kind, true, nil
+}
+
+// CoreKindFlags returns the allocation preferences for cores of the given kind.
+func CoreKindFlags(kind sysfs.CoreKind) AllocFlag {
+	if kind == sysfs.EfficientCore {
+		return AllocDefault | AllocPreferEfficientCores
+	}
+	return AllocDefault | AllocAvoidEfficientCores
+}
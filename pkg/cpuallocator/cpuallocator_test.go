@@ -15,10 +15,16 @@
 package cpuallocator
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 	//"github.com/google/go-cmp/cmp"
+
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
 )
 
 func TestAllocatorHelper(t *testing.T) {
@@ -66,3 +72,303 @@ func TestAllocatorHelper(t *testing.T) {
 		})
 	}
 }
+
+func TestAllocateByCoreKind(t *testing.T) {
+	tcs := []struct {
+		description string
+		from        cpuset.CPUSet
+		efficient   cpuset.CPUSet
+		cnt         int
+		flags       AllocFlag
+		expected    cpuset.CPUSet
+		remaining   cpuset.CPUSet
+	}{
+		{
+			description: "prefer efficient cores",
+			from:        cpuset.NewCPUSet(0, 1, 2, 3, 4, 5, 6, 7),
+			efficient:   cpuset.NewCPUSet(4, 5, 6, 7),
+			cnt:         2,
+			flags:       AllocPreferEfficientCores,
+			expected:    cpuset.NewCPUSet(4, 5),
+			remaining:   cpuset.NewCPUSet(0, 1, 2, 3, 6, 7),
+		},
+		{
+			description: "avoid efficient cores",
+			from:        cpuset.NewCPUSet(0, 1, 2, 3, 4, 5, 6, 7),
+			efficient:   cpuset.NewCPUSet(0, 1, 2, 3),
+			cnt:         3,
+			flags:       AllocAvoidEfficientCores,
+			expected:    cpuset.NewCPUSet(4, 5, 6),
+			remaining:   cpuset.NewCPUSet(0, 1, 2, 3, 7),
+		},
+		{
+			description: "avoid efficient cores, not enough performance cores",
+			from:        cpuset.NewCPUSet(0, 1, 2, 3, 4, 5, 6, 7),
+			efficient:   cpuset.NewCPUSet(2, 3, 4, 5, 6, 7),
+			cnt:         3,
+			flags:       AllocAvoidEfficientCores,
+			expected:    cpuset.NewCPUSet(0, 1, 2),
+			remaining:   cpuset.NewCPUSet(3, 4, 5, 6, 7),
+		},
+		{
+			description: "no efficient cores",
+			from:        cpuset.NewCPUSet(0, 1, 2, 3),
+			efficient:   cpuset.NewCPUSet(),
+			cnt:         2,
+			flags:       AllocPreferEfficientCores,
+			expected:    cpuset.NewCPUSet(0, 1),
+			remaining:   cpuset.NewCPUSet(2, 3),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			ca := &cpuAllocator{
+				Logger:        log,
+				topologyCache: newTopologyCache(nil),
+				priorityCpus:  cpuset.NewCPUSet(),
+				efficientCpus: tc.efficient,
+			}
+			from := tc.from.Clone()
+			result, err := ca.AllocateCpusWithFlags(&from, tc.cnt, true, tc.flags)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !result.Equals(tc.expected) {
+				t.Errorf("expected %q, result was %q", tc.expected, result)
+			}
+			if !from.Equals(tc.remaining) {
+				t.Errorf("expected %q remaining, but %q was", tc.remaining, from)
+			}
+		})
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	// two packages of two cores with two threads each
+	topology := topologyCache{
+		pkg: map[sysfs.ID]cpuset.CPUSet{
+			0: cpuset.NewCPUSet(0, 1, 2, 3),
+			1: cpuset.NewCPUSet(4, 5, 6, 7),
+		},
+		core: map[sysfs.ID]cpuset.CPUSet{
+			0: cpuset.NewCPUSet(0, 1),
+			1: cpuset.NewCPUSet(0, 1),
+			2: cpuset.NewCPUSet(2, 3),
+			3: cpuset.NewCPUSet(2, 3),
+			4: cpuset.NewCPUSet(4, 5),
+			5: cpuset.NewCPUSet(4, 5),
+			6: cpuset.NewCPUSet(6, 7),
+			7: cpuset.NewCPUSet(6, 7),
+		},
+	}
+
+	tcs := []struct {
+		description string
+		free        cpuset.CPUSet
+		offline     cpuset.CPUSet
+		expected    int
+	}{
+		{
+			description: "all free",
+			free:        cpuset.NewCPUSet(0, 1, 2, 3, 4, 5, 6, 7),
+			expected:    0,
+		},
+		{
+			description: "full idle package",
+			free:        cpuset.NewCPUSet(4, 5, 6, 7),
+			expected:    0,
+		},
+		{
+			description: "full idle cores in different packages",
+			free:        cpuset.NewCPUSet(0, 1, 4, 5),
+			expected:    4,
+		},
+		{
+			description: "scattered threads",
+			free:        cpuset.NewCPUSet(0, 2, 4, 6),
+			expected:    12,
+		},
+		{
+			description: "offline thread",
+			free:        cpuset.NewCPUSet(0, 4, 5, 6, 7),
+			offline:     cpuset.NewCPUSet(1),
+			expected:    1,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			frag := topology.fragmentation(tc.free, tc.offline)
+			if frag != tc.expected {
+				t.Errorf("expected fragmentation %d, got %d", tc.expected, frag)
+			}
+		})
+	}
+}
+
+// createTestSysfs creates a sysfs tree of two packages and NUMA nodes, each
+// with two cores of two threads.
+func createTestSysfs(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cpuallocator-sysfs")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	write("devices/system/cpu/isolated", "")
+	for node := 0; node < 2; node++ {
+		cpus := fmt.Sprintf("%d-%d", 4*node, 4*node+3)
+		write(fmt.Sprintf("devices/system/node/node%d/cpulist", node), cpus)
+		write(fmt.Sprintf("devices/system/node/node%d/distance", node),
+			map[bool]string{true: "10 20", false: "20 10"}[node == 0])
+		write(fmt.Sprintf("devices/system/node/node%d/memory%d/online", node, node), "1")
+	}
+	for id := 0; id < 8; id++ {
+		cpu := fmt.Sprintf("devices/system/cpu/cpu%d/", id)
+		first := id - id%2
+		write(cpu+"topology/physical_package_id", fmt.Sprintf("%d", id/4))
+		write(cpu+"topology/core_id", fmt.Sprintf("%d", first))
+		write(cpu+"topology/thread_siblings_list", fmt.Sprintf("%d-%d", first, first+1))
+		write(cpu+fmt.Sprintf("node%d/cpulist", id/4), fmt.Sprintf("%d-%d", id-id%4, id-id%4+3))
+	}
+
+	return dir
+}
+
+func TestTakeLeastFragmenting(t *testing.T) {
+	dir := createTestSysfs(t)
+	defer os.RemoveAll(dir)
+
+	sys, err := sysfs.DiscoverSystemAt(dir, sysfs.DiscoverCPUTopology)
+	if err != nil {
+		t.Fatalf("failed to discover test system: %v", err)
+	}
+	if pkgs := sys.PackageIDs(); len(pkgs) != 2 {
+		t.Fatalf("expected 2 packages in test system, got %d", len(pkgs))
+	}
+	topology := newTopologyCache(sys)
+
+	tcs := []struct {
+		description string
+		from        cpuset.CPUSet
+		cnt         int
+		expected    cpuset.CPUSet
+	}{
+		{
+			description: "complete a partially allocated core",
+			from:        cpuset.NewCPUSet(0, 1, 2, 4, 5, 6, 7),
+			cnt:         1,
+			expected:    cpuset.NewCPUSet(2),
+		},
+		{
+			description: "complete a partially allocated package",
+			from:        cpuset.NewCPUSet(1, 2, 3, 4, 5, 6, 7),
+			cnt:         3,
+			expected:    cpuset.NewCPUSet(1, 2, 3),
+		},
+		{
+			description: "take an idle package",
+			from:        cpuset.NewCPUSet(0, 1, 2, 3, 4, 5, 6, 7),
+			cnt:         4,
+			expected:    cpuset.NewCPUSet(0, 1, 2, 3),
+		},
+		{
+			description: "too few available CPUs",
+			from:        cpuset.NewCPUSet(0, 1),
+			cnt:         3,
+			expected:    cpuset.NewCPUSet(),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			a := newAllocatorHelper(sys, topology)
+			a.from = tc.from.Clone()
+			a.preferred = cpuset.NewCPUSet()
+			a.cnt = tc.cnt
+			a.flags = AllocDefault | AllocLeastFragmenting
+			result := a.allocate()
+			if !result.Equals(tc.expected) {
+				t.Errorf("expected %q, result was %q", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseCoreKindPreference(t *testing.T) {
+	tcs := []struct {
+		description string
+		value       string
+		container   string
+		kind        sysfs.CoreKind
+		preferred   bool
+		fails       bool
+	}{
+		{
+			description: "pod-wide efficient cores",
+			value:       "efficient",
+			container:   "c0",
+			kind:        sysfs.EfficientCore,
+			preferred:   true,
+		},
+		{
+			description: "pod-wide performance cores",
+			value:       "performance",
+			container:   "c0",
+			kind:        sysfs.PerformanceCore,
+			preferred:   true,
+		},
+		{
+			description: "per-container preference",
+			value:       "c0: performance\nc1: efficient\n",
+			container:   "c1",
+			kind:        sysfs.EfficientCore,
+			preferred:   true,
+		},
+		{
+			description: "no preference for container",
+			value:       "c0: performance\n",
+			container:   "c1",
+		},
+		{
+			description: "alternative spelling",
+			value:       "efficiency",
+			container:   "c0",
+			fails:       true,
+		},
+		{
+			description: "invalid per-container kind",
+			value:       "c0: e-core\n",
+			container:   "c0",
+			fails:       true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			kind, preferred, err := ParseCoreKindPreference(tc.value, tc.container)
+			if tc.fails {
+				if err == nil {
+					t.Errorf("expected an error, got kind %s", kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if preferred != tc.preferred || (preferred && kind != tc.kind) {
+				t.Errorf("expected %s (%v), got %s (%v)", tc.kind, tc.preferred, kind, preferred)
+			}
+		})
+	}
+}
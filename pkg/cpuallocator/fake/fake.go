@@ -0,0 +1,120 @@
+// Copyright 2019 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides a topology-agnostic CPU allocator for tests.
+package fake
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+)
+
+// CPUAllocator is a topology-agnostic cpuallocator.CPUAllocator. It
+// allocates the lowest numbered CPUs and treats each ThreadsPerCore
+// consecutive CPU ids as the threads of a single core.
+type CPUAllocator struct {
+	ThreadsPerCore int // number of threads per core, 1 if unset
+}
+
+// Make sure CPUAllocator implements cpuallocator.CPUAllocator.
+var _ cpuallocator.CPUAllocator = &CPUAllocator{}
+
+// NewCPUAllocator creates a fake allocator with the given number of threads per core.
+func NewCPUAllocator(threadsPerCore int) *CPUAllocator {
+	return &CPUAllocator{ThreadsPerCore: threadsPerCore}
+}
+
+// core returns all the threads of the core of the given CPU.
+func (f *CPUAllocator) core(id int) cpuset.CPUSet {
+	tpc := f.ThreadsPerCore
+	if tpc < 1 {
+		tpc = 1
+	}
+	first := id - id%tpc
+	threads := []int{}
+	for i := 0; i < tpc; i++ {
+		threads = append(threads, first+i)
+	}
+	return cpuset.NewCPUSet(threads...)
+}
+
+// AllocateCpus allocates the lowest numbered CPUs, full idle cores first.
+func (f *CPUAllocator) AllocateCpus(from *cpuset.CPUSet, cnt int, prefer bool) (cpuset.CPUSet, error) {
+	return f.AllocateCpusWithFlags(from, cnt, prefer, cpuallocator.AllocDefault)
+}
+
+// AllocateCpusWithFlags allocates the lowest numbered CPUs, full idle cores
+// first if AllocIdleCores is set.
+func (f *CPUAllocator) AllocateCpusWithFlags(from *cpuset.CPUSet, cnt int, _ bool, flags cpuallocator.AllocFlag) (cpuset.CPUSet, error) {
+	if from.Size() < cnt {
+		return cpuset.NewCPUSet(), fmt.Errorf("cannot allocate %d CPUs from %s", cnt, from)
+	}
+	result := cpuset.NewCPUSet()
+	if flags&cpuallocator.AllocIdleCores != 0 {
+		for _, id := range f.IdleCoreCpus(*from).ToSlice() {
+			core := f.core(id)
+			if result.Size()+core.Size() > cnt || core.IsSubsetOf(result) {
+				continue
+			}
+			result = result.Union(core)
+		}
+	}
+	for _, id := range from.Difference(result).ToSlice() {
+		if result.Size() == cnt {
+			break
+		}
+		result = result.Union(cpuset.NewCPUSet(id))
+	}
+	*from = from.Difference(result)
+	return result, nil
+}
+
+// ReleaseCpus releases the highest numbered CPUs, keeping cnt of them.
+func (f *CPUAllocator) ReleaseCpus(from *cpuset.CPUSet, cnt int, prefer bool) (cpuset.CPUSet, error) {
+	return f.AllocateCpus(from, from.Size()-cnt, prefer)
+}
+
+// Fragmentation returns the number of cores only partially in the free set.
+func (f *CPUAllocator) Fragmentation(free cpuset.CPUSet) int {
+	partial := map[int]struct{}{}
+	for _, id := range free.ToSlice() {
+		if core := f.core(id); !core.IsSubsetOf(free) {
+			partial[core.ToSlice()[0]] = struct{}{}
+		}
+	}
+	return len(partial)
+}
+
+// IdleCoreCpus returns the CPUs of the cores with all threads in the given set.
+func (f *CPUAllocator) IdleCoreCpus(cpus cpuset.CPUSet) cpuset.CPUSet {
+	idle := cpuset.NewCPUSet()
+	for _, id := range cpus.ToSlice() {
+		if core := f.core(id); core.IsSubsetOf(cpus) {
+			idle = idle.Union(core)
+		}
+	}
+	return idle
+}
+
+// CoreSiblings returns the hyperthread siblings of the given CPUs not in the set.
+func (f *CPUAllocator) CoreSiblings(cpus cpuset.CPUSet) cpuset.CPUSet {
+	siblings := cpuset.NewCPUSet()
+	for _, id := range cpus.ToSlice() {
+		siblings = siblings.Union(f.core(id))
+	}
+	return siblings.Difference(cpus)
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake
+
+import (
+	"testing"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+)
+
+func TestCPUAllocator(t *testing.T) {
+	fake := NewCPUAllocator(2)
+
+	tcs := []struct {
+		description string
+		from        cpuset.CPUSet
+		cnt         int
+		flags       cpuallocator.AllocFlag
+		expected    cpuset.CPUSet
+	}{
+		{
+			description: "lowest CPUs",
+			from:        cpuset.NewCPUSet(1, 2, 3, 4),
+			cnt:         2,
+			expected:    cpuset.NewCPUSet(1, 2),
+		},
+		{
+			description: "idle cores first",
+			from:        cpuset.NewCPUSet(1, 2, 3, 4),
+			cnt:         2,
+			flags:       cpuallocator.AllocIdleCores,
+			expected:    cpuset.NewCPUSet(2, 3),
+		},
+		{
+			description: "idle cores and a thread",
+			from:        cpuset.NewCPUSet(1, 2, 3, 5),
+			cnt:         3,
+			flags:       cpuallocator.AllocIdleCores,
+			expected:    cpuset.NewCPUSet(1, 2, 3),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.description, func(t *testing.T) {
+			from := tc.from
+			cpus, err := fake.AllocateCpusWithFlags(&from, tc.cnt, false, tc.flags)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !cpus.Equals(tc.expected) || !from.Equals(tc.from.Difference(cpus)) {
+				t.Errorf("expected %s, got %s, left %s", tc.expected, cpus, from)
+			}
+		})
+	}
+
+	if siblings := fake.CoreSiblings(cpuset.NewCPUSet(1, 2)); !siblings.Equals(cpuset.NewCPUSet(0, 3)) {
+		t.Errorf("expected siblings 0,3, got %s", siblings)
+	}
+	if frag := fake.Fragmentation(cpuset.NewCPUSet(1, 2, 3, 5)); frag != 2 {
+		t.Errorf("expected fragmentation 2, got %d", frag)
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 
 	"github.com/intel/cri-resource-manager/pkg/apis/resmgr"
+	extapi "github.com/intel/cri-resource-manager/pkg/apis/resmgr/v1alpha1"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/config"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/kubernetes"
 	logger "github.com/intel/cri-resource-manager/pkg/log"
@@ -45,23 +46,33 @@ const (
 	BlockIO = "blockio"
 	// Memory marks changes that can be applied by the Memory controller.
 	Memory = "memory"
+	// Scheduler marks changes that can be applied by the scheduler controller.
+	Scheduler = "scheduler"
 
 	// TagAVX512 tags containers that use AVX512 instructions.
 	TagAVX512 = "AVX512"
+	// TagExclusiveCPUs tags containers with the CPUs exclusively allocated to them.
+	TagExclusiveCPUs = "ExclusiveCPUs"
+	// TagRDTRestricted tags containers demoted to a restricted RDT class with that class.
+	TagRDTRestricted = "RDTRestricted"
 
 	// RDTClassKey is the pod annotation key for specifying a container RDT class.
 	RDTClassKey = "rdtclass" + "." + kubernetes.ResmgrKeyNamespace
+	// RDTCacheShareKey is the pod annotation key for specifying the cache share of a dynamic RDT class.
+	RDTCacheShareKey = "rdtcacheshare" + "." + kubernetes.ResmgrKeyNamespace
 	// BlockIOClassKey is the pod annotation key for specifying a container Block I/O class.
 	BlockIOClassKey = "blockioclass" + "." + kubernetes.ResmgrKeyNamespace
 	// ToptierLimitKey is the pod annotation key for specifying container top tier memory limits.
 	ToptierLimitKey = "toptierlimit" + "." + kubernetes.ResmgrKeyNamespace
+	// SchedulingClassKey is the pod annotation key for specifying a container scheduling class.
+	SchedulingClassKey = "schedulingclass" + "." + kubernetes.ResmgrKeyNamespace
 
 	// ToptierLimitUnset is the reserved value for indicating unset top tier limits.
 	ToptierLimitUnset int64 = -1
 )
 
 // allControllers is a slice of all controller domains.
-var allControllers = []string{CRI, RDT, BlockIO, Memory}
+var allControllers = []string{CRI, RDT, BlockIO, Memory, Scheduler}
 
 // PodState is the pod state in the runtime.
 type PodState int32
@@ -333,17 +344,29 @@ type Container interface {
 	SetRDTClass(string)
 	// GetRDTClass returns the RDT class for this container.
 	GetRDTClass() string
+	// SetRDTRestriction overrides the RDT class of this container, or clears the override if empty.
+	SetRDTRestriction(string)
+	// GetRDTRestriction returns the overriding RDT class of this container, if any.
+	GetRDTRestriction() (string, bool)
 
 	// SetBlockIOClass assigns this container to the given BlockIO class.
 	SetBlockIOClass(string)
 	// GetBlockIOClass returns the BlockIO class for this container.
 	GetBlockIOClass() string
 
+	// SetSchedulingClass assigns this container to the given scheduling class.
+	SetSchedulingClass(string)
+	// GetSchedulingClass returns the scheduling class for this container.
+	GetSchedulingClass() string
+
 	// SetToptierLimit sets the tier memory limit for the container.
 	SetToptierLimit(int64)
 	// GetToptierLimit returns the top tier memory limit for the container.
 	GetToptierLimit() int64
 
+	// GetStaticPoolsAdjustment returns any static-pools assignment of an external adjustment.
+	GetStaticPoolsAdjustment() (*extapi.StaticPools, bool)
+
 	// SetCRIRequest sets the current pending CRI request of the container.
 	SetCRIRequest(req interface{}) error
 	// GetCRIRequest returns the current pending CRI request of the container.
@@ -398,9 +421,10 @@ type container struct {
 	LinuxReq  *cri.LinuxContainerResources // used to estimate Resources if we lack annotations
 	req       *interface{}                 // pending CRI request
 
-	RDTClass     string // RDT class this container is assigned to.
-	BlockIOClass string // Block I/O class this container is assigned to.
-	ToptierLimit int64  // Top tier memory limit.
+	RDTClass        string // RDT class this container is assigned to.
+	BlockIOClass    string // Block I/O class this container is assigned to.
+	SchedulingClass string // scheduling class this container is assigned to.
+	ToptierLimit    int64  // Top tier memory limit.
 
 	pending map[string]struct{} // controllers with pending changes for this container
 
@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -408,3 +410,65 @@ func TestCPULimitCalculationAccuracy(t *testing.T) {
 		}
 	}
 }
+
+func TestInitContainers(t *testing.T) {
+	cch, dir, err := createTmpCache()
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	defer removeTmpCache(dir)
+
+	fakePods := []*fakePod{
+		{
+			name: "pod1",
+			annotations: map[string]string{
+				KeyResourceAnnotation: `{"initContainers":{"init":{}},"containers":{"app":{}}}`,
+			},
+		},
+		{
+			name: "pod2",
+			annotations: map[string]string{
+				KeyResourceAnnotation: `{"containers":{"init":{},"app":{}}}`,
+			},
+		},
+	}
+
+	pods := []Pod{}
+	for _, fp := range fakePods {
+		pod, err := createFakePod(cch, fp)
+		if err != nil {
+			t.Fatalf("failed to create fake pod %s: %v", fp.name, err)
+		}
+		pods = append(pods, pod)
+		for _, name := range []string{"init", "app"} {
+			if _, err := createFakeContainer(cch, &fakeContainer{fakePod: fp, name: name}); err != nil {
+				t.Fatalf("failed to create fake container %s: %v", name, err)
+			}
+		}
+	}
+
+	names := func(containers []Container) []string {
+		result := []string{}
+		for _, c := range containers {
+			result = append(result, c.GetName())
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	for idx, tc := range []struct {
+		init       []string
+		containers []string
+	}{
+		{init: []string{"init"}, containers: []string{"app"}},
+		{init: []string{}, containers: []string{"app", "init"}},
+	} {
+		pod := pods[idx]
+		if init := names(pod.GetInitContainers()); !reflect.DeepEqual(init, tc.init) {
+			t.Errorf("pod %s: expected init containers %v, got %v", pod.GetName(), tc.init, init)
+		}
+		if containers := names(pod.GetContainers()); !reflect.DeepEqual(containers, tc.containers) {
+			t.Errorf("pod %s: expected containers %v, got %v", pod.GetName(), tc.containers, containers)
+		}
+	}
+}
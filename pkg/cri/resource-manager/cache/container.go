@@ -181,6 +181,10 @@ func (c *container) setDefaults() error {
 	}
 	c.SetBlockIOClass(class)
 
+	if class, ok := c.GetEffectiveAnnotation(SchedulingClassKey); ok {
+		c.SetSchedulingClass(class)
+	}
+
 	limit, ok := c.GetEffectiveAnnotation(ToptierLimitKey)
 	if !ok {
 		c.ToptierLimit = ToptierLimitUnset
@@ -757,6 +761,9 @@ func (c *container) SetRDTClass(class string) {
 }
 
 func (c *container) GetRDTClass() string {
+	if class, ok := c.GetRDTRestriction(); ok {
+		return class
+	}
 	if adjust, _ := c.getEffectiveAdjustment(); adjust != nil {
 		if class, ok := adjust.GetRDTClass(); ok {
 			return class
@@ -765,6 +772,20 @@ func (c *container) GetRDTClass() string {
 	return c.RDTClass
 }
 
+func (c *container) SetRDTRestriction(class string) {
+	if class == "" {
+		delete(c.Tags, TagRDTRestricted)
+	} else {
+		c.Tags[TagRDTRestricted] = class
+	}
+	c.markPending(RDT)
+}
+
+func (c *container) GetRDTRestriction() (string, bool) {
+	class, ok := c.Tags[TagRDTRestricted]
+	return class, ok
+}
+
 func (c *container) SetBlockIOClass(class string) {
 	c.BlockIOClass = class
 	c.markPending(BlockIO)
@@ -779,6 +800,20 @@ func (c *container) GetBlockIOClass() string {
 	return c.BlockIOClass
 }
 
+func (c *container) SetSchedulingClass(class string) {
+	c.SchedulingClass = class
+	c.markPending(Scheduler)
+}
+
+func (c *container) GetSchedulingClass() string {
+	if adjust, _ := c.getEffectiveAdjustment(); adjust != nil {
+		if class, ok := adjust.GetSchedulingClass(); ok {
+			return class
+		}
+	}
+	return c.SchedulingClass
+}
+
 func (c *container) SetToptierLimit(limit int64) {
 	c.ToptierLimit = limit
 	c.markPending(Memory)
@@ -793,6 +828,13 @@ func (c *container) GetToptierLimit() int64 {
 	return c.ToptierLimit
 }
 
+func (c *container) GetStaticPoolsAdjustment() (*extapi.StaticPools, bool) {
+	if adjust, _ := c.getEffectiveAdjustment(); adjust != nil {
+		return adjust.GetStaticPools()
+	}
+	return nil, false
+}
+
 func (c *container) SetCRIRequest(req interface{}) error {
 	if c.req != nil {
 		return cacheError("can't set pending container request: another pending")
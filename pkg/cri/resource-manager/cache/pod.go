@@ -88,10 +88,10 @@ func (p *pod) GetInitContainers() []Container {
 	containers := []Container{}
 
 	for id, c := range p.cache.Containers {
-		if id != c.CacheID {
+		if c.PodID != p.ID || id != c.CacheID {
 			continue
 		}
-		if _, ok := p.Resources.InitContainers[c.ID]; ok {
+		if _, ok := p.Resources.InitContainers[c.Name]; ok {
 			containers = append(containers, c)
 		}
 	}
@@ -108,7 +108,7 @@ func (p *pod) GetContainers() []Container {
 			continue
 		}
 		if p.Resources != nil {
-			if _, ok := p.Resources.InitContainers[c.ID]; ok {
+			if _, ok := p.Resources.InitContainers[c.Name]; ok {
 				continue
 			}
 		}
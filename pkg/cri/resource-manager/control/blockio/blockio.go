@@ -16,6 +16,7 @@ package blockio
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/hashicorp/go-multierror"
 
@@ -34,8 +35,18 @@ const (
 
 // blockio encapsulates the runtime state of our block I/O enforcement/controller.
 type blockioctl struct {
-	cache cache.Cache // resource manager cache
-	idle  *bool       // true if we run without any classes configured
+	sync.Mutex
+	cache   cache.Cache           // resource manager cache
+	idle    *bool                 // true if we run without any classes configured
+	tracked map[string]*container // containers assigned to a class
+}
+
+// container is the state we track for a container assigned to a class.
+type container struct {
+	pretty string // pretty name of the container
+	parent string // cgroup parent directory of the pod
+	id     string // container runtime ID
+	class  string // name of the block I/O class
 }
 
 // Our logger instance.
@@ -47,7 +58,9 @@ var singleton *blockioctl
 // getBlockIOController returns our singleton block I/O controller instance.
 func getBlockIOController() *blockioctl {
 	if singleton == nil {
-		singleton = &blockioctl{}
+		singleton = &blockioctl{
+			tracked: make(map[string]*container),
+		}
 	}
 	return singleton
 }
@@ -56,11 +69,13 @@ func getBlockIOController() *blockioctl {
 func (ctl *blockioctl) Start(cache cache.Cache, client client.Client) error {
 	ctl.cache = cache
 	ctl.reconfigureRunningContainers()
+	blockio.StartDeviceWatch(ctl.devicesChanged)
 	return nil
 }
 
 // Stop shuts down the controller.
 func (ctl *blockioctl) Stop() {
+	blockio.StopDeviceWatch()
 }
 
 // PreCreateHook is the block I/O controller pre-create hook.
@@ -105,6 +120,7 @@ func (ctl *blockioctl) PostUpdateHook(c cache.Container) error {
 
 // PostStop is the block I/O controller post-stop hook.
 func (ctl *blockioctl) PostStopHook(c cache.Container) error {
+	ctl.untrack(c)
 	return nil
 }
 
@@ -127,22 +143,73 @@ func (ctl *blockioctl) isImplicitlyDisabled() bool {
 func (ctl *blockioctl) assign(c cache.Container) error {
 	class := c.GetBlockIOClass()
 	if class == "" {
+		ctl.untrack(c)
 		return nil
 	}
 
 	if ctl.isImplicitlyDisabled() && cache.IsPodQOSClassName(class) {
+		ctl.untrack(c)
 		return nil
 	}
 
 	if err := blockio.SetContainerClass(c, class); err != nil {
 		return blockioError("%q: failed to assign to class %q: %w", c.PrettyName(), class, err)
 	}
+	ctl.track(c, class)
 
 	log.Info("%q: assigned to class %q", c.PrettyName(), class)
 
 	return nil
 }
 
+// track remembers the class of a container for reapplying it after device changes.
+func (ctl *blockioctl) track(c cache.Container, class string) {
+	pod, ok := c.GetPod()
+	if !ok {
+		return
+	}
+
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	ctl.tracked[c.GetCacheID()] = &container{
+		pretty: c.PrettyName(),
+		parent: pod.GetCgroupParentDir(),
+		id:     c.GetID(),
+		class:  class,
+	}
+}
+
+// untrack forgets the class of a container.
+func (ctl *blockioctl) untrack(c cache.Container) {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	delete(ctl.tracked, c.GetCacheID())
+}
+
+// devicesChanged reapplies the given classes to all containers assigned to them.
+func (ctl *blockioctl) devicesChanged(classes []string) {
+	changed := make(map[string]struct{}, len(classes))
+	for _, class := range classes {
+		changed[class] = struct{}{}
+	}
+
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	for _, c := range ctl.tracked {
+		if _, ok := changed[c.class]; !ok {
+			continue
+		}
+		if err := blockio.SetCgroupClass(c.pretty, c.parent, c.id, c.class); err != nil {
+			log.Warn("%q: failed to reapply class %q: %v", c.pretty, c.class, err)
+			continue
+		}
+		log.Info("%q: reapplied class %q after block device changes", c.pretty, c.class)
+	}
+}
+
 // configNotify is blockio class mapping and class definition configuration callback
 func (ctl *blockioctl) configNotify(event config.Event, source config.Source) error {
 	ignoreErrors := (event == config.RevertEvent)
@@ -153,6 +220,9 @@ func (ctl *blockioctl) configNotify(event config.Event, source config.Source) er
 	// Possible errors in reconfiguring running containers are not errors in
 	// the updated configuration, therefore silently ignored.
 	ctl.reconfigureRunningContainers()
+	if ctl.cache != nil {
+		blockio.StartDeviceWatch(ctl.devicesChanged)
+	}
 
 	// We'll re-check idleness at next operation/request.
 	ctl.idle = nil
@@ -172,7 +242,9 @@ func (ctl *blockioctl) reconfigureRunningContainers() error {
 		err := blockio.SetContainerClass(c, class)
 		if err != nil {
 			errors = multierror.Append(errors, err)
+			continue
 		}
+		ctl.track(c, class)
 	}
 	return errors.ErrorOrNil()
 }
@@ -0,0 +1,37 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostisolation
+
+const (
+	// ConfigModuleName is the configuration section for host isolation.
+	ConfigModuleName = "resource-manager.control." + HostIsolationController
+)
+
+// options captures our configurable parameters.
+type options struct {
+	// CgroupRoots are the cpuset cgroups, relative to the cpuset hierarchy root,
+	// whose non-container cgroups are confined to the non-exclusive CPUs.
+	CgroupRoots []string `json:",omitempty"`
+	// KernelThreads controls whether movable kernel threads are confined, too.
+	KernelThreads bool `json:",omitempty"`
+}
+
+// Our runtime configuration.
+var opt = defaultOptions().(*options)
+
+// defaultOptions returns a new options instance, all initialized to defaults.
+func defaultOptions() interface{} {
+	return &options{}
+}
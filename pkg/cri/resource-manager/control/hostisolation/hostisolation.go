@@ -0,0 +1,409 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostisolation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+	"github.com/intel/cri-resource-manager/pkg/cri/client"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control"
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+	"github.com/intel/cri-resource-manager/pkg/utils"
+)
+
+const (
+	// HostIsolationController is the name of the host isolation controller.
+	HostIsolationController = "host-isolation"
+
+	// cpusetCpus is the cpuset cgroup entry for the allowed CPUs.
+	cpusetCpus = "cpuset.cpus"
+	// onlineCPUsPath is the sysfs entry listing all online CPUs.
+	onlineCPUsPath = "/sys/devices/system/cpu/online"
+	// procPath is the mount point of procfs.
+	procPath = "/proc"
+
+	// pfKthread is the task flag (PF_KTHREAD) for kernel threads.
+	pfKthread = 0x00200000
+	// pfNoSetAffinity is the task flag (PF_NO_SETAFFINITY) for pinned kernel threads.
+	pfNoSetAffinity = 0x04000000
+)
+
+// hostctl encapsulates the runtime state of our host isolation controller.
+//
+// Only CPUs exported as exclusive or isolated by the active policy are
+// isolated from the host. Policies which export only shared CPUs, such as
+// balloons and podpools, leave nothing for this controller to do.
+type hostctl struct {
+	sync.Mutex
+	cache     cache.Cache   // resource manager cache
+	exclusive cpuset.CPUSet // exclusive CPUs we last isolated the host from
+	synced    bool          // whether the host is in sync with exclusive
+	noticed   bool          // whether we logged having nothing to isolate
+}
+
+// Our logger instance.
+var log logger.Logger = logger.NewLogger(HostIsolationController)
+
+// Our singleton host isolation controller instance.
+var singleton *hostctl
+
+// getHostIsolationController returns our singleton host isolation controller instance.
+func getHostIsolationController() *hostctl {
+	if singleton == nil {
+		singleton = &hostctl{}
+	}
+	return singleton
+}
+
+// Start initializes the controller for enforcing decisions.
+func (ctl *hostctl) Start(cache cache.Cache, client client.Client) error {
+	ctl.Lock()
+	ctl.cache = cache
+	ctl.synced = false
+	ctl.Unlock()
+
+	if err := ctl.sync(); err != nil {
+		log.Error("failed to isolate host from exclusive CPUs: %v", err)
+	}
+	return nil
+}
+
+// Stop shuts down the controller.
+func (ctl *hostctl) Stop() {
+}
+
+// PreCreateHook is the host isolation controller pre-create hook.
+func (ctl *hostctl) PreCreateHook(c cache.Container) error {
+	return ctl.sync()
+}
+
+// PreStartHook is the host isolation controller pre-start hook.
+func (ctl *hostctl) PreStartHook(c cache.Container) error {
+	return nil
+}
+
+// PostStartHook is the host isolation controller post-start hook.
+func (ctl *hostctl) PostStartHook(c cache.Container) error {
+	return ctl.sync()
+}
+
+// PostUpdateHook is the host isolation controller post-update hook.
+func (ctl *hostctl) PostUpdateHook(c cache.Container) error {
+	return ctl.sync()
+}
+
+// PostStop is the host isolation controller post-stop hook.
+func (ctl *hostctl) PostStopHook(c cache.Container) error {
+	return ctl.sync()
+}
+
+// isImplicitlyDisabled checks if we run without anything to isolate configured.
+func (ctl *hostctl) isImplicitlyDisabled() bool {
+	return len(opt.CgroupRoots) == 0 && !opt.KernelThreads
+}
+
+// sync confines the host to the CPUs not exclusively allocated to any container.
+func (ctl *hostctl) sync() error {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	if ctl.cache == nil || ctl.isImplicitlyDisabled() {
+		return nil
+	}
+
+	exclusive := ctl.exclusiveCPUs()
+	if ctl.synced && exclusive.Equals(ctl.exclusive) {
+		return nil
+	}
+
+	if exclusive.IsEmpty() && !ctl.noticed {
+		log.Info("no exclusive CPUs allocated, nothing to isolate the host from " +
+			"(the active policy might export only shared CPUs)")
+		ctl.noticed = true
+	}
+
+	online, err := readCPUSet(onlineCPUsPath)
+	if err != nil {
+		return hostctlError("failed to read online CPUs: %v", err)
+	}
+
+	allowed := online.Difference(exclusive)
+	if allowed.IsEmpty() {
+		return hostctlError("refusing to confine host to an empty set of CPUs")
+	}
+
+	log.Info("confining host to CPUs %s (exclusive CPUs: %s)", allowed, exclusive)
+
+	errors := []string{}
+	for _, root := range opt.CgroupRoots {
+		if err := ctl.confineCgroups(root, allowed); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	if opt.KernelThreads {
+		if err := ctl.confineKernelThreads(allowed); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	ctl.exclusive = exclusive
+	ctl.synced = len(errors) == 0
+
+	if len(errors) > 0 {
+		return hostctlError("%s", strings.Join(errors, ", "))
+	}
+
+	return nil
+}
+
+// exclusiveCPUs returns the CPUs exclusively allocated to active containers.
+func (ctl *hostctl) exclusiveCPUs() cpuset.CPUSet {
+	exclusive := cpuset.NewCPUSet()
+	for _, c := range ctl.cache.GetContainers() {
+		switch c.GetState() {
+		case cache.ContainerStateCreating, cache.ContainerStateCreated, cache.ContainerStateRunning:
+		default:
+			continue
+		}
+		value, ok := c.GetTag(cache.TagExclusiveCPUs)
+		if !ok {
+			continue
+		}
+		cpus, err := cpuset.Parse(value)
+		if err != nil {
+			log.Error("%q: invalid exclusive CPU tag %q: %v", c.PrettyName(), value, err)
+			continue
+		}
+		exclusive = exclusive.Union(cpus)
+	}
+	return exclusive
+}
+
+// confineCgroups confines all non-container cgroups under root to the given CPUs.
+func (ctl *hostctl) confineCgroups(root string, allowed cpuset.CPUSet) error {
+	dirs, err := ctl.hostCgroups(filepath.Join(utils.CpusetCgroupDir, root))
+	if err != nil {
+		return err
+	}
+
+	// Expand top-down first, then shrink bottom-up, so that every child
+	// cgroup stays a subset of its parent while we are updating them.
+	current := make(map[string]cpuset.CPUSet, len(dirs))
+	for _, dir := range dirs {
+		cpus, err := readCPUSet(filepath.Join(dir, cpusetCpus))
+		if err != nil {
+			log.Warn("failed to read CPUs of cgroup %s: %v", dir, err)
+			continue
+		}
+		current[dir] = cpus
+		if expanded := cpus.Union(allowed); !expanded.Equals(cpus) {
+			if err := writeCPUSet(filepath.Join(dir, cpusetCpus), expanded); err != nil {
+				log.Warn("failed to update CPUs of cgroup %s: %v", dir, err)
+			}
+		}
+	}
+
+	failed := 0
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if cpus, ok := current[dir]; ok && cpus.Equals(allowed) {
+			continue
+		}
+		if err := writeCPUSet(filepath.Join(dir, cpusetCpus), allowed); err != nil {
+			log.Warn("failed to confine cgroup %s: %v", dir, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return hostctlError("failed to confine %d cgroups under %s", failed, root)
+	}
+
+	log.Debug("confined %d cgroups under %s to CPUs %s", len(dirs), root, allowed)
+
+	return nil
+}
+
+// hostCgroups lists the cgroups under root which contain no pods or containers.
+func (ctl *hostctl) hostCgroups(root string) ([]string, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, hostctlError("can't access cgroup root %s: %v", root, err)
+	}
+
+	ids := ctl.podAndContainerIDs()
+	dirs := []string{}
+	skip := map[string]struct{}{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		base := filepath.Base(path)
+		for _, id := range ids {
+			if strings.Contains(base, id) {
+				// Leave pods, containers and all their ancestors alone.
+				for dir := filepath.Dir(path); len(dir) >= len(root); dir = filepath.Dir(dir) {
+					skip[dir] = struct{}{}
+				}
+				return filepath.SkipDir
+			}
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	if err != nil {
+		return nil, hostctlError("failed to walk cgroup root %s: %v", root, err)
+	}
+
+	filtered := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if _, ok := skip[dir]; !ok {
+			filtered = append(filtered, dir)
+		}
+	}
+
+	return filtered, nil
+}
+
+// podAndContainerIDs returns the IDs of all known pods and containers.
+func (ctl *hostctl) podAndContainerIDs() []string {
+	ids := []string{}
+	for _, p := range ctl.cache.GetPods() {
+		if uid := p.GetUID(); uid != "" {
+			ids = append(ids, uid, strings.Replace(uid, "-", "_", -1))
+		}
+		if id := p.GetID(); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	for _, c := range ctl.cache.GetContainers() {
+		if id := c.GetID(); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// confineKernelThreads sets the CPU affinity of all movable kernel threads.
+func (ctl *hostctl) confineKernelThreads(allowed cpuset.CPUSet) error {
+	entries, err := filepath.Glob(filepath.Join(procPath, "[0-9]*"))
+	if err != nil {
+		return hostctlError("failed to list processes: %v", err)
+	}
+
+	mask := unix.CPUSet{}
+	for _, id := range allowed.ToSlice() {
+		mask.Set(id)
+	}
+
+	moved := 0
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(filepath.Base(entry))
+		if err != nil {
+			continue
+		}
+		flags, err := readTaskFlags(filepath.Join(entry, "stat"))
+		if err != nil {
+			// Most likely the task is gone already.
+			continue
+		}
+		if flags&pfKthread == 0 || flags&pfNoSetAffinity != 0 {
+			continue
+		}
+		if err := unix.SchedSetaffinity(pid, &mask); err != nil {
+			log.Debug("failed to set CPU affinity of kernel thread %d: %v", pid, err)
+			continue
+		}
+		moved++
+	}
+
+	log.Debug("confined %d kernel threads to CPUs %s", moved, allowed)
+
+	return nil
+}
+
+// readTaskFlags reads the kernel flags of a task from its stat entry.
+func readTaskFlags(path string) (uint64, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	// The command name can contain spaces and parentheses, skip past it.
+	stat := string(buf)
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return 0, hostctlError("%s: malformed task stat entry", path)
+	}
+	fields := strings.Fields(stat[end+1:])
+	// state ppid pgrp session tty_nr tpgid flags ...
+	if len(fields) < 7 {
+		return 0, hostctlError("%s: malformed task stat entry", path)
+	}
+
+	return strconv.ParseUint(fields[6], 10, 64)
+}
+
+// readCPUSet reads a CPU set from the given file.
+func readCPUSet(path string) (cpuset.CPUSet, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cpuset.NewCPUSet(), err
+	}
+	return cpuset.Parse(strings.TrimSpace(string(buf)))
+}
+
+// writeCPUSet writes a CPU set to the given file.
+func writeCPUSet(path string, cpus cpuset.CPUSet) error {
+	return ioutil.WriteFile(path, []byte(cpus.String()+"\n"), 0644)
+}
+
+// configNotify is our runtime configuration notification callback.
+func (ctl *hostctl) configNotify(event config.Event, source config.Source) error {
+	log.Info("configuration updated")
+
+	ctl.Lock()
+	ctl.synced = false
+	ctl.Unlock()
+
+	if err := ctl.sync(); err != nil {
+		log.Error("failed to isolate host from exclusive CPUs: %v", err)
+	}
+	return nil
+}
+
+// hostctlError creates a host isolation controller-specific formatted error message.
+func hostctlError(format string, args ...interface{}) error {
+	return fmt.Errorf("host-isolation: "+format, args...)
+}
+
+// init registers this controller.
+func init() {
+	control.Register(HostIsolationController, "host isolation controller",
+		getHostIsolationController())
+	config.Register(ConfigModuleName, "Host isolation from exclusive CPUs.", opt, defaultOptions,
+		config.WithNotify(getHostIsolationController().configNotify))
+}
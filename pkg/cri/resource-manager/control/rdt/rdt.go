@@ -15,12 +15,18 @@
 package rdt
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
 
 	"github.com/intel/cri-resource-manager/pkg/cri/client"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control"
 	"github.com/intel/cri-resource-manager/pkg/rdt"
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
 	"github.com/intel/cri-resource-manager/pkg/utils"
 
 	"github.com/intel/cri-resource-manager/pkg/config"
@@ -36,6 +42,7 @@ const (
 type rdtctl struct {
 	cache cache.Cache // resource manager cache
 	idle  *bool       // true if we run without any classes configured
+	cpus  int         // number of CPUs in the system
 }
 
 // Our logger instance.
@@ -59,10 +66,39 @@ func (ctl *rdtctl) Start(cache cache.Cache, client client.Client) error {
 	}
 
 	ctl.cache = cache
+	ctl.cpus = 0
+
+	sys, err := sysfs.DiscoverSystem(sysfs.DiscoverCPUTopology)
+	if err != nil {
+		log.Error("failed to discover system topology, using only static classes: %v", err)
+	} else {
+		ctl.cpus = sys.CPUCount()
+	}
+
+	// Reassign containers before dropping dynamic classes of our previous run.
+	ctl.reassignDynamic()
+	if err := rdt.PruneDynamicClasses(); err != nil {
+		log.Error("failed to remove stale dynamic classes: %v", err)
+	}
 
 	return nil
 }
 
+// reassignDynamic reassigns running containers which want a dynamic class.
+func (ctl *rdtctl) reassignDynamic() {
+	for _, c := range ctl.cache.GetContainers() {
+		if c.GetState() != cache.ContainerStateRunning {
+			continue
+		}
+		if !rdt.WantsDynamicClass(c.GetRDTClass()) {
+			continue
+		}
+		if err := ctl.assign(c); err != nil {
+			log.Warn("%q: failed to reassign RDT class: %v", c.PrettyName(), err)
+		}
+	}
+}
+
 // Stop shuts down the controller.
 func (ctl *rdtctl) Stop() {
 }
@@ -104,6 +140,11 @@ func (ctl *rdtctl) PostUpdateHook(c cache.Container) error {
 	if err := ctl.assign(c); err != nil {
 		return err
 	}
+	if !rdt.WantsDynamicClass(c.GetRDTClass()) {
+		if err := rdt.DeleteDynamicClass(c.GetID()); err != nil {
+			log.Warn("%q: failed to remove dynamic class: %v", c.PrettyName(), err)
+		}
+	}
 
 	c.ClearPending(RDTController)
 
@@ -115,6 +156,9 @@ func (ctl *rdtctl) PostStopHook(c cache.Container) error {
 	if err := ctl.stopMonitor(c); err != nil {
 		return rdtError("%q: failed to remove monitoring group: %v", c.PrettyName(), err)
 	}
+	if err := rdt.DeleteDynamicClass(c.GetID()); err != nil {
+		return rdtError("%q: failed to remove dynamic class: %v", c.PrettyName(), err)
+	}
 	return nil
 }
 
@@ -144,10 +188,11 @@ func (ctl *rdtctl) assign(c cache.Container) error {
 		return nil
 	}
 
-	cls, ok := rdt.GetClass(class)
-	if !ok {
-		return rdtError("%q: unknown RDT class %q", c.PrettyName(), class)
+	cls, err := ctl.getClass(c, class)
+	if err != nil {
+		return err
 	}
+	class = cls.Name()
 
 	pod, ok := c.GetPod()
 	if !ok {
@@ -163,6 +208,11 @@ func (ctl *rdtctl) assign(c cache.Container) error {
 		return rdtError("%q: failed to assign to class %q: %v", c.PrettyName(), class, err)
 	}
 
+	// Drop any monitoring group left behind in the previous class.
+	if err := ctl.removeMonGroups(c, class); err != nil {
+		log.Warn("%q: failed to remove stale monitoring group: %v", c.PrettyName(), err)
+	}
+
 	pname, name, id, pretty := pod.GetName(), c.GetName(), c.GetID(), c.PrettyName()
 	if err := ctl.monitor(cls, pname, name, id, pretty, pids); err != nil {
 		return err
@@ -173,6 +223,56 @@ func (ctl *rdtctl) assign(c cache.Container) error {
 	return nil
 }
 
+// getClass returns the class for a container, creating a dynamic one if necessary.
+func (ctl *rdtctl) getClass(c cache.Container, class string) (rdt.CtrlGroup, error) {
+	if rdt.WantsDynamicClass(class) && ctl.cpus == 0 {
+		// Without the system topology we cannot size dynamic classes.
+		class = rdt.DynamicFallbackClass(class)
+	} else if rdt.WantsDynamicClass(class) {
+		share := ctl.cacheShare(c)
+		cls, err := rdt.CreateDynamicClass(c.GetID(), share)
+		if err == nil {
+			return cls, nil
+		}
+		if !errors.Is(err, rdt.ErrDynamicClassesExhausted) {
+			return nil, rdtError("%q: failed to create dynamic class: %v", c.PrettyName(), err)
+		}
+		fallback := rdt.DynamicFallbackClass(class)
+		log.Warn("%q: %v, falling back to class %q", c.PrettyName(), err, fallback)
+		class = fallback
+	}
+
+	cls, ok := rdt.GetClass(class)
+	if !ok {
+		return nil, rdtError("%q: unknown RDT class %q", c.PrettyName(), class)
+	}
+
+	return cls, nil
+}
+
+// cacheShare returns the cache share (percentage of the dynamic partition) of a container.
+func (ctl *rdtctl) cacheShare(c cache.Container) uint64 {
+	if value, ok := c.GetEffectiveAnnotation(cache.RDTCacheShareKey); ok {
+		share, err := strconv.ParseUint(strings.TrimSuffix(value, "%"), 10, 7)
+		if err == nil && share >= 1 && share <= 100 {
+			return share
+		}
+		log.Warn("%q: ignoring invalid cache share annotation %q", c.PrettyName(), value)
+	}
+
+	// Default to the share of the CPU request of all CPUs in the system.
+	request, ok := c.GetResourceRequirements().Requests[v1.ResourceCPU]
+	if !ok || ctl.cpus == 0 {
+		return 1
+	}
+	share := uint64(request.MilliValue()) * 100 / uint64(ctl.cpus*1000)
+	if share < 1 {
+		share = 1
+	}
+
+	return share
+}
+
 // monitor starts monitoring a container.
 func (ctl *rdtctl) monitor(cls rdt.CtrlGroup, pod, name, id, pretty string, pids []string) error {
 	if !rdt.MonSupported() {
@@ -194,8 +294,16 @@ func (ctl *rdtctl) monitor(cls rdt.CtrlGroup, pod, name, id, pretty string, pids
 
 // stopMonitor stops monitoring a container.
 func (ctl *rdtctl) stopMonitor(c cache.Container) error {
-	name := c.PrettyName()
+	return ctl.removeMonGroups(c, "")
+}
+
+// removeMonGroups removes the monitoring groups of a container in all but the given class.
+func (ctl *rdtctl) removeMonGroups(c cache.Container, keep string) error {
+	name := c.GetID()
 	for _, cls := range rdt.GetClasses() {
+		if cls.Name() == keep {
+			continue
+		}
 		if mg, ok := cls.GetMonGroup(name); ok {
 			if err := cls.DeleteMonGroup(name); err != nil {
 				return err
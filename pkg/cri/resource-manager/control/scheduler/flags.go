@@ -0,0 +1,158 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+)
+
+const (
+	// ConfigModuleName is the configuration section for scheduling classes.
+	ConfigModuleName = "resource-manager.control." + SchedulerController
+)
+
+// Policy is a Linux scheduling policy.
+type Policy int
+
+const (
+	// PolicyOther is the default time-sharing policy (SCHED_OTHER).
+	PolicyOther Policy = 0
+	// PolicyFIFO is the first-in, first-out real-time policy (SCHED_FIFO).
+	PolicyFIFO Policy = 1
+	// PolicyRR is the round-robin real-time policy (SCHED_RR).
+	PolicyRR Policy = 2
+	// PolicyBatch is the policy for batch-style execution (SCHED_BATCH).
+	PolicyBatch Policy = 3
+	// PolicyIdle is the policy for very low priority background jobs (SCHED_IDLE).
+	PolicyIdle Policy = 5
+)
+
+// Class is a scheduling class containers can be assigned to.
+type Class struct {
+	// Policy is the scheduling policy for all tasks of the container.
+	Policy Policy
+	// Priority is the static priority for real-time policies.
+	Priority int `json:",omitempty"`
+	// Nice is the nice value for non-real-time policies.
+	Nice int `json:",omitempty"`
+}
+
+// options captures our configurable parameters.
+type options struct {
+	// Classes are the scheduling classes containers can be assigned to.
+	Classes map[string]*Class `json:",omitempty"`
+	// RecheckInterval is the interval for applying classes to newly spawned threads.
+	RecheckInterval config.Duration `json:",omitempty"`
+}
+
+// Our runtime configuration.
+var opt = defaultOptions().(*options)
+
+// IsRealtime checks if the policy is a real-time one.
+func (p Policy) IsRealtime() bool {
+	return p == PolicyFIFO || p == PolicyRR
+}
+
+// String returns the string representation of a policy.
+func (p Policy) String() string {
+	switch p {
+	case PolicyOther:
+		return "other"
+	case PolicyFIFO:
+		return "fifo"
+	case PolicyRR:
+		return "rr"
+	case PolicyBatch:
+		return "batch"
+	case PolicyIdle:
+		return "idle"
+	default:
+		return fmt.Sprintf("<unknown policy %d>", p)
+	}
+}
+
+// MarshalJSON is the JSON marshaller for Policy.
+func (p Policy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON is the JSON unmarshaller for Policy.
+func (p *Policy) UnmarshalJSON(raw []byte) error {
+	var str string
+
+	if err := json.Unmarshal(raw, &str); err != nil {
+		return schedError("failed to unmarshal policy: %v", err)
+	}
+
+	switch strings.TrimPrefix(strings.ToLower(str), "sched_") {
+	case "other", "normal", "":
+		*p = PolicyOther
+	case "fifo":
+		*p = PolicyFIFO
+	case "rr":
+		*p = PolicyRR
+	case "batch":
+		*p = PolicyBatch
+	case "idle":
+		*p = PolicyIdle
+	default:
+		return schedError("invalid scheduling policy %q", str)
+	}
+	return nil
+}
+
+// Verify checks the class for obvious errors.
+func (c *Class) Verify() error {
+	if c.Policy.IsRealtime() {
+		if c.Priority < 1 || c.Priority > 99 {
+			return schedError("invalid %s priority %d, must be within [1, 99]",
+				c.Policy, c.Priority)
+		}
+		if c.Nice != 0 {
+			return schedError("nice value not applicable to policy %s", c.Policy)
+		}
+		return nil
+	}
+
+	if c.Priority != 0 {
+		return schedError("priority not applicable to policy %s", c.Policy)
+	}
+	if c.Nice < -20 || c.Nice > 19 {
+		return schedError("invalid nice value %d, must be within [-20, 19]", c.Nice)
+	}
+
+	return nil
+}
+
+// String returns the string representation of a class.
+func (c *Class) String() string {
+	if c.Policy.IsRealtime() {
+		return fmt.Sprintf("%s:%d", c.Policy, c.Priority)
+	}
+	return fmt.Sprintf("%s,nice:%d", c.Policy, c.Nice)
+}
+
+// defaultOptions returns a new options instance, all initialized to defaults.
+func defaultOptions() interface{} {
+	return &options{
+		Classes:         make(map[string]*Class),
+		RecheckInterval: config.Duration(10 * time.Second),
+	}
+}
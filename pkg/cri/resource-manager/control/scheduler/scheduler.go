@@ -0,0 +1,391 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+	"github.com/intel/cri-resource-manager/pkg/cri/client"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control"
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+	"github.com/intel/cri-resource-manager/pkg/utils"
+)
+
+const (
+	// SchedulerController is the name of the scheduler controller.
+	SchedulerController = cache.Scheduler
+)
+
+// schedctl encapsulates the runtime state of our scheduler enforcement/controller.
+type schedctl struct {
+	sync.Mutex
+	cache   cache.Cache           // resource manager cache
+	tracked map[string]*container // containers with a scheduling class
+	stop    chan struct{}         // channel to stop rechecking threads
+}
+
+// container is the state we track for a container with a scheduling class.
+type container struct {
+	pretty string              // pretty name of the container
+	parent string              // cgroup parent directory of the pod
+	id     string              // container runtime ID
+	class  string              // name of the scheduling class
+	tasks  map[string]struct{} // tasks we have already set up
+}
+
+// schedParam is the equivalent of struct sched_param.
+type schedParam struct {
+	priority int32
+}
+
+// Our logger instance.
+var log logger.Logger = logger.NewLogger(SchedulerController)
+
+// Our singleton scheduler controller instance.
+var singleton *schedctl
+
+// getSchedulerController returns our singleton scheduler controller instance.
+func getSchedulerController() *schedctl {
+	if singleton == nil {
+		singleton = &schedctl{
+			tracked: make(map[string]*container),
+		}
+	}
+	return singleton
+}
+
+// Start initializes the controller for enforcing decisions.
+func (ctl *schedctl) Start(cache cache.Cache, client client.Client) error {
+	if err := verifyClasses(); err != nil {
+		return err
+	}
+
+	ctl.cache = cache
+	ctl.startRecheck()
+
+	return nil
+}
+
+// Stop shuts down the controller.
+func (ctl *schedctl) Stop() {
+	ctl.stopRecheck()
+}
+
+// PreCreateHook is the scheduler controller pre-create hook.
+func (ctl *schedctl) PreCreateHook(c cache.Container) error {
+	return nil
+}
+
+// PreStartHook is the scheduler controller pre-start hook.
+func (ctl *schedctl) PreStartHook(c cache.Container) error {
+	return nil
+}
+
+// PostStartHook is the scheduler controller post-start hook.
+func (ctl *schedctl) PostStartHook(c cache.Container) error {
+	if !c.HasPending(SchedulerController) {
+		return nil
+	}
+
+	if err := ctl.assign(c); err != nil {
+		return err
+	}
+
+	c.ClearPending(SchedulerController)
+
+	return nil
+}
+
+// PostUpdateHook is the scheduler controller post-update hook.
+func (ctl *schedctl) PostUpdateHook(c cache.Container) error {
+	if !c.HasPending(SchedulerController) {
+		return nil
+	}
+
+	if err := ctl.assign(c); err != nil {
+		return err
+	}
+
+	c.ClearPending(SchedulerController)
+
+	return nil
+}
+
+// PostStop is the scheduler controller post-stop hook.
+func (ctl *schedctl) PostStopHook(c cache.Container) error {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	delete(ctl.tracked, c.GetCacheID())
+
+	return nil
+}
+
+// assign sets the scheduling class of all tasks in a container.
+func (ctl *schedctl) assign(c cache.Container) error {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	name := c.GetSchedulingClass()
+	tracked, ok := ctl.tracked[c.GetCacheID()]
+
+	if name == "" {
+		if !ok {
+			return nil
+		}
+		delete(ctl.tracked, c.GetCacheID())
+		tracked.class = ""
+		tracked.tasks = make(map[string]struct{})
+		log.Info("%q: reset to default scheduling class", c.PrettyName())
+		return ctl.apply(tracked, &Class{Policy: PolicyOther})
+	}
+
+	class, ok := opt.Classes[name]
+	if !ok {
+		return schedError("%q: unknown scheduling class %q", c.PrettyName(), name)
+	}
+
+	if class.Policy.IsRealtime() {
+		if err := checkExclusiveCPUs(c); err != nil {
+			return schedError("%q: refusing real-time class %q: %v", c.PrettyName(), name, err)
+		}
+	}
+
+	pod, ok := c.GetPod()
+	if !ok {
+		return schedError("%q: failed to get pod", c.PrettyName())
+	}
+
+	tracked = &container{
+		pretty: c.PrettyName(),
+		parent: pod.GetCgroupParentDir(),
+		id:     c.GetID(),
+		class:  name,
+		tasks:  make(map[string]struct{}),
+	}
+	ctl.tracked[c.GetCacheID()] = tracked
+
+	if err := ctl.apply(tracked, class); err != nil {
+		return err
+	}
+
+	log.Info("%q: assigned to scheduling class %q (%s)", c.PrettyName(), name, class)
+
+	return nil
+}
+
+// apply sets the given class for all not yet set up tasks of the container.
+func (ctl *schedctl) apply(c *container, class *Class) error {
+	tasks, err := utils.GetTasksInContainer(c.parent, c.id)
+	if err != nil {
+		return schedError("%q: failed to get task list: %v", c.pretty, err)
+	}
+
+	current := make(map[string]struct{}, len(tasks))
+	failed := 0
+	for _, task := range tasks {
+		if _, ok := c.tasks[task]; ok {
+			current[task] = struct{}{}
+			continue
+		}
+		if err := setTaskClass(task, class); err != nil {
+			log.Warn("%q: failed to set scheduling class of task %s: %v", c.pretty, task, err)
+			failed++
+			continue
+		}
+		current[task] = struct{}{}
+	}
+	c.tasks = current
+
+	if failed > 0 {
+		return schedError("%q: failed to set scheduling class of %d tasks", c.pretty, failed)
+	}
+
+	return nil
+}
+
+// recheck sets up scheduling for any newly spawned threads in all tracked containers.
+func (ctl *schedctl) recheck() {
+	ctl.Lock()
+	defer ctl.Unlock()
+
+	for id, c := range ctl.tracked {
+		class, ok := opt.Classes[c.class]
+		if !ok {
+			log.Warn("%q: scheduling class %q is gone", c.pretty, c.class)
+			continue
+		}
+		if class.Policy.IsRealtime() {
+			if err := ctl.checkStillExclusive(id); err != nil {
+				log.Warn("%q: dropping real-time class %q: %v", c.pretty, c.class, err)
+				delete(ctl.tracked, id)
+				c.class = ""
+				c.tasks = make(map[string]struct{})
+				class = &Class{Policy: PolicyOther}
+			}
+		}
+		if err := ctl.apply(c, class); err != nil {
+			log.Warn("%v", err)
+		}
+	}
+}
+
+// checkStillExclusive checks if a tracked container still runs only on exclusive CPUs.
+func (ctl *schedctl) checkStillExclusive(id string) error {
+	if ctl.cache == nil {
+		return nil
+	}
+	c, ok := ctl.cache.LookupContainer(id)
+	if !ok {
+		return nil
+	}
+	return checkExclusiveCPUs(c)
+}
+
+// startRecheck starts periodic rechecking of tracked containers.
+func (ctl *schedctl) startRecheck() {
+	ctl.stopRecheck()
+
+	interval := time.Duration(opt.RecheckInterval)
+	if interval <= 0 {
+		log.Info("periodic rechecking of threads is disabled")
+		return
+	}
+
+	stop := make(chan struct{})
+	ctl.stop = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case _ = <-stop:
+				return
+			case _ = <-ticker.C:
+				ctl.recheck()
+			}
+		}
+	}()
+}
+
+// stopRecheck stops periodic rechecking of tracked containers.
+func (ctl *schedctl) stopRecheck() {
+	if ctl.stop != nil {
+		close(ctl.stop)
+		ctl.stop = nil
+	}
+}
+
+// checkExclusiveCPUs checks if the container runs only on exclusively allocated CPUs.
+func checkExclusiveCPUs(c cache.Container) error {
+	cpus, err := cpuset.Parse(c.GetCpusetCpus())
+	if err != nil {
+		return fmt.Errorf("invalid cpuset %q: %v", c.GetCpusetCpus(), err)
+	}
+	if cpus.IsEmpty() {
+		return fmt.Errorf("container is not pinned to any CPUs")
+	}
+
+	exclusive := cpuset.NewCPUSet()
+	if value, ok := c.GetTag(cache.TagExclusiveCPUs); ok {
+		if exclusive, err = cpuset.Parse(value); err != nil {
+			return fmt.Errorf("invalid exclusive CPUs %q: %v", value, err)
+		}
+	}
+	if !cpus.IsSubsetOf(exclusive) {
+		return fmt.Errorf("CPUs %s not exclusively allocated", cpus.Difference(exclusive))
+	}
+
+	return nil
+}
+
+// setTaskClass sets the scheduling policy, priority and nice value of a task.
+func setTaskClass(task string, class *Class) error {
+	tid, err := strconv.Atoi(task)
+	if err != nil {
+		return fmt.Errorf("invalid task ID %q: %v", task, err)
+	}
+
+	param := schedParam{priority: int32(class.Priority)}
+	_, _, errno := unix.Syscall(unix.SYS_SCHED_SETSCHEDULER, uintptr(tid),
+		uintptr(class.Policy), uintptr(unsafe.Pointer(&param)))
+	if errno != 0 {
+		return fmt.Errorf("sched_setscheduler(%s): %v", class, errno)
+	}
+
+	if !class.Policy.IsRealtime() {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, class.Nice); err != nil {
+			return fmt.Errorf("setpriority(%d): %v", class.Nice, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyClasses checks all configured classes for obvious errors.
+func verifyClasses() error {
+	for name, class := range opt.Classes {
+		if class == nil {
+			return schedError("class %q: missing definition", name)
+		}
+		if err := class.Verify(); err != nil {
+			return schedError("class %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// configNotify is our runtime configuration notification callback.
+func (ctl *schedctl) configNotify(event config.Event, source config.Source) error {
+	log.Info("configuration updated")
+
+	if err := verifyClasses(); err != nil {
+		return err
+	}
+
+	ctl.Lock()
+	for _, c := range ctl.tracked {
+		// Force updating all tasks at the next recheck.
+		c.tasks = make(map[string]struct{})
+	}
+	ctl.Unlock()
+
+	if ctl.cache != nil {
+		ctl.startRecheck()
+	}
+
+	return nil
+}
+
+// schedError creates a scheduler-controller-specific formatted error message.
+func schedError(format string, args ...interface{}) error {
+	return fmt.Errorf("scheduler: "+format, args...)
+}
+
+// init registers this controller.
+func init() {
+	control.Register(SchedulerController, "scheduler controller", getSchedulerController())
+	config.Register(ConfigModuleName, "Scheduling classes.", opt, defaultOptions,
+		config.WithNotify(getSchedulerController().configNotify))
+}
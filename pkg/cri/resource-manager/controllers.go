@@ -18,6 +18,8 @@ import (
 	// List of controllers to pull in.
 	_ "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control/blockio"
 	_ "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control/cri"
+	_ "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control/hostisolation"
 	_ "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control/memory"
 	_ "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control/rdt"
+	_ "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/control/scheduler"
 )
@@ -44,6 +44,8 @@ type Container struct {
 	MemoryRequest int64         // memory requested in bytes
 	MemoryLimit   int64         // memory limit in bytes (maximum allowed memory)
 	Hints         TopologyHints // topology/allocation hints
+	RDTClass      string        // effective RDT class
+	RDTRestricted bool          // demoted to a restricted RDT class
 }
 
 // TopologyHints contain a set of allocation hints for a container.
@@ -51,21 +53,36 @@ type TopologyHints topology.Hints
 
 // Assignment describes resource assignments for a single container.
 type Assignment struct {
-	ContainerID   string // ID of container for this assignment
-	SharedCPUs    string // shared CPUs
-	CPUShare      int    // CPU share/weight for SharedCPUs
-	ExclusiveCPUs string // exclusive CPUs
-	Memory        string // memory controllers
-	Pool          string // pool container is assigned to
+	ContainerID   string         // ID of container for this assignment
+	SharedCPUs    string         // shared CPUs
+	CPUShare      int            // CPU share/weight for SharedCPUs
+	ExclusiveCPUs string         // exclusive CPUs
+	IdleCPUs      string         // idle hyperthread siblings withheld with exclusive CPUs
+	Memory        string         // memory controllers
+	Pool          string         // pool container is assigned to
+	PageMoves     *PageMoveState // dynamic memory page moving state, if any
+}
+
+// PageMoveState describes the state of dynamic memory page moving for a container.
+type PageMoveState struct {
+	Promoted         uint64 // pages moved from PMEM to DRAM
+	Demoted          uint64 // pages moved from DRAM to PMEM
+	Failed           uint64 // pages which failed to move
+	Skipped          uint64 // pages skipped for being busy
+	PendingDemotion  uint   // pages left to demote
+	PendingPromotion uint   // pages left to promote
+	BackoffUntil     string // time page moving is backed off until, if backing off
 }
 
 // Pool describes a single (resource) pool.
 type Pool struct {
-	Name     string   // pool name
-	CPUs     string   // CPUs in this pool
-	Memory   string   // memory controllers (NUMA nodes) for this pool
-	Parent   string   // parent pool
-	Children []string // child pools
+	Name      string   // pool name
+	CPUs      string   // CPUs in this pool
+	IdleCPUs  string   // CPUs withheld idle as hyperthread siblings of exclusive CPUs
+	Exclusive bool     // whether the CPUs of this pool are only allocated exclusively
+	Memory    string   // memory controllers (NUMA nodes) for this pool
+	Parent    string   // parent pool
+	Children  []string // child pools
 }
 
 // Socket describes a single physical CPU socket in the system.
@@ -80,6 +97,17 @@ type Node struct {
 	CPUs string // CPUs with locality for this NUMA node.
 }
 
+// RDTTransition describes a single noisy neighbor demotion or promotion.
+type RDTTransition struct {
+	Time         string // time of the transition
+	ContainerID  string // ID of the container
+	Type         string // demote or promote
+	FromClass    string // previous RDT class
+	ToClass      string // new RDT class
+	LLCOccupancy uint64 // average LLC occupancy in bytes
+	Bandwidth    uint64 // average memory bandwidth in MBps
+}
+
 // System describes the underlying HW/system.
 type System struct {
 	Sockets        map[int]*Socket // physical sockets in the system
@@ -97,6 +125,7 @@ type State struct {
 	Pods        map[string]*Pod        // pods and containers
 	Assignments map[string]*Assignment // resource assignments
 	System      *System                // info about hardware/system
+	Transitions []*RDTTransition       // recent noisy neighbor transitions
 	Error       string
 }
 
@@ -0,0 +1,955 @@
+// Copyright 2019-2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balloons
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/go-multierror"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/introspect"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/kubernetes"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/policy"
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+const (
+	// PolicyName is the symbol used to pull us in as a builtin policy.
+	PolicyName = "balloons"
+	// PolicyDescription is a short description of this policy.
+	PolicyDescription = "Dynamically sized CPU pools (balloons) for classes of workloads."
+	// PolicyPath is the path of this policy in the configuration hierarchy.
+	PolicyPath = "policy." + PolicyName
+
+	// BalloonKey is the annotation for selecting the balloon type of a container.
+	BalloonKey = "balloon." + PolicyName + "." + kubernetes.ResmgrKeyNamespace
+
+	// reservedBalloonDefName is the balloon type of system containers.
+	reservedBalloonDefName = "reserved"
+	// defaultBalloonDefName is the balloon type of containers matching no other type.
+	defaultBalloonDefName = "default"
+
+	// Cache key for storing balloons.
+	keyBalloons = "balloons"
+)
+
+// balloon is a CPU pool of a balloon type, inflated and deflated in whole
+// CPUs as containers join and leave it.
+type balloon struct {
+	def        *BalloonDef    // type of this balloon
+	instance   int            // instance number among balloons of the same type
+	cpus       cpuset.CPUSet  // CPUs of this balloon
+	containers map[string]int // milli-CPU requested by containers, by cache ID
+}
+
+// balloons policy runtime state.
+type balloons struct {
+	logger.Logger
+	sys          sysfs.System              // system/topology information
+	cache        cache.Cache               // system state/cache
+	cpuAllocator cpuallocator.CPUAllocator // CPU allocator used by the policy
+	reserved     cpuset.CPUSet             // CPUs of the reserved balloon
+	available    cpuset.CPUSet             // CPUs available for other balloons
+	free         cpuset.CPUSet             // available CPUs not in any balloon
+	packages     []cpuset.CPUSet           // CPUs of each physical package
+	bdefs        []*BalloonDef             // balloon types, reserved and default included
+	balloons     []*balloon                // all balloons, reserved first
+}
+
+// Make sure balloons implements the policy backend interface.
+var _ policy.Backend = &balloons{}
+
+// CreateBalloonsPolicy creates a new policy instance.
+func CreateBalloonsPolicy(opts *policy.BackendOptions) policy.Backend {
+	p := &balloons{
+		Logger:       logger.NewLogger(PolicyName),
+		cache:        opts.Cache,
+		sys:          opts.System,
+		cpuAllocator: cpuallocator.NewCPUAllocator(opts.System),
+	}
+
+	p.Info("creating policy...")
+
+	for _, id := range p.sys.PackageIDs() {
+		p.packages = append(p.packages, p.sys.Package(id).CPUSet())
+	}
+
+	if err := p.setupCPUs(opts.Available, opts.Reserved); err != nil {
+		p.Fatal("failed to set up CPUs: %v", err)
+	}
+	if err := p.setBalloonDefs(opt); err != nil {
+		p.Fatal("invalid configuration: %v", err)
+	}
+
+	config.GetModule(PolicyPath).AddNotify(p.configNotify)
+
+	return p
+}
+
+// Name returns the name of this policy.
+func (p *balloons) Name() string {
+	return PolicyName
+}
+
+// Description returns the description for this policy.
+func (p *balloons) Description() string {
+	return PolicyDescription
+}
+
+// Start prepares this policy for accepting allocation/release requests.
+func (p *balloons) Start(add []cache.Container, del []cache.Container) error {
+	p.restoreCache()
+
+	if err := p.createMinBalloons(); err != nil {
+		return policyError("failed to start: %v", err)
+	}
+	p.saveState()
+	p.dumpBalloons()
+
+	// Containers of dropped cached balloons are not among the added ones,
+	// reallocate them along with the new containers.
+	add = append(add, p.unassignedContainers(p.cache.GetContainers(), add, del)...)
+
+	return p.Sync(add, del)
+}
+
+// Sync synchronizes the state of this policy.
+func (p *balloons) Sync(add []cache.Container, del []cache.Container) error {
+	var errors *multierror.Error
+
+	p.Debug("synchronizing state...")
+	for _, c := range del {
+		if err := p.ReleaseResources(c); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+	for _, c := range add {
+		if err := p.AllocateResources(c); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	return errors.ErrorOrNil()
+}
+
+// AllocateResources allocates resources for the given container.
+func (p *balloons) AllocateResources(c cache.Container) error {
+	id := c.GetCacheID()
+	if b := p.balloonByContainer(id); b != nil {
+		p.pinContainer(c, b)
+		return nil
+	}
+
+	if p.isCompletedInitContainer(c) {
+		p.Debug("not allocating completed init container %s", c.PrettyName())
+		return nil
+	}
+
+	def, err := p.chooseBalloonDef(c)
+	if err != nil {
+		return err
+	}
+
+	p.Debug("allocating container %s to a balloon of type %s...", c.PrettyName(), def.Name)
+
+	inherited := p.releaseInitContainers(c)
+	b, resized, err := p.addToBalloon(def, id, requestedMilliCPU(c), inherited...)
+	for _, ib := range inherited {
+		resized = append(resized, p.shrinkBalloon(ib)...)
+	}
+	if err != nil {
+		p.pinBalloons(resized)
+		p.saveState()
+		return policyError("failed to allocate %s: %v", c.PrettyName(), err)
+	}
+
+	p.Info("container %s assigned to balloon %s (CPUs %s)", c.PrettyName(), b, b.cpus)
+
+	p.pinContainer(c, b)
+	p.pinBalloons(resized)
+	p.saveState()
+
+	return nil
+}
+
+// ReleaseResources release resources assigned to the given container.
+func (p *balloons) ReleaseResources(c cache.Container) error {
+	id := c.GetCacheID()
+
+	p.Debug("releasing container %s...", c.PrettyName())
+
+	b, resized := p.removeFromBalloon(id)
+	if b == nil {
+		return nil
+	}
+
+	p.Info("container %s released from balloon %s", c.PrettyName(), b)
+
+	p.pinBalloons(resized)
+	p.saveState()
+
+	return nil
+}
+
+// UpdateResources is a resource allocation update request for this policy.
+func (p *balloons) UpdateResources(c cache.Container) error {
+	id := c.GetCacheID()
+	b := p.balloonByContainer(id)
+	if b == nil {
+		return nil
+	}
+
+	milliCPU := requestedMilliCPU(c)
+	if b.containers[id] == milliCPU {
+		return nil
+	}
+
+	p.Debug("updating container %s in balloon %s...", c.PrettyName(), b)
+
+	b.containers[id] = milliCPU
+	changed, err := p.resizeBalloon(b)
+	if err != nil {
+		p.Warn("failed to resize balloon %s: %v", b, err)
+	}
+	p.pinContainer(c, b)
+	if changed {
+		p.pinBalloons([]*balloon{b})
+	}
+	p.saveState()
+
+	return nil
+}
+
+// Rebalance tries to find an optimal allocation of resources for the current containers.
+func (p *balloons) Rebalance() (bool, error) {
+	p.Debug("(not) rebalancing containers...")
+	return false, nil
+}
+
+// HandleEvent handles policy-specific events.
+func (p *balloons) HandleEvent(*events.Policy) (bool, error) {
+	p.Debug("(not) handling event...")
+	return false, nil
+}
+
+// ExportResourceData provides resource data to export for the container.
+func (p *balloons) ExportResourceData(c cache.Container) map[string]string {
+	b := p.balloonByContainer(c.GetCacheID())
+	if b == nil {
+		return nil
+	}
+
+	return map[string]string{
+		policy.ExportSharedCPUs: b.cpus.String(),
+	}
+}
+
+// Introspect provides data for external introspection.
+func (p *balloons) Introspect(state *introspect.State) {
+	pools := make(map[string]*introspect.Pool, len(p.balloons))
+	assignments := make(map[string]*introspect.Assignment)
+	for _, b := range p.balloons {
+		pools[b.String()] = &introspect.Pool{
+			Name: b.String(),
+			CPUs: b.cpus.String(),
+		}
+		for id, milliCPU := range b.containers {
+			c, ok := p.cache.LookupContainer(id)
+			if !ok {
+				continue
+			}
+			assignments[c.GetID()] = &introspect.Assignment{
+				ContainerID: c.GetID(),
+				SharedCPUs:  b.cpus.String(),
+				CPUShare:    milliCPU,
+				Pool:        b.String(),
+			}
+		}
+	}
+	state.Pools = pools
+	state.Assignments = assignments
+}
+
+// policyError creates a formatted policy-specific error.
+func policyError(format string, args ...interface{}) error {
+	return fmt.Errorf(PolicyName+": "+format, args...)
+}
+
+// String returns the name of the balloon.
+func (b *balloon) String() string {
+	return b.def.Name + "[" + strconv.Itoa(b.instance) + "]"
+}
+
+// requested returns the total milli-CPU requested by the containers in the balloon.
+func (b *balloon) requested() int {
+	total := 0
+	for _, milliCPU := range b.containers {
+		total += milliCPU
+	}
+	return total
+}
+
+// neededCPUs returns the number of CPUs the balloon needs with extra milli-CPU added.
+func (b *balloon) neededCPUs(extra int) int {
+	needed := (b.requested() + extra + 999) / 1000
+	if needed == 0 && (len(b.containers) > 0 || extra > 0) {
+		// containers always need a CPU to run on
+		needed = 1
+	}
+	if needed < b.def.MinCPUs {
+		needed = b.def.MinCPUs
+	}
+	return needed
+}
+
+// fits checks if a container requesting milliCPU fits in the balloon.
+func (b *balloon) fits(milliCPU int) bool {
+	return b.def.MaxCPUs == 0 || b.neededCPUs(milliCPU) <= b.def.MaxCPUs
+}
+
+// setupCPUs sets up the reserved and the available CPUs.
+func (p *balloons) setupCPUs(available, reserved policy.ConstraintSet) error {
+	offline := p.sys.Offlined()
+
+	cpus, ok := available[policy.DomainCPU]
+	if !ok {
+		p.available = p.sys.CPUSet().Difference(offline)
+	} else {
+		p.available = cpus.(cpuset.CPUSet).Difference(offline)
+	}
+
+	cpus, ok = reserved[policy.DomainCPU]
+	if !ok {
+		return policyError("cannot start without any reserved CPUs")
+	}
+
+	switch cpus.(type) {
+	case cpuset.CPUSet:
+		p.reserved = cpus.(cpuset.CPUSet).Intersection(p.available)
+		if !p.reserved.Equals(cpus.(cpuset.CPUSet)) {
+			return policyError("part of the reserved CPUs (%s) are not available: %s",
+				cpus.(cpuset.CPUSet).String(), cpus.(cpuset.CPUSet).Difference(p.available))
+		}
+	case resource.Quantity:
+		qty := cpus.(resource.Quantity)
+		count := (int(qty.MilliValue()) + 999) / 1000
+		from := p.available
+		reservedCPUs, err := p.cpuAllocator.AllocateCpus(&from, count, false)
+		if err != nil {
+			return policyError("failed to reserve %d CPUs from %s: %v",
+				count, p.available.String(), err)
+		}
+		p.reserved = reservedCPUs
+	}
+
+	p.available = p.available.Difference(p.reserved)
+	p.free = p.available
+
+	return nil
+}
+
+// setBalloonDefs sets the balloon types from the configuration, adding the
+// reserved and default types if they are not configured.
+func (p *balloons) setBalloonDefs(o *options) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	bdefs := []*BalloonDef{}
+	reserved, dflt := false, false
+	for _, def := range o.BalloonTypes {
+		switch def.Name {
+		case reservedBalloonDefName:
+			// The reserved type is adjusted below, don't modify the configuration.
+			rdef := *def
+			def = &rdef
+			reserved = true
+		case defaultBalloonDefName:
+			dflt = true
+		}
+		bdefs = append(bdefs, def)
+	}
+	if !reserved {
+		bdefs = append([]*BalloonDef{{Name: reservedBalloonDefName}}, bdefs...)
+	}
+	if !dflt {
+		bdefs = append(bdefs, &BalloonDef{Name: defaultBalloonDefName, MinBalloons: 1})
+	}
+
+	// The reserved balloon is the single balloon with all the reserved CPUs.
+	for _, def := range bdefs {
+		if def.Name == reservedBalloonDefName {
+			def.MinCPUs = p.reserved.Size()
+			def.MaxCPUs = p.reserved.Size()
+			def.MinBalloons = 1
+			def.MaxBalloons = 1
+		}
+	}
+
+	p.bdefs = bdefs
+	return nil
+}
+
+// balloonDefByName returns the balloon type with the given name.
+func (p *balloons) balloonDefByName(name string) *BalloonDef {
+	for _, def := range p.bdefs {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// chooseBalloonDef chooses the balloon type for a container, by annotation,
+// by namespace or by the match expressions of balloon types, in this order.
+func (p *balloons) chooseBalloonDef(c cache.Container) (*BalloonDef, error) {
+	if name, ok := c.GetEffectiveAnnotation(BalloonKey); ok {
+		def := p.balloonDefByName(name)
+		if def == nil {
+			return nil, policyError("container %s: unknown balloon type %q", c.PrettyName(), name)
+		}
+		return def, nil
+	}
+
+	if c.GetNamespace() == metav1.NamespaceSystem {
+		return p.balloonDefByName(reservedBalloonDefName), nil
+	}
+
+	for _, def := range p.bdefs {
+		for _, pattern := range def.Namespaces {
+			if match, _ := filepath.Match(pattern, c.GetNamespace()); match {
+				return def, nil
+			}
+		}
+		for _, expr := range def.MatchExpressions {
+			if expr.Evaluate(c) {
+				return def, nil
+			}
+		}
+	}
+
+	return p.balloonDefByName(defaultBalloonDefName), nil
+}
+
+// balloonByContainer returns the balloon a container is assigned to.
+func (p *balloons) balloonByContainer(id string) *balloon {
+	for _, b := range p.balloons {
+		if _, ok := b.containers[id]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// unassignedContainers returns the containers without a balloon, skipping
+// the ones in the given lists.
+func (p *balloons) unassignedContainers(containers []cache.Container, skip ...[]cache.Container) []cache.Container {
+	ids := map[string]struct{}{}
+	for _, list := range skip {
+		for _, c := range list {
+			ids[c.GetCacheID()] = struct{}{}
+		}
+	}
+	unassigned := []cache.Container{}
+	for _, c := range containers {
+		id := c.GetCacheID()
+		if _, ok := ids[id]; ok {
+			continue
+		}
+		if p.balloonByContainer(id) == nil {
+			p.Info("reassigning container %s without a balloon", c.PrettyName())
+			unassigned = append(unassigned, c)
+		}
+	}
+	return unassigned
+}
+
+// balloonsByDef returns the balloons of the given type.
+func (p *balloons) balloonsByDef(def *BalloonDef) []*balloon {
+	balloons := []*balloon{}
+	for _, b := range p.balloons {
+		if b.def == def {
+			balloons = append(balloons, b)
+		}
+	}
+	return balloons
+}
+
+// createMinBalloons creates the minimum number of balloons of each type.
+func (p *balloons) createMinBalloons() error {
+	for _, def := range p.bdefs {
+		for len(p.balloonsByDef(def)) < def.MinBalloons {
+			if _, err := p.newBalloon(def); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newBalloon creates a new balloon of the given type with its minimum CPUs.
+func (p *balloons) newBalloon(def *BalloonDef) (*balloon, error) {
+	instance := 0
+	for _, b := range p.balloonsByDef(def) {
+		if b.instance >= instance {
+			instance = b.instance + 1
+		}
+	}
+
+	b := &balloon{
+		def:        def,
+		instance:   instance,
+		containers: make(map[string]int),
+	}
+
+	if def.Name == reservedBalloonDefName {
+		b.cpus = p.reserved
+	} else {
+		cpus, err := p.takeCPUs(cpuset.NewCPUSet(), def.MinCPUs, def)
+		if err != nil {
+			return nil, policyError("failed to create balloon %s: %v", b, err)
+		}
+		b.cpus = cpus
+	}
+
+	p.balloons = append(p.balloons, b)
+	p.Info("created balloon %s with CPUs %s", b, b.cpus)
+
+	return b, nil
+}
+
+// addToBalloon adds a container to a balloon of the given type, creating a
+// new balloon if no existing one can fit it. Preferred balloons fitting the
+// container are used first. It returns the balloon and the balloons whose
+// CPUs changed.
+func (p *balloons) addToBalloon(def *BalloonDef, id string, milliCPU int, prefer ...*balloon) (*balloon, []*balloon, error) {
+	var b *balloon
+	created := false
+
+	candidates := []*balloon{}
+	for _, cand := range p.balloonsByDef(def) {
+		if def.Name == reservedBalloonDefName {
+			// the reserved balloon is shared by all system containers
+			candidates = append(candidates, cand)
+			break
+		}
+		if cand.fits(milliCPU) && cand.neededCPUs(milliCPU)-cand.cpus.Size() <= p.free.Size() {
+			candidates = append(candidates, cand)
+		}
+	}
+
+	// prefer the preferred balloons, then the one with the most spare capacity
+	preferred := func(b *balloon) bool {
+		for _, pb := range prefer {
+			if pb == b {
+				return true
+			}
+		}
+		return false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if pi, pj := preferred(ci), preferred(cj); pi != pj {
+			return pi
+		}
+		return 1000*ci.cpus.Size()-ci.requested() > 1000*cj.cpus.Size()-cj.requested()
+	})
+
+	if len(candidates) > 0 {
+		b = candidates[0]
+	} else {
+		if def.MaxBalloons > 0 && len(p.balloonsByDef(def)) >= def.MaxBalloons {
+			return nil, nil, policyError("all %d balloons of type %s are full",
+				def.MaxBalloons, def.Name)
+		}
+		needed := (milliCPU + 999) / 1000
+		if needed < def.MinCPUs {
+			needed = def.MinCPUs
+		}
+		if def.MaxCPUs > 0 && needed > def.MaxCPUs {
+			return nil, nil, policyError("%d mCPU does not fit in a balloon of type %s (max %d CPUs)",
+				milliCPU, def.Name, def.MaxCPUs)
+		}
+		if needed > p.free.Size() {
+			return nil, nil, policyError("not enough free CPUs (%d) for a new balloon of type %s",
+				p.free.Size(), def.Name)
+		}
+		nb, err := p.newBalloon(def)
+		if err != nil {
+			return nil, nil, err
+		}
+		b = nb
+		created = true
+	}
+
+	b.containers[id] = milliCPU
+
+	resized := []*balloon{}
+	changed, err := p.resizeBalloon(b)
+	if err != nil {
+		delete(b.containers, id)
+		if created {
+			p.deleteBalloon(b)
+		}
+		return nil, nil, err
+	}
+	if changed {
+		resized = append(resized, b)
+	}
+
+	return b, resized, nil
+}
+
+// removeFromBalloon removes a container from its balloon, deflating or
+// deleting the balloon. It returns the balloon and the balloons whose CPUs
+// changed.
+func (p *balloons) removeFromBalloon(id string) (*balloon, []*balloon) {
+	b := p.balloonByContainer(id)
+	if b == nil {
+		return nil, nil
+	}
+
+	delete(b.containers, id)
+
+	return b, p.shrinkBalloon(b)
+}
+
+// shrinkBalloon deletes a balloon left without containers, or deflates it to
+// the CPUs its containers need. It returns the balloon if its CPUs changed.
+func (p *balloons) shrinkBalloon(b *balloon) []*balloon {
+	if len(b.containers) == 0 && len(p.balloonsByDef(b.def)) > b.def.MinBalloons {
+		p.deleteBalloon(b)
+		return nil
+	}
+
+	if changed, err := p.resizeBalloon(b); err != nil {
+		p.Warn("failed to deflate balloon %s: %v", b, err)
+	} else if changed {
+		return []*balloon{b}
+	}
+
+	return nil
+}
+
+// deleteBalloon deletes an empty balloon, returning its CPUs to the free ones.
+func (p *balloons) deleteBalloon(b *balloon) {
+	for idx, o := range p.balloons {
+		if o == b {
+			p.balloons = append(p.balloons[:idx], p.balloons[idx+1:]...)
+			break
+		}
+	}
+	p.free = p.free.Union(b.cpus)
+	p.Info("deleted balloon %s, freed CPUs %s", b, b.cpus)
+}
+
+// resizeBalloon inflates or deflates a balloon to the number of CPUs its
+// containers need. It returns whether the CPUs of the balloon changed.
+func (p *balloons) resizeBalloon(b *balloon) (bool, error) {
+	if b.def.Name == reservedBalloonDefName {
+		return false, nil
+	}
+
+	target := b.neededCPUs(0)
+	if b.def.MaxCPUs > 0 && target > b.def.MaxCPUs {
+		p.Warn("balloon %s needs %d CPUs, more than its maximum %d",
+			b, target, b.def.MaxCPUs)
+		target = b.def.MaxCPUs
+	}
+
+	switch size := b.cpus.Size(); {
+	case target > size:
+		cpus, err := p.takeCPUs(b.cpus, target-size, b.def)
+		if err != nil {
+			return false, policyError("failed to inflate balloon %s by %d CPUs: %v",
+				b, target-size, err)
+		}
+		b.cpus = b.cpus.Union(cpus)
+		p.Info("inflated balloon %s by %s to %s", b, cpus, b.cpus)
+
+	case target < size:
+		from := b.cpus
+		kept, err := p.cpuAllocator.AllocateCpusWithFlags(&from, target, false, p.allocFlags(b.def))
+		if err != nil {
+			return false, policyError("failed to deflate balloon %s to %d CPUs: %v",
+				b, target, err)
+		}
+		released := b.cpus.Difference(kept)
+		b.cpus = kept
+		p.free = p.free.Union(released)
+		p.Info("deflated balloon %s by %s to %s", b, released, b.cpus)
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// takeCPUs takes cnt free CPUs for a balloon of the given type, preferring
+// CPUs in the same physical packages as the CPUs it already has.
+func (p *balloons) takeCPUs(near cpuset.CPUSet, cnt int, def *BalloonDef) (cpuset.CPUSet, error) {
+	if cnt == 0 {
+		return cpuset.NewCPUSet(), nil
+	}
+
+	flags := p.allocFlags(def)
+
+	if !near.IsEmpty() {
+		local := cpuset.NewCPUSet()
+		for _, pkg := range p.packages {
+			if !pkg.Intersection(near).IsEmpty() {
+				local = local.Union(pkg)
+			}
+		}
+		local = local.Intersection(p.free)
+		if local.Size() >= cnt {
+			if cpus, err := p.cpuAllocator.AllocateCpusWithFlags(&local, cnt, false, flags); err == nil {
+				p.free = p.free.Difference(cpus)
+				return cpus, nil
+			}
+		}
+	}
+
+	free := p.free
+	cpus, err := p.cpuAllocator.AllocateCpusWithFlags(&free, cnt, false, flags)
+	if err != nil {
+		return cpuset.NewCPUSet(), err
+	}
+	p.free = p.free.Difference(cpus)
+
+	return cpus, nil
+}
+
+// allocFlags returns the CPU allocator flags for balloons of the given type.
+func (p *balloons) allocFlags(def *BalloonDef) cpuallocator.AllocFlag {
+	if def.PreferCoreType == "" {
+		return cpuallocator.AllocDefault
+	}
+	kind, err := sysfs.ParseCoreKind(def.PreferCoreType)
+	if err != nil {
+		return cpuallocator.AllocDefault
+	}
+	return cpuallocator.CoreKindFlags(kind)
+}
+
+// pinContainer pins a container to the CPUs of its balloon.
+func (p *balloons) pinContainer(c cache.Container, b *balloon) {
+	c.SetCpusetCpus(b.cpus.String())
+	c.SetCPUShares(int64(cache.MilliCPUToShares(b.containers[c.GetCacheID()])))
+}
+
+// pinBalloons re-pins all containers of the given balloons.
+func (p *balloons) pinBalloons(balloons []*balloon) {
+	for _, b := range balloons {
+		for id := range b.containers {
+			if c, ok := p.cache.LookupContainer(id); ok {
+				p.pinContainer(c, b)
+			}
+		}
+	}
+}
+
+// requestedMilliCPU returns the milli-CPU requested by a container.
+func requestedMilliCPU(c cache.Container) int {
+	if req, ok := c.GetResourceRequirements().Requests[corev1.ResourceCPU]; ok {
+		return int(req.MilliValue())
+	}
+	return 0
+}
+
+// configNotify applies changes to the balloon types.
+func (p *balloons) configNotify(event config.Event, source config.Source) error {
+	p.Info("configuration %s", event)
+
+	old := p.bdefs
+	if err := p.setBalloonDefs(opt); err != nil {
+		p.Error("invalid configuration: %v", err)
+		return err
+	}
+
+	// Move existing balloons to the new types, balloons of removed
+	// types keep their old type until they are deleted.
+	for _, b := range p.balloons {
+		if def := p.balloonDefByName(b.def.Name); def != nil {
+			b.def = def
+		}
+	}
+	for _, b := range p.balloons {
+		if changed, err := p.resizeBalloon(b); err != nil {
+			p.Warn("failed to resize balloon %s: %v", b, err)
+		} else if changed {
+			p.pinBalloons([]*balloon{b})
+		}
+	}
+	if err := p.createMinBalloons(); err != nil {
+		p.Warn("failed to create balloons: %v", err)
+	}
+
+	p.Debug("balloon types changed from %d to %d types", len(old), len(p.bdefs))
+	p.saveState()
+	p.dumpBalloons()
+
+	return nil
+}
+
+// dumpBalloons dumps the current balloons.
+func (p *balloons) dumpBalloons() {
+	p.Info("current balloons:")
+	for _, b := range p.balloons {
+		p.Info("  %s: CPUs %s, %d containers requesting %d mCPU",
+			b, b.cpus, len(b.containers), b.requested())
+	}
+	p.Info("  free CPUs: %s", p.free)
+}
+
+// saveState saves the balloons in the cache.
+func (p *balloons) saveState() {
+	p.cache.SetPolicyEntry(keyBalloons, cache.Cachable(&cachedBalloons{b: p.savedBalloons()}))
+}
+
+// restoreCache restores the balloons from the cache.
+func (p *balloons) restoreCache() {
+	cb := cachedBalloons{}
+	if !p.cache.GetPolicyEntry(keyBalloons, &cb) {
+		p.Warn("initializing empty policy state...")
+		return
+	}
+
+	p.Info("restoring cached policy state...")
+	p.restoreBalloons(cb.b)
+}
+
+// savedBalloons returns the balloons in their cachable form.
+func (p *balloons) savedBalloons() []*savedBalloon {
+	saved := make([]*savedBalloon, 0, len(p.balloons))
+	for _, b := range p.balloons {
+		sb := &savedBalloon{
+			Type:       b.def.Name,
+			Instance:   b.instance,
+			CPUs:       b.cpus.String(),
+			Containers: make(map[string]int, len(b.containers)),
+		}
+		for id, milliCPU := range b.containers {
+			sb.Containers[id] = milliCPU
+		}
+		saved = append(saved, sb)
+	}
+	return saved
+}
+
+// restoreBalloons restores balloons from their cachable form. Balloons of
+// unknown types and CPUs no longer available are dropped, and the containers
+// of dropped balloons get reallocated once they are synchronized.
+func (p *balloons) restoreBalloons(saved []*savedBalloon) {
+	p.balloons = nil
+	p.free = p.available
+
+	for _, sb := range saved {
+		def := p.balloonDefByName(sb.Type)
+		if def == nil {
+			p.Warn("dropping cached balloon %s[%d] of unknown type", sb.Type, sb.Instance)
+			continue
+		}
+		cpus, err := cpuset.Parse(sb.CPUs)
+		if err != nil {
+			p.Warn("dropping cached balloon %s[%d]: %v", sb.Type, sb.Instance, err)
+			continue
+		}
+		if def.Name == reservedBalloonDefName {
+			cpus = p.reserved
+		} else if !cpus.IsSubsetOf(p.free) {
+			p.Warn("dropping cached balloon %s[%d], CPUs %s are not available",
+				sb.Type, sb.Instance, cpus)
+			continue
+		}
+		b := &balloon{
+			def:        def,
+			instance:   sb.Instance,
+			cpus:       cpus,
+			containers: make(map[string]int, len(sb.Containers)),
+		}
+		for id, milliCPU := range sb.Containers {
+			if p.cache != nil {
+				if _, ok := p.cache.LookupContainer(id); !ok {
+					continue
+				}
+			}
+			b.containers[id] = milliCPU
+		}
+		p.free = p.free.Difference(b.cpus)
+		p.balloons = append(p.balloons, b)
+	}
+}
+
+//
+// Cachable data types for storing private balloons policy data in the cache.
+//
+
+type savedBalloon struct {
+	Type       string
+	Instance   int
+	CPUs       string
+	Containers map[string]int
+}
+
+type cachedBalloons struct {
+	b []*savedBalloon
+}
+
+var _ cache.Cachable = &cachedBalloons{}
+
+var _ json.Marshaler = &cachedBalloons{}
+var _ json.Unmarshaler = &cachedBalloons{}
+
+func (cb *cachedBalloons) Get() interface{} {
+	return *cb
+}
+
+func (cb *cachedBalloons) Set(value interface{}) {
+	switch value.(type) {
+	case cachedBalloons:
+		cb.b = value.(cachedBalloons).b
+	case *cachedBalloons:
+		cb.b = value.(*cachedBalloons).b
+	}
+}
+
+func (cb *cachedBalloons) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cb.b)
+}
+
+func (cb *cachedBalloons) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &cb.b)
+}
+
+// Register us as a policy implementation.
+func init() {
+	policy.Register(PolicyName, PolicyDescription, CreateBalloonsPolicy)
+}
@@ -0,0 +1,285 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balloons
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+	fakecpuallocator "github.com/intel/cri-resource-manager/pkg/cpuallocator/fake"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+)
+
+// failingCPUAllocator fails all CPU allocations.
+type failingCPUAllocator struct {
+	fakecpuallocator.CPUAllocator
+}
+
+func (f *failingCPUAllocator) AllocateCpusWithFlags(from *cpuset.CPUSet, cnt int, _ bool, _ cpuallocator.AllocFlag) (cpuset.CPUSet, error) {
+	return cpuset.NewCPUSet(), fmt.Errorf("cannot allocate %d CPUs from %s", cnt, from)
+}
+
+// testPod is a pod with only init and application containers.
+type testPod struct {
+	cache.Pod
+	init       []cache.Container
+	containers []cache.Container
+}
+
+func (p *testPod) GetInitContainers() []cache.Container {
+	return p.init
+}
+
+func (p *testPod) GetContainers() []cache.Container {
+	return p.containers
+}
+
+func (p *testPod) GetPodResourceRequirements() cache.PodResourceRequirements {
+	init := map[string]corev1.ResourceRequirements{}
+	for _, c := range p.init {
+		init[c.GetName()] = corev1.ResourceRequirements{}
+	}
+	return cache.PodResourceRequirements{InitContainers: init}
+}
+
+// testContainer is a container with only an ID and, optionally, a pod and a state.
+type testContainer struct {
+	cache.Container
+	id    string
+	pod   *testPod
+	state cache.ContainerState
+}
+
+func (c *testContainer) GetCacheID() string {
+	return c.id
+}
+
+func (c *testContainer) GetName() string {
+	return c.id
+}
+
+func (c *testContainer) GetPod() (cache.Pod, bool) {
+	return c.pod, c.pod != nil
+}
+
+func (c *testContainer) GetState() cache.ContainerState {
+	return c.state
+}
+
+func (c *testContainer) PrettyName() string {
+	return c.id
+}
+
+// newTestPolicy creates a policy with CPU 0 reserved and CPUs 1-7 available.
+func newTestPolicy(t *testing.T, bdefs ...*BalloonDef) *balloons {
+	p := &balloons{
+		Logger:       logger.NewLogger(PolicyName),
+		cpuAllocator: fakecpuallocator.NewCPUAllocator(1),
+		reserved:     cpuset.NewCPUSet(0),
+		available:    cpuset.MustParse("1-7"),
+		free:         cpuset.MustParse("1-7"),
+		packages:     []cpuset.CPUSet{cpuset.MustParse("0-3"), cpuset.MustParse("4-7")},
+	}
+	if err := p.setBalloonDefs(&options{BalloonTypes: bdefs}); err != nil {
+		t.Fatalf("failed to set balloon types: %v", err)
+	}
+	if err := p.createMinBalloons(); err != nil {
+		t.Fatalf("failed to create balloons: %v", err)
+	}
+	return p
+}
+
+func TestBalloonInflateDeflate(t *testing.T) {
+	p := newTestPolicy(t, &BalloonDef{Name: "latency", MaxCPUs: 3})
+	def := p.balloonDefByName("latency")
+
+	b, _, err := p.addToBalloon(def, "c1", 500)
+	if err != nil {
+		t.Fatalf("failed to add c1: %v", err)
+	}
+	if b.cpus.Size() != 1 {
+		t.Errorf("expected balloon %s with 1 CPU, got %s", b, b.cpus)
+	}
+
+	if b2, resized, err := p.addToBalloon(def, "c2", 1000); err != nil || b2 != b || len(resized) != 1 {
+		t.Fatalf("expected c2 to inflate balloon %s, got %v, %v, %v", b, b2, resized, err)
+	}
+	if b.cpus.Size() != 2 {
+		t.Errorf("expected balloon %s inflated to 2 CPUs, got %s", b, b.cpus)
+	}
+
+	// c3 does not fit in the maximum 3 CPUs, a new balloon is created
+	b3, _, err := p.addToBalloon(def, "c3", 2000)
+	if err != nil {
+		t.Fatalf("failed to add c3: %v", err)
+	}
+	if b3 == b || b3.instance != 1 || !b3.cpus.Intersection(b.cpus).IsEmpty() {
+		t.Errorf("expected c3 in a new disjoint balloon, got %s (%s) and %s (%s)",
+			b3, b3.cpus, b, b.cpus)
+	}
+
+	if _, resized := p.removeFromBalloon("c2"); len(resized) != 1 || b.cpus.Size() != 1 {
+		t.Errorf("expected balloon %s deflated to 1 CPU, got %s", b, b.cpus)
+	}
+
+	// the now empty second balloon is deleted, freeing its CPUs
+	free := p.free.Size()
+	p.removeFromBalloon("c3")
+	if len(p.balloonsByDef(def)) != 1 || p.free.Size() != free+2 {
+		t.Errorf("expected balloon %s to be deleted, balloons: %v, free CPUs %s",
+			b3, p.balloonsByDef(def), p.free)
+	}
+}
+
+func TestBalloonLimits(t *testing.T) {
+	p := newTestPolicy(t,
+		&BalloonDef{Name: "throughput", MinCPUs: 2, MaxCPUs: 2, MinBalloons: 1, MaxBalloons: 2})
+	def := p.balloonDefByName("throughput")
+
+	balloons := p.balloonsByDef(def)
+	if len(balloons) != 1 || balloons[0].cpus.Size() != 2 {
+		t.Fatalf("expected a minimum balloon with 2 CPUs, got %v", balloons)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, _, err := p.addToBalloon(def, fmt.Sprintf("c%d", i), 1000); err != nil {
+			t.Fatalf("failed to add container c%d: %v", i, err)
+		}
+	}
+	if _, _, err := p.addToBalloon(def, "c4", 1000); err == nil {
+		t.Errorf("expected an error adding to full balloons %v", p.balloonsByDef(def))
+	}
+
+	if _, _, err := p.addToBalloon(p.balloonDefByName(defaultBalloonDefName), "c5", 4000); err == nil {
+		t.Errorf("expected an error allocating more than the free CPUs %s", p.free)
+	}
+
+	// the reserved balloon is never resized
+	reserved := p.balloonDefByName(reservedBalloonDefName)
+	if b, resized, err := p.addToBalloon(reserved, "c6", 3000); err != nil || len(resized) != 0 ||
+		!b.cpus.Equals(p.reserved) {
+		t.Errorf("expected c6 in the unresized reserved balloon, got %v, %v, %v", b, resized, err)
+	}
+}
+
+func TestFailedNewBalloon(t *testing.T) {
+	p := newTestPolicy(t, &BalloonDef{Name: "latency"})
+	def := p.balloonDefByName("latency")
+	p.cpuAllocator = &failingCPUAllocator{}
+
+	balloons := len(p.balloons)
+	if _, _, err := p.addToBalloon(def, "c1", 1000); err == nil {
+		t.Fatalf("expected an error inflating a new balloon with a failing allocator")
+	}
+	if len(p.balloons) != balloons || !p.free.Equals(p.available) {
+		t.Errorf("expected the failed new balloon to be deleted, balloons: %v, free CPUs %s",
+			p.balloons, p.free)
+	}
+}
+
+func TestUnassignedContainers(t *testing.T) {
+	p := newTestPolicy(t, &BalloonDef{Name: "latency"})
+	def := p.balloonDefByName("latency")
+
+	if _, _, err := p.addToBalloon(def, "c1", 1000); err != nil {
+		t.Fatalf("failed to add c1: %v", err)
+	}
+	containers := []cache.Container{}
+	for _, id := range []string{"c1", "c2", "c3", "c4"} {
+		containers = append(containers, &testContainer{id: id})
+	}
+
+	unassigned := p.unassignedContainers(containers, containers[2:3], containers[3:])
+	if len(unassigned) != 1 || unassigned[0].GetCacheID() != "c2" {
+		t.Errorf("expected only c2 to be unassigned, got %v", unassigned)
+	}
+}
+
+func TestReservedBalloonDef(t *testing.T) {
+	reserved := &BalloonDef{Name: reservedBalloonDefName, MaxCPUs: 4}
+	p := newTestPolicy(t, reserved)
+
+	def := p.balloonDefByName(reservedBalloonDefName)
+	if def == reserved {
+		t.Fatalf("expected the reserved balloon type to be a copy of the configured one")
+	}
+	if def.MinCPUs != 1 || def.MaxCPUs != 1 {
+		t.Errorf("expected reserved balloon type of 1 CPU, got %d-%d CPUs", def.MinCPUs, def.MaxCPUs)
+	}
+	if reserved.MinCPUs != 0 || reserved.MaxCPUs != 4 || reserved.MaxBalloons != 0 {
+		t.Errorf("configured reserved balloon type modified: %+v", *reserved)
+	}
+}
+
+func TestInitContainerBalloons(t *testing.T) {
+	p := newTestPolicy(t, &BalloonDef{Name: "latency"})
+	def := p.balloonDefByName("latency")
+
+	pod := &testPod{}
+	ic := &testContainer{id: "init0", pod: pod}
+	c0 := &testContainer{id: "ctr0", pod: pod}
+	pod.init = []cache.Container{ic}
+	pod.containers = []cache.Container{c0}
+
+	b, _, err := p.addToBalloon(def, ic.id, 3000)
+	if err != nil {
+		t.Fatalf("failed to add %s: %v", ic.id, err)
+	}
+	initCPUs := b.cpus
+
+	// an idle balloon with more spare capacity than the inherited one
+	idle, err := p.newBalloon(def)
+	if err != nil {
+		t.Fatalf("failed to create idle balloon: %v", err)
+	}
+	if idle.cpus, err = p.takeCPUs(idle.cpus, 4, def); err != nil {
+		t.Fatalf("failed to inflate idle balloon: %v", err)
+	}
+
+	if p.isCompletedInitContainer(ic) {
+		t.Errorf("expected running %s not to be completed", ic.id)
+	}
+
+	inherited := p.releaseInitContainers(c0)
+	if len(inherited) != 1 || inherited[0] != b || b.cpus.Size() != 3 {
+		t.Fatalf("expected balloon %s with 3 CPUs inherited, got %v", b, inherited)
+	}
+
+	got, _, err := p.addToBalloon(def, c0.id, 2000, inherited...)
+	if err != nil {
+		t.Fatalf("failed to add %s: %v", c0.id, err)
+	}
+	for _, ib := range inherited {
+		p.shrinkBalloon(ib)
+	}
+	if got != b {
+		t.Errorf("expected %s in inherited balloon %s, got %s", c0.id, b, got)
+	}
+	if b.cpus.Size() != 2 || !b.cpus.IsSubsetOf(initCPUs) {
+		t.Errorf("expected %s to inherit 2 of CPUs %s, got %s", c0.id, initCPUs, b.cpus)
+	}
+	if _, ok := b.containers[ic.id]; ok {
+		t.Errorf("expected %s to be released from balloon %s", ic.id, b)
+	}
+
+	if !p.isCompletedInitContainer(ic) {
+		t.Errorf("expected %s to be completed once %s is allocated", ic.id, c0.id)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019-2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balloons
+
+import (
+	"path/filepath"
+
+	"github.com/intel/cri-resource-manager/pkg/apis/resmgr"
+	"github.com/intel/cri-resource-manager/pkg/config"
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+// options captures our configurable policy parameters.
+type options struct {
+	// BalloonTypes are the types of balloons containers are assigned to.
+	BalloonTypes []*BalloonDef `json:"BalloonTypes,omitempty"`
+}
+
+// BalloonDef describes a type of balloons.
+type BalloonDef struct {
+	// Name of the balloon type, also used for selecting it by annotation.
+	Name string `json:"Name"`
+	// MinCPUs is the minimum number of CPUs in a balloon of this type.
+	MinCPUs int `json:"MinCPUs"`
+	// MaxCPUs is the maximum number of CPUs in a balloon of this type, 0 for no limit.
+	MaxCPUs int `json:"MaxCPUs"`
+	// MinBalloons is the number of balloons of this type created beforehand.
+	MinBalloons int `json:"MinBalloons"`
+	// MaxBalloons is the maximum number of balloons of this type, 0 for no limit.
+	MaxBalloons int `json:"MaxBalloons"`
+	// PreferCoreType selects performance or efficient cores for the balloons, if available.
+	PreferCoreType string `json:"PreferCoreType,omitempty"`
+	// Namespaces are the namespaces (glob patterns) of containers assigned to this type.
+	Namespaces []string `json:"Namespaces,omitempty"`
+	// MatchExpressions assign containers matching any of them to this type.
+	MatchExpressions []*resmgr.Expression `json:"MatchExpressions,omitempty"`
+}
+
+// Our runtime configuration.
+var opt = defaultOptions().(*options)
+
+// defaultOptions returns a new options instance, all initialized to defaults.
+func defaultOptions() interface{} {
+	return &options{}
+}
+
+// validate checks the balloon types for (obvious) invalidity.
+func (o *options) validate() error {
+	names := map[string]struct{}{}
+	for _, def := range o.BalloonTypes {
+		if def == nil || def.Name == "" {
+			return policyError("balloon types must have a name")
+		}
+		if _, ok := names[def.Name]; ok {
+			return policyError("duplicate balloon type %q", def.Name)
+		}
+		names[def.Name] = struct{}{}
+
+		if def.MinCPUs < 0 || def.MaxCPUs < 0 || def.MinBalloons < 0 || def.MaxBalloons < 0 {
+			return policyError("balloon type %q: negative limits", def.Name)
+		}
+		if def.MaxCPUs > 0 && def.MinCPUs > def.MaxCPUs {
+			return policyError("balloon type %q: MinCPUs (%d) > MaxCPUs (%d)",
+				def.Name, def.MinCPUs, def.MaxCPUs)
+		}
+		if def.MaxBalloons > 0 && def.MinBalloons > def.MaxBalloons {
+			return policyError("balloon type %q: MinBalloons (%d) > MaxBalloons (%d)",
+				def.Name, def.MinBalloons, def.MaxBalloons)
+		}
+		if def.PreferCoreType != "" {
+			if _, err := sysfs.ParseCoreKind(def.PreferCoreType); err != nil {
+				return policyError("balloon type %q: %v", def.Name, err)
+			}
+		}
+		for _, pattern := range def.Namespaces {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return policyError("balloon type %q: invalid namespace pattern %q: %v",
+					def.Name, pattern, err)
+			}
+		}
+		for _, expr := range def.MatchExpressions {
+			if err := expr.Validate(); err != nil {
+				return policyError("balloon type %q: %v", def.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Register us for configuration handling.
+func init() {
+	config.Register(PolicyPath, PolicyDescription, opt, defaultOptions)
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package balloons
+
+import (
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+)
+
+//
+// Init containers of a pod run to completion, one at a time, before any of
+// the application containers is created. Once the first application container
+// of a pod is allocated, the init containers are removed from their balloons,
+// which are kept inflated until the application container has joined one of
+// them. This way the application containers inherit the CPUs of the init
+// containers, and the pod only ever accounts for max(init, sum(app)) CPUs,
+// like the effective request used by kubelet.
+//
+
+// isInitContainer checks if a container is an init container of its pod.
+func isInitContainer(c cache.Container) bool {
+	pod, ok := c.GetPod()
+	if !ok {
+		return false
+	}
+	_, ok = pod.GetPodResourceRequirements().InitContainers[c.GetName()]
+	return ok
+}
+
+// isCompletedInitContainer checks if a container is an init container which
+// has already completed.
+func (p *balloons) isCompletedInitContainer(c cache.Container) bool {
+	if !isInitContainer(c) {
+		return false
+	}
+	if c.GetState() == cache.ContainerStateExited {
+		return true
+	}
+
+	pod, _ := c.GetPod()
+	for _, other := range pod.GetContainers() {
+		if p.balloonByContainer(other.GetCacheID()) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseInitContainers removes the init containers of the pod of an
+// application container from their balloons, without deflating them. It
+// returns the balloons of the init containers, which the caller needs to
+// shrink once the application container is allocated.
+func (p *balloons) releaseInitContainers(c cache.Container) []*balloon {
+	if isInitContainer(c) {
+		return nil
+	}
+	pod, ok := c.GetPod()
+	if !ok {
+		return nil
+	}
+
+	inherited := []*balloon{}
+	for _, ic := range pod.GetInitContainers() {
+		b := p.balloonByContainer(ic.GetCacheID())
+		if b == nil {
+			continue
+		}
+
+		p.Info("releasing completed init container %s for %s", ic.PrettyName(), c.PrettyName())
+
+		delete(b.containers, ic.GetCacheID())
+
+		found := false
+		for _, ib := range inherited {
+			if ib == b {
+				found = true
+				break
+			}
+		}
+		if !found {
+			inherited = append(inherited, b)
+		}
+	}
+
+	return inherited
+}
@@ -93,6 +93,7 @@ type cachedGrant struct {
 	Memset      system.IDSet
 	MemoryLimit memoryMap
 	ColdStart   time.Duration
+	Stages      []ColdStartStage `json:",omitempty"`
 }
 
 func newCachedGrant(cg Grant) *cachedGrant {
@@ -111,6 +112,7 @@ func newCachedGrant(cg Grant) *cachedGrant {
 	}
 
 	ccg.ColdStart = cg.ColdStart()
+	ccg.Stages = cg.ColdStartStages()
 
 	return ccg
 }
@@ -133,7 +135,7 @@ func (ccg *cachedGrant) ToGrant(policy *policy) (Grant, error) {
 		ccg.MemType,
 		ccg.MemType,
 		ccg.MemoryLimit,
-		ccg.ColdStart,
+		ccg.coldStartStages(),
 	)
 
 	if g.Memset().String() != ccg.Memset.String() {
@@ -144,6 +146,15 @@ func (ccg *cachedGrant) ToGrant(policy *policy) (Grant, error) {
 	return g, nil
 }
 
+// coldStartStages returns the cached cold start stages of the grant, falling
+// back to a PMEM-only cold start for caches which only have its duration.
+func (ccg *cachedGrant) coldStartStages() []ColdStartStage {
+	if len(ccg.Stages) > 0 {
+		return ccg.Stages
+	}
+	return pmemColdStart(ccg.ColdStart)
+}
+
 func (cg *grant) MarshalJSON() ([]byte, error) {
 	return json.Marshal(newCachedGrant(cg))
 }
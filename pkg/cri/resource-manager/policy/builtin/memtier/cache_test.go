@@ -16,7 +16,11 @@ package memtier
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
 
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
@@ -139,3 +143,29 @@ func TestAllocationMarshalling(t *testing.T) {
 		})
 	}
 }
+
+func TestCachedColdStartStages(t *testing.T) {
+	stages := []ColdStartStage{
+		{Duration: config.Duration(30 * time.Second), MemoryType: memoryPMEM},
+		{Duration: config.Duration(time.Minute), MemoryType: memoryDRAM | memoryPMEM, CPUShare: 500},
+	}
+	data, err := json.Marshal(&cachedGrant{ColdStart: coldStartDuration(stages), Stages: stages})
+	if err != nil {
+		t.Fatalf("failed to marshal cached grant: %v", err)
+	}
+	ccg := &cachedGrant{}
+	if err := json.Unmarshal(data, ccg); err != nil {
+		t.Fatalf("failed to unmarshal cached grant: %v", err)
+	}
+	restored := ccg.coldStartStages()
+	if len(restored) != 2 || restored[1].CPUShare != 500 || time.Duration(restored[1].Duration) != time.Minute {
+		t.Errorf("expected cold start stages %+v, got %+v", stages, restored)
+	}
+
+	// Caches without stages only have the duration of a PMEM-only cold start.
+	old := &cachedGrant{ColdStart: 10 * time.Second}
+	restored = old.coldStartStages()
+	if len(restored) != 1 || restored[0].MemoryType != memoryPMEM || time.Duration(restored[0].Duration) != 10*time.Second {
+		t.Errorf("expected a single PMEM-only stage, got %+v", restored)
+	}
+}
@@ -17,29 +17,74 @@ package memtier
 import (
 	"time"
 
+	resapi "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
 )
 
+// ColdStartProfile is a named sequence of cold start stages. A container
+// goes through the stages in order, after the last one it gets its full
+// memory set, top tier limit and CPU share.
+type ColdStartProfile []ColdStartStage
+
+// ColdStartStage describes the resources of a container during one stage
+// of its cold start.
+type ColdStartStage struct {
+	// Duration is how long the stage lasts.
+	Duration config.Duration `json:"Duration"`
+	// MemoryType is the types of memory to use during the stage, all granted types if unset.
+	MemoryType memoryType `json:"MemoryType,omitempty"`
+	// ToptierLimit is the top tier memory limit during the stage, if any.
+	ToptierLimit *resapi.Quantity `json:"ToptierLimit,omitempty"`
+	// CPUShare is the CPU share (in milli-CPU) during the stage, if any.
+	CPUShare int `json:"CPUShare,omitempty"`
+}
+
+// pmemColdStart returns a single-stage PMEM-only cold start of the given duration.
+func pmemColdStart(duration time.Duration) []ColdStartStage {
+	if duration <= 0 {
+		return nil
+	}
+	return []ColdStartStage{{Duration: config.Duration(duration), MemoryType: memoryPMEM}}
+}
+
+// coldStartDuration returns the total duration of cold start stages.
+func coldStartDuration(stages []ColdStartStage) time.Duration {
+	total := time.Duration(0)
+	for _, stage := range stages {
+		total += time.Duration(stage.Duration)
+	}
+	return total
+}
+
 // trigger cold start for the container if necessary.
-func (p *policy) triggerColdStart(c cache.Container) error {
+func (p *policy) triggerColdStart(c cache.Container) (bool, error) {
 	log.Info("coldstart: triggering coldstart for %s...", c.PrettyName())
 	g, ok := p.allocations.grants[c.GetCacheID()]
 	if !ok {
 		log.Warn("coldstart: no grant found, nothing to do...")
-		return nil
+		return false, nil
 	}
 
-	coldStart := g.ColdStart()
-	if coldStart <= 0 {
+	stage, ok := g.ColdStartStage()
+	if !ok || g.ColdStart() <= 0 {
 		log.Info("coldstart: no coldstart, nothing to do...")
-		return nil
+		return false, nil
 	}
 
-	// Start a timer to restore the grant memset to full. Store the
-	// timer so that we can release it if the grant is destroyed before
-	// the timer elapses.
-	duration := coldStart
+	g.ApplyColdStartStage(stage)
+	p.startColdStartTimer(c, g, time.Duration(stage.Duration))
+
+	return true, nil
+}
+
+// startColdStartTimer starts a timer for ending the current cold start stage.
+func (p *policy) startColdStartTimer(c cache.Container, g Grant, duration time.Duration) {
+	// Start a timer to move on to the next stage or to restore the grant
+	// memset to full. Store the timer so that we can release it if the grant
+	// is destroyed before the timer elapses.
 	timer := time.AfterFunc(duration, func() {
 		e := &events.Policy{
 			Type:   ColdStartDone,
@@ -52,10 +97,9 @@ func (p *policy) triggerColdStart(c cache.Container) error {
 		}
 	})
 	g.AddTimer(timer)
-	return nil
 }
 
-// finish an ongoing coldstart for the container.
+// finish the ongoing coldstart stage for the container.
 func (p *policy) finishColdStart(c cache.Container) (bool, error) {
 	g, ok := p.allocations.grants[c.GetCacheID()]
 	if !ok {
@@ -63,9 +107,18 @@ func (p *policy) finishColdStart(c cache.Container) (bool, error) {
 		return false, policyError("coldstart: no grant found for %s", c.PrettyName())
 	}
 
+	g.ClearTimer()
+
+	if stage, ok := g.NextColdStartStage(); ok {
+		log.Info("coldstart: moving %s to next stage (memory: %s, duration: %v)",
+			c.PrettyName(), stage.MemoryType, time.Duration(stage.Duration))
+		g.ApplyColdStartStage(stage)
+		p.startColdStartTimer(c, g, time.Duration(stage.Duration))
+		return true, nil
+	}
+
 	log.Info("restoring memset to grant %v", g)
 	g.RestoreMemset()
-	g.ClearTimer()
 
 	return true, nil
 }
@@ -20,10 +20,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
 	policyapi "github.com/intel/cri-resource-manager/pkg/cri/resource-manager/policy"
 	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	resapi "k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
@@ -224,3 +226,91 @@ func TestColdStart(t *testing.T) {
 		})
 	}
 }
+
+func TestColdStartProfiles(t *testing.T) {
+	saved := opt.ColdStartProfiles
+	defer func() { opt.ColdStartProfiles = saved }()
+
+	limit := resapi.MustParse("1Gi")
+	opt.ColdStartProfiles = map[string]ColdStartProfile{
+		"warm-up": {
+			{Duration: config.Duration(30 * time.Second), MemoryType: memoryPMEM},
+			{Duration: config.Duration(5 * time.Minute), MemoryType: memoryDRAM | memoryPMEM, ToptierLimit: &limit, CPUShare: 500},
+		},
+		"invalid": {
+			{Duration: 0, MemoryType: memoryPMEM},
+		},
+	}
+
+	tcases := []struct {
+		name       string
+		annotation string
+		expectErr  bool
+		stages     int
+		duration   time.Duration
+	}{
+		{
+			name:       "legacy duration",
+			annotation: "demo: { duration: 10s }",
+			stages:     1,
+			duration:   10 * time.Second,
+		},
+		{
+			name:       "profile",
+			annotation: "demo: { profile: warm-up }",
+			stages:     2,
+			duration:   5*time.Minute + 30*time.Second,
+		},
+		{
+			name:       "unknown profile",
+			annotation: "demo: { profile: missing }",
+			expectErr:  true,
+		},
+		{
+			name:       "invalid profile",
+			annotation: "demo: { profile: invalid }",
+			expectErr:  true,
+		},
+		{
+			name:       "both duration and profile",
+			annotation: "demo: { duration: 10s, profile: warm-up }",
+			expectErr:  true,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &mockPod{
+				returnValue1FotGetResmgrAnnotation: tc.annotation,
+				returnValue2FotGetResmgrAnnotation: true,
+			}
+			pref, err := coldStartPreference(pod, &mockContainer{name: "demo"})
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", pref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pref.stages) != tc.stages || pref.duration != tc.duration {
+				t.Errorf("expected %d stages lasting %v, got %d lasting %v",
+					tc.stages, tc.duration, len(pref.stages), pref.duration)
+			}
+		})
+	}
+
+	g := &grant{coldStart: opt.ColdStartProfiles["warm-up"]}
+	if stage, ok := g.ColdStartStage(); !ok || stage.MemoryType != memoryPMEM {
+		t.Errorf("expected first stage to be PMEM-only, got %+v", stage)
+	}
+	if stage, ok := g.NextColdStartStage(); !ok || stage.CPUShare != 500 || stage.ToptierLimit.Value() != limit.Value() {
+		t.Errorf("unexpected second stage %+v", stage)
+	}
+	if _, ok := g.NextColdStartStage(); ok {
+		t.Errorf("expected cold start to be done after the last stage")
+	}
+	if g.ColdStart() != 5*time.Minute+30*time.Second {
+		t.Errorf("unexpected total cold start duration %v", g.ColdStart())
+	}
+}
@@ -19,14 +19,19 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/introspect"
 	system "github.com/intel/cri-resource-manager/pkg/sysfs"
 	"github.com/intel/cri-resource-manager/pkg/utils"
 )
@@ -51,6 +56,10 @@ import (
 //    https://www.kernel.org/doc/html/latest/admin-guide/mm/pagemap.html The pages
 //    which don't have the soft-dirty bit are considered to be outside of the
 //    working set.
+//
+// Promotion works the other way around. Pages on PMEM which have the soft-dirty
+// bit set in a number of consecutive scans are considered hot and are moved
+// back to DRAM, as long as the container stays within its DRAM budget.
 
 type page struct {
 	pid  int
@@ -75,6 +84,20 @@ type demoter struct {
 	containerDemoters map[string]chan interface{} // Channel for sending pagemap updates to demoters.
 	pageMoveDuration  time.Duration               // How often should we move pages for a container.
 	pageMoveCount     uint                        // How many pages to move at once.
+
+	// Estimating the working set
+	estimator workingSetEstimator // Estimator for telling which pages have been accessed.
+
+	// Promoting pages
+	pagePromoteCount     uint                     // How many pages to promote at once.
+	pagePromoteThreshold uint                     // How many consecutive scans a page needs to be dirty to be hot.
+	hotPages             map[string]map[page]uint // Consecutive dirty scans of pages on PMEM per container.
+
+	// Limiting and observing page moves
+	bandwidth *bandwidthLimiter           // Bandwidth budget shared by all containers.
+	statsLock sync.Mutex                  // Lock protecting stats, updated by page moving goroutines.
+	stats     map[string]*pageMoveStats   // Page move state and statistics per container.
+	nodeStats map[nodePair]*nodeMoveStats // Page move statistics per source and target node.
 }
 
 // Demoter dynamically demotes pages from DRAM to PMEM.
@@ -83,21 +106,30 @@ type Demoter interface {
 	StartDirtyBitResetTimer(policy *policy, timeout time.Duration)
 	// StopDirtyBitResetTimer stops the memory moving.
 	StopDirtyBitResetTimer()
-	// ResetDirtyBit resets soft-dirty bits for all processes in container c.
+	// ResetDirtyBit starts a new working set tracking period for all processes in container c.
 	ResetDirtyBit(c cache.Container) error
 	// GetPagesForContainer gets pages which could be potentially moved from container c.
 	GetPagesForContainer(c cache.Container, sourceNodes system.IDSet) (pagePool, error)
 	// MovePages moves at most 'count' pages in page pool to a memory node.
 	MovePages(p pagePool, count uint, targetNodes system.IDSet) error
 
+	// GetHotPagesForContainer gets pages which should be promoted from container c.
+	GetHotPagesForContainer(c cache.Container, sourceNodes system.IDSet) (pagePool, error)
+
 	UpdateDemoter(cid string, p pagePool, targetNodes system.IDSet)
+	// UpdatePromoter updates the pages to promote for a container, with budget
+	// limiting the total number of pages to promote.
+	UpdatePromoter(cid string, p pagePool, targetNodes system.IDSet, budget uint)
 	StopDemoter(cid string)
 	UnusedDemoters(cs []cache.Container) []string
+	// PageMoveState returns the page moving state of a container for introspection.
+	PageMoveState(cid string) *introspect.PageMoveState
 }
 
 type pagePool struct {
 	pages        map[int][]page
 	longestRange uint
+	resident     map[system.ID]uint64 // anonymous pages resident per node
 }
 
 type demotion struct {
@@ -105,6 +137,12 @@ type demotion struct {
 	targetNodes system.IDSet
 }
 
+type promotion struct {
+	pagePool    pagePool
+	targetNodes system.IDSet
+	budget      uint
+}
+
 func copyPagePool(p pagePool) pagePool {
 	c := pagePool{
 		longestRange: p.longestRange,
@@ -118,52 +156,84 @@ func copyPagePool(p pagePool) pagePool {
 }
 
 func (d *demoter) UpdateDemoter(cid string, p pagePool, targetNodes system.IDSet) {
+	d.moverChannel(cid) <- demotion{pagePool: p, targetNodes: targetNodes}
+}
+
+func (d *demoter) UpdatePromoter(cid string, p pagePool, targetNodes system.IDSet, budget uint) {
+	d.moverChannel(cid) <- promotion{pagePool: p, targetNodes: targetNodes, budget: budget}
+}
+
+// moverChannel returns the channel of the page moving goroutine of a container,
+// starting the goroutine if necessary.
+func (d *demoter) moverChannel(cid string) chan interface{} {
 	channel, found := d.containerDemoters[cid]
-	if !found {
-		channel := make(chan interface{})
-		go func() {
-			moveTimer := time.NewTicker(d.pageMoveDuration)
-			moveTimerChan := moveTimer.C
-			pagePool := p
-			nodes := targetNodes
-			count := d.pageMoveCount
-			for {
-				select {
-				case msg := <-channel:
-					demotion, ok := msg.(demotion)
-					if ok {
-						pagePool = demotion.pagePool
-						targetNodes = demotion.targetNodes
-						if p.longestRange > d.pageMoveCount {
-							// The number of pages moved needs to be at least as large as a range in numa_maps
-							// file so that we know that all pages will be moved (even if some of them were
-							// already on the PMEM node).
-
-							// TODO: adjust the timer if we have a larger-than-usual range of pages to move.
-							count = p.longestRange
-						} else {
-							count = d.pageMoveCount
-						}
+	if found {
+		return channel
+	}
+
+	channel = make(chan interface{})
+	go func() {
+		moveTimer := time.NewTicker(d.pageMoveDuration)
+		moveTimerChan := moveTimer.C
+		var demote *demotion
+		var promote *promotion
+		count := d.pageMoveCount
+		for {
+			select {
+			case msg := <-channel:
+				switch msg := msg.(type) {
+				case demotion:
+					demote = &msg
+					if msg.pagePool.longestRange > d.pageMoveCount {
+						// The number of pages moved needs to be at least as large as a range in numa_maps
+						// file so that we know that all pages will be moved (even if some of them were
+						// already on the PMEM node).
+
+						// TODO: adjust the timer if we have a larger-than-usual range of pages to move.
+						count = msg.pagePool.longestRange
 					} else {
-						// A stop request.
-						if moveTimer != nil {
-							moveTimer.Stop()
-						}
-						return
+						count = d.pageMoveCount
 					}
-				case _ = <-moveTimerChan:
-					err := d.MovePages(pagePool, count, nodes)
+				case promotion:
+					promote = &msg
+				default:
+					// A stop request.
+					if moveTimer != nil {
+						moveTimer.Stop()
+					}
+					return
+				}
+			case _ = <-moveTimerChan:
+				if d.backingOff(cid) {
+					continue
+				}
+				if demote != nil {
+					result, err := d.moveLimited(demote.pagePool, count, demote.targetNodes, pickClosestPMEMNode)
+					d.recordMoves(cid, result, false)
 					if err != nil {
 						log.Error("Error demoting pages: %s", err)
 					}
 				}
+				if promote != nil && promote.budget > 0 {
+					n := d.pagePromoteCount
+					if promote.budget < n {
+						n = promote.budget
+					}
+					result, err := d.moveLimited(promote.pagePool, n, promote.targetNodes, d.pickClosestDRAMNode)
+					promote.budget -= result.moved
+					d.recordMoves(cid, result, true)
+					if err != nil {
+						log.Error("Error promoting pages: %s", err)
+					}
+				}
+				d.recordPending(cid, demote, promote)
 			}
-		}()
-		d.containerDemoters[cid] = channel
-		// TODO: trigger instant update when run the first time?
-	} else {
-		channel <- demotion{pagePool: p, targetNodes: targetNodes}
-	}
+		}
+	}()
+	d.containerDemoters[cid] = channel
+	// TODO: trigger instant update when run the first time?
+
+	return channel
 }
 
 func (d *demoter) StopDemoter(cid string) {
@@ -172,6 +242,10 @@ func (d *demoter) StopDemoter(cid string) {
 		channel <- "stop"
 		delete(d.containerDemoters, cid)
 	}
+	delete(d.hotPages, cid)
+	d.statsLock.Lock()
+	delete(d.stats, cid)
+	d.statsLock.Unlock()
 }
 
 func (d *demoter) UnusedDemoters(cs []cache.Container) []string {
@@ -231,14 +305,8 @@ func (d *demoter) StartDirtyBitResetTimer(policy *policy, timeout time.Duration)
 	d.dirtyBitStop = stop
 }
 
-func resetDirtyBit(pid string) error {
-	// Write magic value "4" to the clear_refs file. This resets the dirty bit.
-	path := "/proc/" + pid + "/clear_refs"
-	err := ioutil.WriteFile(path, []byte("4"), 0600)
-	return err
-}
-
-// ResetDirtyBit unsets soft-dirty bits for all processes in a container.
+// ResetDirtyBit starts a new working set tracking period for all processes in a
+// container. With the default estimator this unsets the soft-dirty bits.
 func (d *demoter) ResetDirtyBit(c cache.Container) error {
 	parentDir := ""
 	pod, isPod := c.GetPod()
@@ -252,9 +320,9 @@ func (d *demoter) ResetDirtyBit(c cache.Container) error {
 	}
 
 	for _, pid := range pids {
-		err = resetDirtyBit(pid)
+		err = d.estimator.Reset(pid)
 		if err != nil {
-			log.Error("Failed to reset dirty bit for process %s: %v", pid, err)
+			log.Error("Failed to reset %s working set tracking for process %s: %v", d.estimator.Name(), pid, err)
 			return err
 		}
 	}
@@ -262,9 +330,51 @@ func (d *demoter) ResetDirtyBit(c cache.Container) error {
 }
 
 func (d *demoter) GetPagesForContainer(c cache.Container, sourceNodes system.IDSet) (pagePool, error) {
+	return d.getPages(c, sourceNodes, false)
+}
+
+func (d *demoter) GetHotPagesForContainer(c cache.Container, sourceNodes system.IDSet) (pagePool, error) {
+	pool, err := d.getPages(c, sourceNodes, true)
+	if err != nil {
+		return pagePool{}, err
+	}
+	return d.trackHotPages(c.GetCacheID(), pool), nil
+}
+
+// trackHotPages updates the number of consecutive scans the pages of a container
+// have been accessed and returns the pages which have been accessed often enough.
+func (d *demoter) trackHotPages(cid string, pool pagePool) pagePool {
+	if d.hotPages == nil {
+		d.hotPages = make(map[string]map[page]uint)
+	}
+	prev := d.hotPages[cid]
+	seen := make(map[page]uint)
+	hot := pagePool{
+		pages:        make(map[int][]page, 0),
+		longestRange: pool.longestRange,
+		resident:     pool.resident,
+	}
+	for pid, pages := range pool.pages {
+		for _, pg := range pages {
+			n := prev[pg] + 1
+			seen[pg] = n
+			if n >= d.pagePromoteThreshold {
+				hot.pages[pid] = append(hot.pages[pid], pg)
+			}
+		}
+	}
+	d.hotPages[cid] = seen
+	return hot
+}
+
+// getPages gets the exclusive present pages of container c in page ranges with
+// pages on sourceNodes, either accessed or not accessed during the current
+// working set tracking period.
+func (d *demoter) getPages(c cache.Container, sourceNodes system.IDSet, accessed bool) (pagePool, error) {
 	pool := pagePool{
 		pages:        make(map[int][]page, 0),
 		longestRange: 0,
+		resident:     make(map[system.ID]uint64),
 	}
 	parentDir := ""
 	pod, isPod := c.GetPod()
@@ -306,6 +416,9 @@ func (d *demoter) GetPagesForContainer(c cache.Container, sourceNodes system.IDS
 				continue
 			}
 			attrs := strings.Join(tokens[2:], " ")
+			if strings.Contains(attrs, "anon=") {
+				countResidentPages(pool.resident, tokens[2:])
+			}
 			// Filter out lines which don't have "anonymous", since we are not
 			// interested in file-mapped or shared pages. Save the interesting ranges.
 			// TODO: consider dropping the "heap" requirement. There are often ranges
@@ -355,7 +468,7 @@ func (d *demoter) GetPagesForContainer(c cache.Container, sourceNodes system.IDS
 		}
 
 		// Read /proc/pid/pagemap and process only interesting page ranges. For
-		// every read-only page and for every page with the soft-dirty bit on, mark
+		// every page with the soft-dirty bit in the state we are looking for, mark
 		// them as candidates to be moved by adding them to pagePool.
 
 		if len(addressRanges) > 0 {
@@ -368,6 +481,12 @@ func (d *demoter) GetPagesForContainer(c cache.Container, sourceNodes system.IDS
 				fmt.Printf("Could not read pagemaps: %v\n", err)
 				break
 			}
+			checker, err := d.estimator.Scan(pid)
+			if err != nil {
+				log.Error("Could not scan %s working set of process %s: %v", d.estimator.Name(), pid, err)
+				pageMap.Close()
+				continue
+			}
 			for _, addressRange := range addressRanges {
 				idx := int64(addressRange.addr / uint64(os.Getpagesize()) * 8)
 				offset, err := pageMap.Seek(idx, io.SeekStart)
@@ -388,26 +507,27 @@ func (d *demoter) GetPagesForContainer(c cache.Container, sourceNodes system.IDS
 					data := binary.LittleEndian.Uint64(bytes)
 
 					// Check that the page is present (not swapped), exclusively
-					// mapped (not used by any other process), and it has the
-					// soft-dirty bit off.
+					// mapped (not used by any other process), and whether it has
+					// been accessed.
 
 					// Note: there appears to be no way to see from the pagemap entry what the NUMA node is.
 					// We could map this back to the physical address ranges if needed. Currently this is handled
 					// in MovePages() by calling move_pages() first with an empty node array.
 
-					softDirtyBit := uint64(0x1) << 55
 					exclusiveBit := uint64(0x1) << 56
 					presentBit := uint64(0x1) << 63
 					present := (data&presentBit == presentBit)
 					exclusive := (data&exclusiveBit == exclusiveBit)
-					softDirty := (data&softDirtyBit == softDirtyBit)
+					addr := addressRange.addr + i*uint64(os.Getpagesize())
 
-					if present && exclusive && !softDirty {
-						// log.Debug("page a candidate for moving: 0x%08x", addressRange.addr+i*uint64(os.Getpagesize()))
-						pages = append(pages, page{addr: addressRange.addr + i*uint64(os.Getpagesize()), pid: pidNumber})
+					if present && exclusive && checker.Accessed(addr, data) == accessed {
+						// log.Debug("page a candidate for moving: 0x%08x", addr)
+						pages = append(pages, page{addr: addr, pid: pidNumber})
 					}
 				}
 			}
+			checker.Close()
+			pageMap.Close()
 			if _, found := pool.pages[pidNumber]; found {
 				pool.pages[pidNumber] = append(pool.pages[pidNumber], pages...)
 			} else {
@@ -422,6 +542,76 @@ func (d *demoter) GetPagesForContainer(c cache.Container, sourceNodes system.IDS
 	return pool, nil
 }
 
+// countResidentPages adds the per-node page counts of a numa_maps entry to resident.
+func countResidentPages(resident map[system.ID]uint64, attrs []string) {
+	for _, attr := range attrs {
+		if !strings.HasPrefix(attr, "N") {
+			continue
+		}
+		kv := strings.SplitN(attr[1:], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		id, err := strconv.ParseUint(kv[0], 10, 16)
+		if err != nil {
+			continue
+		}
+		count, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		resident[system.ID(id)] += count
+	}
+}
+
+// dramBudget returns the amount of DRAM a container may use: its top tier limit
+// if one is set, otherwise the amount of DRAM granted to it. If the container
+// has neither a top tier limit nor any granted memory, its DRAM is not limited.
+func dramBudget(c cache.Container, g Grant) (uint64, bool) {
+	if limit := c.GetToptierLimit(); limit >= 0 {
+		return uint64(limit), true
+	}
+	granted := g.MemLimit()
+	total := uint64(0)
+	for _, amount := range granted {
+		total += amount
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return granted[memoryDRAM], true
+}
+
+// promotionBudget returns the number of pages which can be promoted to DRAM
+// without exceeding the DRAM budget of a container.
+func promotionBudget(budget uint64, limited bool, resident map[system.ID]uint64, dramNodes system.IDSet) uint {
+	if !limited {
+		return math.MaxUint32
+	}
+	used := uint64(0)
+	for id := range dramNodes {
+		used += resident[id]
+	}
+	budgetPages := budget / uint64(os.Getpagesize())
+	if used >= budgetPages {
+		return 0
+	}
+	return uint(budgetPages - used)
+}
+
+// pickClosestDRAMNode picks the DRAM node closest to the current PMEM node of a page.
+func (d *demoter) pickClosestDRAMNode(currentNode system.ID, targetNodes system.IDSet) system.ID {
+	nodes := targetNodes.SortedMembers()
+	if d.policy == nil || d.policy.sys == nil {
+		return nodes[0]
+	}
+	current := d.policy.sys.Node(currentNode)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return current.DistanceFrom(nodes[i]) < current.DistanceFrom(nodes[j])
+	})
+	return nodes[0]
+}
+
 func pickClosestPMEMNode(currentNode system.ID, targetNodes system.IDSet) system.ID {
 	// TODO: analyze the topology information (and possibly the amount of free memory) and choose the "best"
 	// PMEM node to demote the page to. The array targetNodes already contains only the subset of PMEM nodes
@@ -430,7 +620,7 @@ func pickClosestPMEMNode(currentNode system.ID, targetNodes system.IDSet) system
 	return nodes[rand.Intn(len(nodes))]
 }
 
-func (d *demoter) movePagesForPid(p []page, count uint, pid int, targetNodes system.IDSet) (uint, error) {
+func (d *demoter) movePagesForPid(p []page, count uint, pid int, targetNodes system.IDSet, pick nodePicker) (uint, pageMoveResult, error) {
 	// We move at max count pages, but there might not be that much.
 	nPages := count
 	if uint(len(p)) < count {
@@ -454,10 +644,11 @@ func (d *demoter) movePagesForPid(p []page, count uint, pid int, targetNodes sys
 	_, currentStatus, err := d.pageMover.MovePagesSyscall(pid, nPages, pages, nil, flags)
 	if err != nil {
 		log.Error("Failed to find out the current status of the pages: %v.", err)
-		return 0, err
+		return 0, pageMoveResult{}, err
 	}
 
-	dramPages := make([]uintptr, 0)
+	movePages := make([]uintptr, 0)
+	sources := make([]system.ID, 0)
 	nodes := make([]int, 0)
 	// Choose a target node for every page. Drop the pages which already are on the right controller from the list.
 	for i, pageStatus := range currentStatus {
@@ -467,20 +658,42 @@ func (d *demoter) movePagesForPid(p []page, count uint, pid int, targetNodes sys
 		}
 		// log.Debug("page 0x%08X: old status %d", pages[i], pageStatus)
 		if !targetNodes.Has(system.ID(pageStatus)) {
-			// In case of many PMEM controllers choose the one that is the closest.
-			dramPages = append(dramPages, pages[i])
-			nodes = append(nodes, int(pickClosestPMEMNode(system.ID(pageStatus), targetNodes)))
+			// In case of many target controllers choose the one that is the closest.
+			movePages = append(movePages, pages[i])
+			sources = append(sources, system.ID(pageStatus))
+			nodes = append(nodes, int(pick(system.ID(pageStatus), targetNodes)))
 		} // else no need to move.
 	}
 
 	// Call move_pages() to actually move the pages.
-	_, _, err = d.pageMover.MovePagesSyscall(pid, uint(len(dramPages)), dramPages, nodes, flags)
+	_, status, err := d.pageMover.MovePagesSyscall(pid, uint(len(movePages)), movePages, nodes, flags)
+
+	result := pageMoveResult{}
+	for i := range movePages {
+		pageStatus := -int(syscall.EIO)
+		if err == nil && i < len(status) {
+			pageStatus = status[i]
+		}
+		result.add(sources[i], system.ID(nodes[i]), pageStatus)
+	}
 
 	// We processed (moved or ignored) at least nPages.
-	return nPages, err
+	return nPages, result, err
 }
 
+// nodePicker picks the target node for a page on the current node.
+type nodePicker func(currentNode system.ID, targetNodes system.IDSet) system.ID
+
 func (d *demoter) MovePages(p pagePool, count uint, targetNodes system.IDSet) error {
+	_, err := d.movePages(p, count, targetNodes, pickClosestPMEMNode)
+	return err
+}
+
+// movePages moves at most count pages in a page pool to the target nodes,
+// returning the outcome of moving the pages.
+func (d *demoter) movePages(p pagePool, count uint, targetNodes system.IDSet, pick nodePicker) (pageMoveResult, error) {
+	result := pageMoveResult{}
+
 	// Select pid for moving the pages so that the process with the largest number
 	// of non-dirty pages gets the pages moved first.
 	processedPids := make(map[int]bool, 0)
@@ -500,7 +713,7 @@ func (d *demoter) MovePages(p pagePool, count uint, targetNodes system.IDSet) er
 		}
 
 		if nPagesForPid == 0 {
-			return nil
+			return result, nil
 		}
 
 		processedPids[mostPagesPid] = true
@@ -514,13 +727,14 @@ func (d *demoter) MovePages(p pagePool, count uint, targetNodes system.IDSet) er
 		}
 
 		log.Debug("moving %d pages for pid %d", nMovePages, mostPagesPid)
-		nPages, err := d.movePagesForPid(p.pages[mostPagesPid], nMovePages, mostPagesPid, targetNodes)
+		nPages, pidResult, err := d.movePagesForPid(p.pages[mostPagesPid], nMovePages, mostPagesPid, targetNodes, pick)
+		result.merge(pidResult)
 		if err != nil {
 			log.Error("Failed to move pages: %v", err)
-			return err
+			return result, err
 		}
 		// Remove processed pages from the pagemap.
 		p.pages[mostPagesPid] = p.pages[mostPagesPid][nPages:]
 	}
-	return nil
+	return result, nil
 }
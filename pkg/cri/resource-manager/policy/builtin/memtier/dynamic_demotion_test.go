@@ -16,6 +16,9 @@ package memtier
 
 import (
 	"fmt"
+	"math"
+	"os"
+	"strings"
 	"testing"
 
 	system "github.com/intel/cri-resource-manager/pkg/sysfs"
@@ -257,3 +260,48 @@ func TestMovePages(t *testing.T) {
 		})
 	}
 }
+
+func TestTrackHotPages(t *testing.T) {
+	d := &demoter{pagePromoteThreshold: 2}
+	hot, cold := page{pid: 500, addr: 0xdeadbeef}, page{pid: 500, addr: 0xc0ffee}
+
+	// 1. first scan should not make any page hot yet
+	pool := d.trackHotPages("c", pagePool{pages: map[int][]page{500: {hot, cold}}})
+	if len(pool.pages[500]) != 0 {
+		t.Errorf("Expected no hot pages after first scan, got %v", pool.pages)
+	}
+
+	// 2. only pages dirty in consecutive scans should be hot
+	pool = d.trackHotPages("c", pagePool{pages: map[int][]page{500: {hot}}})
+	if len(pool.pages[500]) != 1 || pool.pages[500][0] != hot {
+		t.Errorf("Expected only page %v hot after second scan, got %v", hot, pool.pages)
+	}
+	pool = d.trackHotPages("c", pagePool{pages: map[int][]page{500: {cold}}})
+	if len(pool.pages[500]) != 0 {
+		t.Errorf("Expected no hot pages after a clean scan, got %v", pool.pages)
+	}
+}
+
+func TestPromotionBudget(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+	dram := system.NewIDSet(0)
+	resident := map[system.ID]uint64{0: 10, 2: 100}
+
+	if budget := promotionBudget(0, false, resident, dram); budget != math.MaxUint32 {
+		t.Errorf("Expected unlimited budget, got %d", budget)
+	}
+	if budget := promotionBudget(15*pageSize, true, resident, dram); budget != 5 {
+		t.Errorf("Expected budget of 5 pages, got %d", budget)
+	}
+	if budget := promotionBudget(5*pageSize, true, resident, dram); budget != 0 {
+		t.Errorf("Expected no budget, got %d", budget)
+	}
+}
+
+func TestCountResidentPages(t *testing.T) {
+	resident := map[system.ID]uint64{}
+	countResidentPages(resident, strings.Fields("heap anon=7 dirty=7 N0=3 N2=4 kernelpagesize_kB=4"))
+	if resident[0] != 3 || resident[2] != 4 || len(resident) != 2 {
+		t.Errorf("Unexpected resident page counts %v", resident)
+	}
+}
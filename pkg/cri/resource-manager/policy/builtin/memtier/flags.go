@@ -15,16 +15,10 @@
 package memtier
 
 import (
-	"fmt"
-	"time"
-
 	config "github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/topology"
 )
 
-// Duration is an alias for time.Duration.
-type Duration time.Duration
-
 // Options captures our configurable policy parameters.
 type options struct {
 	// PinCPU controls CPU pinning in the memtier policy.
@@ -38,32 +32,19 @@ type options struct {
 	// FakeHints are the set of fake TopologyHints to use for testing purposes.
 	FakeHints fakehints `json:",omitempty"`
 
-	DirtyBitScanPeriod Duration `json:"DirtyBitScanPeriod"`
-	PageMovePeriod     Duration `json:"PageMovePeriod"`
-	PageMoveCount      uint     `json:"PageMoveCount"`
-}
-
-// MarshalJSON converts Duration to JSON string.
-func (d Duration) MarshalJSON() ([]byte, error) {
-	return []byte("\"" + time.Duration(d).String() + "\""), nil
-}
-
-// UnmarshalJSON converts JSON string to Duration.
-func (d *Duration) UnmarshalJSON(data []byte) error {
-	if len(data) < 2 {
-		return fmt.Errorf("invalid Duration data")
-	}
-	parsed, err := time.ParseDuration(string(data[1 : len(data)-1]))
-	if err != nil {
-		return err
-	}
-	*d = Duration(parsed)
-	return nil
-}
-
-// String returns the value of Duration as a string.
-func (d *Duration) String() string {
-	return time.Duration(*d).String()
+	DirtyBitScanPeriod config.Duration `json:"DirtyBitScanPeriod"`
+	PageMovePeriod     config.Duration `json:"PageMovePeriod"`
+	PageMoveCount      uint            `json:"PageMoveCount"`
+	// PageMoveBandwidth limits the bytes moved per second by all containers, 0 for no limit.
+	PageMoveBandwidth uint64 `json:"PageMoveBandwidth"`
+	// WorkingSetEstimator selects how accessed pages are detected: soft-dirty, page-idle or damon.
+	WorkingSetEstimator string `json:"WorkingSetEstimator"`
+	// PagePromoteCount is the number of hot pages to move from PMEM to DRAM per PageMovePeriod.
+	PagePromoteCount uint `json:"PagePromoteCount"`
+	// PagePromoteThreshold is the number of consecutive scans a page needs to be dirty to be promoted.
+	PagePromoteThreshold uint `json:"PagePromoteThreshold"`
+	// ColdStartProfiles are the named multi-stage cold start profiles containers can refer to.
+	ColdStartProfiles map[string]ColdStartProfile `json:"ColdStartProfiles,omitempty"`
 }
 
 // Our runtime configuration.
@@ -87,14 +68,17 @@ func (fh *fakehints) merge(hints fakehints) {
 // defaultOptions returns a new options instance, all initialized to defaults.
 func defaultOptions() interface{} {
 	return &options{
-		PinCPU:             true,
-		PinMemory:          true,
-		PreferIsolated:     true,
-		PreferShared:       false,
-		FakeHints:          make(fakehints),
-		DirtyBitScanPeriod: 0,
-		PageMovePeriod:     0,
-		PageMoveCount:      0,
+		PinCPU:               true,
+		PinMemory:            true,
+		PreferIsolated:       true,
+		PreferShared:         false,
+		FakeHints:            make(fakehints),
+		DirtyBitScanPeriod:   0,
+		PageMovePeriod:       0,
+		PageMoveCount:        0,
+		WorkingSetEstimator:  SoftDirtyEstimator,
+		PagePromoteCount:     0,
+		PagePromoteThreshold: 2,
 	}
 }
 
@@ -40,7 +40,7 @@ const (
 	// PolicyPath is the path of this policy in the configuration hierarchy.
 	PolicyPath = "policy." + PolicyName
 
-	// ColdStartDone is the event generated for the end of a container cold start period.
+	// ColdStartDone is the event generated for the end of a container cold start period or stage.
 	ColdStartDone = "cold-start-done"
 	// DirtyBitReset is the event generated for the reseting of the soft-dirty bits for all processes in the containers.
 	DirtyBitReset = "dirty-bit-reset"
@@ -98,12 +98,27 @@ func CreateMemtierPolicy(opts *policyapi.BackendOptions) policyapi.Backend {
 
 	config.GetModule(PolicyPath).AddNotify(p.configNotify)
 
+	estimator, err := newWorkingSetEstimator(opt.WorkingSetEstimator, time.Duration(opt.DirtyBitScanPeriod))
+	if err != nil {
+		log.Error("%v, falling back to %s", err, SoftDirtyEstimator)
+		estimator, _ = newWorkingSetEstimator(SoftDirtyEstimator, 0)
+	}
+
 	p.dynamicDemoter = &demoter{
 		containerDemoters: make(map[string]chan interface{}, 0),
 		pageMoveDuration:  time.Duration(opt.PageMovePeriod),
 		pageMoveCount:     opt.PageMoveCount,
 		pageMover:         &linuxPageMover{},
+		estimator:         estimator,
+
+		pagePromoteCount:     opt.PagePromoteCount,
+		pagePromoteThreshold: opt.PagePromoteThreshold,
+		hotPages:             make(map[string]map[page]uint),
+		stats:                make(map[string]*pageMoveStats),
+		nodeStats:            make(map[nodePair]*nodeMoveStats),
+		bandwidth:            newBandwidthLimiter(opt.PageMoveBandwidth, time.Duration(opt.PageMovePeriod)),
 	}
+	setActiveDemoter(p.dynamicDemoter.(*demoter))
 	p.root.Dump("<pre-start>")
 
 	return p
@@ -128,8 +143,8 @@ func (p *policy) Start(add []cache.Container, del []cache.Container) error {
 	// TODO: the dirty bit reset timer should only be started if there is a container
 	// for which there is a demotion possiblity.
 	if opt.DirtyBitScanPeriod > 0 && opt.PageMovePeriod > 0 && opt.PageMoveCount > 0 {
-		log.Debug("staring dirty bit -based page demotion: scan period %v, page move period %v, page move count %d",
-			opt.DirtyBitScanPeriod.String(), opt.PageMovePeriod.String(), opt.PageMoveCount)
+		log.Debug("staring %s -based page demotion: scan period %v, page move period %v, page move count %d",
+			opt.WorkingSetEstimator, opt.DirtyBitScanPeriod.String(), opt.PageMovePeriod.String(), opt.PageMoveCount)
 		p.dynamicDemoter.StartDirtyBitResetTimer(p, time.Duration(opt.DirtyBitScanPeriod))
 	} else {
 		log.Debug("not staring dirty bit -based page demotion due to missing or empty parameters: scan period %v, page move period %v, page move count %d",
@@ -248,7 +263,7 @@ func (p *policy) HandleEvent(e *events.Policy) (bool, error) {
 				e.Type, e.Data)
 		}
 		log.Info("triggering coldstart period (if necessary) for %s", c.PrettyName())
-		return false, p.triggerColdStart(c)
+		return p.triggerColdStart(c)
 	case ColdStartDone:
 		id, ok := e.Data.(string)
 		if !ok {
@@ -295,11 +310,25 @@ func (p *policy) HandleEvent(e *events.Policy) (bool, error) {
 			}
 			log.Debug("%s event: %d pages for (maybe) demoting for %v", e.Type, count, container.GetCacheID())
 
+			// Gather the hot pages on PMEM which could be promoted.
+			hotPool, promote := p.getHotPages(container, pmemNodes)
+
 			// Reset the dirty bit from all pages.
 			p.dynamicDemoter.ResetDirtyBit(container)
 
 			// Give the pages to the page moving goroutine. Copy the page pool so that there's no race.
 			p.dynamicDemoter.UpdateDemoter(container.GetCacheID(), copyPagePool(pagePool), pmemNodes.Clone())
+			if promote {
+				dram, limited := dramBudget(container, grant)
+				budget := promotionBudget(dram, limited, hotPool.resident, dramNodes)
+				count = 0
+				for _, pages := range hotPool.pages {
+					count += len(pages)
+				}
+				log.Debug("%s event: %d pages for (maybe) promoting for %v, DRAM budget %d pages",
+					e.Type, count, container.GetCacheID(), budget)
+				p.dynamicDemoter.UpdatePromoter(container.GetCacheID(), copyPagePool(hotPool), dramNodes.Clone(), budget)
+			}
 		}
 		cids := p.dynamicDemoter.UnusedDemoters(p.cache.GetContainers())
 		for _, cid := range cids {
@@ -310,6 +339,19 @@ func (p *policy) HandleEvent(e *events.Policy) (bool, error) {
 	return false, nil
 }
 
+// getHotPages gets the hot pages of a container which could be promoted to DRAM.
+func (p *policy) getHotPages(c cache.Container, pmemNodes system.IDSet) (pagePool, bool) {
+	if opt.PagePromoteCount == 0 {
+		return pagePool{}, false
+	}
+	hotPool, err := p.dynamicDemoter.GetHotPagesForContainer(c, pmemNodes)
+	if err != nil {
+		log.Error("failed to get hot pages for container %v: %v", c.GetCacheID(), err)
+		return pagePool{}, false
+	}
+	return hotPool, true
+}
+
 // Introspect provides data for external introspection.
 func (p *policy) Introspect(state *introspect.State) {
 	pools := make(map[string]*introspect.Pool, len(p.pools))
@@ -341,6 +383,7 @@ func (p *policy) Introspect(state *introspect.State) {
 			ExclusiveCPUs: g.ExclusiveCPUs().Union(g.IsolatedCPUs()).String(),
 			Pool:          g.GetCPUNode().Name(),
 		}
+		a.PageMoves = p.dynamicDemoter.PageMoveState(g.GetContainer().GetCacheID())
 		if g.SharedPortion() > 0 || a.ExclusiveCPUs == "" {
 			a.SharedCPUs = g.SharedCPUs().String()
 		}
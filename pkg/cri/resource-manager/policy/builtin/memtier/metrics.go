@@ -0,0 +1,108 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/intel/cri-resource-manager/pkg/metrics"
+)
+
+var (
+	// demoter of the active memtier policy instance, if any
+	activeDemoter     *demoter
+	activeDemoterLock sync.Mutex
+
+	containerPagesDesc = prometheus.NewDesc(
+		"memtier_container_pages_total",
+		"Memory pages promoted, demoted, failed to move or skipped as busy by the memtier policy, per container.",
+		[]string{"container_id", "result"}, nil,
+	)
+	nodePagesDesc = prometheus.NewDesc(
+		"memtier_node_pages_total",
+		"Memory pages promoted, demoted, failed to move or skipped as busy by the memtier policy, per source and target node.",
+		[]string{"source_node", "target_node", "result"}, nil,
+	)
+)
+
+// collector implements prometheus.Collector for page moving statistics.
+type collector struct{}
+
+// setActiveDemoter sets the demoter to collect metrics from.
+func setActiveDemoter(d *demoter) {
+	activeDemoterLock.Lock()
+	defer activeDemoterLock.Unlock()
+	activeDemoter = d
+}
+
+// NewCollector creates a new Prometheus collector for page moving statistics.
+func NewCollector() (prometheus.Collector, error) {
+	return &collector{}, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- containerPagesDesc
+	ch <- nodePagesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	activeDemoterLock.Lock()
+	d := activeDemoter
+	activeDemoterLock.Unlock()
+	if d == nil {
+		return
+	}
+
+	d.statsLock.Lock()
+	defer d.statsLock.Unlock()
+
+	for cid, stats := range d.stats {
+		for result, value := range map[string]uint64{
+			"promoted": stats.promoted,
+			"demoted":  stats.demoted,
+			"failed":   stats.failed,
+			"skipped":  stats.skipped,
+		} {
+			ch <- prometheus.MustNewConstMetric(containerPagesDesc,
+				prometheus.CounterValue, float64(value), cid, result)
+		}
+	}
+
+	for pair, counters := range d.nodeStats {
+		source := strconv.Itoa(int(pair.source))
+		target := strconv.Itoa(int(pair.target))
+		for result, value := range map[string]uint64{
+			"promoted": counters.promoted,
+			"demoted":  counters.demoted,
+			"failed":   counters.failed,
+			"skipped":  counters.skipped,
+		} {
+			ch <- prometheus.MustNewConstMetric(nodePagesDesc,
+				prometheus.CounterValue, float64(value), source, target, result)
+		}
+	}
+}
+
+func init() {
+	err := metrics.RegisterCollector("memtier", NewCollector)
+	if err != nil {
+		log.Error("failed register memtier collector: %v", err)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/intel/cri-resource-manager/pkg/apis/resmgr"
+	"github.com/intel/cri-resource-manager/pkg/apis/resmgr/v1alpha1"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/config"
 	system "github.com/intel/cri-resource-manager/pkg/sysfs"
@@ -34,6 +35,8 @@ type mockSystemNode struct {
 	memTotal uint64
 	memType  system.MemoryType
 	distance []int
+	attrs    *system.MemoryAttributes
+	cpus     cpuset.CPUSet
 }
 
 func (fake *mockSystemNode) MemoryInfo() (*system.MemInfo, error) {
@@ -53,7 +56,7 @@ func (fake *mockSystemNode) GetMemoryType() system.MemoryType {
 }
 
 func (fake *mockSystemNode) CPUSet() cpuset.CPUSet {
-	return cpuset.NewCPUSet()
+	return fake.cpus
 }
 
 func (fake *mockSystemNode) Distance() []int {
@@ -64,9 +67,20 @@ func (fake *mockSystemNode) Distance() []int {
 }
 
 func (fake *mockSystemNode) DistanceFrom(id system.ID) int {
+	if int(id) < len(fake.distance) {
+		return fake.distance[id]
+	}
 	return 0
 }
 
+func (fake *mockSystemNode) MemoryAttributes() *system.MemoryAttributes {
+	return fake.attrs
+}
+
+func (fake *mockSystemNode) IsCXL() bool {
+	return false
+}
+
 type mockCPUPackage struct {
 }
 
@@ -81,6 +95,12 @@ func (p *mockCPUPackage) CPUSet() cpuset.CPUSet {
 func (p *mockCPUPackage) NodeIDs() []system.ID {
 	return []system.ID{}
 }
+func (p *mockCPUPackage) DieIDs() []system.ID {
+	return []system.ID{0}
+}
+func (p *mockCPUPackage) DieCPUSet(system.ID) cpuset.CPUSet {
+	return cpuset.NewCPUSet()
+}
 
 type mockCPU struct {
 	isolated cpuset.CPUSet
@@ -105,6 +125,18 @@ func (c *mockCPU) NodeID() system.ID {
 func (c *mockCPU) CoreID() system.ID {
 	return c.id
 }
+func (c *mockCPU) DieID() system.ID {
+	return 0
+}
+func (c *mockCPU) CoreKind() system.CoreKind {
+	return system.PerformanceCore
+}
+func (c *mockCPU) GetCaches() []*system.Cache {
+	return nil
+}
+func (c *mockCPU) GetLastLevelCache() *system.Cache {
+	return nil
+}
 func (c *mockCPU) ThreadCPUSet() cpuset.CPUSet {
 	return cpuset.NewCPUSet()
 }
@@ -156,6 +188,9 @@ func (fake *mockSystem) Package(system.ID) system.CPUPackage {
 func (fake *mockSystem) Offlined() cpuset.CPUSet {
 	return cpuset.NewCPUSet()
 }
+func (fake *mockSystem) CoreKindCPUs(system.CoreKind) cpuset.CPUSet {
+	return cpuset.NewCPUSet()
+}
 func (fake *mockSystem) Isolated() cpuset.CPUSet {
 	if fake.isolatedCPU > 0 {
 		return cpuset.NewCPUSet(fake.isolatedCPU)
@@ -432,6 +467,18 @@ func (m *mockContainer) SetRDTClass(string) {
 func (m *mockContainer) GetRDTClass() string {
 	panic("unimplemented")
 }
+func (m *mockContainer) SetRDTRestriction(string) {
+	panic("unimplemented")
+}
+func (m *mockContainer) GetRDTRestriction() (string, bool) {
+	panic("unimplemented")
+}
+func (m *mockContainer) SetSchedulingClass(string) {
+	panic("unimplemented")
+}
+func (m *mockContainer) GetSchedulingClass() string {
+	panic("unimplemented")
+}
 func (m *mockContainer) SetBlockIOClass(string) {
 	panic("unimplemented")
 }
@@ -444,6 +491,9 @@ func (m *mockContainer) SetToptierLimit(int64) {
 func (m *mockContainer) GetToptierLimit() int64 {
 	panic("unimplemented")
 }
+func (m *mockContainer) GetStaticPoolsAdjustment() (*v1alpha1.StaticPools, bool) {
+	return nil, false
+}
 func (m *mockContainer) SetCRIRequest(req interface{}) error {
 	panic("unimplemented")
 }
@@ -0,0 +1,317 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/introspect"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+const (
+	// maxBackoffPeriods is the maximum back-off, in page move periods.
+	maxBackoffPeriods = 32
+)
+
+// nodePair identifies the source and target node of moved pages.
+type nodePair struct {
+	source system.ID
+	target system.ID
+}
+
+// pageMoveCounters counts pages moved, failed to move and skipped for being busy.
+type pageMoveCounters struct {
+	moved   uint64
+	failed  uint64
+	skipped uint64
+}
+
+// pageMoveResult is the outcome of a single round of moving pages.
+type pageMoveResult struct {
+	moved   uint
+	failed  uint
+	skipped uint
+	nodes   map[nodePair]*pageMoveCounters
+}
+
+// nodeMoveStats is the page moving statistics of a source and target node.
+type nodeMoveStats struct {
+	promoted uint64 // pages moved from PMEM to DRAM
+	demoted  uint64 // pages moved from DRAM to PMEM
+	failed   uint64 // pages failed to move
+	skipped  uint64 // busy pages skipped
+}
+
+// pageMoveStats is the page moving state and statistics of a container.
+type pageMoveStats struct {
+	promoted         uint64        // pages moved from PMEM to DRAM
+	demoted          uint64        // pages moved from DRAM to PMEM
+	failed           uint64        // pages failed to move
+	skipped          uint64        // busy pages skipped
+	pendingDemotion  uint          // pages left to demote
+	pendingPromotion uint          // pages left to promote
+	backoff          time.Duration // current back-off
+	backoffUntil     time.Time     // time to back off until
+}
+
+// add records the outcome of moving a single page.
+func (r *pageMoveResult) add(source, target system.ID, status int) {
+	if r.nodes == nil {
+		r.nodes = make(map[nodePair]*pageMoveCounters)
+	}
+	pair := nodePair{source: source, target: target}
+	counters, ok := r.nodes[pair]
+	if !ok {
+		counters = &pageMoveCounters{}
+		r.nodes[pair] = counters
+	}
+	switch {
+	case status >= 0:
+		r.moved++
+		counters.moved++
+	case status == -int(syscall.EBUSY):
+		r.skipped++
+		counters.skipped++
+	default:
+		r.failed++
+		counters.failed++
+	}
+}
+
+// merge adds the outcome of another round to this one.
+func (r *pageMoveResult) merge(o pageMoveResult) {
+	r.moved += o.moved
+	r.failed += o.failed
+	r.skipped += o.skipped
+	for pair, oc := range o.nodes {
+		if r.nodes == nil {
+			r.nodes = make(map[nodePair]*pageMoveCounters)
+		}
+		c, ok := r.nodes[pair]
+		if !ok {
+			c = &pageMoveCounters{}
+			r.nodes[pair] = c
+		}
+		c.moved += oc.moved
+		c.failed += oc.failed
+		c.skipped += oc.skipped
+	}
+}
+
+// bandwidthLimiter is a token bucket limiting the bytes moved per second,
+// shared by the page moving goroutines of all containers.
+type bandwidthLimiter struct {
+	sync.Mutex
+	rate   float64          // bytes per second, 0 for no limit
+	burst  float64          // maximum bytes available at once
+	tokens float64          // bytes currently available
+	last   time.Time        // last time tokens were added
+	now    func() time.Time // current time
+}
+
+// newBandwidthLimiter creates a limiter for the given bytes per second. Up to
+// one page move period, but at least a second, worth of bytes can accumulate.
+func newBandwidthLimiter(rate uint64, period time.Duration) *bandwidthLimiter {
+	if period < time.Second {
+		period = time.Second
+	}
+	burst := float64(rate) * period.Seconds()
+	l := &bandwidthLimiter{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: burst,
+		now:    time.Now,
+	}
+	l.last = l.now()
+	return l
+}
+
+// take takes at most pages pages from the budget, returning the number granted.
+func (l *bandwidthLimiter) take(pages uint) uint {
+	if l == nil || l.rate == 0 {
+		return pages
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	pageSize := float64(os.Getpagesize())
+	if available := uint(l.tokens / pageSize); available < pages {
+		pages = available
+	}
+	l.tokens -= float64(pages) * pageSize
+
+	return pages
+}
+
+// refund returns pages taken but not moved to the budget.
+func (l *bandwidthLimiter) refund(pages uint) {
+	if l == nil || l.rate == 0 || pages == 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.tokens += float64(pages) * float64(os.Getpagesize())
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// moveLimited moves at most count pages within the global bandwidth budget.
+func (d *demoter) moveLimited(p pagePool, count uint, targetNodes system.IDSet, pick nodePicker) (pageMoveResult, error) {
+	granted := d.bandwidth.take(count)
+	if granted == 0 {
+		return pageMoveResult{}, nil
+	}
+	result, err := d.movePages(p, granted, targetNodes, pick)
+	d.bandwidth.refund(granted - result.moved)
+	return result, err
+}
+
+// containerStats returns the page moving statistics of a container, with the lock held.
+func (d *demoter) containerStats(cid string) *pageMoveStats {
+	if d.stats == nil {
+		d.stats = make(map[string]*pageMoveStats)
+	}
+	stats, ok := d.stats[cid]
+	if !ok {
+		stats = &pageMoveStats{}
+		d.stats[cid] = stats
+	}
+	return stats
+}
+
+// recordMoves records the outcome of moving pages for a container, backing
+// off exponentially if pages were busy.
+func (d *demoter) recordMoves(cid string, result pageMoveResult, promotion bool) {
+	d.statsLock.Lock()
+	defer d.statsLock.Unlock()
+
+	stats := d.containerStats(cid)
+	if promotion {
+		stats.promoted += uint64(result.moved)
+	} else {
+		stats.demoted += uint64(result.moved)
+	}
+	stats.failed += uint64(result.failed)
+	stats.skipped += uint64(result.skipped)
+
+	if d.nodeStats == nil {
+		d.nodeStats = make(map[nodePair]*nodeMoveStats)
+	}
+	for pair, c := range result.nodes {
+		nc, ok := d.nodeStats[pair]
+		if !ok {
+			nc = &nodeMoveStats{}
+			d.nodeStats[pair] = nc
+		}
+		if promotion {
+			nc.promoted += c.moved
+		} else {
+			nc.demoted += c.moved
+		}
+		nc.failed += c.failed
+		nc.skipped += c.skipped
+	}
+
+	switch {
+	case result.skipped > 0:
+		stats.backoff *= 2
+		if stats.backoff < d.pageMoveDuration {
+			stats.backoff = d.pageMoveDuration
+		}
+		if max := maxBackoffPeriods * d.pageMoveDuration; stats.backoff > max {
+			stats.backoff = max
+		}
+		stats.backoffUntil = time.Now().Add(stats.backoff)
+		log.Debug("%d busy pages for %s, backing off for %v", result.skipped, cid, stats.backoff)
+	case result.moved > 0:
+		stats.backoff = 0
+		stats.backoffUntil = time.Time{}
+	}
+}
+
+// recordPending records the number of pages left to move for a container.
+func (d *demoter) recordPending(cid string, demote *demotion, promote *promotion) {
+	d.statsLock.Lock()
+	defer d.statsLock.Unlock()
+
+	stats := d.containerStats(cid)
+	stats.pendingDemotion, stats.pendingPromotion = 0, 0
+	if demote != nil {
+		stats.pendingDemotion = demote.pagePool.count()
+	}
+	if promote != nil {
+		stats.pendingPromotion = promote.pagePool.count()
+		if promote.budget < stats.pendingPromotion {
+			stats.pendingPromotion = promote.budget
+		}
+	}
+}
+
+// backingOff checks if page moving is backed off for a container.
+func (d *demoter) backingOff(cid string) bool {
+	d.statsLock.Lock()
+	defer d.statsLock.Unlock()
+
+	if stats, ok := d.stats[cid]; ok {
+		return time.Now().Before(stats.backoffUntil)
+	}
+	return false
+}
+
+func (d *demoter) PageMoveState(cid string) *introspect.PageMoveState {
+	d.statsLock.Lock()
+	defer d.statsLock.Unlock()
+
+	stats, ok := d.stats[cid]
+	if !ok {
+		return nil
+	}
+	state := &introspect.PageMoveState{
+		Promoted:         stats.promoted,
+		Demoted:          stats.demoted,
+		Failed:           stats.failed,
+		Skipped:          stats.skipped,
+		PendingDemotion:  stats.pendingDemotion,
+		PendingPromotion: stats.pendingPromotion,
+	}
+	if time.Now().Before(stats.backoffUntil) {
+		state.BackoffUntil = stats.backoffUntil.Format(time.RFC3339)
+	}
+	return state
+}
+
+// count returns the number of pages in the pool.
+func (p pagePool) count() uint {
+	count := uint(0)
+	for _, pages := range p.pages {
+		count += uint(len(pages))
+	}
+	return count
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+	now := time.Now()
+	l := newBandwidthLimiter(10*pageSize, 0)
+	l.now = func() time.Time { return now }
+	l.last = now
+
+	if granted := l.take(4); granted != 4 {
+		t.Errorf("expected 4 pages granted, got %d", granted)
+	}
+	if granted := l.take(10); granted != 6 {
+		t.Errorf("expected the remaining 6 pages granted, got %d", granted)
+	}
+	if granted := l.take(1); granted != 0 {
+		t.Errorf("expected no pages granted from an exhausted budget, got %d", granted)
+	}
+
+	l.refund(2)
+	if granted := l.take(5); granted != 2 {
+		t.Errorf("expected 2 refunded pages granted, got %d", granted)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if granted := l.take(10); granted != 5 {
+		t.Errorf("expected 5 pages granted after half a second, got %d", granted)
+	}
+
+	now = now.Add(time.Hour)
+	if granted := l.take(100); granted != 10 {
+		t.Errorf("expected budget to be capped at 10 pages, got %d", granted)
+	}
+
+	// A page move period longer than a second lets a period worth of bandwidth accumulate.
+	l = newBandwidthLimiter(10*pageSize, 3*time.Second)
+	l.now = func() time.Time { return now }
+	l.last = now
+	now = now.Add(time.Hour)
+	if granted := l.take(100); granted != 30 {
+		t.Errorf("expected budget to be capped at 30 pages, got %d", granted)
+	}
+
+	var unlimited *bandwidthLimiter
+	if granted := unlimited.take(100); granted != 100 {
+		t.Errorf("expected no limit without a limiter, got %d", granted)
+	}
+}
+
+func TestRecordMoves(t *testing.T) {
+	d := &demoter{pageMoveDuration: time.Second}
+
+	result := pageMoveResult{}
+	result.add(0, 2, 2)
+	result.add(0, 2, -int(syscall.EBUSY))
+	result.add(1, 2, -int(syscall.ENOMEM))
+	d.recordMoves("c", result, false)
+
+	state := d.PageMoveState("c")
+	if state == nil || state.Demoted != 1 || state.Skipped != 1 || state.Failed != 1 {
+		t.Errorf("unexpected page move state %+v", state)
+	}
+	if state.BackoffUntil == "" || !d.backingOff("c") {
+		t.Errorf("expected busy pages to cause a back-off")
+	}
+	if c := d.nodeStats[nodePair{source: 0, target: 2}]; c == nil || c.demoted != 1 || c.promoted != 0 || c.skipped != 1 {
+		t.Errorf("unexpected node 0 -> 2 statistics %+v", c)
+	}
+	if c := d.nodeStats[nodePair{source: 1, target: 2}]; c == nil || c.failed != 1 {
+		t.Errorf("unexpected node 1 -> 2 statistics %+v", c)
+	}
+
+	d.recordMoves("c", result, false)
+	if backoff := d.stats["c"].backoff; backoff != 2*time.Second {
+		t.Errorf("expected back-off to double to 2s, got %v", backoff)
+	}
+
+	result = pageMoveResult{}
+	result.add(0, 2, 2)
+	d.recordMoves("c", result, true)
+	if d.backingOff("c") || d.PageMoveState("c").Promoted != 1 {
+		t.Errorf("expected successful moves to end back-off, got %+v", d.PageMoveState("c"))
+	}
+	if c := d.nodeStats[nodePair{source: 0, target: 2}]; c.promoted != 1 || c.demoted != 2 {
+		t.Errorf("unexpected node 0 -> 2 statistics after promotion %+v", c)
+	}
+}
@@ -148,19 +148,23 @@ func podSharedCPUPreference(pod cache.Pod, container cache.Container) (bool, int
 }
 
 // ColdStartPreference lists the various ways the container can be configured to trigger
-// cold start. Currently, only timer is supported. If the "duration" is set to a duration
-// greater than 0, cold start is enabled and the DRAM controller is added to the container
-// after the duration has passed.
+// cold start. If the "duration" is set to a duration greater than 0, cold start is enabled
+// and the DRAM controller is added to the container after the duration has passed. If the
+// "profile" is set, the container goes through the stages of the named cold start profile
+// in the policy configuration.
 type ColdStartPreference struct {
 	duration time.Duration
+	stages   []ColdStartStage
 }
 
 type coldStartPreferenceYaml struct {
 	Duration string // `yaml:"duration,omitempty"`
+	Profile  string // `yaml:"profile,omitempty"`
 }
 
 // coldStartPreference figures out if the container memory should be first allocated from PMEM.
-// It returns the time (in milliseconds) after which DRAM controller should be added to the mix.
+// It returns the time (in milliseconds) after which DRAM controller should be added to the mix,
+// together with the cold start stages to go through.
 func coldStartPreference(pod cache.Pod, container cache.Container) (ColdStartPreference, error) {
 	value, ok := pod.GetResmgrAnnotation(keyColdStartPreference)
 	if !ok {
@@ -179,6 +183,13 @@ func coldStartPreference(pod cache.Pod, container cache.Container) (ColdStartPre
 		return ColdStartPreference{}, nil
 	}
 
+	if coldStartPreference.Profile != "" {
+		if coldStartPreference.Duration != "" {
+			return ColdStartPreference{}, fmt.Errorf("cold start duration and profile are mutually exclusive")
+		}
+		return coldStartProfilePreference(coldStartPreference.Profile)
+	}
+
 	// Parse the cold start data.
 	duration, err := time.ParseDuration(coldStartPreference.Duration)
 	if err != nil {
@@ -194,6 +205,35 @@ func coldStartPreference(pod cache.Pod, container cache.Container) (ColdStartPre
 
 	return ColdStartPreference{
 		duration: duration,
+		stages:   pmemColdStart(duration),
+	}, nil
+}
+
+// coldStartProfilePreference looks up and validates the named cold start profile.
+func coldStartProfilePreference(name string) (ColdStartPreference, error) {
+	profile, ok := opt.ColdStartProfiles[name]
+	if !ok {
+		return ColdStartPreference{}, fmt.Errorf("unknown cold start profile %q", name)
+	}
+
+	stages := make([]ColdStartStage, 0, len(profile))
+	for idx, stage := range profile {
+		duration := time.Duration(stage.Duration)
+		if duration <= 0 || duration > time.Hour {
+			// Stages need to have a duration. We also reject durations which are longer than one hour.
+			return ColdStartPreference{}, fmt.Errorf("failed to validate duration %s of stage #%d of cold start profile %q: value out of scope",
+				duration.String(), idx, name)
+		}
+		if stage.CPUShare < 0 {
+			return ColdStartPreference{}, fmt.Errorf("invalid CPU share %d in stage #%d of cold start profile %q",
+				stage.CPUShare, idx, name)
+		}
+		stages = append(stages, stage)
+	}
+
+	return ColdStartPreference{
+		duration: coldStartDuration(stages),
+		stages:   stages,
 	}, nil
 }
 
@@ -344,7 +344,7 @@ func (p *policy) applyGrant(grant Grant) error {
 	mems := ""
 	node := grant.GetMemoryNode()
 	if !node.IsRootNode() && opt.PinMemory {
-		mems = grant.Memset().String()
+		mems = p.tierMemset(grant).String()
 	}
 
 	if opt.PinCPU {
@@ -492,13 +492,10 @@ func (p *policy) filterInsufficientResources(req Request, originals []Node) []No
 		// system?
 
 		supply := node.FreeSupply()
-		memType := req.MemoryType()
 
-		if memType == memoryUnspec {
-			// The algorithm for handling unspecified memory allocations is the same as for handling a request
-			// with memory type all.
-			memType = memoryAll
-		}
+		// The algorithm for handling unspecified memory allocations is the same as for handling a request
+		// with memory type all. Only the types of memory in any preferred memory tier are considered.
+		memType := p.tierMemoryType(node, req)
 		bitsToFit := req.MemAmountToAllocate()
 
 		if memType&memoryPMEM != 0 {
@@ -510,8 +507,8 @@ func (p *policy) filterInsufficientResources(req Request, originals []Node) []No
 				bitsToFit -= supply.MemoryLimit()[memoryPMEM] - supply.ExtraMemoryReservation(memoryPMEM)
 			}
 		}
-		if req.ColdStart() > 0 {
-			// For a "cold start" request, the memory request must fit completely in the PMEM. So reject the node.
+		if req.ColdStart() > 0 && req.ColdStartMemoryType()&^memoryPMEM == 0 {
+			// For a PMEM-only "cold start" request, the memory request must fit completely in the PMEM. So reject the node.
 			continue
 		}
 		if memType&memoryDRAM != 0 {
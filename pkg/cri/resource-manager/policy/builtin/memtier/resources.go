@@ -94,6 +94,8 @@ type Request interface {
 	MemAmountToAllocate() uint64
 	// ColdStart returns the cold start timeout.
 	ColdStart() time.Duration
+	// ColdStartMemoryType returns the type(s) of memory used initially during cold start.
+	ColdStartMemoryType() memoryType
 }
 
 // Grant represents CPU and memory capacity allocated to a container from a node.
@@ -137,6 +139,15 @@ type Grant interface {
 	RestoreMemset()
 	// ColdStart returns the cold start timeout.
 	ColdStart() time.Duration
+	// ColdStartStages returns all cold start stages.
+	ColdStartStages() []ColdStartStage
+	// ColdStartStage returns the current cold start stage, if any.
+	ColdStartStage() (ColdStartStage, bool)
+	// NextColdStartStage moves on to the next cold start stage, if any.
+	NextColdStartStage() (ColdStartStage, bool)
+	// ApplyColdStartStage applies the memory types, top tier limit and
+	// CPU share of a cold start stage and reapplies the grant.
+	ApplyColdStartStage(ColdStartStage)
 	// AddTimer adds a cold start timer.
 	AddTimer(*time.Timer)
 	// StopTimer stops a cold start timer.
@@ -187,6 +198,7 @@ type request struct {
 	memReq  uint64     // memory request
 	memLim  uint64     // memory limit
 	memType memoryType // requested types of memory
+	tier    memoryTier // preferred tier of memory
 
 	// elevate indicates how much to elevate the actual allocation of the
 	// container in the tree of pools. Or in other words how many levels to
@@ -194,28 +206,32 @@ type request struct {
 	// the container to an actual pool. Currently ignored.
 	elevate int
 
-	// coldStart tells the timeout (in milliseconds) how long to wait until
-	// a DRAM memory controller should be added to a container asking for a
-	// mixed DRAM/PMEM memory allocation. This allows for a "cold start" where
-	// initial memory requests are made to the PMEM memory. A value of 0
-	// indicates that cold start is not explicitly requested.
-	coldStart time.Duration
+	// coldStart lists the stages the container should go through before
+	// its full memory set is used. Typically this is a single PMEM-only
+	// stage, after which a DRAM memory controller is added to a container
+	// asking for a mixed DRAM/PMEM memory allocation. This allows for a
+	// "cold start" where initial memory requests are made to the PMEM
+	// memory. No stages indicate that cold start is not explicitly requested.
+	coldStart []ColdStartStage
 }
 
 var _ Request = &request{}
 
 // grant implements our Grant interface.
 type grant struct {
-	container      cache.Container // container CPU is granted to
-	node           Node            // node CPU is supplied from
-	memoryNode     Node            // node memory is supplied from
-	exclusive      cpuset.CPUSet   // exclusive CPUs
-	portion        int             // milliCPUs granted from shared set
-	memType        memoryType      // requested types of memory
-	memset         system.IDSet    // assigned memory nodes
-	allocatedMem   memoryMap       // memory limit
-	coldStart      time.Duration   // how long until cold start is done
-	coldStartTimer *time.Timer     // timer to trigger cold start timeout
+	container      cache.Container  // container CPU is granted to
+	node           Node             // node CPU is supplied from
+	memoryNode     Node             // node memory is supplied from
+	exclusive      cpuset.CPUSet    // exclusive CPUs
+	portion        int              // milliCPUs granted from shared set
+	memType        memoryType       // requested types of memory
+	memset         system.IDSet     // assigned memory nodes
+	allocatedMem   memoryMap        // memory limit
+	coldStart      []ColdStartStage // cold start stages
+	coldStartStage int              // current cold start stage
+	coldStartTimer *time.Timer      // timer to trigger cold start timeout
+	toptierLimit   *int64           // top tier limit before cold start, if changed
+	cpuShares      *int64           // CPU shares before cold start, if changed
 }
 
 var _ Grant = &grant{}
@@ -346,13 +362,9 @@ func (cs *supply) AccountRelease(g Grant) {
 }
 
 func (cs *supply) allocateMemory(cr *request) (memoryMap, error) {
-	memType := cr.MemoryType()
+	memType := cs.node.Policy().tierMemoryType(cs.node, cr)
 	allocatedMem := createMemoryMap(0, 0, 0)
 
-	if memType == memoryUnspec {
-		memType = memoryAll
-	}
-
 	amount := cr.MemAmountToAllocate()
 	remaining := amount
 
@@ -375,7 +387,7 @@ func (cs *supply) allocateMemory(cr *request) (memoryMap, error) {
 		}
 	}
 
-	if remaining > 0 && cr.ColdStart() > 0 {
+	if remaining > 0 && cr.ColdStart() > 0 && cr.ColdStartMemoryType()&^memoryPMEM == 0 {
 		cs.mem[memoryPMEM] += amount - remaining
 		cs.grantedMem[memoryPMEM] = amount - remaining
 		return nil, policyError("internal error: not enough memory at %s, short circuit due to cold start", cs.node.Name())
@@ -465,20 +477,22 @@ func (cs *supply) Allocate(r Request) (Grant, error) {
 	}
 
 	// allocate only limited memory set due to cold start
-	memType := memoryPMEM
-	coldStart := cr.ColdStart()
-	if coldStart <= 0 {
-		memType = cr.memType
+	memType := cr.memType
+	if cr.ColdStart() > 0 && cr.ColdStartMemoryType() != memoryUnspec {
+		memType = cr.ColdStartMemoryType()
 	}
 
-	grant := newGrant(cs.node, cr.GetContainer(), exclusive, cr.fraction, memType, cr.memType, allocatedMem, coldStart)
+	g := newGrant(cs.node, cr.GetContainer(), exclusive, cr.fraction, memType, cr.memType, allocatedMem, cr.coldStart)
+	if !cr.tier.isAny() && !cs.node.IsRootNode() {
+		g.(*grant).memset = cs.node.Policy().tierNodes(cs.node, cr.tier, g.Memset())
+	}
 
 	cs.node.DepthFirst(func(n Node) error {
-		n.FreeSupply().AccountAllocate(grant)
+		n.FreeSupply().AccountAllocate(g)
 		return nil
 	})
 
-	return grant, nil
+	return g, nil
 }
 
 func (cs *supply) ReallocateMemory(g Grant) error {
@@ -642,7 +656,7 @@ func newRequest(container cache.Container) Request {
 	pod, _ := container.GetPod()
 	full, fraction, isolate, elevate := cpuAllocationPreferences(pod, container)
 	req, lim, mtype := memoryAllocationPreference(pod, container)
-	coldStart := time.Duration(0)
+	var coldStart []ColdStartStage
 
 	if mtype == memoryUnspec {
 		mtype = defaultMemoryType
@@ -653,7 +667,11 @@ func newRequest(container cache.Container) Request {
 		if err != nil {
 			log.Error("Failed to parse cold start preference")
 		} else {
-			coldStart = parsedColdStart.duration
+			for _, stage := range parsedColdStart.stages {
+				// restrict stages to the requested memory types
+				stage.MemoryType &= mtype
+				coldStart = append(coldStart, stage)
+			}
 		}
 	}
 
@@ -665,6 +683,7 @@ func newRequest(container cache.Container) Request {
 		memReq:    req,
 		memLim:    lim,
 		memType:   mtype,
+		tier:      podMemoryTierPreference(pod, container),
 		elevate:   elevate,
 		coldStart: coldStart,
 	}
@@ -748,7 +767,15 @@ func (cr *request) MemoryType() memoryType {
 
 // ColdStart returns the cold start timeout (in milliseconds).
 func (cr *request) ColdStart() time.Duration {
-	return cr.coldStart
+	return coldStartDuration(cr.coldStart)
+}
+
+// ColdStartMemoryType returns the memory types used during the first cold start stage.
+func (cr *request) ColdStartMemoryType() memoryType {
+	if len(cr.coldStart) == 0 {
+		return memoryUnspec
+	}
+	return cr.coldStart[0].MemoryType
 }
 
 // Score collects data for scoring this supply wrt. the given request.
@@ -850,7 +877,7 @@ func (score *score) String() string {
 }
 
 // newGrant creates a CPU grant from the given node for the container.
-func newGrant(n Node, c cache.Container, exclusive cpuset.CPUSet, portion int, initialMt, mt memoryType, allocatedMem memoryMap, coldStart time.Duration) Grant {
+func newGrant(n Node, c cache.Container, exclusive cpuset.CPUSet, portion int, initialMt, mt memoryType, allocatedMem memoryMap, coldStart []ColdStartStage) Grant {
 	mems := n.GetMemset(initialMt)
 	if mems.Size() == 0 {
 		mems = n.GetMemset(memoryDRAM)
@@ -960,6 +987,14 @@ func (cg *grant) RestoreMemset() {
 	mems := cg.GetMemoryNode().GetMemset(cg.memType)
 	cg.memset = mems
 	cg.GetMemoryNode().Policy().applyGrant(cg)
+	if cg.toptierLimit != nil {
+		cg.GetContainer().SetToptierLimit(*cg.toptierLimit)
+		cg.toptierLimit = nil
+	}
+	if cg.cpuShares != nil {
+		cg.GetContainer().SetCPUShares(*cg.cpuShares)
+		cg.cpuShares = nil
+	}
 }
 
 func (cg *grant) ExpandMemset() (bool, error) {
@@ -1025,9 +1060,59 @@ func (cg *grant) UpdateExtraMemoryReservation() {
 }
 
 func (cg *grant) ColdStart() time.Duration {
+	return coldStartDuration(cg.coldStart)
+}
+
+func (cg *grant) ColdStartStages() []ColdStartStage {
 	return cg.coldStart
 }
 
+func (cg *grant) ColdStartStage() (ColdStartStage, bool) {
+	if cg.coldStartStage >= len(cg.coldStart) {
+		return ColdStartStage{}, false
+	}
+	return cg.coldStart[cg.coldStartStage], true
+}
+
+func (cg *grant) NextColdStartStage() (ColdStartStage, bool) {
+	if cg.coldStartStage < len(cg.coldStart) {
+		cg.coldStartStage++
+	}
+	return cg.ColdStartStage()
+}
+
+func (cg *grant) ApplyColdStartStage(stage ColdStartStage) {
+	mems := system.NewIDSet()
+	if stage.MemoryType != memoryUnspec {
+		mems = cg.GetMemoryNode().GetMemset(stage.MemoryType & cg.memType)
+	}
+	if mems.Size() == 0 {
+		mems = cg.GetMemoryNode().GetMemset(cg.memType)
+	}
+	cg.memset = mems.Clone()
+	cg.GetMemoryNode().Policy().applyGrant(cg)
+
+	c := cg.GetContainer()
+	if stage.ToptierLimit != nil {
+		if cg.toptierLimit == nil {
+			limit := c.GetToptierLimit()
+			cg.toptierLimit = &limit
+		}
+		c.SetToptierLimit(stage.ToptierLimit.Value())
+	} else if cg.toptierLimit != nil {
+		c.SetToptierLimit(*cg.toptierLimit)
+	}
+	if stage.CPUShare > 0 {
+		if cg.cpuShares == nil {
+			shares := c.GetCPUShares()
+			cg.cpuShares = &shares
+		}
+		c.SetCPUShares(int64(cache.MilliCPUToShares(stage.CPUShare)))
+	} else if cg.cpuShares != nil {
+		c.SetCPUShares(*cg.cpuShares)
+	}
+}
+
 func (cg *grant) AddTimer(timer *time.Timer) {
 	cg.coldStartTimer = timer
 }
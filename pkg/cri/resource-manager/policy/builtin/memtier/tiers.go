@@ -0,0 +1,292 @@
+// Copyright 2019-2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+// Memory tiers are an alternative to selecting memory by its type. Memory nodes
+// are ranked by their estimated access latency and bandwidth from the CPU nodes
+// of a container, using the heterogeneous memory attributes (HMAT) reported by
+// the kernel, or NUMA distances if those are not available. A container can
+// then ask for
+//   - fastest: the fastest tier, the memory nodes within 25% of the latency
+//     of the best ranked one,
+//   - fastest:N: the N best ranked memory nodes, or
+//   - bulk: the memory nodes outside of the fastest tier,
+// of the memory nodes of its pool. The tier decides both the memory nodes the
+// container is pinned to and the types of memory it is accounted for.
+
+const (
+	// annotation key for the tier of memory to use
+	keyMemoryTierPreference = "memory-tier"
+
+	// memory nodes within this factor of the best latency are in the fastest tier
+	fastTierSlackNum = 5
+	fastTierSlackDen = 4
+)
+
+// memoryTier is a preferred tier of memory.
+type memoryTier struct {
+	fast    bool // use memory in the fastest tier
+	fastest int  // number of fastest memory nodes to use, 0 for the whole tier
+	bulk    bool // use memory outside the fastest tier
+}
+
+// memoryNodeEstimate is the estimated performance of accessing a memory node.
+type memoryNodeEstimate struct {
+	id        system.ID
+	latency   uint64 // read latency (ns), or NUMA distance without memory attributes
+	bandwidth uint64 // read bandwidth (MB/s), 0 without memory attributes
+}
+
+// String stringifies a memoryTier.
+func (t memoryTier) String() string {
+	switch {
+	case t.bulk:
+		return "bulk"
+	case t.fastest > 0:
+		return "fastest:" + strconv.Itoa(t.fastest)
+	case t.fast:
+		return "fastest"
+	}
+	return "any"
+}
+
+// isAny checks if a memoryTier allows any memory.
+func (t memoryTier) isAny() bool {
+	return !t.fast && !t.bulk
+}
+
+// parseMemoryTier parses a memory tier string.
+func parseMemoryTier(value string) (memoryTier, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "":
+		return memoryTier{}, nil
+	case value == "bulk":
+		return memoryTier{bulk: true}, nil
+	case value == "fastest":
+		return memoryTier{fast: true}, nil
+	case strings.HasPrefix(value, "fastest:"):
+		count, err := strconv.Atoi(strings.TrimPrefix(value, "fastest:"))
+		if err != nil || count < 1 {
+			return memoryTier{}, policyError("invalid memory tier '%s'", value)
+		}
+		return memoryTier{fast: true, fastest: count}, nil
+	}
+	return memoryTier{}, policyError("unknown memory tier '%s'", value)
+}
+
+// podMemoryTierPreference returns what tier of memory the container should use.
+func podMemoryTierPreference(pod cache.Pod, c cache.Container) memoryTier {
+	value, ok := pod.GetResmgrAnnotation(keyMemoryTierPreference)
+	if !ok {
+		return memoryTier{}
+	}
+
+	// Try to parse as per-container preference. Assume common for all containers if fails.
+	pref := ""
+	preferences := map[string]string{}
+	if err := yaml.Unmarshal([]byte(value), &preferences); err == nil {
+		p, ok := preferences[c.GetName()]
+		if !ok {
+			log.Debug("container %s has no entry among memory tier preferences", c.PrettyName())
+			return memoryTier{}
+		}
+		pref = p
+	} else {
+		pref = value
+	}
+
+	tier, err := parseMemoryTier(pref)
+	if err != nil {
+		log.Error("invalid memory tier preference ('%s') in annotation %s: %v",
+			pref, keyMemoryTierPreference, err)
+		return memoryTier{}
+	}
+	return tier
+}
+
+// estimateMemoryNode estimates the performance of accessing a memory node from a
+// CPU node. The kernel only reports memory attributes for the best initiators, so
+// for other CPU nodes they are scaled by the ratio of the NUMA distances.
+func estimateMemoryNode(cpu system.ID, mem system.Node, useAttrs bool) memoryNodeEstimate {
+	distance := mem.DistanceFrom(cpu)
+	attrs := mem.MemoryAttributes()
+	if !useAttrs || attrs == nil {
+		return memoryNodeEstimate{id: mem.ID(), latency: uint64(distance)}
+	}
+
+	best := 0
+	for _, id := range attrs.Initiators.Members() {
+		if d := mem.DistanceFrom(id); d > 0 && (best == 0 || d < best) {
+			best = d
+		}
+	}
+
+	latency, bandwidth := attrs.ReadLatency, attrs.ReadBandwidth
+	if best > 0 && distance > best {
+		latency = latency * uint64(distance) / uint64(best)
+		bandwidth = bandwidth * uint64(best) / uint64(distance)
+	}
+
+	return memoryNodeEstimate{id: mem.ID(), latency: latency, bandwidth: bandwidth}
+}
+
+// rankMemoryNodes ranks memory nodes by their estimated performance from the
+// closest of the given CPU nodes, the fastest first.
+func rankMemoryNodes(sys system.System, cpuNodes, memNodes []system.ID) []memoryNodeEstimate {
+	// Memory attributes can be used only if we have them for all nodes.
+	useAttrs := true
+	for _, id := range memNodes {
+		if attrs := sys.Node(id).MemoryAttributes(); attrs == nil || attrs.ReadLatency == 0 {
+			useAttrs = false
+			break
+		}
+	}
+
+	ranked := make([]memoryNodeEstimate, 0, len(memNodes))
+	for _, id := range memNodes {
+		best := memoryNodeEstimate{id: id}
+		for idx, cpu := range cpuNodes {
+			e := estimateMemoryNode(cpu, sys.Node(id), useAttrs)
+			if idx == 0 || e.latency < best.latency ||
+				(e.latency == best.latency && e.bandwidth > best.bandwidth) {
+				best = e
+			}
+		}
+		ranked = append(ranked, best)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		ri, rj := ranked[i], ranked[j]
+		if ri.latency != rj.latency {
+			return ri.latency < rj.latency
+		}
+		if ri.bandwidth != rj.bandwidth {
+			return ri.bandwidth > rj.bandwidth
+		}
+		return ri.id < rj.id
+	})
+
+	return ranked
+}
+
+// selectMemoryTier selects the memory nodes of a tier from ranked memory nodes.
+func selectMemoryTier(ranked []memoryNodeEstimate, tier memoryTier) system.IDSet {
+	mems := system.NewIDSet()
+	if len(ranked) == 0 {
+		return mems
+	}
+
+	limit := ranked[0].latency * fastTierSlackNum / fastTierSlackDen
+	switch {
+	case tier.bulk:
+		for _, e := range ranked {
+			if e.latency > limit {
+				mems.Add(e.id)
+			}
+		}
+	case tier.fastest > 0:
+		for idx, e := range ranked {
+			if idx >= tier.fastest {
+				break
+			}
+			mems.Add(e.id)
+		}
+	case tier.fast:
+		for _, e := range ranked {
+			if e.latency <= limit {
+				mems.Add(e.id)
+			}
+		}
+	}
+
+	return mems
+}
+
+// tierNodes returns the memory nodes within a memory tier, as seen from the CPUs of a node.
+func (p *policy) tierNodes(n Node, tier memoryTier, mems system.IDSet) system.IDSet {
+	if tier.isAny() || mems.Size() < 2 {
+		return mems
+	}
+
+	cpuNodes := []system.ID{}
+	for _, id := range n.GetPhysicalNodeIDs() {
+		if !p.sys.Node(id).CPUSet().IsEmpty() {
+			cpuNodes = append(cpuNodes, id)
+		}
+	}
+
+	ranked := rankMemoryNodes(p.sys, cpuNodes, mems.SortedMembers())
+	tiered := selectMemoryTier(ranked, tier)
+	if tiered.Size() == 0 {
+		log.Debug("  => no memory in tier %s of %s, using all of it", tier, mems)
+		return mems
+	}
+
+	log.Debug("  => memory tier %s of %s (ranked %v): %s", tier, mems, ranked, tiered)
+	return tiered
+}
+
+// tierMemset returns the memory nodes of a grant within the preferred memory tier.
+func (p *policy) tierMemset(g Grant) system.IDSet {
+	pod, ok := g.GetContainer().GetPod()
+	if !ok {
+		return g.Memset()
+	}
+	tier := podMemoryTierPreference(pod, g.GetContainer())
+	return p.tierNodes(g.GetCPUNode(), tier, g.Memset())
+}
+
+// tierMemoryType returns the types of memory a request can use from a pool,
+// narrowed down to the types of memory in the preferred memory tier.
+func (p *policy) tierMemoryType(n Node, req Request) memoryType {
+	memType := req.MemoryType()
+	if memType == memoryUnspec {
+		memType = memoryAll
+	}
+
+	tier := req.(*request).tier
+	if tier.isAny() || n.IsRootNode() {
+		return memType
+	}
+
+	types := memoryUnspec
+	for _, id := range p.tierNodes(n, tier, n.GetMemset(memType)).Members() {
+		switch p.sys.Node(id).GetMemoryType() {
+		case system.MemoryTypeDRAM:
+			types |= memoryDRAM
+		case system.MemoryTypePMEM:
+			types |= memoryPMEM
+		case system.MemoryTypeHBM:
+			types |= memoryHBM
+		}
+	}
+	if memType&types == 0 {
+		return memType
+	}
+
+	return memType & types
+}
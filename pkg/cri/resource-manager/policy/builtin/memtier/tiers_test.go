@@ -0,0 +1,187 @@
+// Copyright 2019-2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"testing"
+
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func TestParseMemoryTier(t *testing.T) {
+	for value, expected := range map[string]memoryTier{
+		"":          {},
+		"bulk":      {bulk: true},
+		"fastest":   {fast: true},
+		"Fastest:3": {fast: true, fastest: 3},
+	} {
+		tier, err := parseMemoryTier(value)
+		if err != nil || tier != expected {
+			t.Errorf("parsing %q: expected %s, got %s (error %v)", value, expected, tier, err)
+		}
+	}
+	for _, value := range []string{"fastest:0", "fastest:x", "slowest"} {
+		if _, err := parseMemoryTier(value); err == nil {
+			t.Errorf("expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestRankMemoryNodes(t *testing.T) {
+	// two sockets with a DRAM and a slow memory-only node each
+	nodes := []*mockSystemNode{
+		{id: 0, distance: []int{10, 21, 17, 28}},
+		{id: 1, distance: []int{21, 10, 28, 17}},
+		{id: 2, distance: []int{17, 28, 10, 28}},
+		{id: 3, distance: []int{28, 17, 28, 10}},
+	}
+	sys := &mockSystem{}
+	for _, n := range nodes {
+		sys.nodes = append(sys.nodes, n)
+	}
+	memNodes := []system.ID{0, 1, 2, 3}
+
+	ranked := rankMemoryNodes(sys, []system.ID{0}, memNodes)
+	if ids := estimateIDs(ranked); !sameIDs(ids, []system.ID{0, 2, 1, 3}) {
+		t.Errorf("expected ranking by distance 0, 2, 1, 3, got %v", ids)
+	}
+
+	attrs := []*system.MemoryAttributes{
+		{Initiators: system.NewIDSet(0), ReadLatency: 100, ReadBandwidth: 100000},
+		{Initiators: system.NewIDSet(1), ReadLatency: 100, ReadBandwidth: 100000},
+		{Initiators: system.NewIDSet(0), ReadLatency: 300, ReadBandwidth: 20000},
+		{Initiators: system.NewIDSet(1), ReadLatency: 300, ReadBandwidth: 20000},
+	}
+	for idx, n := range nodes {
+		n.attrs = attrs[idx]
+	}
+
+	ranked = rankMemoryNodes(sys, []system.ID{0}, memNodes)
+	if ids := estimateIDs(ranked); !sameIDs(ids, []system.ID{0, 1, 2, 3}) {
+		t.Errorf("expected ranking by memory attributes 0, 1, 2, 3, got %v", ids)
+	}
+	if e := ranked[1]; e.latency != 210 || e.bandwidth != 47619 {
+		t.Errorf("unexpected estimate for remote DRAM %+v", e)
+	}
+
+	if mems := selectMemoryTier(ranked, memoryTier{fast: true, fastest: 2}); mems.String() != "0,1" {
+		t.Errorf("expected fastest:2 tier to be 0,1, got %s", mems)
+	}
+	if mems := selectMemoryTier(ranked, memoryTier{fast: true}); mems.String() != "0" {
+		t.Errorf("expected fastest tier to be 0, got %s", mems)
+	}
+	if mems := selectMemoryTier(ranked, memoryTier{bulk: true}); mems.String() != "1,2,3" {
+		t.Errorf("expected bulk tier to be 1,2,3, got %s", mems)
+	}
+
+	// The fastest and bulk tiers split the memory nodes between them.
+	ranked = rankMemoryNodes(sys, []system.ID{0, 1}, memNodes)
+	if mems := selectMemoryTier(ranked, memoryTier{fast: true}); mems.String() != "0,1" {
+		t.Errorf("expected fastest tier from both sockets to be 0,1, got %s", mems)
+	}
+	if mems := selectMemoryTier(ranked, memoryTier{bulk: true}); mems.String() != "2,3" {
+		t.Errorf("expected bulk tier from both sockets to be 2,3, got %s", mems)
+	}
+}
+
+func TestTierMemoryType(t *testing.T) {
+	// a socket with a DRAM and a slow memory-only node
+	sys := &mockSystem{
+		nodes: []system.Node{
+			&mockSystemNode{id: 0, distance: []int{10, 17}, memType: system.MemoryTypeDRAM, cpus: cpuset.MustParse("0-3")},
+			&mockSystemNode{id: 1, distance: []int{17, 10}, memType: system.MemoryTypePMEM},
+		},
+	}
+	p := &policy{sys: sys}
+	n := &numanode{
+		node: node{
+			policy: p,
+			name:   "testnode0",
+			kind:   UnknownNode,
+			parent: &node{kind: UnknownNode},
+			mem:    system.NewIDSet(0),
+			pMem:   system.NewIDSet(1),
+			hbm:    system.NewIDSet(),
+		},
+		id: 0,
+	}
+	n.self.node = n
+
+	tcases := []struct {
+		name     string
+		memType  memoryType
+		tier     memoryTier
+		expected memoryType
+	}{
+		{
+			name:     "any tier",
+			memType:  memoryDRAM | memoryPMEM,
+			expected: memoryDRAM | memoryPMEM,
+		},
+		{
+			name:     "fastest tier",
+			memType:  memoryDRAM | memoryPMEM,
+			tier:     memoryTier{fast: true},
+			expected: memoryDRAM,
+		},
+		{
+			name:     "bulk tier",
+			memType:  memoryDRAM | memoryPMEM,
+			tier:     memoryTier{bulk: true},
+			expected: memoryPMEM,
+		},
+		{
+			name:     "unspecified type in bulk tier",
+			memType:  memoryUnspec,
+			tier:     memoryTier{bulk: true},
+			expected: memoryPMEM,
+		},
+		{
+			name:     "single type",
+			memType:  memoryDRAM,
+			tier:     memoryTier{bulk: true},
+			expected: memoryDRAM,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &request{memType: tc.memType, tier: tc.tier, container: &mockContainer{}}
+			if memType := p.tierMemoryType(n, req); memType != tc.expected {
+				t.Errorf("expected memory type %s, got %s", tc.expected, memType)
+			}
+		})
+	}
+}
+
+func estimateIDs(ranked []memoryNodeEstimate) []system.ID {
+	ids := []system.ID{}
+	for _, e := range ranked {
+		ids = append(ids, e.id)
+	}
+	return ids
+}
+
+func sameIDs(a, b []system.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
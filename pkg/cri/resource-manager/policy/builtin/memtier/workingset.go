@@ -0,0 +1,483 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Working set estimation decides which pages of a process have been accessed
+// during a tracking period. Pages outside of the working set are candidates for
+// demotion, and pages of the working set residing on PMEM for promotion.
+//
+// The available estimators are
+//   - soft-dirty: the soft-dirty bits of the page table entries, which only
+//     catch writes,
+//   - page-idle: the idle page tracking bitmap in /sys/kernel/mm/page_idle,
+//     which catches both reads and writes,
+//   - damon: the DAMON sysfs interface in /sys/kernel/mm/damon, which
+//     catches both reads and writes at memory region granularity.
+
+const (
+	// SoftDirtyEstimator estimates the working set using soft-dirty bits.
+	SoftDirtyEstimator = "soft-dirty"
+	// PageIdleEstimator estimates the working set using idle page tracking.
+	PageIdleEstimator = "page-idle"
+	// DamonEstimator estimates the working set using DAMON.
+	DamonEstimator = "damon"
+
+	// pageIdleChunkSize is the size of pagemap and idle bitmap chunks read at once.
+	pageIdleChunkSize = 64 * 1024
+	// damonMinKdamonds is the minimum number of kdamonds set up for monitoring.
+	damonMinKdamonds = 4
+
+	// pagemap entry bits
+	pagemapSoftDirtyBit = uint64(0x1) << 55
+	pagemapPresentBit   = uint64(0x1) << 63
+	pagemapPFNMask      = (uint64(0x1) << 55) - 1
+)
+
+// workingSetEstimator tracks which pages of processes have been accessed.
+type workingSetEstimator interface {
+	// Name returns the name of the estimator.
+	Name() string
+	// Reset starts a new tracking period for a process.
+	Reset(pid string) error
+	// Scan prepares for checking which pages of a process have been accessed
+	// during the current tracking period.
+	Scan(pid string) (pageChecker, error)
+}
+
+// pageChecker checks if pages of a single process have been accessed.
+type pageChecker interface {
+	// Accessed checks if the page at addr, with the given pagemap entry, has been accessed.
+	Accessed(addr, entry uint64) bool
+	// Close releases any resources used by the checker.
+	Close() error
+}
+
+// newWorkingSetEstimator creates the working set estimator of the given name.
+func newWorkingSetEstimator(name string, period time.Duration) (workingSetEstimator, error) {
+	switch name {
+	case SoftDirtyEstimator, "":
+		return &softDirtyEstimator{procRoot: "/proc"}, nil
+	case PageIdleEstimator:
+		return &pageIdleEstimator{procRoot: "/proc", bitmap: "/sys/kernel/mm/page_idle/bitmap"}, nil
+	case DamonEstimator:
+		return newDamonEstimator("/proc", "/sys/kernel/mm/damon/admin", period), nil
+	}
+	return nil, policyError("unknown working set estimator %q", name)
+}
+
+//
+// soft-dirty bit based estimation
+//
+
+type softDirtyEstimator struct {
+	procRoot string
+}
+
+type softDirtyChecker struct{}
+
+func (e *softDirtyEstimator) Name() string {
+	return SoftDirtyEstimator
+}
+
+func (e *softDirtyEstimator) Reset(pid string) error {
+	// Write magic value "4" to the clear_refs file. This resets the dirty bit.
+	path := filepath.Join(e.procRoot, pid, "clear_refs")
+	return ioutil.WriteFile(path, []byte("4"), 0600)
+}
+
+func (e *softDirtyEstimator) Scan(pid string) (pageChecker, error) {
+	return softDirtyChecker{}, nil
+}
+
+func (softDirtyChecker) Accessed(addr, entry uint64) bool {
+	return entry&pagemapSoftDirtyBit != 0
+}
+
+func (softDirtyChecker) Close() error {
+	return nil
+}
+
+//
+// idle page tracking based estimation
+//
+// The idle bit of a page frame is set by writing to the bitmap and cleared
+// by the kernel when the page is accessed. The heap pages of a process are
+// marked idle when a tracking period starts, so checking pages does not
+// change their state and pages seen for the first time are considered
+// accessed.
+//
+
+type pageIdleEstimator struct {
+	procRoot string
+	bitmap   string
+}
+
+type pageIdleChecker struct {
+	bitmap *os.File
+	chunk  []byte // last chunk read from the bitmap
+	start  int64  // offset of the last chunk read
+}
+
+func (e *pageIdleEstimator) Name() string {
+	return PageIdleEstimator
+}
+
+func (e *pageIdleEstimator) Reset(pid string) error {
+	maps, err := ioutil.ReadFile(filepath.Join(e.procRoot, pid, "maps"))
+	if err != nil {
+		return policyError("failed to read maps of process %s: %v", pid, err)
+	}
+	pageMap, err := os.Open(filepath.Join(e.procRoot, pid, "pagemap"))
+	if err != nil {
+		return policyError("failed to open pagemap of process %s: %v", pid, err)
+	}
+	defer pageMap.Close()
+
+	// Collect the idle bitmap words of all present heap pages, reading the
+	// pagemap in bounded chunks.
+	pageSize := uint64(os.Getpagesize())
+	words := map[int64]uint64{}
+	entries := make([]byte, pageIdleChunkSize)
+	for _, line := range strings.Split(string(maps), "\n") {
+		if !strings.HasSuffix(line, "[heap]") {
+			continue
+		}
+		addrs := strings.SplitN(strings.Fields(line)[0], "-", 2)
+		if len(addrs) != 2 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(addrs[0], 16, 64)
+		end, err2 := strconv.ParseUint(addrs[1], 16, 64)
+		if err1 != nil || err2 != nil || end <= start {
+			continue
+		}
+		for offset, last := start/pageSize*8, end/pageSize*8; offset < last; offset += pageIdleChunkSize {
+			chunk := entries
+			if last-offset < pageIdleChunkSize {
+				chunk = entries[:last-offset]
+			}
+			n, err := pageMap.ReadAt(chunk, int64(offset))
+			if err != nil && n == 0 {
+				log.Error("failed to read pagemap of process %s: %v", pid, err)
+				break
+			}
+			for i := 0; i+8 <= n; i += 8 {
+				entry := binary.LittleEndian.Uint64(chunk[i:])
+				pfn := entry & pagemapPFNMask
+				if entry&pagemapPresentBit == 0 || pfn == 0 {
+					continue
+				}
+				words[int64(pfn/64)*8] |= uint64(1) << (pfn % 64)
+			}
+			if n < len(chunk) {
+				break
+			}
+		}
+	}
+
+	bitmap, err := os.OpenFile(e.bitmap, os.O_WRONLY, 0)
+	if err != nil {
+		return policyError("failed to open idle page bitmap: %v", err)
+	}
+	defer bitmap.Close()
+
+	word := make([]byte, 8)
+	for offset, bits := range words {
+		binary.LittleEndian.PutUint64(word, bits)
+		if _, err := bitmap.WriteAt(word, offset); err != nil {
+			return policyError("failed to mark pages of process %s idle: %v", pid, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *pageIdleEstimator) Scan(pid string) (pageChecker, error) {
+	f, err := os.Open(e.bitmap)
+	if err != nil {
+		return nil, policyError("failed to open idle page bitmap: %v", err)
+	}
+	return &pageIdleChecker{bitmap: f}, nil
+}
+
+func (c *pageIdleChecker) Accessed(addr, entry uint64) bool {
+	pfn := entry & pagemapPFNMask
+	if pfn == 0 {
+		// No PFN available, consider the page accessed.
+		return true
+	}
+
+	offset := int64(pfn/64) * 8
+	bit := uint64(1) << (pfn % 64)
+
+	word, err := c.word(offset)
+	if err != nil {
+		log.Error("failed to read idle page bitmap for PFN 0x%x: %v", pfn, err)
+		return true
+	}
+	idle := word&bit != 0
+
+	return !idle
+}
+
+// word returns the bitmap word at offset, reading the bitmap in chunks.
+func (c *pageIdleChecker) word(offset int64) (uint64, error) {
+	if offset < c.start || offset+8 > c.start+int64(len(c.chunk)) {
+		if c.chunk == nil {
+			c.chunk = make([]byte, pageIdleChunkSize)
+		}
+		c.start = offset - offset%pageIdleChunkSize
+		n, err := c.bitmap.ReadAt(c.chunk[:cap(c.chunk)], c.start)
+		c.chunk = c.chunk[:n]
+		if offset+8 > c.start+int64(n) {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+	return binary.LittleEndian.Uint64(c.chunk[offset-c.start:]), nil
+}
+
+func (c *pageIdleChecker) Close() error {
+	return c.bitmap.Close()
+}
+
+//
+// DAMON based estimation
+//
+// Every monitored process gets a kdamond of its own, with a single 'stat'
+// scheme matching all regions. The aggregation interval is set to the
+// tracking period, so the access counts of the tried regions of the scheme
+// tell which regions have been accessed during the last period. A new process
+// is monitored by a free kdamond, or one left behind by an exited process,
+// without disturbing the others. Since the number of kdamonds can only be
+// changed with all of them stopped, it is doubled when none are free.
+//
+
+type damonEstimator struct {
+	procRoot string
+	admin    string
+	period   time.Duration
+	pids     []string // monitored processes, pids[i] by kdamond #i, "" if free
+}
+
+type damonRegion struct {
+	start    uint64
+	end      uint64
+	accesses uint64
+}
+
+type damonChecker struct {
+	regions []damonRegion
+}
+
+func newDamonEstimator(procRoot, admin string, period time.Duration) *damonEstimator {
+	return &damonEstimator{
+		procRoot: procRoot,
+		admin:    admin,
+		period:   period,
+	}
+}
+
+func (e *damonEstimator) Name() string {
+	return DamonEstimator
+}
+
+func (e *damonEstimator) Reset(pid string) error {
+	free := -1
+	for idx, p := range e.pids {
+		if p == pid {
+			return nil
+		}
+		if free < 0 && (p == "" || !e.alive(p)) {
+			free = idx
+		}
+	}
+
+	if free < 0 {
+		free = len(e.pids)
+		if err := e.grow(); err != nil {
+			return err
+		}
+	}
+
+	return e.start(free, pid)
+}
+
+// alive checks if a process still exists.
+func (e *damonEstimator) alive(pid string) bool {
+	_, err := os.Stat(filepath.Join(e.procRoot, pid))
+	return err == nil
+}
+
+// grow doubles the number of kdamonds, restarting those of live processes.
+func (e *damonEstimator) grow() error {
+	for idx := range e.pids {
+		// Errors are ignored, the kdamond might have stopped with its process.
+		e.write(e.kdamond(idx, "state"), "off")
+	}
+
+	cnt := 2 * len(e.pids)
+	if cnt < damonMinKdamonds {
+		cnt = damonMinKdamonds
+	}
+	pids := e.pids
+	e.pids = make([]string, cnt)
+
+	if err := e.write(filepath.Join(e.admin, "kdamonds", "nr_kdamonds"), strconv.Itoa(cnt)); err != nil {
+		return err
+	}
+
+	for idx, pid := range pids {
+		if pid == "" || !e.alive(pid) {
+			continue
+		}
+		if err := e.start(idx, pid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// start sets up and starts kdamond #idx for monitoring a process.
+func (e *damonEstimator) start(idx int, pid string) error {
+	// Errors are ignored, the kdamond might not be running.
+	e.write(e.kdamond(idx, "state"), "off")
+	e.pids[idx] = ""
+
+	aggr := strconv.FormatInt(e.period.Microseconds(), 10)
+	ctx := e.kdamond(idx, "contexts", "0")
+	for _, setting := range [][2]string{
+		{e.kdamond(idx, "contexts", "nr_contexts"), "1"},
+		{filepath.Join(ctx, "operations"), "vaddr"},
+		{filepath.Join(ctx, "monitoring_attrs", "intervals", "aggr_us"), aggr},
+		{filepath.Join(ctx, "targets", "nr_targets"), "1"},
+		{filepath.Join(ctx, "targets", "0", "pid_target"), pid},
+		{filepath.Join(ctx, "schemes", "nr_schemes"), "1"},
+		{filepath.Join(ctx, "schemes", "0", "action"), "stat"},
+		{e.kdamond(idx, "state"), "on"},
+	} {
+		if err := e.write(setting[0], setting[1]); err != nil {
+			return err
+		}
+	}
+
+	e.pids[idx] = pid
+	return nil
+}
+
+func (e *damonEstimator) Scan(pid string) (pageChecker, error) {
+	idx := -1
+	for i, p := range e.pids {
+		if p == pid {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil, policyError("process %s is not monitored by DAMON", pid)
+	}
+
+	if err := e.write(e.kdamond(idx, "state"), "update_schemes_tried_regions"); err != nil {
+		return nil, err
+	}
+
+	dir := e.kdamond(idx, "contexts", "0", "schemes", "0", "tried_regions")
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, policyError("failed to read DAMON regions: %v", err)
+	}
+
+	checker := &damonChecker{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		region := damonRegion{}
+		for _, field := range []struct {
+			name  string
+			value *uint64
+		}{
+			{"start", &region.start},
+			{"end", &region.end},
+			{"nr_accesses", &region.accesses},
+		} {
+			if *field.value, err = readUint(filepath.Join(dir, entry.Name(), field.name)); err != nil {
+				return nil, err
+			}
+		}
+		checker.regions = append(checker.regions, region)
+	}
+	sort.Slice(checker.regions, func(i, j int) bool {
+		return checker.regions[i].start < checker.regions[j].start
+	})
+
+	return checker, nil
+}
+
+// kdamond returns the path of an entry in the sysfs directory of a kdamond.
+func (e *damonEstimator) kdamond(idx int, entry ...string) string {
+	return filepath.Join(append([]string{e.admin, "kdamonds", strconv.Itoa(idx)}, entry...)...)
+}
+
+// write writes a value to a DAMON sysfs file.
+func (e *damonEstimator) write(path, value string) error {
+	if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+		return policyError("failed to write %q to %s: %v", value, path, err)
+	}
+	return nil
+}
+
+func (c *damonChecker) Accessed(addr, entry uint64) bool {
+	idx := sort.Search(len(c.regions), func(i int) bool {
+		return c.regions[i].end > addr
+	})
+	if idx < len(c.regions) && c.regions[idx].start <= addr {
+		return c.regions[idx].accesses > 0
+	}
+	// Not monitored (yet), consider the page accessed.
+	return true
+}
+
+func (c *damonChecker) Close() error {
+	return nil
+}
+
+// readUint reads an unsigned integer from a file.
+func readUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, policyError("failed to read %s: %v", path, err)
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, policyError("failed to parse %s: %v", path, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,319 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memtier
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory for %s: %v", path, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestSoftDirtyEstimator(t *testing.T) {
+	root, err := ioutil.TempDir("", "memtier-softdirty")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	writeTestFile(t, filepath.Join(root, "123", "clear_refs"), "")
+	e := &softDirtyEstimator{procRoot: root}
+	if err := e.Reset("123"); err != nil {
+		t.Errorf("unexpected reset error: %v", err)
+	}
+	if value := readTestFile(t, filepath.Join(root, "123", "clear_refs")); value != "4" {
+		t.Errorf("expected clear_refs to be reset with 4, got %q", value)
+	}
+
+	checker, _ := e.Scan("123")
+	if !checker.Accessed(0x1000, pagemapSoftDirtyBit|0x42) {
+		t.Errorf("expected soft-dirty page to be accessed")
+	}
+	if checker.Accessed(0x1000, 0x42) {
+		t.Errorf("expected clean page not to be accessed")
+	}
+}
+
+func TestPageIdleEstimator(t *testing.T) {
+	root, err := ioutil.TempDir("", "memtier-pageidle")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	// PFN 65 is idle, PFN 66 is not.
+	bitmap := make([]byte, 16)
+	binary.LittleEndian.PutUint64(bitmap[8:], uint64(1)<<1)
+	path := filepath.Join(root, "bitmap")
+	writeTestFile(t, path, string(bitmap))
+
+	e := &pageIdleEstimator{procRoot: root, bitmap: path}
+	checker, err := e.Scan("123")
+	if err != nil {
+		t.Fatalf("unexpected scan error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		// Checking pages must not change their state.
+		if checker.Accessed(0x1000, 65) {
+			t.Errorf("expected idle page not to be accessed")
+		}
+		if !checker.Accessed(0x2000, 66) {
+			t.Errorf("expected non-idle page to be accessed")
+		}
+	}
+	checker.Close()
+
+	// The present heap pages, PFNs 66 and 68, are marked idle by Reset. For a
+	// real bitmap this would only set bits, our fake file gets the written word.
+	pageSize := os.Getpagesize()
+	heap := 4 * pageSize
+	writeTestFile(t, filepath.Join(root, "123", "maps"),
+		fmt.Sprintf("%08x-%08x r-xp 00000000 08:01 42 /bin/true\n", pageSize, 2*pageSize)+
+			fmt.Sprintf("%08x-%08x rw-p 00000000 00:00 0 [heap]\n", heap, heap+3*pageSize))
+	pagemap := make([]byte, (heap/pageSize+3)*8)
+	for i, entry := range []uint64{pagemapPresentBit | 66, 67, pagemapPresentBit | 68} {
+		binary.LittleEndian.PutUint64(pagemap[(heap/pageSize+i)*8:], entry)
+	}
+	writeTestFile(t, filepath.Join(root, "123", "pagemap"), string(pagemap))
+
+	if err := e.Reset("123"); err != nil {
+		t.Fatalf("unexpected reset error: %v", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if word := binary.LittleEndian.Uint64(data[8:]); word != uint64(1)<<2|uint64(1)<<4 {
+		t.Errorf("expected PFNs 66 and 68 to be marked idle, got bitmap word 0x%x", word)
+	}
+}
+
+func TestPageIdleChunks(t *testing.T) {
+	root, err := ioutil.TempDir("", "memtier-pageidle")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	// The heap spans more than a chunk of pagemap, its first and last pages are present.
+	pageSize := os.Getpagesize()
+	pages := pageIdleChunkSize/8 + 2
+	heap := 4 * pageSize
+	writeTestFile(t, filepath.Join(root, "123", "maps"),
+		fmt.Sprintf("%08x-%08x rw-p 00000000 00:00 0 [heap]\n", heap, heap+pages*pageSize))
+	pagemap := make([]byte, (heap/pageSize+pages)*8)
+	binary.LittleEndian.PutUint64(pagemap[(heap/pageSize)*8:], pagemapPresentBit|1)
+	binary.LittleEndian.PutUint64(pagemap[(heap/pageSize+pages-1)*8:], pagemapPresentBit|2)
+	writeTestFile(t, filepath.Join(root, "123", "pagemap"), string(pagemap))
+
+	// The bitmap spans more than a chunk, PFN 3 in the first one and the last PFN in the second.
+	bitmap := make([]byte, pageIdleChunkSize+8)
+	lastPFN := uint64(len(bitmap)*8 - 1)
+	binary.LittleEndian.PutUint64(bitmap, uint64(1)<<3)
+	binary.LittleEndian.PutUint64(bitmap[pageIdleChunkSize:], uint64(1)<<63)
+	path := filepath.Join(root, "bitmap")
+	writeTestFile(t, path, string(bitmap))
+
+	e := &pageIdleEstimator{procRoot: root, bitmap: path}
+	checker, err := e.Scan("123")
+	if err != nil {
+		t.Fatalf("unexpected scan error: %v", err)
+	}
+	for _, pfn := range []uint64{3, lastPFN, 3} {
+		if checker.Accessed(0x1000, pfn) {
+			t.Errorf("expected idle PFN %d not to be accessed", pfn)
+		}
+	}
+	if !checker.Accessed(0x1000, 4) {
+		t.Errorf("expected non-idle PFN 4 to be accessed")
+	}
+	if !checker.Accessed(0x1000, lastPFN+64) {
+		t.Errorf("expected PFN beyond the bitmap to be accessed")
+	}
+	checker.Close()
+
+	if err := e.Reset("123"); err != nil {
+		t.Fatalf("unexpected reset error: %v", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if word := binary.LittleEndian.Uint64(data); word != uint64(1)<<1|uint64(1)<<2 {
+		t.Errorf("expected PFNs 1 and 2 to be marked idle, got bitmap word 0x%x", word)
+	}
+}
+
+func TestDamonEstimator(t *testing.T) {
+	root, err := ioutil.TempDir("", "memtier-damon")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	proc := filepath.Join(root, "proc")
+	admin := filepath.Join(root, "admin")
+	os.MkdirAll(filepath.Join(proc, "123"), 0755)
+
+	ctx := filepath.Join(admin, "kdamonds", "0", "contexts", "0")
+	for _, dir := range []string{
+		filepath.Join(ctx, "monitoring_attrs", "intervals"),
+		filepath.Join(ctx, "targets", "0"),
+		filepath.Join(ctx, "schemes", "0"),
+	} {
+		os.MkdirAll(dir, 0755)
+	}
+	regions := filepath.Join(ctx, "schemes", "0", "tried_regions")
+	for name, content := range map[string]string{
+		"0/start": "4096", "0/end": "8192", "0/nr_accesses": "0",
+		"1/start": "8192", "1/end": "16384", "1/nr_accesses": "3",
+	} {
+		writeTestFile(t, filepath.Join(regions, name), content+"\n")
+	}
+
+	e := newDamonEstimator(proc, admin, 10*time.Second)
+	if err := e.Reset("123"); err != nil {
+		t.Fatalf("unexpected reset error: %v", err)
+	}
+	for path, expected := range map[string]string{
+		filepath.Join(admin, "kdamonds", "nr_kdamonds"):                "4",
+		filepath.Join(ctx, "operations"):                               "vaddr",
+		filepath.Join(ctx, "targets", "0", "pid_target"):               "123",
+		filepath.Join(ctx, "monitoring_attrs", "intervals", "aggr_us"): "10000000",
+		filepath.Join(ctx, "schemes", "0", "action"):                   "stat",
+		filepath.Join(admin, "kdamonds", "0", "state"):                 "on",
+	} {
+		if value := readTestFile(t, path); value != expected {
+			t.Errorf("expected %s to be %q, got %q", path, expected, value)
+		}
+	}
+
+	checker, err := e.Scan("123")
+	if err != nil {
+		t.Fatalf("unexpected scan error: %v", err)
+	}
+	if state := readTestFile(t, filepath.Join(admin, "kdamonds", "0", "state")); state != "update_schemes_tried_regions" {
+		t.Errorf("expected tried regions to be updated, got state %q", state)
+	}
+	if checker.Accessed(0x1800, 0) {
+		t.Errorf("expected page in unaccessed region not to be accessed")
+	}
+	if !checker.Accessed(0x2800, 0) {
+		t.Errorf("expected page in accessed region to be accessed")
+	}
+	if !checker.Accessed(0x8000, 0) {
+		t.Errorf("expected page outside monitored regions to be accessed")
+	}
+
+	if _, err := e.Scan("456"); err == nil {
+		t.Errorf("expected an error scanning an unmonitored process")
+	}
+}
+
+func TestDamonEstimatorSlots(t *testing.T) {
+	root, err := ioutil.TempDir("", "memtier-damon")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	proc := filepath.Join(root, "proc")
+	admin := filepath.Join(root, "admin")
+	state := func(idx int) string {
+		return readTestFile(t, filepath.Join(admin, "kdamonds", fmt.Sprint(idx), "state"))
+	}
+	target := func(idx int) string {
+		return readTestFile(t, filepath.Join(admin, "kdamonds", fmt.Sprint(idx),
+			"contexts", "0", "targets", "0", "pid_target"))
+	}
+	for idx := 0; idx < 2*damonMinKdamonds; idx++ {
+		ctx := filepath.Join(admin, "kdamonds", fmt.Sprint(idx), "contexts", "0")
+		for _, dir := range []string{
+			filepath.Join(ctx, "monitoring_attrs", "intervals"),
+			filepath.Join(ctx, "targets", "0"),
+			filepath.Join(ctx, "schemes", "0", "tried_regions"),
+		} {
+			os.MkdirAll(dir, 0755)
+		}
+	}
+
+	e := newDamonEstimator(proc, admin, 10*time.Second)
+	for idx := 0; idx < damonMinKdamonds; idx++ {
+		pid := fmt.Sprint(100 + idx)
+		os.MkdirAll(filepath.Join(proc, pid), 0755)
+		if err := e.Reset(pid); err != nil {
+			t.Fatalf("unexpected reset error: %v", err)
+		}
+	}
+
+	// New processes must not disturb the kdamonds of earlier ones.
+	for idx := 0; idx < damonMinKdamonds; idx++ {
+		if s := state(idx); s != "on" {
+			t.Errorf("expected kdamond #%d to be on, got %q", idx, s)
+		}
+		if pid := target(idx); pid != fmt.Sprint(100+idx) {
+			t.Errorf("expected kdamond #%d to monitor %d, got %s", idx, 100+idx, pid)
+		}
+	}
+
+	// The kdamond of an exited process is taken over by a new one.
+	os.RemoveAll(filepath.Join(proc, "101"))
+	os.MkdirAll(filepath.Join(proc, "200"), 0755)
+	if err := e.Reset("200"); err != nil {
+		t.Fatalf("unexpected reset error: %v", err)
+	}
+	if pid := target(1); pid != "200" {
+		t.Errorf("expected kdamond #1 to monitor 200, got %s", pid)
+	}
+	if s := state(0); s != "on" {
+		t.Errorf("expected kdamond #0 to stay on, got %q", s)
+	}
+	if value := readTestFile(t, filepath.Join(admin, "kdamonds", "nr_kdamonds")); value != fmt.Sprint(damonMinKdamonds) {
+		t.Errorf("expected %d kdamonds, got %s", damonMinKdamonds, value)
+	}
+
+	// Without free kdamonds, their number is doubled.
+	os.MkdirAll(filepath.Join(proc, "300"), 0755)
+	if err := e.Reset("300"); err != nil {
+		t.Fatalf("unexpected reset error: %v", err)
+	}
+	if value := readTestFile(t, filepath.Join(admin, "kdamonds", "nr_kdamonds")); value != fmt.Sprint(2*damonMinKdamonds) {
+		t.Errorf("expected %d kdamonds, got %s", 2*damonMinKdamonds, value)
+	}
+	if pid := target(damonMinKdamonds); pid != "300" {
+		t.Errorf("expected kdamond #%d to monitor 300, got %s", damonMinKdamonds, pid)
+	}
+	if pid := target(1); pid != "200" {
+		t.Errorf("expected kdamond #1 to keep monitoring 200, got %s", pid)
+	}
+	if _, err := e.Scan("300"); err != nil {
+		t.Errorf("unexpected scan error: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019-2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podpools
+
+import (
+	"strings"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+)
+
+// Overflow behaviors when a pod finds no free slot in the pools of its type.
+const (
+	// OverflowReject rejects the containers of the pod.
+	OverflowReject = "reject"
+	// OverflowShare runs the containers of the pod in the default pool.
+	OverflowShare = "share"
+)
+
+// options captures our configurable policy parameters.
+type options struct {
+	// PoolTypes are the types of pools carved out of the available CPUs.
+	PoolTypes []*PoolDef `json:"PoolTypes,omitempty"`
+}
+
+// PoolDef describes a type of pod pools.
+type PoolDef struct {
+	// Name of the pool type, also used for selecting it by annotation.
+	Name string `json:"Name"`
+	// CPUs is the number of CPUs in each pool of this type.
+	CPUs int `json:"CPUs"`
+	// Instances is the number of pools of this type, 0 for as many as fit.
+	Instances int `json:"Instances"`
+	// MaxPods is the number of pods sharing a pool, 0 for a single pod.
+	MaxPods int `json:"MaxPods"`
+	// Overflow is the behavior when no pool of this type has a free slot.
+	Overflow string `json:"Overflow,omitempty"`
+}
+
+// Our runtime configuration.
+var opt = defaultOptions().(*options)
+
+// defaultOptions returns a new options instance, all initialized to defaults.
+func defaultOptions() interface{} {
+	return &options{}
+}
+
+// validate checks the pool types for (obvious) invalidity.
+func (o *options) validate() error {
+	names := map[string]struct{}{}
+	fillers := 0
+	for _, def := range o.PoolTypes {
+		if def == nil || def.Name == "" {
+			return policyError("pool types must have a name")
+		}
+		if def.Name == reservedPoolDefName || def.Name == defaultPoolDefName {
+			return policyError("pool type name %q is reserved", def.Name)
+		}
+		if _, ok := names[def.Name]; ok {
+			return policyError("duplicate pool type %q", def.Name)
+		}
+		names[def.Name] = struct{}{}
+
+		if def.CPUs < 1 {
+			return policyError("pool type %q: pools need at least one CPU", def.Name)
+		}
+		if def.Instances < 0 || def.MaxPods < 0 {
+			return policyError("pool type %q: negative limits", def.Name)
+		}
+		if def.Instances == 0 {
+			fillers++
+		}
+		switch strings.ToLower(def.Overflow) {
+		case "", OverflowReject, OverflowShare:
+		default:
+			return policyError("pool type %q: invalid overflow behavior %q", def.Name, def.Overflow)
+		}
+	}
+	if fillers > 1 {
+		return policyError("only one pool type can have as many instances as fit")
+	}
+	return nil
+}
+
+// maxPods returns the number of pods sharing a pool of this type.
+func (def *PoolDef) maxPods() int {
+	if def.MaxPods == 0 {
+		return 1
+	}
+	return def.MaxPods
+}
+
+// overflowShares checks if pods overflowing this type share the default pool.
+func (def *PoolDef) overflowShares() bool {
+	return strings.ToLower(def.Overflow) == OverflowShare
+}
+
+// Register us for configuration handling.
+func init() {
+	config.Register(PolicyPath, PolicyDescription, opt, defaultOptions)
+}
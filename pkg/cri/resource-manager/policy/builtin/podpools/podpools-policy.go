@@ -0,0 +1,682 @@
+// Copyright 2019-2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podpools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/introspect"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/kubernetes"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/policy"
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+const (
+	// PolicyName is the symbol used to pull us in as a builtin policy.
+	PolicyName = "podpools"
+	// PolicyDescription is a short description of this policy.
+	PolicyDescription = "Fixed-size CPU pools with slots for pods."
+	// PolicyPath is the path of this policy in the configuration hierarchy.
+	PolicyPath = "policy." + PolicyName
+
+	// PoolKey is the annotation for selecting the pool type of a pod.
+	PoolKey = "pool." + PolicyName + "." + kubernetes.ResmgrKeyNamespace
+
+	// reservedPoolDefName is the pool type of system pods.
+	reservedPoolDefName = "reserved"
+	// defaultPoolDefName is the pool type of pods without a pool type.
+	defaultPoolDefName = "default"
+
+	// Cache key for storing pod assignments.
+	keyPodPools = "podpools"
+)
+
+// pool is a fixed set of CPUs shared by the containers of the pods in it.
+type pool struct {
+	def      *PoolDef                       // type of this pool
+	instance int                            // instance number among pools of the same type
+	cpus     cpuset.CPUSet                  // CPUs of this pool
+	pods     map[string]map[string]struct{} // cache IDs of containers, by pod ID
+}
+
+// podpools policy runtime state.
+type podpools struct {
+	logger.Logger
+	sys          sysfs.System              // system/topology information
+	cache        cache.Cache               // system state/cache
+	cpuAllocator cpuallocator.CPUAllocator // CPU allocator used by the policy
+	reserved     cpuset.CPUSet             // CPUs of the reserved pool
+	available    cpuset.CPUSet             // CPUs available for other pools
+	nodes        []cpuset.CPUSet           // CPUs of each NUMA node
+	pdefs        []*PoolDef                // configured pool types
+	pools        []*pool                   // all pools, reserved and default first
+}
+
+// Make sure podpools implements the policy backend interface.
+var _ policy.Backend = &podpools{}
+
+// CreatePodpoolsPolicy creates a new policy instance.
+func CreatePodpoolsPolicy(opts *policy.BackendOptions) policy.Backend {
+	p := &podpools{
+		Logger:       logger.NewLogger(PolicyName),
+		cache:        opts.Cache,
+		sys:          opts.System,
+		cpuAllocator: cpuallocator.NewCPUAllocator(opts.System),
+	}
+
+	p.Info("creating policy...")
+
+	for _, id := range p.sys.NodeIDs() {
+		p.nodes = append(p.nodes, p.sys.Node(id).CPUSet())
+	}
+
+	if err := p.setupCPUs(opts.Available, opts.Reserved); err != nil {
+		p.Fatal("failed to set up CPUs: %v", err)
+	}
+	if err := p.carvePools(opt); err != nil {
+		p.Fatal("invalid configuration: %v", err)
+	}
+
+	config.GetModule(PolicyPath).AddNotify(p.configNotify)
+
+	return p
+}
+
+// Name returns the name of this policy.
+func (p *podpools) Name() string {
+	return PolicyName
+}
+
+// Description returns the description for this policy.
+func (p *podpools) Description() string {
+	return PolicyDescription
+}
+
+// Start prepares this policy for accepting allocation/release requests.
+func (p *podpools) Start(add []cache.Container, del []cache.Container) error {
+	p.restoreCache()
+	p.pinPools()
+	p.saveState()
+	p.dumpPools()
+
+	return p.Sync(add, del)
+}
+
+// Sync synchronizes the state of this policy.
+func (p *podpools) Sync(add []cache.Container, del []cache.Container) error {
+	p.Debug("synchronizing state...")
+	for _, c := range del {
+		p.ReleaseResources(c)
+	}
+	for _, c := range add {
+		p.AllocateResources(c)
+	}
+
+	return nil
+}
+
+// AllocateResources allocates resources for the given container.
+func (p *podpools) AllocateResources(c cache.Container) error {
+	podID := c.GetPodID()
+
+	pl := p.poolByPod(podID)
+	if pl == nil {
+		def, err := p.choosePoolDef(c)
+		if err != nil {
+			return err
+		}
+		if pl, err = p.assignPod(def, podID); err != nil {
+			return policyError("failed to allocate %s: %v", c.PrettyName(), err)
+		}
+		p.Info("pod of container %s assigned to pool %s (CPUs %s)", c.PrettyName(), pl, pl.cpus)
+	}
+
+	pl.pods[podID][c.GetCacheID()] = struct{}{}
+	p.pinContainer(c, pl)
+	p.saveState()
+
+	return nil
+}
+
+// ReleaseResources release resources assigned to the given container.
+func (p *podpools) ReleaseResources(c cache.Container) error {
+	p.Debug("releasing container %s...", c.PrettyName())
+
+	if pl := p.releaseContainer(c.GetPodID(), c.GetCacheID()); pl != nil {
+		p.Info("container %s released from pool %s", c.PrettyName(), pl)
+		p.saveState()
+	}
+
+	return nil
+}
+
+// UpdateResources is a resource allocation update request for this policy.
+func (p *podpools) UpdateResources(c cache.Container) error {
+	if pl := p.poolByPod(c.GetPodID()); pl != nil {
+		p.pinContainer(c, pl)
+	}
+	return nil
+}
+
+// Rebalance tries to find an optimal allocation of resources for the current containers.
+func (p *podpools) Rebalance() (bool, error) {
+	p.Debug("(not) rebalancing containers...")
+	return false, nil
+}
+
+// HandleEvent handles policy-specific events.
+func (p *podpools) HandleEvent(*events.Policy) (bool, error) {
+	p.Debug("(not) handling event...")
+	return false, nil
+}
+
+// ExportResourceData provides resource data to export for the container.
+func (p *podpools) ExportResourceData(c cache.Container) map[string]string {
+	pl := p.poolByPod(c.GetPodID())
+	if pl == nil {
+		return nil
+	}
+
+	return map[string]string{
+		policy.ExportSharedCPUs: pl.cpus.String(),
+	}
+}
+
+// Introspect provides data for external introspection.
+func (p *podpools) Introspect(state *introspect.State) {
+	pools := make(map[string]*introspect.Pool, len(p.pools))
+	assignments := make(map[string]*introspect.Assignment)
+	for _, pl := range p.pools {
+		pools[pl.String()] = &introspect.Pool{
+			Name: pl.String(),
+			CPUs: pl.cpus.String(),
+		}
+		for _, containers := range pl.pods {
+			for id := range containers {
+				c, ok := p.cache.LookupContainer(id)
+				if !ok {
+					continue
+				}
+				assignments[c.GetID()] = &introspect.Assignment{
+					ContainerID: c.GetID(),
+					SharedCPUs:  pl.cpus.String(),
+					CPUShare:    requestedMilliCPU(c),
+					Pool:        pl.String(),
+				}
+			}
+		}
+	}
+	state.Pools = pools
+	state.Assignments = assignments
+}
+
+// policyError creates a formatted policy-specific error.
+func policyError(format string, args ...interface{}) error {
+	return fmt.Errorf(PolicyName+": "+format, args...)
+}
+
+// String returns the name of the pool.
+func (pl *pool) String() string {
+	if pl.isShared() {
+		return pl.def.Name
+	}
+	return pl.def.Name + "[" + strconv.Itoa(pl.instance) + "]"
+}
+
+// isShared checks if this is the reserved or the default pool, shared by any number of pods.
+func (pl *pool) isShared() bool {
+	return pl.def.Name == reservedPoolDefName || pl.def.Name == defaultPoolDefName
+}
+
+// hasSlot checks if the pool has a free slot for a pod.
+func (pl *pool) hasSlot() bool {
+	return pl.isShared() || len(pl.pods) < pl.def.maxPods()
+}
+
+// setupCPUs sets up the reserved and the available CPUs.
+func (p *podpools) setupCPUs(available, reserved policy.ConstraintSet) error {
+	offline := p.sys.Offlined()
+
+	cpus, ok := available[policy.DomainCPU]
+	if !ok {
+		p.available = p.sys.CPUSet().Difference(offline)
+	} else {
+		p.available = cpus.(cpuset.CPUSet).Difference(offline)
+	}
+
+	cpus, ok = reserved[policy.DomainCPU]
+	if !ok {
+		return policyError("cannot start without any reserved CPUs")
+	}
+
+	switch cpus.(type) {
+	case cpuset.CPUSet:
+		p.reserved = cpus.(cpuset.CPUSet).Intersection(p.available)
+		if !p.reserved.Equals(cpus.(cpuset.CPUSet)) {
+			return policyError("part of the reserved CPUs (%s) are not available: %s",
+				cpus.(cpuset.CPUSet).String(), cpus.(cpuset.CPUSet).Difference(p.available))
+		}
+	case resource.Quantity:
+		qty := cpus.(resource.Quantity)
+		count := (int(qty.MilliValue()) + 999) / 1000
+		from := p.available
+		reservedCPUs, err := p.cpuAllocator.AllocateCpus(&from, count, false)
+		if err != nil {
+			return policyError("failed to reserve %d CPUs from %s: %v",
+				count, p.available.String(), err)
+		}
+		p.reserved = reservedCPUs
+	}
+
+	p.available = p.available.Difference(p.reserved)
+
+	return nil
+}
+
+// carvePools pre-partitions the available CPUs into pools of the configured
+// types. Pool types with a fixed number of instances are carved first, then
+// the one with as many instances as fit. The remaining CPUs form the default
+// pool, which falls back to the reserved CPUs if no CPUs remain.
+func (p *podpools) carvePools(o *options) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	reserved := &pool{
+		def:  &PoolDef{Name: reservedPoolDefName},
+		cpus: p.reserved,
+		pods: make(map[string]map[string]struct{}),
+	}
+	pools := []*pool{reserved}
+	carved := []*pool{}
+
+	free := p.available
+	var filler *PoolDef
+	for _, def := range o.PoolTypes {
+		if def.Instances == 0 {
+			filler = def
+			continue
+		}
+		for i := 0; i < def.Instances; i++ {
+			pl, err := p.carvePool(def, i, &free)
+			if err != nil {
+				return err
+			}
+			carved = append(carved, pl)
+		}
+	}
+	if filler != nil {
+		for i := 0; ; i++ {
+			pl, err := p.carvePool(filler, i, &free)
+			if err != nil {
+				break
+			}
+			carved = append(carved, pl)
+		}
+	}
+
+	dflt := &pool{
+		def:  &PoolDef{Name: defaultPoolDefName},
+		cpus: free,
+		pods: make(map[string]map[string]struct{}),
+	}
+	if dflt.cpus.IsEmpty() {
+		p.Warn("no CPUs left for the default pool, using reserved CPUs %s", p.reserved)
+		dflt.cpus = p.reserved
+	}
+
+	p.pdefs = o.PoolTypes
+	p.pools = append(append(pools, dflt), carved...)
+
+	return nil
+}
+
+// carvePool carves a pool of the given type from the free CPUs. The pool is
+// carved from full cores within a single NUMA node, so that pools share
+// neither cores nor memory controllers with each other.
+func (p *podpools) carvePool(def *PoolDef, instance int, free *cpuset.CPUSet) (*pool, error) {
+	nodes := p.nodes
+	if len(nodes) == 0 {
+		nodes = []cpuset.CPUSet{*free}
+	}
+	for _, node := range nodes {
+		from := node.Intersection(*free)
+		if from.Size() < def.CPUs {
+			continue
+		}
+		cpus, err := p.cpuAllocator.AllocateCpusWithFlags(&from, def.CPUs, false, cpuallocator.AllocIdleCores)
+		if err != nil || !p.cpuAllocator.CoreSiblings(cpus).IsEmpty() {
+			continue
+		}
+		*free = free.Difference(cpus)
+
+		return &pool{
+			def:      def,
+			instance: instance,
+			cpus:     cpus,
+			pods:     make(map[string]map[string]struct{}),
+		}, nil
+	}
+
+	return nil, policyError("no NUMA node has %d free CPUs in full cores (free: %s) for pool %s[%d]",
+		def.CPUs, free.String(), def.Name, instance)
+}
+
+// poolDefByName returns the pool type with the given name.
+func (p *podpools) poolDefByName(name string) *PoolDef {
+	for _, pl := range p.pools[:2] {
+		if pl.def.Name == name {
+			return pl.def
+		}
+	}
+	for _, def := range p.pdefs {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// choosePoolDef chooses the pool type for the pod of a container.
+func (p *podpools) choosePoolDef(c cache.Container) (*PoolDef, error) {
+	if name, ok := c.GetEffectiveAnnotation(PoolKey); ok {
+		def := p.poolDefByName(name)
+		if def == nil {
+			return nil, policyError("container %s: unknown pool type %q", c.PrettyName(), name)
+		}
+		if def.Name == reservedPoolDefName && c.GetNamespace() != metav1.NamespaceSystem {
+			return nil, policyError("container %s: pool type %q is only for %s pods",
+				c.PrettyName(), name, metav1.NamespaceSystem)
+		}
+		return def, nil
+	}
+
+	if c.GetNamespace() == metav1.NamespaceSystem {
+		return p.poolDefByName(reservedPoolDefName), nil
+	}
+
+	return p.poolDefByName(defaultPoolDefName), nil
+}
+
+// poolByPod returns the pool a pod is assigned to.
+func (p *podpools) poolByPod(podID string) *pool {
+	for _, pl := range p.pools {
+		if _, ok := pl.pods[podID]; ok {
+			return pl
+		}
+	}
+	return nil
+}
+
+// poolByName returns the pool with the given type and instance.
+func (p *podpools) poolByName(name string, instance int) *pool {
+	for _, pl := range p.pools {
+		if pl.def.Name == name && (pl.isShared() || pl.instance == instance) {
+			return pl
+		}
+	}
+	return nil
+}
+
+// assignPod assigns a pod to the least occupied pool of the given type with
+// a free slot. If there is none, the pod is either rejected or assigned to
+// the default pool, depending on the overflow behavior of the type.
+func (p *podpools) assignPod(def *PoolDef, podID string) (*pool, error) {
+	p.prunePods()
+
+	var best *pool
+	for _, pl := range p.pools {
+		if pl.def != def || !pl.hasSlot() {
+			continue
+		}
+		if best == nil || len(pl.pods) < len(best.pods) {
+			best = pl
+		}
+	}
+
+	if best == nil {
+		if !def.overflowShares() {
+			return nil, policyError("no free slots in pools of type %s", def.Name)
+		}
+		p.Warn("no free slots in pools of type %s, sharing the default pool", def.Name)
+		best = p.poolByName(defaultPoolDefName, 0)
+	}
+
+	best.pods[podID] = make(map[string]struct{})
+	return best, nil
+}
+
+// releaseContainer removes a container from its pool. The pod keeps its
+// slot until it is gone, so restarted containers end up in the same pool.
+func (p *podpools) releaseContainer(podID, id string) *pool {
+	pl := p.poolByPod(podID)
+	if pl == nil {
+		return nil
+	}
+	if _, ok := pl.pods[podID][id]; !ok {
+		return nil
+	}
+
+	delete(pl.pods[podID], id)
+
+	return pl
+}
+
+// prunePods frees the slots of pods which are gone.
+func (p *podpools) prunePods() {
+	for _, pl := range p.pools {
+		for podID, containers := range pl.pods {
+			if len(containers) > 0 {
+				continue
+			}
+			if _, ok := p.cache.LookupPod(podID); !ok {
+				delete(pl.pods, podID)
+				p.Info("released slot of pod %s in pool %s", podID, pl)
+			}
+		}
+	}
+}
+
+// pinContainer pins a container to the CPUs of its pool.
+func (p *podpools) pinContainer(c cache.Container, pl *pool) {
+	c.SetCpusetCpus(pl.cpus.String())
+	c.SetCPUShares(int64(cache.MilliCPUToShares(requestedMilliCPU(c))))
+}
+
+// requestedMilliCPU returns the milli-CPU requested by a container.
+func requestedMilliCPU(c cache.Container) int {
+	if req, ok := c.GetResourceRequirements().Requests[corev1.ResourceCPU]; ok {
+		return int(req.MilliValue())
+	}
+	return 0
+}
+
+// configNotify re-carves the pools and reassigns the pods in them.
+func (p *podpools) configNotify(event config.Event, source config.Source) error {
+	p.Info("configuration %s", event)
+
+	saved := p.savedPods()
+	old := p.pools
+	if err := p.carvePools(opt); err != nil {
+		p.Error("invalid configuration: %v", err)
+		p.pools = old
+		return err
+	}
+
+	p.restorePods(saved)
+	p.pinPools()
+	p.saveState()
+	p.dumpPools()
+
+	return nil
+}
+
+// pinPools pins the containers of all pods to the CPUs of their pools.
+func (p *podpools) pinPools() {
+	for _, pl := range p.pools {
+		for _, containers := range pl.pods {
+			for id := range containers {
+				if c, ok := p.cache.LookupContainer(id); ok {
+					p.pinContainer(c, pl)
+				}
+			}
+		}
+	}
+}
+
+// dumpPools dumps the current pools.
+func (p *podpools) dumpPools() {
+	p.Info("current pools:")
+	for _, pl := range p.pools {
+		p.Info("  %s: CPUs %s, %d pods", pl, pl.cpus, len(pl.pods))
+	}
+}
+
+// saveState saves the pod assignments in the cache.
+func (p *podpools) saveState() {
+	p.cache.SetPolicyEntry(keyPodPools, cache.Cachable(&cachedPods{p: p.savedPods()}))
+}
+
+// restoreCache restores the pod assignments from the cache.
+func (p *podpools) restoreCache() {
+	cp := cachedPods{}
+	if !p.cache.GetPolicyEntry(keyPodPools, &cp) {
+		p.Warn("initializing empty policy state...")
+		return
+	}
+
+	p.Info("restoring cached policy state...")
+	p.restorePods(cp.p)
+}
+
+// savedPods returns the pod assignments in their cachable form.
+func (p *podpools) savedPods() []*savedPod {
+	saved := []*savedPod{}
+	for _, pl := range p.pools {
+		for podID, containers := range pl.pods {
+			sp := &savedPod{
+				ID:       podID,
+				Pool:     pl.def.Name,
+				Instance: pl.instance,
+			}
+			for id := range containers {
+				sp.Containers = append(sp.Containers, id)
+			}
+			saved = append(saved, sp)
+		}
+	}
+	return saved
+}
+
+// restorePods restores pod assignments. Pods are put back in the same pool
+// if it exists and has a free slot. Otherwise they are assigned to another
+// pool of the same type, or to the default pool if there is none.
+func (p *podpools) restorePods(saved []*savedPod) {
+	for _, pl := range p.pools {
+		pl.pods = make(map[string]map[string]struct{})
+	}
+
+	pending := []*savedPod{}
+	for _, sp := range saved {
+		pl := p.poolByName(sp.Pool, sp.Instance)
+		if pl == nil || !pl.hasSlot() {
+			pending = append(pending, sp)
+			continue
+		}
+		p.restorePod(pl, sp)
+	}
+
+	for _, sp := range pending {
+		def := p.poolDefByName(sp.Pool)
+		if def == nil {
+			p.Warn("pool type %s of pod %s is gone, using the default pool", sp.Pool, sp.ID)
+			def = p.poolDefByName(defaultPoolDefName)
+		}
+		pl, err := p.assignPod(def, sp.ID)
+		if err != nil {
+			p.Warn("pod %s falls back to the default pool: %v", sp.ID, err)
+			pl, _ = p.assignPod(p.poolDefByName(defaultPoolDefName), sp.ID)
+		}
+		p.restorePod(pl, sp)
+	}
+}
+
+// restorePod puts a pod with its containers in a pool.
+func (p *podpools) restorePod(pl *pool, sp *savedPod) {
+	containers := make(map[string]struct{}, len(sp.Containers))
+	for _, id := range sp.Containers {
+		containers[id] = struct{}{}
+	}
+	pl.pods[sp.ID] = containers
+}
+
+//
+// Cachable data types for storing private podpools policy data in the cache.
+//
+
+type savedPod struct {
+	ID         string
+	Pool       string
+	Instance   int
+	Containers []string
+}
+
+type cachedPods struct {
+	p []*savedPod
+}
+
+var _ cache.Cachable = &cachedPods{}
+
+var _ json.Marshaler = &cachedPods{}
+var _ json.Unmarshaler = &cachedPods{}
+
+func (cp *cachedPods) Get() interface{} {
+	return *cp
+}
+
+func (cp *cachedPods) Set(value interface{}) {
+	switch value.(type) {
+	case cachedPods:
+		cp.p = value.(cachedPods).p
+	case *cachedPods:
+		cp.p = value.(*cachedPods).p
+	}
+}
+
+func (cp *cachedPods) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cp.p)
+}
+
+func (cp *cachedPods) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &cp.p)
+}
+
+// Register us as a policy implementation.
+func init() {
+	policy.Register(PolicyName, PolicyDescription, CreatePodpoolsPolicy)
+}
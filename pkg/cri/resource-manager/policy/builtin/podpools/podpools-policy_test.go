@@ -0,0 +1,270 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podpools
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	fakecpuallocator "github.com/intel/cri-resource-manager/pkg/cpuallocator/fake"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+)
+
+// testCache is a cache with only a set of pods.
+type testCache struct {
+	cache.Cache
+	pods map[string]struct{}
+}
+
+func (c *testCache) LookupPod(id string) (cache.Pod, bool) {
+	_, ok := c.pods[id]
+	return nil, ok
+}
+
+// testContainer is a container with only a namespace and a pool annotation.
+type testContainer struct {
+	cache.Container
+	namespace string
+	pool      string
+}
+
+func (c *testContainer) GetNamespace() string {
+	return c.namespace
+}
+
+func (c *testContainer) GetEffectiveAnnotation(key string) (string, bool) {
+	if key != PoolKey || c.pool == "" {
+		return "", false
+	}
+	return c.pool, true
+}
+
+func (c *testContainer) PrettyName() string {
+	return c.namespace + "/" + c.pool
+}
+
+// newTestPolicy creates a policy with CPU 0 reserved and CPUs 1-9 available.
+func newTestPolicy(t *testing.T, pdefs ...*PoolDef) *podpools {
+	p := &podpools{
+		Logger:       logger.NewLogger(PolicyName),
+		cache:        &testCache{pods: map[string]struct{}{}},
+		cpuAllocator: fakecpuallocator.NewCPUAllocator(1),
+		reserved:     cpuset.NewCPUSet(0),
+		available:    cpuset.MustParse("1-9"),
+	}
+	if err := p.carvePools(&options{PoolTypes: pdefs}); err != nil {
+		t.Fatalf("failed to carve pools: %v", err)
+	}
+	return p
+}
+
+func poolNames(pools []*pool) []string {
+	names := []string{}
+	for _, pl := range pools {
+		names = append(names, pl.String()+":"+pl.cpus.String())
+	}
+	return names
+}
+
+func TestCarvePools(t *testing.T) {
+	p := newTestPolicy(t,
+		&PoolDef{Name: "nfv", CPUs: 3},
+		&PoolDef{Name: "dpdk", CPUs: 2, Instances: 2},
+	)
+	expected := []string{"reserved:0", "default:8-9", "dpdk[0]:1-2", "dpdk[1]:3-4", "nfv[0]:5-7"}
+	if names := poolNames(p.pools); fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("expected pools %v, got %v", expected, names)
+	}
+
+	p = newTestPolicy(t, &PoolDef{Name: "nfv", CPUs: 3})
+	if dflt := p.poolByName(defaultPoolDefName, 0); !dflt.cpus.Equals(p.reserved) {
+		t.Errorf("expected default pool to fall back to reserved CPUs, got %s", dflt.cpus)
+	}
+
+	err := (&podpools{
+		Logger:       logger.NewLogger(PolicyName),
+		cpuAllocator: fakecpuallocator.NewCPUAllocator(1),
+		available:    cpuset.MustParse("1-3"),
+	}).carvePools(&options{PoolTypes: []*PoolDef{{Name: "nfv", CPUs: 2, Instances: 2}}})
+	if err == nil {
+		t.Errorf("expected an error carving more CPUs than available")
+	}
+}
+
+func TestCarveNUMALocalCores(t *testing.T) {
+	// two NUMA nodes of three cores with two threads each, CPU 0 reserved
+	newPolicy := func() *podpools {
+		return &podpools{
+			Logger:       logger.NewLogger(PolicyName),
+			cpuAllocator: fakecpuallocator.NewCPUAllocator(2),
+			reserved:     cpuset.NewCPUSet(0),
+			available:    cpuset.MustParse("1-11"),
+			nodes:        []cpuset.CPUSet{cpuset.MustParse("0-5"), cpuset.MustParse("6-11")},
+		}
+	}
+
+	p := newPolicy()
+	if err := p.carvePools(&options{PoolTypes: []*PoolDef{{Name: "nfv", CPUs: 4}}}); err != nil {
+		t.Fatalf("failed to carve pools: %v", err)
+	}
+	expected := []string{"reserved:0", "default:1,10-11", "nfv[0]:2-5", "nfv[1]:6-9"}
+	if names := poolNames(p.pools); fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("expected pools %v, got %v", expected, names)
+	}
+
+	for _, def := range []*PoolDef{
+		{Name: "odd", CPUs: 3, Instances: 1},
+		{Name: "wide", CPUs: 8, Instances: 1},
+	} {
+		if err := newPolicy().carvePools(&options{PoolTypes: []*PoolDef{def}}); err == nil {
+			t.Errorf("expected an error carving %d CPUs in full cores of a NUMA node", def.CPUs)
+		}
+	}
+}
+
+func TestRestorePods(t *testing.T) {
+	p := newTestPolicy(t, &PoolDef{Name: "nfv", CPUs: 2, Instances: 2})
+
+	saved := []*savedPod{
+		{ID: "pod0", Pool: "nfv", Instance: 1, Containers: []string{"c0"}},
+		{ID: "pod1", Pool: "nfv", Instance: 1, Containers: []string{"c1"}},
+		{ID: "pod2", Pool: "gone", Instance: 0, Containers: []string{"c2"}},
+	}
+	p.restorePods(saved)
+
+	for pod, expected := range map[string]string{
+		"pod0": "nfv[1]",
+		"pod1": "nfv[0]",
+		"pod2": defaultPoolDefName,
+	} {
+		if pl := p.poolByPod(pod); pl == nil || pl.String() != expected {
+			t.Errorf("expected %s restored in pool %s, got %v", pod, expected, pl)
+		}
+	}
+}
+
+func TestAssignPods(t *testing.T) {
+	p := newTestPolicy(t,
+		&PoolDef{Name: "nfv", CPUs: 4, Instances: 1, MaxPods: 2},
+		&PoolDef{Name: "dpdk", CPUs: 2, Instances: 1, Overflow: OverflowShare},
+	)
+	nfv, dpdk := p.poolDefByName("nfv"), p.poolDefByName("dpdk")
+	pods := p.cache.(*testCache).pods
+
+	for _, pod := range []string{"pod0", "pod1", "pod2", "pod3", "pod4"} {
+		pods[pod] = struct{}{}
+	}
+	for _, pod := range []string{"pod0", "pod1"} {
+		if pl, err := p.assignPod(nfv, pod); err != nil || pl.def != nfv {
+			t.Fatalf("expected %s in an nfv pool, got %v, %v", pod, pl, err)
+		}
+	}
+	if _, err := p.assignPod(nfv, "pod2"); err == nil {
+		t.Errorf("expected pod2 to be rejected by full nfv pools")
+	}
+
+	if pl, err := p.assignPod(dpdk, "pod3"); err != nil || pl.def != dpdk {
+		t.Fatalf("expected pod3 in a dpdk pool, got %v, %v", pl, err)
+	}
+	if pl, err := p.assignPod(dpdk, "pod4"); err != nil || pl.def.Name != defaultPoolDefName {
+		t.Errorf("expected pod4 to overflow to the default pool, got %v, %v", pl, err)
+	}
+
+	// the slot is kept after the last container of the pod is released
+	p.poolByPod("pod0").pods["pod0"]["c0"] = struct{}{}
+	p.poolByPod("pod0").pods["pod0"]["c1"] = struct{}{}
+	p.releaseContainer("pod0", "c0")
+	p.releaseContainer("pod0", "c1")
+	if p.poolByPod("pod0") == nil {
+		t.Errorf("expected pod0 to keep its slot without containers")
+	}
+	if _, err := p.assignPod(nfv, "pod2"); err == nil {
+		t.Errorf("expected pod2 to be rejected while pod0 keeps its slot")
+	}
+
+	// the slot is freed once the pod is gone
+	delete(pods, "pod0")
+	if pl, err := p.assignPod(nfv, "pod2"); err != nil || pl.def != nfv {
+		t.Errorf("expected pod2 in the freed nfv slot, got %v, %v", pl, err)
+	}
+	if p.poolByPod("pod0") != nil {
+		t.Errorf("expected the slot of pod0 to be freed")
+	}
+}
+
+func TestChoosePoolDef(t *testing.T) {
+	p := newTestPolicy(t, &PoolDef{Name: "nfv", CPUs: 2})
+
+	tcases := []struct {
+		name      string
+		namespace string
+		pool      string
+		expected  string
+	}{
+		{
+			name:      "annotated pool",
+			namespace: "default",
+			pool:      "nfv",
+			expected:  "nfv",
+		},
+		{
+			name:      "unannotated pod",
+			namespace: "default",
+			expected:  defaultPoolDefName,
+		},
+		{
+			name:      "system pod",
+			namespace: metav1.NamespaceSystem,
+			expected:  reservedPoolDefName,
+		},
+		{
+			name:      "annotated reserved pool for a system pod",
+			namespace: metav1.NamespaceSystem,
+			pool:      reservedPoolDefName,
+			expected:  reservedPoolDefName,
+		},
+		{
+			name:      "annotated reserved pool for a non-system pod",
+			namespace: "default",
+			pool:      reservedPoolDefName,
+		},
+		{
+			name:      "unknown pool",
+			namespace: "default",
+			pool:      "gone",
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			def, err := p.choosePoolDef(&testContainer{namespace: tc.namespace, pool: tc.pool})
+			if tc.expected == "" {
+				if err == nil {
+					t.Errorf("expected an error, got pool type %s", def.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if def.Name != tc.expected {
+				t.Errorf("expected pool type %s, got %s", tc.expected, def.Name)
+			}
+		})
+	}
+}
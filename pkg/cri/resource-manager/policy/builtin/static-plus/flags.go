@@ -0,0 +1,46 @@
+// Copyright 2019 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staticplus
+
+import (
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+)
+
+// options captures our configurable policy parameters.
+type options struct {
+	// StrictSMTIsolation controls whether exclusive CPUs are granted as full physical cores by default.
+	StrictSMTIsolation bool `json:",omitempty"`
+	// ParkIdleSiblings controls whether idle siblings of full core grants are put offline.
+	ParkIdleSiblings bool `json:",omitempty"`
+	// StickyAllocationPeriod is how long the exclusive CPUs of a released container are kept for its replacement.
+	StickyAllocationPeriod config.Duration `json:",omitempty"`
+}
+
+// Our runtime configuration.
+var opt = defaultOptions().(*options)
+
+// defaultOptions returns a new options instance, all initialized to defaults.
+func defaultOptions() interface{} {
+	return &options{
+		StickyAllocationPeriod: config.Duration(30 * time.Second),
+	}
+}
+
+// Register us for configuration handling.
+func init() {
+	config.Register(PolicyPath, PolicyDescription, opt, defaultOptions)
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staticplus
+
+import (
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+)
+
+//
+// Init containers of a pod run to completion, one at a time, before any of
+// the application containers is created. Once the first application container
+// of a pod is allocated, the assignments of the init containers are released
+// and their exclusive CPUs are inherited by the application containers. This
+// way the pod only ever accounts for max(init, sum(app)) CPUs, like the
+// effective request used by kubelet, instead of init and app at the same time.
+//
+
+// isInitContainer checks if a container is an init container of its pod.
+func isInitContainer(c cache.Container) bool {
+	pod, ok := c.GetPod()
+	if !ok {
+		return false
+	}
+	_, ok = pod.GetPodResourceRequirements().InitContainers[c.GetName()]
+	return ok
+}
+
+// isCompletedInitContainer checks if a container is an init container which
+// has already completed.
+func (p *staticplus) isCompletedInitContainer(c cache.Container) bool {
+	if !isInitContainer(c) {
+		return false
+	}
+	if c.GetState() == cache.ContainerStateExited {
+		return true
+	}
+
+	pod, _ := c.GetPod()
+	for _, other := range pod.GetContainers() {
+		if _, ok := p.allocations[other.GetCacheID()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseInitContainers releases the assignments of the init containers of the
+// pod of an application container, letting the pod inherit their exclusive CPUs.
+func (p *staticplus) releaseInitContainers(c cache.Container) {
+	if isInitContainer(c) {
+		return
+	}
+	pod, ok := c.GetPod()
+	if !ok {
+		return
+	}
+
+	p.pruneInheritedCPUs()
+
+	for _, ic := range pod.GetInitContainers() {
+		id := ic.GetCacheID()
+		a, ok := p.allocations[id]
+		if !ok {
+			continue
+		}
+
+		p.Info("releasing completed init container %s for %s", ic.PrettyName(), c.PrettyName())
+
+		if err := p.delAssignment(a, id); err != nil {
+			p.Warn("failed to release init container %s: %v", ic.PrettyName(), err)
+			continue
+		}
+
+		if !a.exclusive.IsEmpty() {
+			p.inherited[c.GetPodID()] = p.inherited[c.GetPodID()].Union(a.exclusive)
+		}
+	}
+}
+
+// takeInheritedCPUs takes cnt exclusive CPUs inherited from the init containers
+// of the pod of a container, if enough of them are still free in the isolated
+// or in the shared pool. With strict SMT isolation the CPUs are taken as full
+// cores, along with their idle hyperthread siblings.
+func (p *staticplus) takeInheritedCPUs(c cache.Container, cnt int, strict bool, flags cpuallocator.AllocFlag) (cpuset.CPUSet, cpuset.CPUSet, bool) {
+	none := cpuset.NewCPUSet()
+
+	podID := c.GetPodID()
+	inherited, ok := p.inherited[podID]
+	if !ok {
+		return none, none, false
+	}
+
+	for _, from := range []*cpuset.CPUSet{&p.isolated, &p.shared} {
+		avail := inherited.Intersection(*from)
+		if strict {
+			avail = avail.Intersection(p.cpuAllocator.IdleCoreCpus(*from))
+		}
+		if avail.Size() < cnt {
+			continue
+		}
+
+		cpus, err := p.cpuAllocator.AllocateCpusWithFlags(&avail, cnt, true, flags)
+		if err != nil {
+			continue
+		}
+		idle := none
+		if strict {
+			idle = p.cpuAllocator.CoreSiblings(cpus).Intersection(*from)
+		}
+
+		// leave at least one CPU in the shared pool, like normal slicing does
+		if from == &p.shared && from.Size()-cpus.Size()-idle.Size() < 1 {
+			continue
+		}
+
+		*from = from.Difference(cpus).Difference(idle)
+
+		if inherited = inherited.Difference(cpus); inherited.IsEmpty() {
+			delete(p.inherited, podID)
+		} else {
+			p.inherited[podID] = inherited
+		}
+
+		p.Info("container %s inherits CPUs %s from init containers", c.PrettyName(), cpus.String())
+
+		return cpus, idle, true
+	}
+
+	return none, none, false
+}
+
+// pruneInheritedCPUs forgets CPUs inherited by pods which are gone.
+func (p *staticplus) pruneInheritedCPUs() {
+	for podID := range p.inherited {
+		if _, ok := p.cache.LookupPod(podID); !ok {
+			delete(p.inherited, podID)
+		}
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"strconv"
 
+	"sigs.k8s.io/yaml"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,17 +41,26 @@ const (
 	PolicyName = "static-plus"
 	// PolicyDescription is a short description of this policy.
 	PolicyDescription = "A simple policy supporting exclusive/pinned and shared allocations."
+	// PolicyPath is the path of this policy in the configuration hierarchy.
+	PolicyPath = "policy." + PolicyName
 	// Cache key for storing container resource allocations.
 	keyAllocations = "allocations"
 	// Cache key for storing the shared pool.
 	keySharedPool = "shared-pool"
 	// keyPreferIsolated is the annotation used to mark pods preferring isolated CPUs.
 	keyPreferIsolated = "prefer-isolated-cpus"
+	// keyPreferCoreType is the annotation used to mark pods preferring performance or efficient cores.
+	keyPreferCoreType = "prefer-core-type"
+	// keyStrictSMTIsolation is the annotation used to mark pods requesting exclusive full physical cores.
+	keyStrictSMTIsolation = "strict-smt-isolation"
+	// Cache key for storing idle hyperthread siblings parked offline.
+	keyParkedCPUs = "parked-cpus"
 )
 
 // Assignment tracks resource assignments for a single container.
 type Assignment struct {
 	exclusive cpuset.CPUSet // exclusively allocated cpus
+	idle      cpuset.CPUSet // idle hyperthread siblings of exclusive cpus
 	shared    int           // milli-cpus to allocated from shared cpus
 }
 
@@ -68,6 +79,9 @@ type staticplus struct {
 	cache        cache.Cache               // system state/cache
 	shared       cpuset.CPUSet             // pool for fractional and shared allocations
 	cpuAllocator cpuallocator.CPUAllocator // CPU allocator used by the policy
+	parked       cpuset.CPUSet             // idle hyperthread siblings parked offline
+	sticky       map[string]*stickyCPUs    // exclusive CPUs kept for restarted containers
+	inherited    map[string]cpuset.CPUSet  // CPUs of completed init containers, by pod ID
 }
 
 // Make sure staticplus implements the policy backend interface.
@@ -80,10 +94,14 @@ func CreateStaticPlusPolicy(opts *policy.BackendOptions) policy.Backend {
 		cache:        opts.Cache,
 		sys:          opts.System,
 		cpuAllocator: cpuallocator.NewCPUAllocator(opts.System),
+		sticky:       make(map[string]*stickyCPUs),
+		inherited:    make(map[string]cpuset.CPUSet),
 	}
 
 	p.Info("creating policy...")
 
+	p.restoreParkedCPUs()
+
 	if err := p.setupPools(opts.Available, opts.Reserved); err != nil {
 		p.Fatal("failed to set up cpu pools: %v", err)
 	}
@@ -113,6 +131,10 @@ func (p *staticplus) Start(add []cache.Container, del []cache.Container) error {
 		return policyError("failed to start: %v", err)
 	}
 
+	for _, a := range p.allocations {
+		p.parkIdleSiblings(a)
+	}
+
 	return p.Sync(add, del)
 }
 
@@ -141,6 +163,13 @@ func (p *staticplus) AllocateResources(c cache.Container) error {
 		return nil
 	}
 
+	if p.isCompletedInitContainer(c) {
+		p.Debug("not allocating completed init container %s", c.PrettyName())
+		return nil
+	}
+
+	p.releaseInitContainers(c)
+
 	a, err := p.assignCpus(c)
 	if err != nil {
 		return err
@@ -160,6 +189,8 @@ func (p *staticplus) ReleaseResources(c cache.Container) error {
 		return nil
 	}
 
+	p.saveStickyCPUs(c, a)
+
 	return p.delAssignment(a, id)
 }
 
@@ -210,8 +241,56 @@ func (p *staticplus) ExportResourceData(c cache.Container) map[string]string {
 }
 
 // Introspect provides data for external introspection.
-func (p *staticplus) Introspect(*introspect.State) {
-	return
+func (p *staticplus) Introspect(state *introspect.State) {
+	idle := cpuset.NewCPUSet()
+	assignments := make(map[string]*introspect.Assignment, len(p.allocations))
+	for id, a := range p.allocations {
+		c, ok := p.cache.LookupContainer(id)
+		if !ok {
+			continue
+		}
+		ia := &introspect.Assignment{
+			ContainerID:   c.GetID(),
+			CPUShare:      a.shared,
+			ExclusiveCPUs: a.exclusive.String(),
+			IdleCPUs:      a.idle.String(),
+		}
+		switch {
+		case c.GetNamespace() == metav1.NamespaceSystem:
+			ia.Pool = "reserved"
+			ia.SharedCPUs = p.reserved.String()
+		case a.exclusive.IsEmpty():
+			ia.Pool = "shared"
+			ia.SharedCPUs = p.shared.String()
+		case !a.exclusive.Intersection(p.sys.Isolated()).IsEmpty():
+			ia.Pool = "isolated"
+		default:
+			ia.Pool = "shared"
+		}
+		if a.shared > 0 && ia.SharedCPUs == "" {
+			ia.SharedCPUs = p.shared.String()
+		}
+		idle = idle.Union(a.idle)
+		assignments[ia.ContainerID] = ia
+	}
+	state.Assignments = assignments
+
+	state.Pools = map[string]*introspect.Pool{
+		"reserved": {
+			Name: "reserved",
+			CPUs: p.reserved.String(),
+		},
+		"shared": {
+			Name:     "shared",
+			CPUs:     p.shared.String(),
+			IdleCPUs: idle.Difference(p.sys.Isolated()).String(),
+		},
+		"isolated": {
+			Name:     "isolated",
+			CPUs:     p.isolated.String(),
+			IdleCPUs: idle.Intersection(p.sys.Isolated()).String(),
+		},
+	}
 }
 
 // policyError creates a formatted policy-specific error.
@@ -278,7 +357,7 @@ func (p *staticplus) setupPools(available, reserved policy.ConstraintSet) error
 			p.reserved = cpuset.NewCPUSet(0)
 			p.available = p.available.Difference(p.reserved)
 		} else {
-			p.reserved, err = p.takeCPUs(&p.available, nil, count, false)
+			p.reserved, err = p.takeCPUs(&p.available, nil, count, false, cpuallocator.AllocDefault)
 			if err != nil {
 				return policyError("failed to reserve %d CPUs from %s: %v",
 					count, p.available.String())
@@ -357,6 +436,59 @@ func (p *staticplus) optOutFromIsolation(c cache.Container) bool {
 	return !preferIsolated
 }
 
+// coreTypePreference returns the CPU allocator flags for the core type preference of a container.
+func (p *staticplus) coreTypePreference(c cache.Container) cpuallocator.AllocFlag {
+	pod, found := c.GetPod()
+	if !found {
+		return cpuallocator.AllocDefault
+	}
+	value, ok := pod.GetResmgrAnnotation(keyPreferCoreType)
+	if !ok {
+		return cpuallocator.AllocDefault
+	}
+
+	kind, ok, err := cpuallocator.ParseCoreKindPreference(value, c.GetName())
+	if err != nil {
+		p.Error("invalid annotation '%s' on container %s: %v", keyPreferCoreType, c.PrettyName(), err)
+		return cpuallocator.AllocDefault
+	}
+	if !ok {
+		return cpuallocator.AllocDefault
+	}
+
+	p.Info("container %s prefers %s cores", c.PrettyName(), kind)
+	return cpuallocator.CoreKindFlags(kind)
+}
+
+// strictSMTIsolation checks if a container wants its exclusive CPUs as full physical cores.
+func (p *staticplus) strictSMTIsolation(c cache.Container) bool {
+	pod, found := c.GetPod()
+	if !found {
+		return opt.StrictSMTIsolation
+	}
+	value, ok := pod.GetResmgrAnnotation(keyStrictSMTIsolation)
+	if !ok {
+		return opt.StrictSMTIsolation
+	}
+
+	strict, err := strconv.ParseBool(value)
+	if err != nil {
+		preferences := map[string]bool{}
+		if err := yaml.Unmarshal([]byte(value), &preferences); err != nil {
+			p.Error("invalid annotation '%s' on container %s: %v", keyStrictSMTIsolation, c.PrettyName(), err)
+			return opt.StrictSMTIsolation
+		}
+		if strict, ok = preferences[c.GetName()]; !ok {
+			return opt.StrictSMTIsolation
+		}
+	}
+
+	if strict {
+		p.Info("container %s requests strict SMT isolation", c.PrettyName())
+	}
+	return strict
+}
+
 // assignCpus allocates cpus for a containers.
 func (p *staticplus) assignCpus(c cache.Container) (*Assignment, error) {
 	full, part := p.requestedCpus(c)
@@ -371,24 +503,40 @@ func (p *staticplus) assignCpus(c cache.Container) (*Assignment, error) {
 		return &Assignment{shared: part}, nil
 	}
 
+	flags := p.coreTypePreference(c)
+	strict := p.strictSMTIsolation(c)
+
+	// reclaim the exclusive CPUs kept for a restarted container, if still free
+	if cpus, idle, ok := p.takeStickyCPUs(c, full, strict); ok {
+		return &Assignment{exclusive: cpus, idle: idle, shared: part}, nil
+	}
+
+	// reuse the exclusive CPUs of completed init containers, if still free
+	if cpus, idle, ok := p.takeInheritedCPUs(c, full, strict, flags); ok {
+		return &Assignment{exclusive: cpus, idle: idle, shared: part}, nil
+	}
+
 	// if there is capacity in the isolated pool, slice cpus off from it
 	if p.isolated.Size() >= full && !p.optOutFromIsolation(c) {
-		cpus, err := p.takeCPUs(&p.isolated, nil, full, true)
-		if err != nil {
+		cpus, idle, err := p.takeExclusiveCPUs(&p.isolated, full, strict, flags)
+		switch {
+		case err == nil:
+			return &Assignment{exclusive: cpus, idle: idle, shared: part}, nil
+		case !strict:
 			return nil, policyError("failed to allocate %d isolated CPUs: %v",
 				full, err)
 		}
-		return &Assignment{exclusive: cpus, shared: part}, nil
+		p.Warn("can't allocate %d isolated CPUs as full cores: %v", full, err)
 	}
 
 	// otherwise, try to slice off cpus from the shared pool
 	if p.shared.Size() >= full {
-		cpus, err := p.takeCPUs(&p.shared, nil, full, true)
+		cpus, idle, err := p.takeExclusiveCPUs(&p.shared, full, strict, flags)
 		if err != nil {
 			return nil, policyError("failed to allocate %d exclusive CPUs: %v",
 				full, err)
 		}
-		return &Assignment{exclusive: cpus, shared: part}, nil
+		return &Assignment{exclusive: cpus, idle: idle, shared: part}, nil
 	}
 
 	// we're screwed, not enough cpu in either isolated or shared pool
@@ -445,6 +593,7 @@ func (p *staticplus) addAssignment(c cache.Container, a *Assignment) error {
 	}
 
 	p.allocations[c.GetCacheID()] = a
+	p.parkIdleSiblings(a)
 
 	p.cache.SetPolicyEntry(keySharedPool, p.shared)
 	p.cache.SetPolicyEntry(keyAllocations,
@@ -456,6 +605,7 @@ func (p *staticplus) addAssignment(c cache.Container, a *Assignment) error {
 // delAssignment updates container allocations for a deleted container assignment.
 func (p *staticplus) delAssignment(a *Assignment, id string) error {
 	delete(p.allocations, id)
+	p.unparkIdleSiblings(a)
 
 	switch {
 	// for shared-only allocations there is not much to do...
@@ -465,14 +615,14 @@ func (p *staticplus) delAssignment(a *Assignment, id string) error {
 
 		// for isolated exclusive cpus, return them to the pool
 	case !a.exclusive.Intersection(p.sys.Isolated()).IsEmpty():
-		p.isolated = p.isolated.Union(a.exclusive)
+		p.isolated = p.isolated.Union(a.exclusive).Union(a.idle)
 
 		p.Info("freed isolated allocations (%s) of container %s",
 			a.exclusive.String(), id)
 
 		// for cpus sliced off the shared pool, return then and update others
 	default:
-		p.shared = p.shared.Union(a.exclusive)
+		p.shared = p.shared.Union(a.exclusive).Union(a.idle)
 
 		p.Info("freed exclusive allocations (%s) of container %s",
 			a.exclusive.String(), id)
@@ -549,8 +699,8 @@ func (p *staticplus) updatePools() error {
 				id, isolated.String(), excshare.String())
 		}
 
-		p.isolated = p.isolated.Difference(isolated)
-		p.shared = p.shared.Difference(excshare)
+		p.isolated = p.isolated.Difference(isolated).Difference(ca.idle)
+		p.shared = p.shared.Difference(excshare).Difference(ca.idle)
 	}
 
 	if err := p.updateSharedAllocations(); err != nil {
@@ -597,14 +747,17 @@ func (p *staticplus) dumpAllocations() {
 			if e == "" {
 				e = "<none>"
 			}
+			if !ca.idle.IsEmpty() {
+				e += " (idle siblings: " + ca.idle.String() + ")"
+			}
 			p.Info("  %s: exclusive: %s, shared: %d milli-cpu", id, e, ca.shared)
 		}
 	}
 }
 
 // Take up to cnt CPUs from a given CPU set to another.
-func (p *staticplus) takeCPUs(from, to *cpuset.CPUSet, cnt int, preferHighPrio bool) (cpuset.CPUSet, error) {
-	cset, err := p.cpuAllocator.AllocateCpus(from, cnt, preferHighPrio)
+func (p *staticplus) takeCPUs(from, to *cpuset.CPUSet, cnt int, preferHighPrio bool, flags cpuallocator.AllocFlag) (cpuset.CPUSet, error) {
+	cset, err := p.cpuAllocator.AllocateCpusWithFlags(from, cnt, preferHighPrio, flags)
 	if err != nil {
 		return cset, err
 	}
@@ -616,6 +769,94 @@ func (p *staticplus) takeCPUs(from, to *cpuset.CPUSet, cnt int, preferHighPrio b
 	return cset, err
 }
 
+// takeExclusiveCPUs takes cnt exclusive CPUs, as full physical cores if strict.
+// It returns the CPUs taken and any idle hyperthread siblings withheld with them.
+func (p *staticplus) takeExclusiveCPUs(from *cpuset.CPUSet, cnt int, strict bool, flags cpuallocator.AllocFlag) (cpuset.CPUSet, cpuset.CPUSet, error) {
+	if !strict {
+		cpus, err := p.takeCPUs(from, nil, cnt, true, flags)
+		return cpus, cpuset.NewCPUSet(), err
+	}
+
+	cores := p.cpuAllocator.IdleCoreCpus(*from)
+	if cores.Size() < cpuallocator.FullCoreFootprint(p.sys, cnt) {
+		return cpuset.NewCPUSet(), cpuset.NewCPUSet(),
+			policyError("not enough idle full cores in %s for %d CPUs", from.String(), cnt)
+	}
+
+	cpus, err := p.takeCPUs(&cores, nil, cnt, true, flags)
+	if err != nil {
+		return cpus, cpuset.NewCPUSet(), err
+	}
+	idle := p.cpuAllocator.CoreSiblings(cpus).Intersection(*from)
+
+	// leave at least one CPU in the shared pool, like topology-aware does
+	if from == &p.shared && from.Size()-cpus.Size()-idle.Size() < 1 {
+		return cpuset.NewCPUSet(), cpuset.NewCPUSet(),
+			policyError("taking %d CPUs as full cores would exhaust shared pool %s",
+				cnt, from.String())
+	}
+
+	*from = from.Difference(cpus).Difference(idle)
+
+	return cpus, idle, nil
+}
+
+// parkIdleSiblings puts the idle hyperthread siblings of an assignment offline, if enabled.
+func (p *staticplus) parkIdleSiblings(a *Assignment) {
+	cpus := a.idle.Difference(p.parked)
+	if !opt.ParkIdleSiblings || cpus.IsEmpty() {
+		return
+	}
+
+	if _, err := p.sys.SetCpusOnline(false, sysfs.NewIDSetFromIntSlice(cpus.ToSlice()...)); err != nil {
+		p.Error("failed to park idle siblings %s: %v", cpus.String(), err)
+		return
+	}
+
+	p.Info("parked idle siblings %s offline", cpus.String())
+	p.parked = p.parked.Union(cpus)
+	p.cache.SetPolicyEntry(keyParkedCPUs, p.parked)
+}
+
+// unparkIdleSiblings puts any parked idle hyperthread siblings of an assignment back online.
+func (p *staticplus) unparkIdleSiblings(a *Assignment) {
+	cpus := a.idle.Intersection(p.parked)
+	if cpus.IsEmpty() {
+		return
+	}
+
+	if _, err := p.sys.SetCpusOnline(true, sysfs.NewIDSetFromIntSlice(cpus.ToSlice()...)); err != nil {
+		p.Error("failed to put parked siblings %s back online: %v", cpus.String(), err)
+		return
+	}
+
+	p.Info("put parked siblings %s back online", cpus.String())
+	p.parked = p.parked.Difference(cpus)
+	p.cache.SetPolicyEntry(keyParkedCPUs, p.parked)
+}
+
+// restoreParkedCPUs puts any CPUs parked by a previous instance back online.
+func (p *staticplus) restoreParkedCPUs() {
+	parked := cpuset.NewCPUSet()
+	p.parked = cpuset.NewCPUSet()
+
+	if !p.cache.GetPolicyEntry(keyParkedCPUs, &parked) || parked.IsEmpty() {
+		return
+	}
+
+	if _, err := p.sys.SetCpusOnline(true, sysfs.NewIDSetFromIntSlice(parked.ToSlice()...)); err != nil {
+		p.Error("failed to put previously parked CPUs %s back online: %v", parked.String(), err)
+		p.parked = parked
+		return
+	}
+
+	p.Info("put previously parked CPUs %s back online", parked.String())
+	p.cache.SetPolicyEntry(keyParkedCPUs, p.parked)
+	if err := p.cache.Save(); err != nil {
+		p.Error("failed to save cache after restoring parked CPUs: %v", err)
+	}
+}
+
 //
 // Cachable data types for storing private static-plus policy data in the cache.
 //
@@ -649,6 +890,7 @@ func (ca *cachedAllocations) Set(value interface{}) {
 
 type marshallableAssignment struct {
 	Exclusive string
+	Idle      string `json:",omitempty"`
 	Shared    int
 }
 
@@ -657,6 +899,7 @@ func (ca *cachedAllocations) MarshalJSON() ([]byte, error) {
 	for id, r := range ca.a {
 		dst[id] = &marshallableAssignment{
 			Exclusive: r.exclusive.String(),
+			Idle:      r.idle.String(),
 			Shared:    r.shared,
 		}
 	}
@@ -682,8 +925,14 @@ func (ca *cachedAllocations) UnmarshalJSON(data []byte) error {
 			return policyError("failed to unmarshal cpuset '%s': %v",
 				r.Exclusive, err)
 		}
+		idle, err := cpuset.Parse(r.Idle)
+		if err != nil {
+			return policyError("failed to unmarshal cpuset '%s': %v",
+				r.Idle, err)
+		}
 		ca.a[id] = &Assignment{
 			exclusive: cset,
+			idle:      idle,
 			shared:    r.Shared,
 		}
 	}
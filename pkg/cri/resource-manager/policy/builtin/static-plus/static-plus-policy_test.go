@@ -0,0 +1,451 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staticplus
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	logger "github.com/intel/cri-resource-manager/pkg/log"
+	"github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+// createTestSysfs creates a sysfs tree of a single package and NUMA node with
+// 4 cores of 2 threads, with the given CPUs offline.
+func createTestSysfs(t *testing.T, offline ...int) string {
+	dir, err := ioutil.TempDir("", "static-plus-sysfs")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	write("sys/devices/system/node/node0/cpulist", "0-7")
+	write("sys/devices/system/node/node0/distance", "10")
+	write("sys/devices/system/node/node0/memory0/online", "1")
+	write("sys/devices/system/cpu/isolated", "")
+	for id := 0; id < 8; id++ {
+		cpu := fmt.Sprintf("sys/devices/system/cpu/cpu%d/", id)
+		first := id - id%2
+		online := "1"
+		for _, o := range offline {
+			if o == id {
+				online = "0"
+			}
+		}
+		write(cpu+"online", online)
+		write(cpu+"topology/physical_package_id", "0")
+		write(cpu+"topology/core_id", fmt.Sprintf("%d", first))
+		write(cpu+"topology/thread_siblings_list", fmt.Sprintf("%d-%d", first, first+1))
+		write(cpu+"node0/cpulist", "0-7")
+	}
+
+	return dir
+}
+
+// newTestPolicy creates a policy for the sysfs tree and cache in the given directory.
+func newTestPolicy(t *testing.T, dir string) *staticplus {
+	sys, err := sysfs.DiscoverSystemAt(filepath.Join(dir, "sys"))
+	if err != nil {
+		t.Fatalf("failed to discover test system: %v", err)
+	}
+	cch, err := cache.NewCache(cache.Options{CacheDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	return &staticplus{
+		Logger:       logger.NewLogger(PolicyName),
+		sys:          sys,
+		cache:        cch,
+		cpuAllocator: cpuallocator.NewCPUAllocator(sys),
+		shared:       cpuset.NewCPUSet(),
+		parked:       cpuset.NewCPUSet(),
+		sticky:       make(map[string]*stickyCPUs),
+		inherited:    make(map[string]cpuset.CPUSet),
+	}
+}
+
+// testPod is a pod with only a UID and containers.
+type testPod struct {
+	cache.Pod
+	uid        string
+	init       []cache.Container
+	containers []cache.Container
+}
+
+func (p *testPod) GetUID() string {
+	return p.uid
+}
+
+func (p *testPod) GetInitContainers() []cache.Container {
+	return p.init
+}
+
+func (p *testPod) GetContainers() []cache.Container {
+	return p.containers
+}
+
+func (p *testPod) GetPodResourceRequirements() cache.PodResourceRequirements {
+	init := map[string]corev1.ResourceRequirements{}
+	for _, c := range p.init {
+		init[c.GetName()] = corev1.ResourceRequirements{}
+	}
+	return cache.PodResourceRequirements{InitContainers: init}
+}
+
+// testContainer is a container with only a name, a pod and a state.
+type testContainer struct {
+	cache.Container
+	name  string
+	pod   *testPod
+	state cache.ContainerState
+}
+
+func (c *testContainer) GetName() string {
+	return c.name
+}
+
+func (c *testContainer) GetCacheID() string {
+	return c.pod.uid + "/" + c.name
+}
+
+func (c *testContainer) GetPodID() string {
+	return c.pod.uid
+}
+
+func (c *testContainer) GetPod() (cache.Pod, bool) {
+	return c.pod, c.pod != nil
+}
+
+func (c *testContainer) GetState() cache.ContainerState {
+	return c.state
+}
+
+func (c *testContainer) PrettyName() string {
+	return c.pod.uid + "/" + c.name
+}
+
+func TestTakeExclusiveCPUs(t *testing.T) {
+	dir := createTestSysfs(t)
+	defer os.RemoveAll(dir)
+
+	tcases := []struct {
+		name     string
+		from     string
+		shared   bool
+		cnt      int
+		strict   bool
+		cpus     int
+		idle     int
+		left     int
+		expected bool
+	}{
+		{
+			name:     "any threads",
+			from:     "0-7",
+			cnt:      3,
+			cpus:     3,
+			left:     5,
+			expected: true,
+		},
+		{
+			name:     "full cores",
+			from:     "0-7",
+			cnt:      3,
+			strict:   true,
+			cpus:     3,
+			idle:     1,
+			left:     4,
+			expected: true,
+		},
+		{
+			name:   "not enough full cores",
+			from:   "0-2,4",
+			cnt:    3,
+			strict: true,
+			left:   4,
+		},
+		{
+			name:     "full cores from the shared pool",
+			from:     "0-5",
+			shared:   true,
+			cnt:      3,
+			strict:   true,
+			cpus:     3,
+			idle:     1,
+			left:     2,
+			expected: true,
+		},
+		{
+			name:   "full cores exhausting the shared pool",
+			from:   "0-3",
+			shared: true,
+			cnt:    3,
+			strict: true,
+			left:   4,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPolicy(t, dir)
+			from := cpuset.MustParse(tc.from)
+			pool := &from
+			if tc.shared {
+				p.shared = from
+				pool = &p.shared
+			}
+
+			cpus, idle, err := p.takeExclusiveCPUs(pool, tc.cnt, tc.strict, cpuallocator.AllocDefault)
+			switch {
+			case err != nil && tc.expected:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !tc.expected:
+				t.Fatalf("expected an error, got CPUs %s", cpus)
+			}
+			if cpus.Size() != tc.cpus || idle.Size() != tc.idle || pool.Size() != tc.left {
+				t.Errorf("expected %d CPUs, %d idle, %d left, got %s, %s, %s",
+					tc.cpus, tc.idle, tc.left, cpus, idle, *pool)
+			}
+			if !cpus.Union(idle).Union(*pool).Equals(cpuset.MustParse(tc.from)) {
+				t.Errorf("CPUs %s, idle %s and left %s do not add up to %s",
+					cpus, idle, *pool, tc.from)
+			}
+			if tc.strict && !p.cpuAllocator.CoreSiblings(cpus).IsSubsetOf(cpus.Union(idle)) {
+				t.Errorf("CPUs %s share cores outside the grant", cpus)
+			}
+		})
+	}
+}
+
+func TestRestoreParkedCPUs(t *testing.T) {
+	dir := createTestSysfs(t, 3, 5)
+	defer os.RemoveAll(dir)
+
+	p := newTestPolicy(t, dir)
+	p.cache.SetPolicyEntry(keyParkedCPUs, cpuset.MustParse("3,5"))
+
+	p.restoreParkedCPUs()
+
+	if !p.parked.IsEmpty() {
+		t.Errorf("expected no parked CPUs, got %s", p.parked)
+	}
+	for _, id := range []int{3, 5} {
+		path := filepath.Join(dir, fmt.Sprintf("sys/devices/system/cpu/cpu%d/online", id))
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if online := strings.TrimSpace(string(data)); online != "1" {
+			t.Errorf("expected CPU #%d online, got %s", id, online)
+		}
+	}
+
+	// The restored state must be saved, so a restarted instance won't see stale parked CPUs.
+	cch, err := cache.NewCache(cache.Options{CacheDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatalf("failed to reload cache: %v", err)
+	}
+	parked := cpuset.NewCPUSet()
+	if !cch.GetPolicyEntry(keyParkedCPUs, &parked) {
+		t.Fatalf("parked CPUs not saved in cache")
+	}
+	if !parked.IsEmpty() {
+		t.Errorf("expected no parked CPUs in saved cache, got %s", parked)
+	}
+}
+
+func TestStickyCPUs(t *testing.T) {
+	saved := *opt
+	defer func() { *opt = saved }()
+
+	dir := createTestSysfs(t)
+	defer os.RemoveAll(dir)
+
+	c := &testContainer{name: "ctr0", pod: &testPod{uid: "pod0-uid"}}
+
+	tcases := []struct {
+		name     string
+		shared   string
+		isolated string
+		period   time.Duration
+		cnt      int
+		strict   bool
+		expected string
+		idle     string
+	}{
+		{
+			name:     "reclaimed from the shared pool",
+			shared:   "0-7",
+			cnt:      2,
+			expected: "2-3",
+		},
+		{
+			name:     "reclaimed from the isolated pool",
+			shared:   "0-1",
+			isolated: "2-7",
+			cnt:      2,
+			expected: "2-3",
+		},
+		{
+			name:     "reclaimed as full cores",
+			shared:   "0-7",
+			cnt:      2,
+			strict:   true,
+			expected: "2-3",
+		},
+		{
+			name:   "partially taken",
+			shared: "0-2,4-7",
+			cnt:    2,
+		},
+		{
+			name:   "different number of CPUs",
+			shared: "0-7",
+			cnt:    3,
+		},
+		{
+			name:   "disabled",
+			shared: "0-7",
+			period: -1,
+			cnt:    2,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPolicy(t, dir)
+			p.shared = cpuset.MustParse(tc.shared)
+			p.isolated = cpuset.NewCPUSet()
+			if tc.isolated != "" {
+				p.isolated = cpuset.MustParse(tc.isolated)
+			}
+			opt.StickyAllocationPeriod = config.Duration(time.Minute)
+			if tc.period != 0 {
+				opt.StickyAllocationPeriod = config.Duration(tc.period)
+			}
+			free := p.shared.Union(p.isolated)
+
+			p.saveStickyCPUs(c, &Assignment{exclusive: cpuset.MustParse("2-3")})
+			cpus, idle, ok := p.takeStickyCPUs(c, tc.cnt, tc.strict)
+			if tc.expected == "" {
+				if ok {
+					t.Errorf("expected no sticky CPUs, got %s", cpus)
+				}
+				if left := p.shared.Union(p.isolated); !left.Equals(free) {
+					t.Errorf("expected free CPUs %s to be left intact, got %s", free, left)
+				}
+				return
+			}
+			if !ok || cpus.String() != tc.expected || idle.String() != tc.idle {
+				t.Fatalf("expected sticky CPUs %s (idle %q), got %s (idle %q), %v",
+					tc.expected, tc.idle, cpus, idle.String(), ok)
+			}
+			if !p.shared.Union(p.isolated).Union(cpus).Union(idle).Equals(free) {
+				t.Errorf("CPUs %s and idle %s not taken from free CPUs %s", cpus, idle, free)
+			}
+			if _, _, ok := p.takeStickyCPUs(c, tc.cnt, tc.strict); ok {
+				t.Errorf("expected sticky CPUs to be reclaimed only once")
+			}
+		})
+	}
+}
+
+func TestStickyCPUsExpiry(t *testing.T) {
+	p := &staticplus{
+		sticky: map[string]*stickyCPUs{
+			"pod0/ctr0": {exclusive: cpuset.MustParse("2-3"), expires: time.Now().Add(time.Minute)},
+			"pod0/ctr1": {exclusive: cpuset.MustParse("4-5"), expires: time.Now()},
+		},
+	}
+
+	p.pruneStickyCPUs(time.Now())
+	if _, ok := p.sticky["pod0/ctr1"]; ok {
+		t.Errorf("expected expired sticky CPUs to be pruned")
+	}
+	if _, ok := p.sticky["pod0/ctr0"]; !ok {
+		t.Errorf("expected sticky CPUs to be kept within the grace period")
+	}
+}
+
+func TestInheritedCPUs(t *testing.T) {
+	dir := createTestSysfs(t)
+	defer os.RemoveAll(dir)
+
+	pod := &testPod{uid: "pod0-uid"}
+	ic := &testContainer{name: "init0", pod: pod, state: cache.ContainerStateExited}
+	c0 := &testContainer{name: "ctr0", pod: pod}
+	c1 := &testContainer{name: "ctr1", pod: pod}
+	pod.init = []cache.Container{ic}
+	pod.containers = []cache.Container{c0, c1}
+
+	p := newTestPolicy(t, dir)
+	p.shared = cpuset.MustParse("0-1,6-7")
+	p.allocations = Allocations{ic.GetCacheID(): {exclusive: cpuset.MustParse("2-5")}}
+
+	if p.isCompletedInitContainer(c0) {
+		t.Errorf("expected %s not to be an init container", c0.name)
+	}
+	if !p.isCompletedInitContainer(ic) {
+		t.Errorf("expected exited %s to be a completed init container", ic.name)
+	}
+
+	p.releaseInitContainers(c0)
+	if _, ok := p.allocations[ic.GetCacheID()]; ok {
+		t.Fatalf("expected init container assignment to be released")
+	}
+	if cpus := p.inherited[pod.uid]; cpus.String() != "2-5" {
+		t.Fatalf("expected inherited CPUs 2-5, got %s", cpus)
+	}
+
+	cpus, idle, ok := p.takeInheritedCPUs(c0, 2, true, cpuallocator.AllocDefault)
+	if !ok || cpus.Size() != 2 || !idle.IsEmpty() || !cpus.IsSubsetOf(cpuset.MustParse("2-5")) {
+		t.Fatalf("expected 2 inherited CPUs as a full core, got %s (idle %s), %v", cpus, idle, ok)
+	}
+	left := cpuset.MustParse("2-5").Difference(cpus)
+	if inherited := p.inherited[pod.uid]; !inherited.Equals(left) {
+		t.Errorf("expected inherited CPUs %s left, got %s", left, inherited)
+	}
+
+	// another container takes one of the remaining inherited CPUs in the meantime
+	taken := cpuset.NewCPUSet(left.ToSlice()[0])
+	p.shared = p.shared.Difference(taken)
+	if cpus, _, ok := p.takeInheritedCPUs(c1, 2, false, cpuallocator.AllocDefault); ok {
+		t.Errorf("expected no inherited CPUs for %s, got %s", c1.name, cpus)
+	}
+	if cpus, _, ok := p.takeInheritedCPUs(c1, 1, false, cpuallocator.AllocDefault); !ok || !cpus.Equals(left.Difference(taken)) {
+		t.Errorf("expected inherited CPU %s, got %s, %v", left.Difference(taken), cpus, ok)
+	}
+	if inherited := p.inherited[pod.uid]; !inherited.Equals(taken) {
+		t.Errorf("expected only the CPU taken by another container left, got %s", inherited)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staticplus
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+)
+
+//
+// Sticky CPUs are the exclusive CPUs of a released container, kept for a
+// grace period and keyed by pod UID and container name. If kubelet recreates
+// the container within the grace period, the replacement gets the same
+// exclusive CPUs whenever they are still free. The kept CPUs are returned to
+// their pool and do not withhold any capacity from other containers.
+//
+
+// stickyCPUs are the exclusive CPUs kept for a released container.
+type stickyCPUs struct {
+	exclusive cpuset.CPUSet // exclusive CPUs of the released assignment
+	expires   time.Time     // end of the grace period
+}
+
+// stickyKey returns the key of sticky CPUs for a container.
+func stickyKey(c cache.Container) (string, bool) {
+	pod, ok := c.GetPod()
+	if !ok {
+		return "", false
+	}
+	return pod.GetUID() + "/" + c.GetName(), true
+}
+
+// saveStickyCPUs keeps the exclusive CPUs of a released assignment for the grace period.
+func (p *staticplus) saveStickyCPUs(c cache.Container, a *Assignment) {
+	period := time.Duration(opt.StickyAllocationPeriod)
+	if period <= 0 || a.exclusive.IsEmpty() {
+		return
+	}
+	key, ok := stickyKey(c)
+	if !ok {
+		return
+	}
+
+	p.pruneStickyCPUs(time.Now())
+	p.sticky[key] = &stickyCPUs{
+		exclusive: a.exclusive,
+		expires:   time.Now().Add(period),
+	}
+
+	p.Debug("keeping exclusive CPUs %s of %s for %s", a.exclusive.String(), key, period)
+}
+
+// pruneStickyCPUs removes the sticky CPUs with an expired grace period.
+func (p *staticplus) pruneStickyCPUs(now time.Time) {
+	for key, sc := range p.sticky {
+		if !now.Before(sc.expires) {
+			delete(p.sticky, key)
+		}
+	}
+}
+
+// takeStickyCPUs takes the unexpired sticky CPUs of a container from their
+// pool, if they match the request and are still free. With strict SMT
+// isolation the idle hyperthread siblings are taken with them.
+func (p *staticplus) takeStickyCPUs(c cache.Container, cnt int, strict bool) (cpuset.CPUSet, cpuset.CPUSet, bool) {
+	none := cpuset.NewCPUSet()
+
+	key, ok := stickyKey(c)
+	if !ok {
+		return none, none, false
+	}
+	p.pruneStickyCPUs(time.Now())
+	sc, ok := p.sticky[key]
+	if !ok {
+		return none, none, false
+	}
+	delete(p.sticky, key)
+
+	cpus := sc.exclusive
+	if cpus.Size() != cnt {
+		return none, none, false
+	}
+
+	var from *cpuset.CPUSet
+	switch {
+	case cpus.IsSubsetOf(p.isolated):
+		from = &p.isolated
+	case cpus.IsSubsetOf(p.shared):
+		from = &p.shared
+	default:
+		p.Debug("sticky CPUs %s of %s are no longer free", cpus.String(), key)
+		return none, none, false
+	}
+
+	idle := none
+	if strict {
+		idle = p.cpuAllocator.CoreSiblings(cpus)
+		if !idle.IsSubsetOf(*from) {
+			p.Debug("sticky CPUs %s of %s are no longer full cores", cpus.String(), key)
+			return none, none, false
+		}
+	}
+
+	// leave at least one CPU in the shared pool, like normal slicing does
+	if from == &p.shared && from.Size()-cpus.Size()-idle.Size() < 1 {
+		return none, none, false
+	}
+
+	*from = from.Difference(cpus).Difference(idle)
+
+	p.Info("container %s reclaims sticky CPUs %s", c.PrettyName(), cpus.String())
+
+	return cpus, idle, true
+}
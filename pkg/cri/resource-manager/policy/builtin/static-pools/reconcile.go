@@ -0,0 +1,176 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stp
+
+import (
+	"sort"
+	"strings"
+)
+
+// reconcileConfig assigns the existing containers to the cpu lists of a
+// configuration. Containers in non-exclusive pools whose cpu lists are gone
+// are moved to the least populated remaining cpu list of their pool. Changes
+// that would break exclusive assignments are refused. The updated status of
+// moved containers is returned.
+func reconcileConfig(cfg *conf, ccr stpContainerCache) (map[string]stpContainerStatus, error) {
+	if cfg == nil || cfg.Pools == nil {
+		return nil, stpError("invalid config, no pools configured")
+	}
+
+	for _, pool := range cfg.Pools {
+		for _, cl := range pool.CPULists {
+			cl.containers = nil
+		}
+	}
+
+	pending := []string{}
+	for _, id := range ccr.sortedIDs() {
+		cs := ccr[id]
+
+		// Check that pool for container exists
+		pool, ok := cfg.Pools[cs.Pool]
+		if !ok {
+			return nil, stpError("invalid stp configuration: pool %q for container %q not found", cs.Pool, id)
+		}
+
+		// Check that pool exclusivity is compatible with container configuration
+		if pool.Exclusive && cs.NExclusiveCPUs < 1 {
+			return nil, stpError("invalid stp configuration: container %q with no exclusive CPUs set to run in exclusive pool %q", id, cs.Pool)
+		} else if !pool.Exclusive && cs.NExclusiveCPUs > 0 {
+			return nil, stpError("invalid stp configuration: container %q with exclusive CPUs set to run in non-exclusive pool %q", id, cs.Pool)
+		}
+
+		// Check that cpu lists of container are still in the pool
+		for _, cpus := range cs.Cpusets {
+			cl := findCPUList(&pool, cpus)
+			if cl == nil && !pool.Exclusive {
+				pending = append(pending, id)
+				break
+			}
+			if cl == nil {
+				return nil, stpError("invalid stp configuration: exclusive cpu list %q of container %q not found in pool %q", cpus, id, cs.Pool)
+			}
+			if pool.Exclusive && len(cl.getContainers()) > 0 {
+				return nil, stpError("invalid stp configuration: exclusive cpu list %q of container %q already taken in pool %q", cpus, id, cs.Pool)
+			}
+			cl.addContainer(id)
+		}
+	}
+
+	// Move containers whose non-exclusive cpu lists are gone
+	moved := make(map[string]stpContainerStatus)
+	for _, id := range pending {
+		cs := ccr[id]
+		pool := cfg.Pools[cs.Pool]
+		for _, cl := range pool.CPULists {
+			cl.removeContainer(id)
+		}
+		cl := leastPopulatedCPUList(cs.Socket, &pool)
+		if cl == nil {
+			return nil, stpError("invalid stp configuration: no cpu list left for container %q in pool %q", id, cs.Pool)
+		}
+		cl.addContainer(id)
+		cs.Cpusets = []string{cl.Cpuset}
+		moved[id] = cs
+	}
+
+	return moved, nil
+}
+
+// balanceSharedPools evens out the number of containers in the cpu lists of
+// non-exclusive pools. The updated status of moved containers is returned.
+func balanceSharedPools(cfg *conf, ccr stpContainerCache) map[string]stpContainerStatus {
+	moved := make(map[string]stpContainerStatus)
+
+	for _, id := range ccr.sortedIDs() {
+		cs := ccr[id]
+		pool, ok := cfg.Pools[cs.Pool]
+		if !ok || pool.Exclusive || len(cs.Cpusets) != 1 {
+			continue
+		}
+
+		current := findCPUList(&pool, cs.Cpusets[0])
+		target := leastPopulatedCPUList(cs.Socket, &pool)
+		if current == nil || target == nil {
+			continue
+		}
+		if len(target.getContainers())+1 >= len(current.getContainers()) {
+			continue
+		}
+
+		current.removeContainer(id)
+		target.addContainer(id)
+		cs.Cpusets = []string{target.Cpuset}
+		moved[id] = cs
+	}
+
+	return moved
+}
+
+// moveContainers updates the registry and cpusets of moved containers.
+func (stp *stp) moveContainers(moved map[string]stpContainerStatus) {
+	if len(moved) == 0 {
+		return
+	}
+
+	ccr := stp.getContainerRegistry()
+	for id, cs := range moved {
+		(*ccr)[id] = cs
+
+		c, ok := stp.state.LookupContainer(id)
+		if !ok {
+			continue
+		}
+		cpuset := strings.Join(cs.Cpusets, ",")
+		if cs.NoAffinity {
+			stp.Info("container %q moved to cpu list %q of pool %q (no affinity)", id, cpuset, cs.Pool)
+			continue
+		}
+		stp.Info("moving container %q to cpu list %q of pool %q", id, cpuset, cs.Pool)
+		c.SetCpusetCpus(cpuset)
+	}
+	stp.setContainerRegistry(ccr)
+}
+
+// findCPUList looks up the cpu list with the given cpuset in a pool.
+func findCPUList(pool *poolConfig, cpus string) *cpuList {
+	for _, cl := range pool.CPULists {
+		if cl.Cpuset == cpus {
+			return cl
+		}
+	}
+	return nil
+}
+
+// leastPopulatedCPUList picks the available cpu list with the fewest containers.
+func leastPopulatedCPUList(socket int64, pool *poolConfig) *cpuList {
+	var least *cpuList
+	for _, cl := range getAvailableCPULists(socket, pool) {
+		if least == nil || len(cl.getContainers()) < len(least.getContainers()) {
+			least = cl
+		}
+	}
+	return least
+}
+
+// sortedIDs returns the container IDs in the registry, sorted.
+func (c stpContainerCache) sortedIDs() []string {
+	ids := make([]string, 0, len(c))
+	for id := range c {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
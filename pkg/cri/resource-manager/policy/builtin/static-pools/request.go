@@ -0,0 +1,180 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stp
+
+import (
+	"strconv"
+
+	extapi "github.com/intel/cri-resource-manager/pkg/apis/resmgr/v1alpha1"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/kubernetes"
+)
+
+const (
+	// PoolKey is the annotation for selecting the pool of a container.
+	PoolKey = "pool.static-pools." + kubernetes.ResmgrKeyNamespace
+	// SocketKey is the annotation for selecting the socket of a container.
+	SocketKey = "socket.static-pools." + kubernetes.ResmgrKeyNamespace
+	// ExclusiveCPUsKey is the annotation for the number of exclusive CPUs of a container.
+	ExclusiveCPUsKey = "exclusive-cpus.static-pools." + kubernetes.ResmgrKeyNamespace
+)
+
+// getStaticPoolsRequest returns the pool, socket and exclusive CPU count
+// requested for a container using pod annotations or external adjustments.
+// Settings of an external adjustment take precedence over annotations.
+func (stp *stp) getStaticPoolsRequest(c cache.Container) *extapi.StaticPools {
+	req, err := parseStaticPoolsAnnotations(c.GetEffectiveAnnotation)
+	if err != nil {
+		stp.Warn("container %s: %v", c.PrettyName(), err)
+	}
+	if adjust, ok := c.GetStaticPoolsAdjustment(); ok {
+		req = mergeStaticPoolsRequest(req, adjust)
+	}
+	return req
+}
+
+// parseStaticPoolsAnnotations parses static-pools annotations using the given lookup
+// function. Annotations which fail to parse are ignored and reported as an error.
+func parseStaticPoolsAnnotations(lookup func(string) (string, bool)) (*extapi.StaticPools, error) {
+	req := &extapi.StaticPools{}
+	var err error
+
+	if value, ok := lookup(PoolKey); ok && value != "" {
+		req.Pool = &value
+	}
+	if value, ok := lookup(SocketKey); ok {
+		if socket, perr := strconv.ParseInt(value, 10, 64); perr != nil || socket < -1 {
+			err = stpError("ignoring invalid annotation %s=%q", SocketKey, value)
+		} else {
+			req.Socket = &socket
+		}
+	}
+	if value, ok := lookup(ExclusiveCPUsKey); ok {
+		if cpus, perr := strconv.ParseInt(value, 10, 64); perr != nil || cpus < 0 {
+			err = stpError("ignoring invalid annotation %s=%q", ExclusiveCPUsKey, value)
+		} else {
+			req.ExclusiveCPUs = &cpus
+		}
+	}
+
+	if req.Pool == nil && req.Socket == nil && req.ExclusiveCPUs == nil {
+		return nil, err
+	}
+	return req, err
+}
+
+// mergeStaticPoolsRequest overrides the settings of a request with any settings of another.
+func mergeStaticPoolsRequest(req, override *extapi.StaticPools) *extapi.StaticPools {
+	if req == nil {
+		return override.DeepCopy()
+	}
+	if override == nil {
+		return req
+	}
+	merged := req.DeepCopy()
+	if override.Pool != nil {
+		pool := *override.Pool
+		merged.Pool = &pool
+	}
+	if override.Socket != nil {
+		socket := *override.Socket
+		merged.Socket = &socket
+	}
+	if override.ExclusiveCPUs != nil {
+		cpus := *override.ExclusiveCPUs
+		merged.ExclusiveCPUs = &cpus
+	}
+	return merged
+}
+
+// applyStaticPoolsRequest updates container status with the settings of a request.
+func applyStaticPoolsRequest(cs *stpContainerStatus, req *extapi.StaticPools) {
+	if req == nil {
+		return
+	}
+	if req.Pool != nil {
+		cs.Pool = *req.Pool
+	}
+	if req.Socket != nil {
+		cs.Socket = *req.Socket
+	}
+	if req.ExclusiveCPUs != nil {
+		cs.NExclusiveCPUs = *req.ExclusiveCPUs
+	}
+}
+
+// reassignContainers moves containers whose pool, socket or exclusive CPU count
+// requested by annotations or adjustments differs from their current assignment.
+// If the requested assignment cannot be fulfilled the current one is kept.
+func (stp *stp) reassignContainers() int {
+	reassigned := 0
+	ccr := *stp.getContainerRegistry()
+	for _, id := range ccr.sortedIDs() {
+		cs := ccr[id]
+		c, ok := stp.state.LookupContainer(id)
+		if !ok {
+			continue
+		}
+		req := stp.getStaticPoolsRequest(c)
+		if req == nil {
+			continue
+		}
+
+		ncs := stpContainerStatus{
+			Pool:           cs.Pool,
+			Socket:         cs.Socket,
+			NExclusiveCPUs: cs.NExclusiveCPUs,
+			NoAffinity:     cs.NoAffinity,
+		}
+		applyStaticPoolsRequest(&ncs, req)
+		if ncs.Pool == "infra" {
+			ncs.Socket = -1
+		}
+		if ncs.Pool == cs.Pool && ncs.Socket == cs.Socket && ncs.NExclusiveCPUs == cs.NExclusiveCPUs {
+			continue
+		}
+		if _, ok := stp.conf.Pools[ncs.Pool]; !ok {
+			stp.Error("can't reassign container %s: non-existent pool %q", c.PrettyName(), ncs.Pool)
+			continue
+		}
+
+		stp.Info("reassigning container %s from pool %q (socket %d, %d exclusive CPUs) "+
+			"to pool %q (socket %d, %d exclusive CPUs)", c.PrettyName(),
+			cs.Pool, cs.Socket, cs.NExclusiveCPUs, ncs.Pool, ncs.Socket, ncs.NExclusiveCPUs)
+
+		stp.releaseStpResources(id)
+		if err := stp.allocateStpResources(c, ncs); err != nil {
+			stp.Error("failed to reassign container %s: %v", c.PrettyName(), err)
+			stp.restoreStpResources(c, cs)
+			continue
+		}
+		reassigned++
+	}
+	return reassigned
+}
+
+// restoreStpResources puts a container back to the cpu lists of its earlier assignment.
+func (stp *stp) restoreStpResources(c cache.Container, cs stpContainerStatus) {
+	id := c.GetCacheID()
+	pool := stp.conf.Pools[cs.Pool]
+	for _, cpus := range cs.Cpusets {
+		if cl := findCPUList(&pool, cpus); cl != nil {
+			cl.addContainer(id)
+		}
+	}
+	ccr := stp.getContainerRegistry()
+	(*ccr)[id] = cs
+	stp.setContainerRegistry(ccr)
+}
@@ -19,9 +19,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"sort"
 	"strconv"
 	"strings"
 
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
 	"github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/agent"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
@@ -158,10 +161,8 @@ func (stp *stp) AllocateResources(c cache.Container) error {
 	containerID := c.GetCacheID()
 	stp.Debug("allocating resources for container %s...", containerID)
 
-	cs := stpContainerStatus{Socket: -1}
-
 	// Default pool name
-	poolName := "shared"
+	cs := stpContainerStatus{Pool: "shared", Socket: -1}
 
 	// Get resource requests
 	stp.Debug("RESOURCE REQUESTS: %s", c.GetResourceRequirements().Requests)
@@ -175,7 +176,7 @@ func (stp *stp) AllocateResources(c cache.Container) error {
 	// workloads
 	cmkArgs := stp.parseContainerCmdline(c.GetCommand(), c.GetArgs())
 	if cmkArgs != nil {
-		poolName = cmkArgs.Pool
+		cs.Pool = cmkArgs.Pool
 		cs.Socket = cmkArgs.SocketID
 		cs.NoAffinity = cmkArgs.NoAffinity
 
@@ -198,7 +199,7 @@ func (stp *stp) AllocateResources(c cache.Container) error {
 	}
 	envVal, ok = c.GetEnv(StpEnvPool)
 	if ok {
-		poolName = envVal
+		cs.Pool = envVal
 	}
 	_, ok = c.GetEnv(StpEnvNoAffinity)
 	if ok {
@@ -206,16 +207,21 @@ func (stp *stp) AllocateResources(c cache.Container) error {
 		cs.NoAffinity = true
 	}
 
+	// Pod annotations and external adjustments override all of the above
+	if req := stp.getStaticPoolsRequest(c); req != nil {
+		applyStaticPoolsRequest(&cs, req)
+		stp.Debug("static-pools request of container %s: %s", c.PrettyName(), utils.DumpJSON(req))
+	}
+
 	// Force socket to -1 if pool is not "socket aware"
-	if poolName == "infra" {
+	if cs.Pool == "infra" {
 		cs.Socket = -1
 	}
 
 	// Get pool configuration
-	if _, ok := stp.conf.Pools[poolName]; !ok {
-		return stpError("non-existent pool %q", poolName)
+	if _, ok := stp.conf.Pools[cs.Pool]; !ok {
+		return stpError("non-existent pool %q", cs.Pool)
 	}
-	cs.Pool = poolName
 
 	// Allocate (CPU) resources for the container
 	err := stp.allocateStpResources(c, cs)
@@ -241,8 +247,18 @@ func (stp *stp) UpdateResources(c cache.Container) error {
 
 // Rebalance tries to find an optimal allocation of resources for the current containers.
 func (stp *stp) Rebalance() (bool, error) {
-	stp.Debug("(not) rebalancing containers...")
-	return false, nil
+	if stp.conf == nil {
+		return false, nil
+	}
+
+	stp.Debug("reassigning containers with updated pool requests...")
+	reassigned := stp.reassignContainers()
+
+	stp.Debug("rebalancing containers in non-exclusive pools...")
+	moved := balanceSharedPools(stp.conf, *stp.getContainerRegistry())
+	stp.moveContainers(moved)
+
+	return reassigned > 0 || len(moved) > 0, nil
 }
 
 // HandleEvent handles policy-specific events.
@@ -257,20 +273,90 @@ func (stp *stp) ExportResourceData(c cache.Container) map[string]string {
 }
 
 // Introspect provides data for external introspection.
-func (stp *stp) Introspect(*introspect.State) {
-	return
+func (stp *stp) Introspect(state *introspect.State) {
+	if stp.conf == nil {
+		return
+	}
+
+	pools := make(map[string]*introspect.Pool)
+	for name, pool := range stp.conf.Pools {
+		sockets := make(map[uint64][]string)
+		for _, cl := range pool.CPULists {
+			sockets[cl.Socket] = append(sockets[cl.Socket], cl.Cpuset)
+		}
+
+		p := &introspect.Pool{
+			Name:      name,
+			Exclusive: pool.Exclusive,
+			Children:  make([]string, 0, len(sockets)),
+		}
+		all := []string{}
+		for socket, lists := range sockets {
+			child := &introspect.Pool{
+				Name:      socketPoolName(name, socket),
+				CPUs:      joinCpusets(lists),
+				Exclusive: pool.Exclusive,
+				Parent:    name,
+			}
+			pools[child.Name] = child
+			p.Children = append(p.Children, child.Name)
+			all = append(all, lists...)
+		}
+		sort.Strings(p.Children)
+		p.CPUs = joinCpusets(all)
+		pools[name] = p
+	}
+	state.Pools = pools
+
+	ccr := stp.getContainerRegistry()
+	assignments := make(map[string]*introspect.Assignment, len(*ccr))
+	for id, cs := range *ccr {
+		c, ok := stp.state.LookupContainer(id)
+		if !ok {
+			continue
+		}
+		a := &introspect.Assignment{
+			ContainerID: c.GetID(),
+			Pool:        cs.Pool,
+		}
+		if pool, ok := stp.conf.Pools[cs.Pool]; ok {
+			sockets := make(map[uint64]struct{})
+			for _, cpus := range cs.Cpusets {
+				if cl := findCPUList(&pool, cpus); cl != nil {
+					sockets[cl.Socket] = struct{}{}
+				}
+			}
+			if len(sockets) == 1 {
+				for socket := range sockets {
+					a.Pool = socketPoolName(cs.Pool, socket)
+				}
+			}
+			if pool.Exclusive {
+				a.ExclusiveCPUs = joinCpusets(cs.Cpusets)
+			} else {
+				a.SharedCPUs = joinCpusets(cs.Cpusets)
+			}
+		}
+		assignments[a.ContainerID] = a
+	}
+	state.Assignments = assignments
 }
 
 func (stp *stp) configNotify(event config.Event, source config.Source) error {
 	stp.Info("configuration %s", event)
 
-	if err := stp.verifyConfig(cfg); err != nil {
+	moved, err := reconcileConfig(cfg, *stp.getContainerRegistry())
+	if err != nil {
 		return err
 	}
 
 	opt.createNodeLabel = cfg.LabelNode
 	opt.createNodeTaint = cfg.TaintNode
 	stp.conf = cfg
+	stp.moveContainers(moved)
+	if err := stp.updateNode(*stp.conf); err != nil {
+		stp.Warn("failed to update node for new configuration: %v", err)
+	}
 	stp.Info("config updated successfully")
 	stp.Debug("new policy configuration:\n%s", utils.DumpJSON(stp.conf))
 
@@ -296,52 +382,27 @@ func (stp *stp) initializeState() error {
 		}
 	}
 
-	return stp.verifyConfig(stp.conf)
-}
-
-// Verify configuration against the existing set of containers
-func (stp *stp) verifyConfig(cfg *conf) error {
-	//  Sanity check for config
-	if cfg == nil || cfg.Pools == nil {
-		return stpError("invalid config, no pools configured")
+	moved, err := reconcileConfig(stp.conf, *stp.getContainerRegistry())
+	if err != nil {
+		return err
 	}
+	stp.moveContainers(moved)
 
-	// Loop through all existing containers
-	ccr := stp.getContainerRegistry()
-	for id, cs := range *ccr {
-		// Check that pool for container exists
-		pool, ok := cfg.Pools[cs.Pool]
-		if !ok {
-			return stpError("invalid stp configuration: pool %q for container %q not found", cs.Pool, id)
-		}
+	return nil
+}
 
-		// Check that pool exclusivity is compatible with container configuration
-		if pool.Exclusive && cs.NExclusiveCPUs < 1 {
-			return stpError("invalid stp configuration: container %q with no exclusive CPUs set to run in exclusive pool %q", id, cs.Pool)
-		} else if !pool.Exclusive && cs.NExclusiveCPUs > 0 {
-			return stpError("invalid stp configuration: container %q with exclusive CPUs set to run in non-exclusive pool %q", id, cs.Pool)
-		}
+// socketPoolName returns the name used for the cpu lists of a pool in a socket.
+func socketPoolName(pool string, socket uint64) string {
+	return pool + "/socket #" + strconv.FormatUint(socket, 10)
+}
 
-		// Check that cpu lists (cpuset) of container can be satisfied by the pool
-		// NOTE: we do not try to do any migration to possibly free cpu lists
-		// if the originally allocated cpu lists are not available
-		// TODO: for non-exclusive pools it might be feasible just to alter the
-		// cpuset (i.e. reconcile new cpu list using the existing pool/socket
-		// spec for container) in case cpu lists do not match exactly
-		for _, cCpuset := range cs.Cpusets {
-			for i, pClist := range pool.CPULists {
-				if cCpuset == pClist.Cpuset {
-					pool.CPULists[i].addContainer(id)
-					break
-				}
-				if i == len(pool.CPULists)-1 {
-					return stpError("invalid stp configuration: cpu list %q configured for container %q not found in pool %q", cCpuset, id, cs.Pool)
-				}
-			}
-		}
+// joinCpusets combines cpusets into a single canonical cpuset string.
+func joinCpusets(cpusets []string) string {
+	cset, err := cpuset.Parse(strings.Join(cpusets, ","))
+	if err != nil {
+		return strings.Join(cpusets, ",")
 	}
-
-	return nil
+	return cset.String()
 }
 
 type cmkLegacyArgs struct {
@@ -461,7 +522,7 @@ func (stp *stp) allocateStpResources(c cache.Container, cs stpContainerStatus) e
 		cl.addContainer(containerID)
 		cpuset += sep + cl.Cpuset
 		sep = ","
-		cs.Cpusets = append(cs.Cpusets, cpuset)
+		cs.Cpusets = append(cs.Cpusets, cl.Cpuset)
 	}
 
 	// Commit our changes
@@ -22,6 +22,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	extapi "github.com/intel/cri-resource-manager/pkg/apis/resmgr/v1alpha1"
 	logger "github.com/intel/cri-resource-manager/pkg/log"
 )
 
@@ -85,3 +86,123 @@ func TestCachableData(t *testing.T) {
 		t.Errorf("Exptected %v but got %v", *ccr, *ccr2)
 	}
 }
+
+func testConf() *conf {
+	return &conf{
+		Pools: map[string]poolConfig{
+			"exclusive": {
+				Exclusive: true,
+				CPULists: []*cpuList{
+					{Socket: 0, Cpuset: "0,4"},
+					{Socket: 0, Cpuset: "1,5"},
+				},
+			},
+			"shared": {
+				CPULists: []*cpuList{
+					{Socket: 0, Cpuset: "2,6"},
+					{Socket: 1, Cpuset: "3,7"},
+				},
+			},
+		},
+	}
+}
+
+func TestReconcileConfig(t *testing.T) {
+	ccr := stpContainerCache{
+		"excl": stpContainerStatus{Pool: "exclusive", Socket: -1, NExclusiveCPUs: 1, Cpusets: []string{"1,5"}},
+		"sh-1": stpContainerStatus{Pool: "shared", Socket: -1, Cpusets: []string{"2,6"}},
+		"sh-2": stpContainerStatus{Pool: "shared", Socket: -1, Cpusets: []string{"3,7"}},
+	}
+
+	// 1. unchanged configuration should not move anything
+	moved, err := reconcileConfig(testConf(), ccr)
+	if err != nil || len(moved) != 0 {
+		t.Errorf("Expected no moves and no error but got %v, %v", moved, err)
+	}
+
+	// 2. shrinking a shared pool should move its containers
+	cfg := testConf()
+	shared := cfg.Pools["shared"]
+	shared.CPULists = shared.CPULists[0:1]
+	cfg.Pools["shared"] = shared
+	moved, err = reconcileConfig(cfg, ccr)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := map[string]stpContainerStatus{
+		"sh-2": {Pool: "shared", Socket: -1, Cpusets: []string{"2,6"}},
+	}
+	if !cmp.Equal(expected, moved) {
+		t.Errorf("Expected %v but got %v", expected, moved)
+	}
+
+	// 3. removing an exclusively assigned cpu list should be refused
+	cfg = testConf()
+	exclusive := cfg.Pools["exclusive"]
+	exclusive.CPULists = exclusive.CPULists[0:1]
+	cfg.Pools["exclusive"] = exclusive
+	if _, err = reconcileConfig(cfg, ccr); err == nil {
+		t.Errorf("Expected an error for a broken exclusive assignment")
+	}
+}
+
+func TestBalanceSharedPools(t *testing.T) {
+	ccr := stpContainerCache{
+		"sh-1": stpContainerStatus{Pool: "shared", Socket: -1, Cpusets: []string{"2,6"}},
+		"sh-2": stpContainerStatus{Pool: "shared", Socket: -1, Cpusets: []string{"2,6"}},
+		"sh-3": stpContainerStatus{Pool: "shared", Socket: 0, Cpusets: []string{"2,6"}},
+	}
+	cfg := testConf()
+	if _, err := reconcileConfig(cfg, ccr); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	moved := balanceSharedPools(cfg, ccr)
+	expected := map[string]stpContainerStatus{
+		"sh-1": {Pool: "shared", Socket: -1, Cpusets: []string{"3,7"}},
+	}
+	if !cmp.Equal(expected, moved) {
+		t.Errorf("Expected %v but got %v", expected, moved)
+	}
+}
+
+func TestStaticPoolsRequest(t *testing.T) {
+	lookup := func(annotations map[string]string) func(string) (string, bool) {
+		return func(key string) (string, bool) {
+			value, ok := annotations[key]
+			return value, ok
+		}
+	}
+
+	// 1. no annotations should give no request
+	req, err := parseStaticPoolsAnnotations(lookup(nil))
+	if req != nil || err != nil {
+		t.Errorf("Expected <nil> request and no error but got %v, %v", req, err)
+	}
+
+	// 2. invalid annotations should be ignored with an error
+	req, err = parseStaticPoolsAnnotations(lookup(map[string]string{
+		PoolKey:          "exclusive",
+		SocketKey:        "foo",
+		ExclusiveCPUsKey: "2",
+	}))
+	if err == nil {
+		t.Errorf("Expected an error for an invalid socket annotation")
+	}
+	cs := stpContainerStatus{Pool: "shared", Socket: 1}
+	applyStaticPoolsRequest(&cs, req)
+	expected := stpContainerStatus{Pool: "exclusive", Socket: 1, NExclusiveCPUs: 2}
+	if !cmp.Equal(expected, cs) {
+		t.Errorf("Expected %v but got %v", expected, cs)
+	}
+
+	// 3. adjustments should override annotations
+	pool, socket := "infra", int64(0)
+	req = mergeStaticPoolsRequest(req, &extapi.StaticPools{Pool: &pool, Socket: &socket})
+	cs = stpContainerStatus{Pool: "shared", Socket: -1}
+	applyStaticPoolsRequest(&cs, req)
+	expected = stpContainerStatus{Pool: "infra", Socket: 0, NExclusiveCPUs: 2}
+	if !cmp.Equal(expected, cs) {
+		t.Errorf("Expected %v but got %v", expected, cs)
+	}
+}
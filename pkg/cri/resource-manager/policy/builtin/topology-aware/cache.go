@@ -17,6 +17,7 @@ package topologyaware
 import (
 	"encoding/json"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
@@ -31,7 +32,11 @@ func (p *policy) saveAllocations() {
 }
 
 func (p *policy) restoreAllocations() bool {
-	return p.cache.GetPolicyEntry(keyAllocations, &p.allocations)
+	if !p.cache.GetPolicyEntry(keyAllocations, &p.allocations) {
+		return false
+	}
+	p.reaccountMemory()
+	return true
 }
 
 func (p *policy) saveConfig() error {
@@ -53,17 +58,23 @@ func (p *policy) restoreConfig() bool {
 
 type cachedGrant struct {
 	Exclusive string
+	Idle      string `json:",omitempty"`
 	Part      int
 	Container string
 	Pool      string
+	Memory    uint64       `json:",omitempty"`
+	Memset    system.IDSet `json:",omitempty"`
 }
 
 func newCachedGrant(cg CPUGrant) *cachedGrant {
 	ccg := &cachedGrant{}
 	ccg.Exclusive = cg.ExclusiveCPUs().String()
+	ccg.Idle = cg.IdleCPUs().String()
 	ccg.Part = cg.SharedPortion()
 	ccg.Container = cg.GetContainer().GetCacheID()
 	ccg.Pool = cg.GetNode().Name()
+	ccg.Memory = cg.GrantedMemory()
+	ccg.Memset = cg.Memset()
 
 	return ccg
 }
@@ -78,11 +89,20 @@ func (ccg *cachedGrant) ToCPUGrant(policy *policy) (CPUGrant, error) {
 		return nil, policyError("cache error: failed to restore %v, unknown container", *ccg)
 	}
 
+	// Grants cached before memsets were recorded get the full memory of their pool.
+	memset := ccg.Memset
+	if memset.Size() == 0 {
+		memset = node.GetMemset()
+	}
+
 	return newCPUGrant(
 		node,
 		container,
 		cpuset.MustParse(ccg.Exclusive),
+		cpuset.MustParse(ccg.Idle),
 		ccg.Part,
+		ccg.Memory,
+		memset,
 	), nil
 }
 
@@ -98,6 +118,9 @@ func (cg *cpuGrant) UnmarshalJSON(data []byte) error {
 	}
 
 	cg.exclusive = cpuset.MustParse(ccg.Exclusive)
+	cg.idle = cpuset.MustParse(ccg.Idle)
+	cg.memory = ccg.Memory
+	cg.memset = ccg.Memset
 
 	return nil
 }
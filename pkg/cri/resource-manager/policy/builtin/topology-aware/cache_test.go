@@ -18,15 +18,22 @@ import (
 	"bytes"
 	"testing"
 
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
 func TestToCPUGrant(t *testing.T) {
+	pool := &virtualnode{}
+	pool.self.node = pool
+	pool.mem = system.NewIDSet(0, 1)
+
 	tcases := []struct {
-		name          string
-		policy        *policy
-		cgrant        *cachedGrant
-		expectedError bool
+		name           string
+		policy         *policy
+		cgrant         *cachedGrant
+		expectedError  bool
+		expectedMemset system.IDSet
 	}{
 		{
 			name:   "unknown node",
@@ -53,28 +60,48 @@ func TestToCPUGrant(t *testing.T) {
 		},
 		{
 			name: "known node",
+			cgrant: &cachedGrant{
+				Pool:   "node1",
+				Memset: system.NewIDSet(1),
+			},
+			policy: &policy{
+				nodes: map[string]Node{
+					"node1": pool,
+				},
+				cache: &mockCache{
+					returnValue2ForLookupContainer: true,
+				},
+			},
+			expectedMemset: system.NewIDSet(1),
+		},
+		{
+			name: "known node without cached memset",
 			cgrant: &cachedGrant{
 				Pool: "node1",
 			},
 			policy: &policy{
 				nodes: map[string]Node{
-					"node1": &node{},
+					"node1": pool,
 				},
 				cache: &mockCache{
 					returnValue2ForLookupContainer: true,
 				},
 			},
+			expectedMemset: system.NewIDSet(0, 1),
 		},
 	}
 	for _, tc := range tcases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := tc.cgrant.ToCPUGrant(tc.policy)
+			cg, err := tc.cgrant.ToCPUGrant(tc.policy)
 			if tc.expectedError && err == nil {
 				t.Errorf("Expected error, but got success")
 			}
 			if !tc.expectedError && err != nil {
 				t.Errorf("Unxpected error: %+v", err)
 			}
+			if tc.expectedMemset != nil && cg.Memset().String() != tc.expectedMemset.String() {
+				t.Errorf("Expected memset %s, got %s", tc.expectedMemset, cg.Memset())
+			}
 		})
 	}
 }
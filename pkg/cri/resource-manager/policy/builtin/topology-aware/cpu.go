@@ -17,7 +17,9 @@ package topologyaware
 import (
 	"fmt"
 
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
@@ -45,6 +47,8 @@ type CPUSupply interface {
 	Allocate(CPURequest) (CPUGrant, error)
 	// Release releases a previously allocated grant.
 	Release(CPUGrant)
+	// Reserve takes back the capacity of a previously released grant.
+	Reserve(CPUGrant)
 	// String returns a printable representation of this supply.
 	String() string
 }
@@ -64,6 +68,12 @@ type CPURequest interface {
 	Isolate() bool
 	// Elevate returns the requested elevation/allocation displacement for this request.
 	Elevate() int
+	// MemoryRequest returns the amount of memory requested.
+	MemoryRequest() uint64
+	// CoreKind returns the preferred kind of cores, if any, for this request.
+	CoreKind() (system.CoreKind, bool)
+	// StrictSMT returns whether exclusive CPUs should be granted as full physical cores.
+	StrictSMT() bool
 }
 
 // CPUGrant represents CPU capacity allocated to a container from a node.
@@ -80,6 +90,12 @@ type CPUGrant interface {
 	SharedPortion() int
 	// IsolatedCpus returns the exclusively granted isolated cpuset.
 	IsolatedCPUs() cpuset.CPUSet
+	// IdleCPUs returns the hyperthread siblings of exclusive CPUs withheld from others.
+	IdleCPUs() cpuset.CPUSet
+	// GrantedMemory returns the amount of memory granted.
+	GrantedMemory() uint64
+	// Memset returns the set of memory (NUMA nodes) granted.
+	Memset() system.IDSet
 	// String returns a printable representation of this grant.
 	String() string
 }
@@ -97,6 +113,8 @@ type CPUScore interface {
 	SharedCapacity() int
 	Colocated() int
 	HintScores() map[string]float64
+	MemoryFit() bool
+	CoreKindFit() float64
 
 	String() string
 }
@@ -113,10 +131,16 @@ var _ CPUSupply = &cpuSupply{}
 
 // cpuRequest implements our CpuRequest interface.
 type cpuRequest struct {
-	container cache.Container // container for this request
-	full      int             // number of full CPUs requested
-	fraction  int             // amount of fractional CPU requested
-	isolate   bool            // prefer isolated exclusive CPUs
+	container  cache.Container // container for this request
+	full       int             // number of full CPUs requested
+	fraction   int             // amount of fractional CPU requested
+	isolate    bool            // prefer isolated exclusive CPUs
+	memory     uint64          // amount of memory requested
+	kind       system.CoreKind // preferred kind of cores
+	anyKind    bool            // no preferred kind of cores
+	strict     bool            // grant exclusive CPUs as full physical cores
+	sticky     cpuset.CPUSet   // exclusive CPUs of a sticky allocation
+	stickyMems system.IDSet    // memory nodes of a sticky allocation
 
 	// elevate indicates how much to elevate the actual allocation of the
 	// container in the tree of pools. Or in other words how many levels to
@@ -132,7 +156,10 @@ type cpuGrant struct {
 	container cache.Container // container CPU is granted to
 	node      Node            // node CPU is supplied from
 	exclusive cpuset.CPUSet   // exclusive CPUs
+	idle      cpuset.CPUSet   // idle hyperthread siblings of exclusive CPUs
 	portion   int             // milliCPUs granted from shared set
+	memory    uint64          // amount of memory granted
+	memset    system.IDSet    // memory (NUMA nodes) granted
 }
 
 var _ CPUGrant = &cpuGrant{}
@@ -145,6 +172,8 @@ type cpuScore struct {
 	shared    int                // remaining shared capacity
 	colocated int                // number of colocated containers
 	hints     map[string]float64 // hint scores
+	memfit    bool               // whether requested memory fits
+	corefit   float64            // fraction of CPUs of the preferred kind
 }
 
 var _ CPUScore = &cpuScore{}
@@ -198,7 +227,7 @@ func (cs *cpuSupply) AccountAllocate(g CPUGrant) {
 	if cs.node.IsSameNode(g.GetNode()) {
 		return
 	}
-	exclusive := g.ExclusiveCPUs()
+	exclusive := g.ExclusiveCPUs().Union(g.IdleCPUs())
 	cs.isolated = cs.isolated.Difference(exclusive)
 	cs.sharable = cs.sharable.Difference(exclusive)
 }
@@ -211,7 +240,7 @@ func (cs *cpuSupply) AccountRelease(g CPUGrant) {
 
 	ncs := cs.node.GetCPU()
 	nodecpus := ncs.IsolatedCPUs().Union(ncs.SharableCPUs())
-	grantcpus := g.ExclusiveCPUs().Intersection(nodecpus)
+	grantcpus := g.ExclusiveCPUs().Union(g.IdleCPUs()).Intersection(nodecpus)
 
 	isolated := grantcpus.Intersection(ncs.IsolatedCPUs())
 	sharable := grantcpus.Intersection(ncs.SharableCPUs())
@@ -221,15 +250,26 @@ func (cs *cpuSupply) AccountRelease(g CPUGrant) {
 
 // Allocate allocates a grant from the supply.
 func (cs *cpuSupply) Allocate(r CPURequest) (CPUGrant, error) {
-	var exclusive cpuset.CPUSet
+	var exclusive, idle cpuset.CPUSet
 	var err error
 
 	cr := r.(*cpuRequest)
 
 	// allocate isolated exclusive CPUs or slice them off the sharable set
 	switch {
+	case cr.full > 0 && cs.hasStickyCPUs(cr):
+		exclusive, idle = cs.takeStickyCPUs(cr)
+
+	case cr.full > 0 && cr.strict:
+		exclusive, idle, err = cs.takeFullCores(cr.full, cr.allocFlags())
+		if err != nil {
+			return nil, policyError("internal error: "+
+				"can't allocate %d exclusive CPUs as full cores from %s of %s: %v",
+				cr.full, cs, cs.node.Name(), err)
+		}
+
 	case cr.full > 0 && cs.isolated.Size() >= cr.full:
-		exclusive, err = cs.takeCPUs(&cs.isolated, nil, cr.full)
+		exclusive, err = cs.takeCPUs(&cs.isolated, nil, cr.full, cr.allocFlags())
 		if err != nil {
 			return nil, policyError("internal error: "+
 				"can't allocate %d exclusive CPUs from %s of %s",
@@ -237,7 +277,7 @@ func (cs *cpuSupply) Allocate(r CPURequest) (CPUGrant, error) {
 		}
 
 	case cr.full > 0 && (1000*cs.sharable.Size()-cs.granted)/1000 > cr.full:
-		exclusive, err = cs.takeCPUs(&cs.sharable, nil, cr.full)
+		exclusive, err = cs.takeCPUs(&cs.sharable, nil, cr.full, cr.allocFlags())
 		if err != nil {
 			return nil, policyError("internal error: "+
 				"can't slice %d exclusive CPUs from %s(-%d) of %s",
@@ -255,7 +295,18 @@ func (cs *cpuSupply) Allocate(r CPURequest) (CPUGrant, error) {
 		cs.granted += cr.fraction
 	}
 
-	grant := newCPUGrant(cs.node, cr.GetContainer(), exclusive, cr.fraction)
+	// allocate memory, widening the memset to neighbor nodes if necessary
+	memset := cs.node.GetMemset()
+	if cr.memory > 0 && !cs.node.IsRootNode() {
+		if cr.stickyMems.Size() > 0 && cs.node.Policy().memoryFits(cr.stickyMems, cr.memory) {
+			memset = cr.stickyMems.Clone()
+		} else {
+			memset = cs.node.Policy().widenMemset(memset, cr.memory)
+		}
+	}
+
+	grant := newCPUGrant(cs.node, cr.GetContainer(), exclusive, idle, cr.fraction, cr.memory, memset)
+	cs.node.Policy().chargeMemory(grant)
 
 	cs.node.DepthFirst(func(n Node) error {
 		n.FreeCPU().AccountAllocate(grant)
@@ -267,12 +318,14 @@ func (cs *cpuSupply) Allocate(r CPURequest) (CPUGrant, error) {
 
 // Release returns CPU from the given grant to the supply.
 func (cs *cpuSupply) Release(g CPUGrant) {
-	isolated := g.ExclusiveCPUs().Intersection(cs.node.GetCPU().IsolatedCPUs())
-	sharable := g.ExclusiveCPUs().Difference(isolated)
+	exclusive := g.ExclusiveCPUs().Union(g.IdleCPUs())
+	isolated := exclusive.Intersection(cs.node.GetCPU().IsolatedCPUs())
+	sharable := exclusive.Difference(isolated)
 
 	cs.isolated = cs.isolated.Union(isolated)
 	cs.sharable = cs.sharable.Union(sharable)
 	cs.granted -= g.SharedPortion()
+	cs.node.Policy().unchargeMemory(g)
 
 	cs.node.DepthFirst(func(n Node) error {
 		n.FreeCPU().AccountRelease(g)
@@ -280,6 +333,21 @@ func (cs *cpuSupply) Release(g CPUGrant) {
 	})
 }
 
+// Reserve takes back the exact CPU and memory of a previously released grant.
+func (cs *cpuSupply) Reserve(g CPUGrant) {
+	exclusive := g.ExclusiveCPUs().Union(g.IdleCPUs())
+
+	cs.isolated = cs.isolated.Difference(exclusive)
+	cs.sharable = cs.sharable.Difference(exclusive)
+	cs.granted += g.SharedPortion()
+	cs.node.Policy().chargeMemory(g)
+
+	cs.node.DepthFirst(func(n Node) error {
+		n.FreeCPU().AccountAllocate(g)
+		return nil
+	})
+}
+
 // String returns the CPU supply as a string.
 func (cs *cpuSupply) String() string {
 	none, isolated, sharable, sep := "-", "", "", ""
@@ -299,8 +367,8 @@ func (cs *cpuSupply) String() string {
 }
 
 // takeCPUs takes up to cnt CPUs from a given CPU set to another.
-func (cs *cpuSupply) takeCPUs(from, to *cpuset.CPUSet, cnt int) (cpuset.CPUSet, error) {
-	cset, err := cs.node.Policy().cpuAllocator.AllocateCpus(from, cnt, true)
+func (cs *cpuSupply) takeCPUs(from, to *cpuset.CPUSet, cnt int, flags cpuallocator.AllocFlag) (cpuset.CPUSet, error) {
+	cset, err := cs.node.Policy().cpuAllocator.AllocateCpusWithFlags(from, cnt, true, flags)
 	if err != nil {
 		return cset, err
 	}
@@ -316,6 +384,8 @@ func (cs *cpuSupply) takeCPUs(from, to *cpuset.CPUSet, cnt int) (cpuset.CPUSet,
 func newCPURequest(container cache.Container) CPURequest {
 	pod, _ := container.GetPod()
 	full, fraction, isolate, elevate := cpuAllocationPreferences(pod, container)
+	kind, hasKind := podCoreKindPreference(pod, container)
+	strict := full > 0 && podStrictSMTPreference(pod, container)
 
 	return &cpuRequest{
 		container: container,
@@ -323,6 +393,10 @@ func newCPURequest(container cache.Container) CPURequest {
 		fraction:  fraction,
 		isolate:   isolate,
 		elevate:   elevate,
+		memory:    memoryRequest(container),
+		kind:      kind,
+		anyKind:   !hasKind,
+		strict:    strict,
 	}
 }
 
@@ -334,6 +408,9 @@ func (cr *cpuRequest) GetContainer() cache.Container {
 // String returns aprintable representation of the CPU request.
 func (cr *cpuRequest) String() string {
 	isolated := map[bool]string{false: "", true: "isolated "}[cr.isolate]
+	if cr.strict {
+		isolated += "full-core "
+	}
 	switch {
 	case cr.full == 0 && cr.fraction == 0:
 		return fmt.Sprintf("<CPU request " + cr.container.PrettyName() + ": ->")
@@ -372,6 +449,34 @@ func (cr *cpuRequest) Elevate() int {
 	return cr.elevate
 }
 
+// MemoryRequest returns the amount of memory requested.
+func (cr *cpuRequest) MemoryRequest() uint64 {
+	return cr.memory
+}
+
+// CoreKind returns the preferred kind of cores, if any, for this request.
+func (cr *cpuRequest) CoreKind() (system.CoreKind, bool) {
+	return cr.kind, !cr.anyKind
+}
+
+// StrictSMT returns whether exclusive CPUs should be granted as full physical cores.
+func (cr *cpuRequest) StrictSMT() bool {
+	return cr.strict
+}
+
+// allocFlags returns the CPU allocator flags for this request.
+func (cr *cpuRequest) allocFlags() cpuallocator.AllocFlag {
+	flags := cpuallocator.AllocDefault | cpuallocator.AllocLeastFragmenting
+	switch {
+	case cr.anyKind:
+		return flags
+	case cr.kind == system.EfficientCore:
+		return flags | cpuallocator.AllocPreferEfficientCores
+	default:
+		return flags | cpuallocator.AllocAvoidEfficientCores
+	}
+}
+
 // Score collects data for scoring this supply wrt. the given request.
 func (cs *cpuSupply) GetScore(request CPURequest) CPUScore {
 	score := &cpuScore{
@@ -390,17 +495,45 @@ func (cs *cpuSupply) GetScore(request CPURequest) CPUScore {
 
 	// calculate isolated node capacity CPU
 	if cr.isolate {
-		score.isolated = cs.isolated.Size() - full
+		if cr.strict {
+			score.isolated = cs.fullCoreCapacity(cs.isolated, full)
+		} else {
+			score.isolated = cs.isolated.Size() - full
+		}
 	}
 
 	// if we don't want isolated or there is not enough, calculate slicable capacity
 	if !cr.isolate || score.isolated < 0 {
-		score.shared -= 1000 * full
+		if cr.strict {
+			if cs.fullCoreCapacity(cs.sharable, full) < 0 {
+				score.shared = -1
+			} else {
+				score.shared -= 1000 * cs.fullCoreFootprint(full)
+			}
+		} else {
+			score.shared -= 1000 * full
+		}
 	}
 
 	// calculate fractional capacity
 	score.shared -= part
 
+	// calculate the fraction of CPUs of the preferred kind
+	score.corefit = 1.0
+	if !cr.anyKind {
+		nodecpu := cs.node.GetCPU()
+		cpus := nodecpu.SharableCPUs().Union(nodecpu.IsolatedCPUs())
+		if cpus.Size() > 0 {
+			kindCPUs := cs.node.System().CoreKindCPUs(cr.kind).Intersection(cpus)
+			score.corefit = float64(kindCPUs.Size()) / float64(cpus.Size())
+		} else {
+			score.corefit = 0.0
+		}
+	}
+
+	// calculate memory fit
+	score.memfit = cs.node.Policy().memoryFits(cs.node.GetMemset(), cr.memory)
+
 	// calculate colocation score
 	for _, grant := range cs.node.Policy().allocations.CPU {
 		if grant.GetNode().NodeID() == cs.node.NodeID() {
@@ -465,18 +598,30 @@ func (score *cpuScore) HintScores() map[string]float64 {
 	return score.hints
 }
 
+func (score *cpuScore) MemoryFit() bool {
+	return score.memfit
+}
+
+func (score *cpuScore) CoreKindFit() float64 {
+	return score.corefit
+}
+
 func (score *cpuScore) String() string {
-	return fmt.Sprintf("<CPU score: node %s, isolated:%d, shared:%d, colocated:%d, hints: %v>",
-		score.supply.GetNode().Name(), score.isolated, score.shared, score.colocated, score.hints)
+	return fmt.Sprintf("<CPU score: node %s, isolated:%d, shared:%d, colocated:%d, memfit:%v, corefit:%.2f, hints: %v>",
+		score.supply.GetNode().Name(), score.isolated, score.shared, score.colocated, score.memfit,
+		score.corefit, score.hints)
 }
 
 // newCPUGrant creates a CPU grant from the given node for the container.
-func newCPUGrant(n Node, c cache.Container, exclusive cpuset.CPUSet, portion int) CPUGrant {
+func newCPUGrant(n Node, c cache.Container, exclusive, idle cpuset.CPUSet, portion int, memory uint64, memset system.IDSet) CPUGrant {
 	return &cpuGrant{
 		node:      n,
 		container: c,
 		exclusive: exclusive,
+		idle:      idle,
 		portion:   portion,
+		memory:    memory,
+		memset:    memset,
 	}
 }
 
@@ -510,9 +655,24 @@ func (cg *cpuGrant) IsolatedCPUs() cpuset.CPUSet {
 	return cg.node.GetCPU().IsolatedCPUs().Intersection(cg.exclusive)
 }
 
+// IdleCPUs returns the hyperthread siblings of exclusive CPUs withheld from others.
+func (cg *cpuGrant) IdleCPUs() cpuset.CPUSet {
+	return cg.idle
+}
+
+// GrantedMemory returns the amount of memory granted.
+func (cg *cpuGrant) GrantedMemory() uint64 {
+	return cg.memory
+}
+
+// Memset returns the set of memory (NUMA nodes) granted.
+func (cg *cpuGrant) Memset() system.IDSet {
+	return cg.memset.Clone()
+}
+
 // String returns a printable representation of the CPU grant.
 func (cg *cpuGrant) String() string {
-	var isolated, exclusive, shared, sep string
+	var isolated, exclusive, shared, memory, sep string
 
 	isol := cg.IsolatedCPUs()
 	if !isol.IsEmpty() {
@@ -523,11 +683,19 @@ func (cg *cpuGrant) String() string {
 		exclusive = fmt.Sprintf("%sexclusive: %s", sep, cg.exclusive)
 		sep = ", "
 	}
+	if !cg.idle.IsEmpty() {
+		exclusive += fmt.Sprintf("%sidle siblings: %s", sep, cg.idle)
+		sep = ", "
+	}
 	if cg.portion > 0 {
 		shared = fmt.Sprintf("%sshared: %s (%d milli-CPU)", sep,
 			cg.node.FreeCPU().SharableCPUs(), cg.portion)
+		sep = ", "
+	}
+	if cg.memory > 0 {
+		memory = fmt.Sprintf("%smemory: %d from %s", sep, cg.memory, cg.memset)
 	}
 
-	return fmt.Sprintf("<CPU grant for %s from %s: %s%s%s>",
-		cg.container.PrettyName(), cg.node.Name(), isolated, exclusive, shared)
+	return fmt.Sprintf("<CPU grant for %s from %s: %s%s%s%s>",
+		cg.container.PrettyName(), cg.node.Name(), isolated, exclusive, shared, memory)
 }
@@ -0,0 +1,198 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"sort"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// sortByCPURequest sorts containers by decreasing CPU request, for compacting allocations.
+func sortByCPURequest(containers []cache.Container) {
+	requests := make(map[string]int, len(containers))
+	for _, c := range containers {
+		req := newCPURequest(c)
+		requests[c.GetCacheID()] = 1000*req.FullCPUs() + req.CPUFraction()
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		return requests[containers[i].GetCacheID()] > requests[containers[j].GetCacheID()]
+	})
+}
+
+// freeCPUs returns the set of CPUs not exclusively granted to any container.
+func (p *policy) freeCPUs() cpuset.CPUSet {
+	cpus := p.root.GetCPU()
+	free := cpus.SharableCPUs().Union(cpus.IsolatedCPUs())
+	for _, grant := range p.allocations.CPU {
+		free = free.Difference(grant.ExclusiveCPUs()).Difference(grant.IdleCPUs())
+	}
+	return free
+}
+
+// fragmentingGrants returns the exclusive grants which, if released, would
+// reduce the fragmentation of free CPUs the most, in decreasing order.
+func (p *policy) fragmentingGrants() []CPUGrant {
+	free := p.freeCPUs()
+	current := p.cpuAllocator.Fragmentation(free)
+
+	gains := map[CPUGrant]int{}
+	grants := []CPUGrant{}
+	for _, grant := range p.allocations.CPU {
+		if grant.ExclusiveCPUs().IsEmpty() {
+			continue
+		}
+		gain := current - p.cpuAllocator.Fragmentation(free.Union(grant.ExclusiveCPUs()))
+		if gain > 0 {
+			gains[grant] = gain
+			grants = append(grants, grant)
+		}
+	}
+
+	sort.Slice(grants, func(i, j int) bool {
+		gi, gj := grants[i], grants[j]
+		if gains[gi] != gains[gj] {
+			return gains[gi] > gains[gj]
+		}
+		return gi.GetContainer().GetCacheID() < gj.GetContainer().GetCacheID()
+	})
+
+	return grants
+}
+
+// migrateExclusiveGrants reallocates the most fragmenting exclusive grants, within the
+// migration budget of the current interval. It returns the number of grants migrated.
+func (p *policy) migrateExclusiveGrants(now time.Time) (int, error) {
+	var errors error
+
+	if now.Sub(p.migrationAt) >= time.Duration(opt.MigrationInterval) {
+		p.migrationAt = now
+		p.migrations = 0
+	}
+	if p.migrations >= opt.MigrationBudget {
+		return 0, nil
+	}
+
+	before := p.cpuAllocator.Fragmentation(p.freeCPUs())
+	migrated := 0
+	for _, grant := range p.fragmentingGrants() {
+		if p.migrations >= opt.MigrationBudget {
+			break
+		}
+
+		ok, err := p.migrateGrant(grant)
+		if err != nil {
+			errors = p.appendError(errors, err)
+			continue
+		}
+		if ok {
+			p.migrations++
+			migrated++
+		}
+	}
+
+	if migrated > 0 {
+		log.Info("migrated %d exclusive grants, fragmentation of free CPUs %d => %d",
+			migrated, before, p.cpuAllocator.Fragmentation(p.freeCPUs()))
+	}
+
+	return migrated, errors
+}
+
+// migrateGrant tries to reallocate an exclusive grant within its original pool
+// and memory nodes, so a running container never has its memset changed. The
+// new grant is only applied if it leaves free CPUs less fragmented, otherwise
+// the old grant is reinstated.
+func (p *policy) migrateGrant(old CPUGrant) (bool, error) {
+	c := old.GetContainer()
+	before := p.cpuAllocator.Fragmentation(p.freeCPUs())
+
+	if _, _, err := p.releasePool(c); err != nil {
+		return false, policyError("failed to release %s for migration: %v", c.PrettyName(), err)
+	}
+
+	request := newCPURequest(c)
+	request.(*cpuRequest).stickyMems = old.Memset()
+
+	grant, err := old.GetNode().FreeCPU().Allocate(request)
+	if err != nil {
+		p.reinstateGrant(old)
+		return false, policyError("failed to migrate %s: %v", c.PrettyName(), err)
+	}
+	p.allocations.CPU[c.GetCacheID()] = grant
+	p.saveAllocations()
+
+	if grant.Memset().String() != old.Memset().String() {
+		log.Debug("not migrating %s, memory would move from nodes %s to %s",
+			c.PrettyName(), old.Memset(), grant.Memset())
+		return false, p.rollbackMigration(c, old)
+	}
+
+	after := p.cpuAllocator.Fragmentation(p.freeCPUs())
+	if after >= before {
+		log.Debug("not migrating %s, fragmentation of free CPUs %d => %d",
+			c.PrettyName(), before, after)
+		return false, p.rollbackMigration(c, old)
+	}
+
+	p.wakeUpGrant(grant)
+
+	if err := p.applyGrant(grant); err != nil {
+		err = policyError("failed to apply migrated grant %s: %v", grant, err)
+		return false, p.appendError(err, p.rollbackMigration(c, old))
+	}
+
+	log.Info("migrated exclusive CPUs %s of %s to %s to defragment free CPUs",
+		old.ExclusiveCPUs(), c.PrettyName(), grant.ExclusiveCPUs())
+
+	p.parkIdleSiblings(grant)
+
+	if err := p.updateSharedAllocations(grant); err != nil {
+		log.Warn("failed to update shared allocations affected by %s: %v",
+			c.PrettyName(), err)
+	}
+
+	return true, nil
+}
+
+// rollbackMigration releases the new grant of a container and reinstates its old one.
+func (p *policy) rollbackMigration(c cache.Container, old CPUGrant) error {
+	if _, _, err := p.releasePool(c); err != nil {
+		return policyError("failed to release migrated grant of %s: %v", c.PrettyName(), err)
+	}
+	p.reinstateGrant(old)
+	return nil
+}
+
+// reinstateGrant restores a released grant with its original resources.
+func (p *policy) reinstateGrant(grant CPUGrant) {
+	grant.GetNode().FreeCPU().Reserve(grant)
+	p.allocations.CPU[grant.GetContainer().GetCacheID()] = grant
+	p.saveAllocations()
+	p.parkIdleSiblings(grant)
+}
+
+// appendError combines errors, the way rebalancing reports them.
+func (p *policy) appendError(errors, err error) error {
+	if err == nil {
+		return errors
+	}
+	if errors == nil {
+		return err
+	}
+	return policyError("%v, %v", errors, err)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// addExclusiveTestGrant adds a reserved exclusive grant of a guaranteed container to a pool.
+func (p *policy) addExclusiveTestGrant(id string, n Node, cpus string) CPUGrant {
+	exclusive := cpuset.MustParse(cpus)
+	qty := *resource.NewQuantity(int64(exclusive.Size()), resource.DecimalSI)
+	c := &mockContainer{
+		name:                      id,
+		returnValueForGetCacheID:  id,
+		returnValueForGetQOSClass: v1.PodQOSGuaranteed,
+		returnValueForGetPod:      &mockPod{returnValueFotGetQOSClass: v1.PodQOSGuaranteed},
+		returnValueForGetResourceRequirements: v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: qty},
+			Limits:   v1.ResourceList{v1.ResourceCPU: qty},
+		},
+	}
+	grant := newCPUGrant(n, c, exclusive, cpuset.NewCPUSet(), 0, 0, n.GetMemset())
+	n.FreeCPU().Reserve(grant)
+	p.allocations.CPU[id] = grant
+	return grant
+}
+
+func TestFragmentingGrants(t *testing.T) {
+	p := newTestPolicy()
+	p.addExclusiveTestGrant("a", p.pools[2], "5")
+	p.addExclusiveTestGrant("b", p.pools[3], "8-9")
+	p.addExclusiveTestGrant("c", p.pools[1], "1-2")
+	p.addExclusiveTestGrant("d", p.pools[4], "12")
+	p.addTestGrant("e", p.pools[4], v1.PodQOSBurstable, cpuset.NewCPUSet(), 500)
+
+	// Releasing c rejoins two partial cores, a and d one each, b none.
+	expected := []string{"c", "a", "d"}
+
+	grants := p.fragmentingGrants()
+	if len(grants) != len(expected) {
+		t.Fatalf("expected %d fragmenting grants, got %d", len(expected), len(grants))
+	}
+	for i, grant := range grants {
+		if id := grant.GetContainer().GetCacheID(); id != expected[i] {
+			t.Errorf("grant #%d: expected %s, got %s", i, expected[i], id)
+		}
+	}
+}
+
+func TestMigrationBudget(t *testing.T) {
+	saved := *opt
+	defer func() { *opt = saved }()
+	opt.MigrationBudget = 1
+	opt.MigrationInterval = config.Duration(time.Minute)
+
+	start := time.Now()
+
+	tcases := []struct {
+		name       string
+		migrations int
+		now        time.Time
+		expectedAt time.Time
+		expected   int
+	}{
+		{
+			name:       "budget left",
+			now:        start.Add(time.Second),
+			expectedAt: start,
+		},
+		{
+			name:       "budget exhausted",
+			migrations: 1,
+			now:        start.Add(time.Second),
+			expectedAt: start,
+			expected:   1,
+		},
+		{
+			name:       "budget reset after interval",
+			migrations: 1,
+			now:        start.Add(time.Minute),
+			expectedAt: start.Add(time.Minute),
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestPolicy()
+			p.migrationAt = start
+			p.migrations = tc.migrations
+
+			if _, err := p.migrateExclusiveGrants(tc.now); err != nil {
+				t.Fatalf("unexpected migration error: %v", err)
+			}
+			if !p.migrationAt.Equal(tc.expectedAt) {
+				t.Errorf("expected migration interval to start at %v, got %v", tc.expectedAt, p.migrationAt)
+			}
+			if p.migrations != tc.expected {
+				t.Errorf("expected %d migrations, got %d", tc.expected, p.migrations)
+			}
+		})
+	}
+}
+
+func TestMigrateGrantRollback(t *testing.T) {
+	p := newTestPolicy()
+	pool := p.pools[2]
+	old := p.addExclusiveTestGrant("a", pool, "5")
+	free := pool.FreeCPU().SharableCPUs()
+
+	// The only placement in the original pool is as fragmenting as the old one.
+	ok, err := p.migrateGrant(old)
+	if err != nil {
+		t.Fatalf("unexpected migration error: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected migration to be rolled back")
+	}
+
+	grant, found := p.allocations.CPU["a"]
+	if !found {
+		t.Fatalf("grant of rolled back migration not reinstated")
+	}
+	if cpus := grant.ExclusiveCPUs().String(); cpus != "5" {
+		t.Errorf("expected reinstated CPUs 5, got %s", cpus)
+	}
+	if grant.GetNode() != pool {
+		t.Errorf("expected reinstated grant in %s, got %s", pool.Name(), grant.GetNode().Name())
+	}
+	if cpus := pool.FreeCPU().SharableCPUs(); !cpus.Equals(free) {
+		t.Errorf("expected free CPUs %s after rollback, got %s", free, cpus)
+	}
+}
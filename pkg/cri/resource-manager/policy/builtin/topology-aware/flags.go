@@ -15,6 +15,8 @@
 package topologyaware
 
 import (
+	"time"
+
 	config "github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/topology"
 )
@@ -29,6 +31,24 @@ type options struct {
 	PreferIsolated bool `json:"PreferIsolatedCPUs"`
 	// PreferShared controls whether shared CPU allocation is always preferred by default.
 	PreferShared bool `json:"PreferSharedCPUs"`
+	// StrictSMTIsolation controls whether exclusive CPUs are granted as full physical cores by default.
+	StrictSMTIsolation bool `json:",omitempty"`
+	// ParkIdleSiblings controls whether idle siblings of full core grants are put offline.
+	ParkIdleSiblings bool `json:",omitempty"`
+	// MigrateExclusive enables migrating exclusive CPU grants to defragment free CPUs when rebalancing.
+	MigrateExclusive bool `json:",omitempty"`
+	// MigrationBudget is the maximum number of exclusive grants to migrate per migration interval.
+	MigrationBudget int `json:",omitempty"`
+	// MigrationInterval is the period the migration budget applies to.
+	MigrationInterval config.Duration `json:",omitempty"`
+	// StickyAllocationPeriod is how long the allocation of a released container is kept for its replacement.
+	StickyAllocationPeriod config.Duration `json:",omitempty"`
+	// PowerSaving consolidates workloads at low load, putting unused CPUs into lowest frequency or offline.
+	PowerSaving string `json:",omitempty"`
+	// PowerSavingLowLoad is the load (percentage of all CPUs) below which workloads are consolidated.
+	PowerSavingLowLoad int `json:",omitempty"`
+	// PowerSavingHighLoad is the load (percentage of awake CPUs) above which all CPUs are brought back.
+	PowerSavingHighLoad int `json:",omitempty"`
 	// FakeHints are the set of fake TopologyHints to use for testing purposes.
 	FakeHints fakehints `json:",omitempty"`
 }
@@ -54,11 +74,16 @@ func (fh *fakehints) merge(hints fakehints) {
 // defaultOptions returns a new options instance, all initialized to defaults.
 func defaultOptions() interface{} {
 	return &options{
-		PinCPU:         true,
-		PinMemory:      true,
-		PreferIsolated: true,
-		PreferShared:   false,
-		FakeHints:      make(fakehints),
+		PinCPU:                 true,
+		PinMemory:              true,
+		PreferIsolated:         true,
+		PreferShared:           false,
+		MigrationBudget:        1,
+		MigrationInterval:      config.Duration(10 * time.Minute),
+		StickyAllocationPeriod: config.Duration(30 * time.Second),
+		PowerSavingLowLoad:     30,
+		PowerSavingHighLoad:    60,
+		FakeHints:              make(fakehints),
 	}
 }
 
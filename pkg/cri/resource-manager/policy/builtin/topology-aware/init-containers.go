@@ -0,0 +1,156 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+)
+
+//
+// Init containers of a pod run to completion, one at a time, before any of
+// the application containers is created. Once the first application container
+// of a pod is allocated, the allocations of the init containers are released
+// and their exclusive CPUs are inherited by the application containers. This
+// way the pod only ever accounts for max(init, sum(app)) CPUs, like the
+// effective request used by kubelet, instead of init and app at the same time.
+//
+
+// inheritedCPUs are exclusive CPUs released by completed init containers.
+type inheritedCPUs struct {
+	node string        // name of the pool of the released init container grant
+	cpus cpuset.CPUSet // exclusive CPUs not yet taken by application containers
+}
+
+// isInitContainer checks if a container is an init container of its pod.
+func isInitContainer(c cache.Container) bool {
+	pod, ok := c.GetPod()
+	if !ok {
+		return false
+	}
+	_, ok = pod.GetPodResourceRequirements().InitContainers[c.GetName()]
+	return ok
+}
+
+// isCompletedInitContainer checks if a container is an init container which
+// has already completed.
+func (p *policy) isCompletedInitContainer(c cache.Container) bool {
+	if !isInitContainer(c) {
+		return false
+	}
+	if c.GetState() == cache.ContainerStateExited {
+		return true
+	}
+
+	pod, _ := c.GetPod()
+	for _, other := range pod.GetContainers() {
+		if _, ok := p.allocations.CPU[other.GetCacheID()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseInitContainers releases the allocations of the init containers of the
+// pod of an application container, letting the pod inherit their exclusive CPUs.
+func (p *policy) releaseInitContainers(c cache.Container) {
+	if isInitContainer(c) {
+		return
+	}
+	pod, ok := c.GetPod()
+	if !ok {
+		return
+	}
+
+	p.pruneInheritedCPUs()
+
+	for _, ic := range pod.GetInitContainers() {
+		grant, ok := p.allocations.CPU[ic.GetCacheID()]
+		if !ok {
+			continue
+		}
+
+		log.Info("releasing completed init container %s for %s",
+			ic.PrettyName(), c.PrettyName())
+
+		if err := p.releaseResources(ic, false); err != nil {
+			log.Warn("failed to release init container %s: %v", ic.PrettyName(), err)
+			continue
+		}
+
+		if cpus := grant.ExclusiveCPUs(); !cpus.IsEmpty() {
+			p.inherited[c.GetPodID()] = append(p.inherited[c.GetPodID()],
+				&inheritedCPUs{node: grant.GetNode().Name(), cpus: cpus})
+		}
+	}
+}
+
+// inheritedPool returns the pool of exclusive CPUs inherited from init containers
+// fitting the request, if any, updating the request to take the inherited CPUs.
+func (p *policy) inheritedPool(request CPURequest) Node {
+	cr := request.(*cpuRequest)
+	podID := cr.GetContainer().GetPodID()
+	if cr.full == 0 || len(p.inherited[podID]) == 0 {
+		return nil
+	}
+
+	for idx, ic := range p.inherited[podID] {
+		node, ok := p.nodes[ic.node]
+		if !ok || !poolFits(node, request) {
+			continue
+		}
+
+		supply := node.FreeCPU().(*cpuSupply)
+		from := ic.cpus.Intersection(supply.isolated.Union(supply.sharable))
+		if from.Size() < cr.full {
+			continue
+		}
+		cpus, err := p.cpuAllocator.AllocateCpusWithFlags(&from, cr.full, true, cr.allocFlags())
+		if err != nil {
+			continue
+		}
+
+		cr.sticky = cpus
+		if !supply.hasStickyCPUs(cr) {
+			cr.sticky = cpuset.NewCPUSet()
+			continue
+		}
+
+		log.Debug("  => using CPUs %s inherited from init containers in pool %s",
+			cpus, ic.node)
+
+		ic.cpus = ic.cpus.Difference(cpus)
+		if ic.cpus.IsEmpty() {
+			p.inherited[podID] = append(p.inherited[podID][:idx], p.inherited[podID][idx+1:]...)
+			if len(p.inherited[podID]) == 0 {
+				delete(p.inherited, podID)
+			}
+		}
+
+		return node
+	}
+
+	return nil
+}
+
+// pruneInheritedCPUs forgets CPUs inherited by pods which are gone.
+func (p *policy) pruneInheritedCPUs() {
+	for podID := range p.inherited {
+		if _, ok := p.cache.LookupPod(podID); !ok {
+			delete(p.inherited, podID)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// newInitTestPod creates a guaranteed pod with an init container requesting
+// 2 CPUs and application containers requesting the given CPUs each.
+func newInitTestPod(p *policy, appCPUs ...string) (*mockContainer, []*mockContainer) {
+	requirements := func(cpus string) v1.ResourceRequirements {
+		qty := resource.MustParse(cpus)
+		return v1.ResourceRequirements{
+			Requests: v1.ResourceList{v1.ResourceCPU: qty},
+			Limits:   v1.ResourceList{v1.ResourceCPU: qty},
+		}
+	}
+	pod := &mockPod{
+		name:                      "pod0",
+		uid:                       "pod0-uid",
+		returnValueFotGetQOSClass: v1.PodQOSGuaranteed,
+		resources: cache.PodResourceRequirements{
+			InitContainers: map[string]v1.ResourceRequirements{"init": requirements("2")},
+			Containers:     map[string]v1.ResourceRequirements{},
+		},
+	}
+	newContainer := func(name, cpus string) *mockContainer {
+		return &mockContainer{
+			name:                                  name,
+			returnValueForGetCacheID:              name,
+			returnValueForGetQOSClass:             v1.PodQOSGuaranteed,
+			returnValueForGetPod:                  pod,
+			returnValueForGetPodID:                "pod0",
+			returnValueForGetState:                cache.ContainerStateRunning,
+			returnValueForGetResourceRequirements: requirements(cpus),
+		}
+	}
+
+	initCtr := newContainer("init", "2")
+	pod.initContainers = []cache.Container{initCtr}
+	apps := []*mockContainer{}
+	for idx, cpus := range appCPUs {
+		app := newContainer(fmt.Sprintf("app%d", idx), cpus)
+		pod.resources.Containers[app.name] = app.returnValueForGetResourceRequirements
+		pod.containers = append(pod.containers, app)
+		apps = append(apps, app)
+	}
+	p.cache.(*mockCache).returnValueForLookupPod = pod
+
+	return initCtr, apps
+}
+
+func TestInheritInitContainerCPUs(t *testing.T) {
+	p := newTestPolicy()
+	initCtr, apps := newInitTestPod(p, "2")
+
+	if err := p.AllocateResources(initCtr); err != nil {
+		t.Fatalf("failed to allocate init container: %v", err)
+	}
+	initCPUs := p.allocations.CPU["init"].ExclusiveCPUs()
+	if initCPUs.Size() != 2 {
+		t.Fatalf("expected init container with 2 exclusive CPUs, got %s", initCPUs)
+	}
+
+	if err := p.AllocateResources(apps[0]); err != nil {
+		t.Fatalf("failed to allocate application container: %v", err)
+	}
+	if _, ok := p.allocations.CPU["init"]; ok {
+		t.Errorf("expected init container to be released")
+	}
+	if cpus := p.allocations.CPU["app0"].ExclusiveCPUs(); !cpus.Equals(initCPUs) {
+		t.Errorf("expected application container to inherit CPUs %s, got %s", initCPUs, cpus)
+	}
+	if len(p.inherited) != 0 {
+		t.Errorf("expected all inherited CPUs to be taken, got %v", p.inherited)
+	}
+
+	// a completed init container is not allocated again, for instance on resync
+	if err := p.AllocateResources(initCtr); err != nil {
+		t.Fatalf("failed to skip completed init container: %v", err)
+	}
+	if _, ok := p.allocations.CPU["init"]; ok {
+		t.Errorf("expected completed init container not to be allocated")
+	}
+}
+
+func TestInheritTakenInitContainerCPUs(t *testing.T) {
+	p := newTestPolicy()
+	initCtr, apps := newInitTestPod(p, "1", "1")
+
+	if err := p.AllocateResources(initCtr); err != nil {
+		t.Fatalf("failed to allocate init container: %v", err)
+	}
+	grant := p.allocations.CPU["init"]
+	initCPUs := grant.ExclusiveCPUs()
+
+	if err := p.AllocateResources(apps[0]); err != nil {
+		t.Fatalf("failed to allocate first application container: %v", err)
+	}
+	first := p.allocations.CPU["app0"].ExclusiveCPUs()
+	if first.Size() != 1 || !first.IsSubsetOf(initCPUs) {
+		t.Fatalf("expected first application container to inherit one of CPUs %s, got %s",
+			initCPUs, first)
+	}
+
+	// another container takes the rest of the inherited CPUs in the meantime
+	left := initCPUs.Difference(first)
+	other := &mockContainer{name: "other", returnValueForGetCacheID: "other"}
+	taken := newCPUGrant(grant.GetNode(), other, left, cpuset.NewCPUSet(), 0, 0, nil)
+	grant.GetNode().FreeCPU().Reserve(taken)
+	p.allocations.CPU["other"] = taken
+
+	if err := p.AllocateResources(apps[1]); err != nil {
+		t.Fatalf("failed to allocate second application container: %v", err)
+	}
+	second := p.allocations.CPU["app1"].ExclusiveCPUs()
+	if second.Size() != 1 || !second.Intersection(initCPUs).IsEmpty() {
+		t.Errorf("expected second application container to get another CPU than %s, got %s",
+			initCPUs, second)
+	}
+}
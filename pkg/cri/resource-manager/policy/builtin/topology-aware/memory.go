@@ -0,0 +1,191 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+//
+// Memory is accounted per NUMA node. Each grant charges its memory request
+// evenly to the NUMA nodes in its memset. The free memory of a pool is the
+// total free memory of the NUMA nodes in its memset. If the capacity of a
+// NUMA node is unknown, memory is not accounted for that node and any request
+// is considered to fit.
+//
+
+// memoryAccounting tracks the memory capacity and grants of NUMA nodes.
+type memoryAccounting struct {
+	capacity map[system.ID]uint64 // memory capacity per NUMA node
+	granted  map[system.ID]uint64 // granted memory per NUMA node
+}
+
+// newMemoryAccounting creates memory accounting with no known capacity.
+func newMemoryAccounting() memoryAccounting {
+	return memoryAccounting{
+		capacity: make(map[system.ID]uint64),
+		granted:  make(map[system.ID]uint64),
+	}
+}
+
+// discoverMemory discovers the memory capacity of all NUMA nodes.
+func (p *policy) discoverMemory() {
+	for _, id := range p.sys.NodeIDs() {
+		info, err := p.sys.Node(id).MemoryInfo()
+		if err != nil || info == nil {
+			log.Warn("unknown memory capacity for NUMA node #%d, not accounting memory", id)
+			continue
+		}
+		p.memory.capacity[id] = info.MemTotal
+		log.Debug("NUMA node #%d has %d bytes of memory", id, info.MemTotal)
+	}
+}
+
+// memoryKnown checks if the capacity of all NUMA nodes in the memset is known.
+func (p *policy) memoryKnown(mems system.IDSet) bool {
+	if mems.Size() == 0 {
+		return false
+	}
+	for id := range mems {
+		if _, ok := p.memory.capacity[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// memoryCapacity returns the total memory capacity of the NUMA nodes in the memset.
+func (p *policy) memoryCapacity(mems system.IDSet) uint64 {
+	capacity := uint64(0)
+	for id := range mems {
+		capacity += p.memory.capacity[id]
+	}
+	return capacity
+}
+
+// grantedMemory returns the total granted memory of the NUMA nodes in the memset.
+func (p *policy) grantedMemory(mems system.IDSet) uint64 {
+	granted := uint64(0)
+	for id := range mems {
+		granted += p.memory.granted[id]
+	}
+	return granted
+}
+
+// freeMemory returns the total free memory of the NUMA nodes in the memset.
+func (p *policy) freeMemory(mems system.IDSet) uint64 {
+	free := uint64(0)
+	for id := range mems {
+		if capacity, granted := p.memory.capacity[id], p.memory.granted[id]; capacity > granted {
+			free += capacity - granted
+		}
+	}
+	return free
+}
+
+// memoryFits checks if the given amount of memory fits into the memset.
+func (p *policy) memoryFits(mems system.IDSet, amount uint64) bool {
+	return amount == 0 || !p.memoryKnown(mems) || p.freeMemory(mems) >= amount
+}
+
+// widenMemset adds the closest NUMA nodes to the memset until the amount fits.
+func (p *policy) widenMemset(mems system.IDSet, amount uint64) system.IDSet {
+	mems = mems.Clone()
+
+	for !p.memoryFits(mems, amount) {
+		candidates := []system.ID{}
+		distance := map[system.ID]int{}
+		for _, id := range p.sys.NodeIDs() {
+			if mems.Has(id) {
+				continue
+			}
+			for m := range mems {
+				d := p.sys.Node(m).DistanceFrom(id)
+				if dist, ok := distance[id]; !ok || d < dist {
+					distance[id] = d
+				}
+			}
+			candidates = append(candidates, id)
+		}
+		if len(candidates) == 0 {
+			log.Warn("%d bytes of memory does not fit into any set of NUMA nodes", amount)
+			break
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			ci, cj := candidates[i], candidates[j]
+			if distance[ci] != distance[cj] {
+				return distance[ci] < distance[cj]
+			}
+			return ci < cj
+		})
+		log.Debug("  => widening memset %s with NUMA node #%d", mems, candidates[0])
+		mems.Add(candidates[0])
+	}
+
+	return mems
+}
+
+// chargeMemory accounts the memory of a grant to the NUMA nodes of its memset.
+func (p *policy) chargeMemory(grant CPUGrant) {
+	mems, amount := grant.Memset(), grant.GrantedMemory()
+	if amount == 0 || mems.Size() == 0 {
+		return
+	}
+	share := amount / uint64(mems.Size())
+	for id := range mems {
+		p.memory.granted[id] += share
+	}
+}
+
+// unchargeMemory returns the memory of a grant to the NUMA nodes of its memset.
+func (p *policy) unchargeMemory(grant CPUGrant) {
+	mems, amount := grant.Memset(), grant.GrantedMemory()
+	if amount == 0 || mems.Size() == 0 {
+		return
+	}
+	share := amount / uint64(mems.Size())
+	for id := range mems {
+		if p.memory.granted[id] > share {
+			p.memory.granted[id] -= share
+		} else {
+			delete(p.memory.granted, id)
+		}
+	}
+}
+
+// reaccountMemory recalculates granted memory from all existing grants.
+func (p *policy) reaccountMemory() {
+	p.memory.granted = make(map[system.ID]uint64)
+	for _, grant := range p.allocations.CPU {
+		p.chargeMemory(grant)
+	}
+}
+
+// memoryRequest returns the amount of memory requested by the container.
+func memoryRequest(c cache.Container) uint64 {
+	resources := c.GetResourceRequirements()
+	if qty, ok := resources.Requests[corev1.ResourceMemory]; ok && qty.Value() > 0 {
+		return uint64(qty.Value())
+	}
+	if qty, ok := resources.Limits[corev1.ResourceMemory]; ok && qty.Value() > 0 {
+		return uint64(qty.Value())
+	}
+	return 0
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"testing"
+
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// mockMemorySystem is a system with four NUMA nodes of 1000 bytes each,
+// nodes 0-1 and 2-3 being close to each other.
+type mockMemorySystem struct {
+	mockSystem
+}
+
+type mockMemoryNode struct {
+	mockSystemNode
+}
+
+func (fake *mockMemorySystem) Node(id system.ID) system.Node {
+	return &mockMemoryNode{mockSystemNode{id: id}}
+}
+func (fake *mockMemorySystem) NodeIDs() []system.ID {
+	return []system.ID{0, 1, 2, 3}
+}
+func (fake *mockMemoryNode) MemoryInfo() (*system.MemInfo, error) {
+	return &system.MemInfo{MemTotal: 1000}, nil
+}
+func (fake *mockMemoryNode) DistanceFrom(id system.ID) int {
+	if fake.id/2 == id/2 {
+		return 11
+	}
+	return 21
+}
+
+func TestWidenMemset(t *testing.T) {
+	tcases := []struct {
+		name     string
+		granted  map[system.ID]uint64
+		mems     system.IDSet
+		amount   uint64
+		expected string
+	}{
+		{
+			name:     "fits",
+			mems:     system.NewIDSet(2),
+			amount:   1000,
+			expected: "2",
+		},
+		{
+			name:     "widen to closest node",
+			mems:     system.NewIDSet(2),
+			amount:   1500,
+			expected: "2,3",
+		},
+		{
+			name:     "widen to remote nodes",
+			mems:     system.NewIDSet(2),
+			granted:  map[system.ID]uint64{3: 800},
+			amount:   1500,
+			expected: "0,2,3",
+		},
+		{
+			name:     "does not fit anywhere",
+			mems:     system.NewIDSet(1),
+			amount:   5000,
+			expected: "0,1,2,3",
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &policy{
+				sys:    &mockMemorySystem{},
+				memory: newMemoryAccounting(),
+			}
+			p.discoverMemory()
+			for id, amount := range tc.granted {
+				p.memory.granted[id] = amount
+			}
+			mems := p.widenMemset(tc.mems, tc.amount)
+			if mems.String() != tc.expected {
+				t.Errorf("Expected memset %q, but got %q", tc.expected, mems.String())
+			}
+		})
+	}
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	p := &policy{
+		sys:    &mockMemorySystem{},
+		memory: newMemoryAccounting(),
+	}
+	p.discoverMemory()
+	mems := system.NewIDSet(0, 1)
+	grant := newCPUGrant(&node{}, &mockContainer{}, cpuset.NewCPUSet(), cpuset.NewCPUSet(), 0, 1200, mems)
+
+	p.chargeMemory(grant)
+	if granted := p.grantedMemory(mems); granted != 1200 {
+		t.Errorf("Expected 1200 bytes granted, but got %d", granted)
+	}
+	if free := p.freeMemory(mems); free != 800 {
+		t.Errorf("Expected 800 bytes free, but got %d", free)
+	}
+	if p.memoryFits(mems, 1000) {
+		t.Errorf("Expected 1000 bytes not to fit into %s", mems)
+	}
+	if !p.memoryFits(system.NewIDSet(2), 1000) {
+		t.Errorf("Expected 1000 bytes to fit into NUMA node #2")
+	}
+
+	p.unchargeMemory(grant)
+	if granted := p.grantedMemory(mems); granted != 0 {
+		t.Errorf("Expected no memory granted, but got %d", granted)
+	}
+}
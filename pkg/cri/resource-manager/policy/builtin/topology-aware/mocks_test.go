@@ -18,6 +18,8 @@ import (
 	"os"
 
 	"github.com/intel/cri-resource-manager/pkg/apis/resmgr"
+	"github.com/intel/cri-resource-manager/pkg/apis/resmgr/v1alpha1"
+	fakecpuallocator "github.com/intel/cri-resource-manager/pkg/cpuallocator/fake"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/config"
 	system "github.com/intel/cri-resource-manager/pkg/sysfs"
@@ -54,6 +56,12 @@ func (fake *mockSystemNode) DistanceFrom(id system.ID) int {
 func (fake *mockSystemNode) GetMemoryType() system.MemoryType {
 	return system.MemoryTypeDRAM
 }
+func (fake *mockSystemNode) MemoryAttributes() *system.MemoryAttributes {
+	return nil
+}
+func (fake *mockSystemNode) IsCXL() bool {
+	return false
+}
 
 type mockSystemCPUPackage struct {
 	id system.ID // package id
@@ -68,6 +76,12 @@ func (fake *mockSystemCPUPackage) CPUSet() cpuset.CPUSet {
 func (fake *mockSystemCPUPackage) NodeIDs() []system.ID {
 	return []system.ID{}
 }
+func (fake *mockSystemCPUPackage) DieIDs() []system.ID {
+	return []system.ID{0}
+}
+func (fake *mockSystemCPUPackage) DieCPUSet(system.ID) cpuset.CPUSet {
+	return cpuset.NewCPUSet()
+}
 
 type mockCPU struct {
 	id            system.ID
@@ -93,6 +107,18 @@ func (c *mockCPU) NodeID() system.ID {
 func (c *mockCPU) CoreID() system.ID {
 	return c.id
 }
+func (c *mockCPU) DieID() system.ID {
+	return 0
+}
+func (c *mockCPU) CoreKind() system.CoreKind {
+	return system.PerformanceCore
+}
+func (c *mockCPU) GetCaches() []*system.Cache {
+	return nil
+}
+func (c *mockCPU) GetLastLevelCache() *system.Cache {
+	return nil
+}
 func (c *mockCPU) ThreadCPUSet() cpuset.CPUSet {
 	return cpuset.NewCPUSet()
 }
@@ -146,6 +172,9 @@ func (fake *mockSystem) Package(id system.ID) system.CPUPackage {
 func (fake *mockSystem) Offlined() cpuset.CPUSet {
 	return cpuset.NewCPUSet()
 }
+func (fake *mockSystem) CoreKindCPUs(system.CoreKind) cpuset.CPUSet {
+	return cpuset.NewCPUSet()
+}
 func (fake *mockSystem) Isolated() cpuset.CPUSet {
 	if fake.isolatedCPU > 0 {
 		return cpuset.NewCPUSet(fake.isolatedCPU)
@@ -174,19 +203,26 @@ type mockContainer struct {
 	namespace                             string
 	returnValueForGetResourceRequirements v1.ResourceRequirements
 	returnValueForGetCacheID              string
+	returnValueForGetQOSClass             v1.PodQOSClass
+	returnValueForGetPod                  cache.Pod
+	returnValueForGetPodID                string
+	returnValueForGetState                cache.ContainerState
 }
 
 func (m *mockContainer) PrettyName() string {
 	return m.name
 }
 func (m *mockContainer) GetPod() (cache.Pod, bool) {
+	if m.returnValueForGetPod != nil {
+		return m.returnValueForGetPod, true
+	}
 	return &mockPod{}, false
 }
 func (m *mockContainer) GetID() string {
 	panic("unimplemented")
 }
 func (m *mockContainer) GetPodID() string {
-	panic("unimplemented")
+	return m.returnValueForGetPodID
 }
 func (m *mockContainer) GetCacheID() string {
 	if len(m.returnValueForGetCacheID) == 0 {
@@ -205,10 +241,10 @@ func (m *mockContainer) UpdateState(cache.ContainerState) {
 	panic("unimplemented")
 }
 func (m *mockContainer) GetState() cache.ContainerState {
-	panic("unimplemented")
+	return m.returnValueForGetState
 }
 func (m *mockContainer) GetQOSClass() v1.PodQOSClass {
-	panic("unimplemented")
+	return m.returnValueForGetQOSClass
 }
 func (m *mockContainer) GetImage() string {
 	panic("unimplemented")
@@ -379,6 +415,18 @@ func (m *mockContainer) SetRDTClass(string) {
 func (m *mockContainer) GetRDTClass() string {
 	panic("unimplemented")
 }
+func (m *mockContainer) SetRDTRestriction(string) {
+	panic("unimplemented")
+}
+func (m *mockContainer) GetRDTRestriction() (string, bool) {
+	panic("unimplemented")
+}
+func (m *mockContainer) SetSchedulingClass(string) {
+	panic("unimplemented")
+}
+func (m *mockContainer) GetSchedulingClass() string {
+	panic("unimplemented")
+}
 func (m *mockContainer) SetBlockIOClass(string) {
 	panic("unimplemented")
 }
@@ -391,6 +439,9 @@ func (m *mockContainer) SetToptierLimit(int64) {
 func (m *mockContainer) GetToptierLimit() int64 {
 	panic("unimplemented")
 }
+func (m *mockContainer) GetStaticPoolsAdjustment() (*v1alpha1.StaticPools, bool) {
+	return nil, false
+}
 func (m *mockContainer) SetCRIRequest(req interface{}) error {
 	panic("unimplemented")
 }
@@ -436,16 +487,20 @@ func (m *mockContainer) Eval(string) interface{} {
 
 type mockPod struct {
 	name                               string
+	uid                                string
+	initContainers                     []cache.Container
+	containers                         []cache.Container
+	resources                          cache.PodResourceRequirements
 	returnValueFotGetQOSClass          v1.PodQOSClass
 	returnValue1FotGetResmgrAnnotation string
 	returnValue2FotGetResmgrAnnotation bool
 }
 
 func (m *mockPod) GetInitContainers() []cache.Container {
-	panic("unimplemented")
+	return m.initContainers
 }
 func (m *mockPod) GetContainers() []cache.Container {
-	panic("unimplemented")
+	return m.containers
 }
 func (m *mockPod) GetContainer(string) (cache.Container, bool) {
 	panic("unimplemented")
@@ -454,7 +509,7 @@ func (m *mockPod) GetID() string {
 	panic("unimplemented")
 }
 func (m *mockPod) GetUID() string {
-	panic("unimplemented")
+	return m.uid
 }
 func (m *mockPod) GetName() string {
 	return m.name
@@ -505,7 +560,7 @@ func (m *mockPod) GetCgroupParentDir() string {
 	panic("unimplemented")
 }
 func (m *mockPod) GetPodResourceRequirements() cache.PodResourceRequirements {
-	panic("unimplemented")
+	return m.resources
 }
 func (m *mockPod) GetContainerAffinity(string) []*cache.Affinity {
 	panic("unimplemented")
@@ -524,6 +579,7 @@ type mockCache struct {
 	returnValueForGetPolicyEntry   bool
 	returnValue1ForLookupContainer cache.Container
 	returnValue2ForLookupContainer bool
+	returnValueForLookupPod        cache.Pod
 }
 
 func (m *mockCache) InsertPod(string, interface{}) cache.Pod {
@@ -533,7 +589,7 @@ func (m *mockCache) DeletePod(string) cache.Pod {
 	panic("unimplemented")
 }
 func (m *mockCache) LookupPod(string) (cache.Pod, bool) {
-	panic("unimplemented")
+	return m.returnValueForLookupPod, m.returnValueForLookupPod != nil
 }
 func (m *mockCache) InsertContainer(interface{}) (cache.Container, error) {
 	panic("unimplemented")
@@ -603,7 +659,7 @@ func (m *mockCache) SetAdjustment(*config.Adjustment) (bool, map[string]error) {
 	panic("unimplemented")
 }
 func (m *mockCache) Save() error {
-	panic("unimplemented")
+	return nil
 }
 func (m *mockCache) Refresh(interface{}) ([]cache.Pod, []cache.Pod, []cache.Container, []cache.Container) {
 	panic("unimplemented")
@@ -617,3 +673,44 @@ func (m *mockCache) OpenFile(string, string, os.FileMode) (*os.File, error) {
 func (m *mockCache) WriteFile(string, string, os.FileMode, []byte) error {
 	panic("unimplemented")
 }
+
+// newTestPolicy creates a policy with four NUMA nodes of 4 CPUs, two threads
+// per core, under a virtual root, with CPU 0 reserved.
+func newTestPolicy() *policy {
+	p := &policy{
+		sys:          &mockSystem{},
+		cache:        &mockCache{},
+		cpuAllocator: fakecpuallocator.NewCPUAllocator(2),
+		sticky:       map[string]*stickyAllocation{},
+		nodes:        map[string]Node{},
+		allowed:      cpuset.MustParse("0-15"),
+		reserved:     cpuset.NewCPUSet(0),
+		parked:       cpuset.NewCPUSet(),
+		powersaving:  cpuset.NewCPUSet(),
+		powersaved:   cpuset.NewCPUSet(),
+		inherited:    map[string][]*inheritedCPUs{},
+		memory:       newMemoryAccounting(),
+	}
+	p.allocations = allocations{policy: p, CPU: map[string]CPUGrant{}}
+	root := p.NewVirtualNode("root", nilnode).(*virtualnode)
+	root.nodecpu = newCPUSupply(root, cpuset.NewCPUSet(), p.allowed, 0)
+	root.freecpu = root.nodecpu.Clone()
+	p.root = root
+	p.nodes[root.Name()] = root
+	p.pools = []Node{p.root}
+	for i, cpus := range []string{"0-3", "4-7", "8-11", "12-15"} {
+		n := p.NewNumaNode(system.ID(i), p.root).(*numanode)
+		n.node.id = i + 1
+		n.nodecpu = newCPUSupply(n, cpuset.NewCPUSet(), cpuset.MustParse(cpus), 0)
+		n.freecpu = n.nodecpu.Clone()
+		p.nodes[n.Name()] = n
+		p.pools = append(p.pools, n)
+	}
+	return p
+}
+
+// addTestGrant adds a grant of a container of the given QoS class to a pool.
+func (p *policy) addTestGrant(id string, n Node, qos v1.PodQOSClass, exclusive cpuset.CPUSet, portion int) {
+	c := &mockContainer{name: id, returnValueForGetCacheID: id, returnValueForGetQOSClass: qos}
+	p.allocations.CPU[id] = newCPUGrant(n, c, exclusive, cpuset.NewCPUSet(), portion, 0, nil)
+}
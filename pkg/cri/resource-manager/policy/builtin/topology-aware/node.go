@@ -46,6 +46,10 @@ const (
 	NumaNode NodeKind = "numa node"
 	// VirtualNode represents a virtual node, currently the root multi-socket setups.
 	VirtualNode NodeKind = "virtual node"
+	// CacheNode represents a group of CPUs sharing a last-level cache.
+	CacheNode NodeKind = "cache"
+	// CoreKindNode represents the cores of a single kind in hybrid CPUs.
+	CoreKindNode NodeKind = "core type"
 )
 
 const (
@@ -97,6 +101,12 @@ type Node interface {
 	GetMemset() system.IDSet
 	// DiscoverMemset
 	DiscoverMemset() system.IDSet
+	// MemoryCapacity returns the memory capacity of this node.
+	MemoryCapacity() uint64
+	// GrantedMemory returns the amount of granted memory of this node.
+	GrantedMemory() uint64
+	// FreeMemory returns the amount of free memory of this node.
+	FreeMemory() uint64
 	// DepthFirst traverse the tree@node calling the function at each node.
 	DepthFirst(func(Node) error) error
 	// BreadthFirst traverse the tree@node calling the function at each node.
@@ -144,6 +154,21 @@ type numanode struct {
 	sysnode system.Node // corresponding system.Node
 }
 
+// cachenode represents a group of CPUs sharing a last-level cache.
+type cachenode struct {
+	node                // common node data
+	id    system.ID     // cache id
+	cache *system.Cache // corresponding system.Cache
+	cpus  cpuset.CPUSet // CPUs of the parent node sharing the cache
+}
+
+// corekindnode represents the performance or efficient cores of its parent node.
+type corekindnode struct {
+	node                 // common node data
+	kind system.CoreKind // kind of cores
+	cpus cpuset.CPUSet   // CPUs of the parent node of this kind
+}
+
 // virtualnode represents a virtual node (ATM only the root in a multi-socket system).
 type virtualnode struct {
 	node // common node data
@@ -273,7 +298,8 @@ func (n *node) Dump(prefix string, level ...int) {
 	n.self.node.dump(prefix, lvl)
 	log.Debug("%s  - node CPU: %v", idt, n.nodecpu)
 	log.Debug("%s  - free CPU: %v", idt, n.freecpu)
-	log.Debug("%s  - memory: %v", idt, n.mem)
+	log.Debug("%s  - memory: %v (capacity: %d, granted: %d, free: %d)", idt, n.mem,
+		n.MemoryCapacity(), n.GrantedMemory(), n.FreeMemory())
 	for _, grant := range n.policy.allocations.CPU {
 		if grant.GetNode().NodeID() == n.id {
 			log.Debug("%s    + %s", idt, grant)
@@ -354,6 +380,21 @@ func (n *node) DiscoverMemset() system.IDSet {
 	return n.self.node.DiscoverMemset()
 }
 
+// MemoryCapacity returns the memory capacity of this node.
+func (n *node) MemoryCapacity() uint64 {
+	return n.policy.memoryCapacity(n.GetMemset())
+}
+
+// GrantedMemory returns the amount of granted memory of this node.
+func (n *node) GrantedMemory() uint64 {
+	return n.policy.grantedMemory(n.GetMemset())
+}
+
+// FreeMemory returns the amount of free memory of this node.
+func (n *node) FreeMemory() uint64 {
+	return n.policy.freeMemory(n.GetMemset())
+}
+
 // Granted returns the amount of granted shared CPU capacity of this node.
 func (n *node) GrantedCPU() int {
 	granted := n.freecpu.Granted()
@@ -490,8 +531,12 @@ func (n *socketnode) GetMemset() system.IDSet {
 // DiscoverMemset discovers the set of memory attached to this socket.
 func (n *socketnode) DiscoverMemset() system.IDSet {
 	n.mem = system.NewIDSet()
-	for _, c := range n.children {
-		n.mem.Add(c.GetMemset().Members()...)
+	if n.IsLeafNode() {
+		n.mem.Add(n.syspkg.NodeIDs()...)
+	} else {
+		for _, c := range n.children {
+			n.mem.Add(c.GetMemset().Members()...)
+		}
 	}
 
 	return n.mem.Clone()
@@ -513,6 +558,142 @@ func (n *socketnode) HintScore(hint topology.Hint) float64 {
 	return 0.0
 }
 
+// NewCacheNode creates a node for CPUs sharing a last-level cache.
+func (p *policy) NewCacheNode(c *system.Cache, cpus cpuset.CPUSet, parent Node) Node {
+	name := fmt.Sprintf("L%d cache #%v", c.Level(), c.ID())
+	if _, ok := p.nodes[name]; ok {
+		// cache ids are not exposed on all platforms
+		name = fmt.Sprintf("L%d cache (CPUs %s)", c.Level(), cpus)
+	}
+
+	n := &cachenode{}
+	n.self.node = n
+	n.node.init(p, name, CacheNode, parent)
+	n.id = c.ID()
+	n.cache = c
+	n.cpus = cpus
+
+	return n
+}
+
+// Dump (the cache-specific parts of) this node.
+func (n *cachenode) dump(prefix string, level ...int) {
+	log.Debug("%s<%s, %d bytes, CPUs %s>", indent(prefix, level...), n.name, n.cache.Size(), n.cpus)
+}
+
+// Get CPU supply available at this node.
+func (n *cachenode) GetCPU() CPUSupply {
+	return n.nodecpu.Clone()
+}
+
+// DiscoverCPU discovers the CPU supply available at this node.
+func (n *cachenode) DiscoverCPU() CPUSupply {
+	log.Debug("discovering CPU available at node %s...", n.Name())
+
+	isolated := n.cpus.Intersection(n.policy.isolated)
+	sharable := n.cpus.Difference(isolated)
+	n.nodecpu = newCPUSupply(n, isolated, sharable, 0)
+
+	n.freecpu = n.nodecpu.Clone()
+	return n.nodecpu.Clone()
+}
+
+// GetMemset() returns the set of memory attached to this node.
+func (n *cachenode) GetMemset() system.IDSet {
+	return n.mem.Clone()
+}
+
+// DiscoverMemset discovers the set of memory attached to this node.
+func (n *cachenode) DiscoverMemset() system.IDSet {
+	n.mem = system.NewIDSet()
+	for _, id := range n.cpus.ToSlice() {
+		n.mem.Add(n.System().CPU(system.ID(id)).NodeID())
+	}
+	return n.mem.Clone()
+}
+
+// HintScore calculates the (CPU) score of the node for the given topology hint.
+func (n *cachenode) HintScore(hint topology.Hint) float64 {
+	switch {
+	case hint.CPUs != "":
+		return cpuHintScore(hint, n.cpus)
+
+	case hint.NUMAs != "":
+		// all caches of a NUMA node are equally close to its devices, so
+		// don't penalize underfit and let the lower node win a tie
+		return numaHintScore(hint, n.mem.Members()...)
+
+	case hint.Sockets != "":
+		pkgID := n.System().CPU(system.ID(n.cpus.ToSlice()[0])).PackageID()
+		score := socketHintScore(hint, pkgID)
+		if score > 0.0 {
+			// penalize underfit reciprocally (inverse-proportionally) to the socket size
+			pkgCPUs := n.System().Package(pkgID).CPUSet()
+			score /= float64(len(n.policy.lastLevelCaches(pkgCPUs)))
+		}
+		return score
+	}
+
+	return 0.0
+}
+
+// NewCoreKindNode creates a node for the cores of a single kind.
+func (p *policy) NewCoreKindNode(kind system.CoreKind, cpus cpuset.CPUSet, parent Node) Node {
+	n := &corekindnode{}
+	n.self.node = n
+	n.node.init(p, fmt.Sprintf("%s cores of %s", kind, parent.Name()), CoreKindNode, parent)
+	n.kind = kind
+	n.cpus = cpus
+
+	return n
+}
+
+// Dump (the core type specific parts of) this node.
+func (n *corekindnode) dump(prefix string, level ...int) {
+	log.Debug("%s<%s, CPUs %s>", indent(prefix, level...), n.name, n.cpus)
+}
+
+// Get CPU supply available at this node.
+func (n *corekindnode) GetCPU() CPUSupply {
+	return n.nodecpu.Clone()
+}
+
+// DiscoverCPU discovers the CPU supply available at this node.
+func (n *corekindnode) DiscoverCPU() CPUSupply {
+	log.Debug("discovering CPU available at node %s...", n.Name())
+
+	isolated := n.cpus.Intersection(n.policy.isolated)
+	sharable := n.cpus.Difference(isolated)
+	n.nodecpu = newCPUSupply(n, isolated, sharable, 0)
+
+	n.freecpu = n.nodecpu.Clone()
+	return n.nodecpu.Clone()
+}
+
+// GetMemset() returns the set of memory attached to this node.
+func (n *corekindnode) GetMemset() system.IDSet {
+	return n.mem.Clone()
+}
+
+// DiscoverMemset discovers the set of memory attached to this node.
+func (n *corekindnode) DiscoverMemset() system.IDSet {
+	n.mem = system.NewIDSet()
+	for _, id := range n.cpus.ToSlice() {
+		n.mem.Add(n.System().CPU(system.ID(id)).NodeID())
+	}
+	return n.mem.Clone()
+}
+
+// HintScore calculates the (CPU) score of the node for the given topology hint.
+func (n *corekindnode) HintScore(hint topology.Hint) float64 {
+	if hint.CPUs != "" {
+		return cpuHintScore(hint, n.cpus)
+	}
+	// the cores are as close to devices as the rest of the parent node,
+	// so score the same and let the lower node win a tie
+	return n.parent.HintScore(hint)
+}
+
 // NewVirtualNode creates a new virtual node.
 func (p *policy) NewVirtualNode(name string, parent Node) Node {
 	n := &virtualnode{}
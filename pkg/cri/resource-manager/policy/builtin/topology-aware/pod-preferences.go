@@ -22,7 +22,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
 )
 
 const (
@@ -30,6 +32,10 @@ const (
 	keyIsolationPreference = "prefer-isolated-cpus"
 	// annotation key for opting out of exclusive allocation and relaxed topology fitting.
 	keySharedCPUPreference = "prefer-shared-cpus"
+	// annotation key for preferring performance or efficient cores in hybrid CPUs.
+	keyCoreKindPreference = "prefer-core-type"
+	// annotation key for requesting exclusive CPUs as full physical cores.
+	keyStrictSMTPreference = "strict-smt-isolation"
 )
 
 // podIsolationPreference checks if containers explicitly prefers to run on multiple isolated CPUs.
@@ -108,6 +114,54 @@ func podSharedCPUPreference(pod cache.Pod, container cache.Container) (bool, int
 	return true, int(elevate)
 }
 
+// podCoreKindPreference checks if a container prefers performance or efficient cores.
+// The second return value indicates whether the container has any preference.
+func podCoreKindPreference(pod cache.Pod, container cache.Container) (system.CoreKind, bool) {
+	value, ok := pod.GetResmgrAnnotation(keyCoreKindPreference)
+	if !ok {
+		return system.PerformanceCore, false
+	}
+
+	name := container.GetName()
+	kind, ok, err := cpuallocator.ParseCoreKindPreference(value, name)
+	if err != nil {
+		log.Error("invalid core type preference %s = '%s' for container %s: %v",
+			keyCoreKindPreference, value, name, err)
+		return system.PerformanceCore, false
+	}
+	if ok {
+		log.Debug("%s core type preference '%s'", name, kind)
+	}
+
+	return kind, ok
+}
+
+// podStrictSMTPreference checks if a container wants its exclusive CPUs as full physical cores.
+func podStrictSMTPreference(pod cache.Pod, container cache.Container) bool {
+	value, ok := pod.GetResmgrAnnotation(keyStrictSMTPreference)
+	if !ok {
+		return opt.StrictSMTIsolation
+	}
+	if value == "false" || value == "true" {
+		return value[0] == 't'
+	}
+
+	preferences := map[string]bool{}
+	if err := yaml.Unmarshal([]byte(value), &preferences); err != nil {
+		log.Error("failed to parse strict SMT isolation preference %s = '%s': %v",
+			keyStrictSMTPreference, value, err)
+		return opt.StrictSMTIsolation
+	}
+
+	name := container.GetName()
+	if pref, ok := preferences[name]; ok {
+		log.Debug("%s per-container strict SMT isolation preference '%v'", name, pref)
+		return pref
+	}
+
+	return opt.StrictSMTIsolation
+}
+
 // cpuAllocationPreferences figures out the amount and kind of CPU to allocate.
 func cpuAllocationPreferences(pod cache.Pod, container cache.Container) (int, int, bool, int) {
 	req, ok := container.GetResourceRequirements().Requests[corev1.ResourceCPU]
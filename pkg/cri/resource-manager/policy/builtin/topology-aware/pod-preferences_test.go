@@ -358,3 +358,56 @@ func TestCpuAllocationPreferences(t *testing.T) {
 		})
 	}
 }
+
+func TestPodStrictSMTPreference(t *testing.T) {
+	tcases := []struct {
+		name      string
+		pod       *mockPod
+		container *mockContainer
+		expected  bool
+	}{
+		{
+			name:      "return defaults",
+			pod:       &mockPod{},
+			container: &mockContainer{},
+			expected:  opt.StrictSMTIsolation,
+		},
+		{
+			name: "prefer resmgr's annotation value",
+			pod: &mockPod{
+				returnValue1FotGetResmgrAnnotation: "true",
+				returnValue2FotGetResmgrAnnotation: true,
+			},
+			container: &mockContainer{},
+			expected:  true,
+		},
+		{
+			name: "return defaults for unparsable",
+			pod: &mockPod{
+				returnValue1FotGetResmgrAnnotation: "UNPARSABLE",
+				returnValue2FotGetResmgrAnnotation: true,
+			},
+			container: &mockContainer{},
+			expected:  opt.StrictSMTIsolation,
+		},
+		{
+			name: "return defined preferences",
+			pod: &mockPod{
+				returnValue1FotGetResmgrAnnotation: "testcontainer: true",
+				returnValue2FotGetResmgrAnnotation: true,
+			},
+			container: &mockContainer{
+				name: "testcontainer",
+			},
+			expected: true,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			strict := podStrictSMTPreference(tc.pod, tc.container)
+			if strict != tc.expected {
+				t.Errorf("Expected %v, but got %v", tc.expected, strict)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/kubernetes"
 	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
 // buildPoolsByTopology builds a hierarchical tree of pools based on HW topology.
@@ -34,7 +35,6 @@ func (p *policy) buildPoolsByTopology() error {
 	poolCnt := socketCnt + nodeCnt + map[bool]int{false: 0, true: 1}[socketCnt > 1]
 
 	p.nodes = make(map[string]Node, poolCnt)
-	p.pools = make([]Node, poolCnt)
 
 	// create virtual root if necessary
 	if socketCnt > 1 {
@@ -56,13 +56,43 @@ func (p *policy) buildPoolsByTopology() error {
 	}
 
 	// create nodes for NUMA nodes
+	numas := make(map[system.ID]Node, nodeCnt)
 	if nodeCnt > 0 {
 		for _, id := range p.sys.NodeIDs() {
 			n = p.NewNumaNode(id, sockets[p.sys.Node(id).PackageID()])
 			p.nodes[n.Name()] = n
+			numas[id] = n
 		}
 	}
 
+	// create nodes for last-level caches, if several of them share a leaf node
+	if err := p.sys.Discover(system.DiscoverCache); err != nil {
+		log.Warn("failed to discover CPU caches: %v", err)
+	}
+	if nodeCnt > 0 {
+		for _, id := range p.sys.NodeIDs() {
+			p.addCacheNodes(p.sys.Node(id).CPUSet(), numas[id])
+		}
+	} else {
+		for _, id := range p.sys.PackageIDs() {
+			p.addCacheNodes(p.sys.Package(id).CPUSet(), sockets[id])
+		}
+	}
+
+	// split leaf nodes with both performance and efficient cores by core type
+	leaves := []Node{}
+	p.root.DepthFirst(func(n Node) error {
+		if n.IsLeafNode() {
+			leaves = append(leaves, n)
+		}
+		return nil
+	})
+	for _, n := range leaves {
+		p.addCoreKindNodes(n)
+	}
+
+	p.pools = make([]Node, len(p.nodes))
+
 	// enumerate nodes, calculate tree depth, discover node resource capacity
 	p.root.DepthFirst(func(n Node) error {
 		p.pools[p.nodeCnt] = n
@@ -82,6 +112,71 @@ func (p *policy) buildPoolsByTopology() error {
 	return nil
 }
 
+// addCacheNodes creates nodes for the last-level caches of the given parent.
+func (p *policy) addCacheNodes(cpus cpuset.CPUSet, parent Node) {
+	caches := p.lastLevelCaches(cpus)
+	if len(caches) < 2 {
+		return
+	}
+	for _, c := range caches {
+		n := p.NewCacheNode(c, c.SharedCPUSet().Intersection(cpus), parent)
+		p.nodes[n.Name()] = n
+	}
+}
+
+// addCoreKindNodes creates nodes for the performance and efficient cores of the given leaf.
+func (p *policy) addCoreKindNodes(parent Node) {
+	var cpus cpuset.CPUSet
+
+	switch n := parent.(type) {
+	case *numanode:
+		cpus = n.sysnode.CPUSet()
+	case *socketnode:
+		cpus = n.syspkg.CPUSet()
+	case *cachenode:
+		cpus = n.cpus
+	default:
+		return
+	}
+
+	efficient := p.sys.CoreKindCPUs(system.EfficientCore).Intersection(cpus)
+	if efficient.IsEmpty() || efficient.Equals(cpus) {
+		return
+	}
+
+	for _, kind := range []system.CoreKind{system.PerformanceCore, system.EfficientCore} {
+		n := p.NewCoreKindNode(kind, p.sys.CoreKindCPUs(kind).Intersection(cpus), parent)
+		p.nodes[n.Name()] = n
+	}
+}
+
+// lastLevelCaches returns the last-level caches of the given CPUs, sorted by their first CPU.
+func (p *policy) lastLevelCaches(cpus cpuset.CPUSet) []*system.Cache {
+	seen := map[*system.Cache]struct{}{}
+	caches := []*system.Cache{}
+	for _, id := range cpus.ToSlice() {
+		cpu := p.sys.CPU(system.ID(id))
+		if cpu == nil {
+			return nil
+		}
+		llc := cpu.GetLastLevelCache()
+		if llc == nil {
+			// without full cache information we can't split the CPUs by caches
+			return nil
+		}
+		if _, ok := seen[llc]; !ok {
+			seen[llc] = struct{}{}
+			caches = append(caches, llc)
+		}
+	}
+	sort.Slice(caches, func(i, j int) bool {
+		ci := caches[i].SharedCPUSet().Intersection(cpus).ToSlice()
+		cj := caches[j].SharedCPUSet().Intersection(cpus).ToSlice()
+		return ci[0] < cj[0]
+	})
+	return caches
+}
+
 // Pick a pool and allocate resource from it to the container.
 func (p *policy) allocatePool(container cache.Container) (CPUGrant, error) {
 	var pool Node
@@ -90,6 +185,10 @@ func (p *policy) allocatePool(container cache.Container) (CPUGrant, error) {
 
 	if container.GetNamespace() == kubernetes.NamespaceSystem {
 		pool = p.root
+	} else if sticky := p.stickyPool(request); sticky != nil {
+		pool = sticky
+	} else if inherited := p.inheritedPool(request); inherited != nil {
+		pool = inherited
 	} else {
 		affinity := p.calculatePoolAffinities(request.GetContainer())
 		scores, pools := p.sortPoolsByScore(request, affinity)
@@ -123,7 +222,7 @@ func (p *policy) applyGrant(grant CPUGrant) error {
 
 	container := grant.GetContainer()
 	exclusive := grant.ExclusiveCPUs()
-	shared := grant.SharedCPUs()
+	shared := p.awakeCPUs(grant.SharedCPUs())
 	portion := grant.SharedPortion()
 
 	cpus := ""
@@ -144,7 +243,7 @@ func (p *policy) applyGrant(grant CPUGrant) error {
 	mems := ""
 	node := grant.GetNode()
 	if !node.IsRootNode() && opt.PinMemory {
-		mems = node.GetMemset().String()
+		mems = grant.Memset().String()
 	}
 
 	if opt.PinCPU {
@@ -198,6 +297,7 @@ func (p *policy) releasePool(container cache.Container) (CPUGrant, bool, error)
 	pool := grant.GetNode()
 	cpus := pool.FreeCPU()
 
+	p.unparkIdleSiblings(grant)
 	cpus.Release(grant)
 	delete(p.allocations.CPU, container.GetCacheID())
 	p.saveAllocations()
@@ -209,6 +309,13 @@ func (p *policy) releasePool(container cache.Container) (CPUGrant, bool, error)
 func (p *policy) updateSharedAllocations(grant CPUGrant) error {
 	log.Debug("* updating shared allocations affected by %s", grant)
 
+	p.pinSharedAllocations()
+
+	return nil
+}
+
+// Pin all shared allocations to the current shared CPUs of their pools.
+func (p *policy) pinSharedAllocations() {
 	for _, other := range p.allocations.CPU {
 		if other.SharedPortion() == 0 && !other.ExclusiveCPUs().IsEmpty() {
 			log.Debug("  => %s not affected (only exclusive CPUs)...", other)
@@ -216,14 +323,12 @@ func (p *policy) updateSharedAllocations(grant CPUGrant) error {
 		}
 
 		if opt.PinCPU {
-			shared := other.GetNode().FreeCPU().SharableCPUs().String()
+			shared := p.awakeCPUs(other.GetNode().FreeCPU().SharableCPUs()).String()
 			log.Debug("  => updating %s with shared CPUs of %s: %s...",
 				other, other.GetNode().Name(), shared)
 			other.GetContainer().SetCpusetCpus(shared)
 		}
 	}
-
-	return nil
 }
 
 // addImplicitAffinities adds our set of policy-specific implicit affinities.
@@ -307,38 +412,58 @@ func (p *policy) compareScores(request CPURequest, scores map[int]CPUScore,
 	isolated1, shared1 := score1.IsolatedCapacity(), score1.SharedCapacity()
 	isolated2, shared2 := score2.IsolatedCapacity(), score2.SharedCapacity()
 	affinity1, affinity2 := affinity[id1], affinity[id2]
+	memfit1, memfit2 := score1.MemoryFit(), score2.MemoryFit()
 
 	//
 	// Notes:
 	//
 	// Our scoring/score sorting algorithm is:
 	//
-	// 1) - insufficient isolated or shared capacity loses
-	// 2) - if we have affinity, the higher affinity wins
-	// 3) - if we have topology hints
-	//       * better hint score wins
-	//       * for a tie, prefer the lower node then the smaller id
-	// 4) - if a node is lower in the tree it wins
-	// 5) - for isolated allocations
+	// 1) - insufficient isolated, shared or memory capacity loses
+	// 2) - when saving power, a node without power-saved CPUs wins
+	// 3) - if we have affinity, the higher affinity wins
+	// 4) - if we have topology hints, better hint score wins
+	// 5) - if we have a core type preference, a higher share of that type wins
+	// 6) - if we have topology hints, for a tie in hint scores
+	//       * prefer the lower node then the smaller id
+	// 7) - if a node is lower in the tree it wins
+	// 8) - for isolated allocations
 	//       * more isolated capacity wins
 	//       * for a tie, prefer the smaller id
-	// 6) - for exclusive allocations
+	// 9) - for exclusive allocations
 	//       * more slicable (shared) capacity wins
 	//       * for a tie, prefer the smaller id
-	// 7) - for shared-only allocations
+	// 10) - for shared-only allocations
 	//       * fewer colocated containers win
 	//       * for a tie prefer more shared capacity then the smaller id
 	//
+	// Affinity and hints express where a container has to be for its
+	// devices and peers, a core type preference only how fast its cores
+	// should be, so the latter only breaks ties between the former.
+	//
 
-	// 1) a node with insufficient isolated or shared capacity loses
+	// 1) a node with insufficient isolated, shared or memory capacity loses
 	switch {
 	case isolated2 < 0 || shared2 < 0:
 		return true
 	case isolated1 < 0 || shared1 < 0:
 		return false
+	case !memfit2 && memfit1:
+		return true
+	case !memfit1 && memfit2:
+		return false
 	}
 
-	// 2) higher affinity wins
+	// 2) a node without power-saved CPUs wins
+	saving1, saving2 := p.isPowerSaving(node1), p.isPowerSaving(node2)
+	if !saving1 && saving2 {
+		return true
+	}
+	if !saving2 && saving1 {
+		return false
+	}
+
+	// 3) higher affinity wins
 	if affinity1 > affinity2 {
 		return true
 	}
@@ -346,12 +471,14 @@ func (p *policy) compareScores(request CPURequest, scores map[int]CPUScore,
 		return false
 	}
 
-	// 3) better topology hint score wins
+	// 4) better topology hint score wins
 	hScores1 := score1.HintScores()
-	if len(hScores1) > 0 {
+	hinted := len(hScores1) > 0
+	hs1, nz1, hs2, nz2 := 0.0, 0.0, 0.0, 0.0
+	if hinted {
 		hScores2 := score2.HintScores()
-		hs1, nz1 := combineHintScores(hScores1)
-		hs2, nz2 := combineHintScores(hScores2)
+		hs1, nz1 = combineHintScores(hScores1)
+		hs2, nz2 = combineHintScores(hScores2)
 
 		if hs1 > hs2 {
 			return true
@@ -368,20 +495,29 @@ func (p *policy) compareScores(request CPURequest, scores map[int]CPUScore,
 				return false
 			}
 		}
+	}
 
-		// for a tie, prefer lower nodes and smaller ids
-		if hs1 == hs2 && nz1 == nz2 && (hs1 != 0 || nz1 != 0) {
-			if depth1 > depth2 {
-				return true
-			}
-			if depth1 < depth2 {
-				return false
-			}
-			return id1 < id2
+	// 5) a higher share of cores of the preferred type wins
+	corefit1, corefit2 := score1.CoreKindFit(), score2.CoreKindFit()
+	if corefit1 > corefit2 {
+		return true
+	}
+	if corefit2 > corefit1 {
+		return false
+	}
+
+	// 6) for a tie in hint scores, prefer lower nodes and smaller ids
+	if hinted && hs1 == hs2 && nz1 == nz2 && (hs1 != 0 || nz1 != 0) {
+		if depth1 > depth2 {
+			return true
 		}
+		if depth1 < depth2 {
+			return false
+		}
+		return id1 < id2
 	}
 
-	// 4) a lower node wins
+	// 7) a lower node wins
 	if depth1 > depth2 {
 		return true
 	}
@@ -389,7 +525,7 @@ func (p *policy) compareScores(request CPURequest, scores map[int]CPUScore,
 		return false
 	}
 
-	// 5) more isolated capacity wins
+	// 8) more isolated capacity wins
 	if request.Isolate() {
 		if isolated1 > isolated2 {
 			return true
@@ -400,7 +536,7 @@ func (p *policy) compareScores(request CPURequest, scores map[int]CPUScore,
 		return id1 < id2
 	}
 
-	// 6) more slicable shared capacity wins
+	// 9) more slicable shared capacity wins
 	if request.FullCPUs() > 0 {
 		if shared1 > shared2 {
 			return true
@@ -412,7 +548,7 @@ func (p *policy) compareScores(request CPURequest, scores map[int]CPUScore,
 		return id1 < id2
 	}
 
-	// 7) fewer colocated containers win
+	// 10) fewer colocated containers win
 	if score1.Colocated() < score2.Colocated() {
 		return true
 	}
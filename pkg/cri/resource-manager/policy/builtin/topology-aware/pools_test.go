@@ -0,0 +1,266 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	"github.com/intel/cri-resource-manager/pkg/topology"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// createCacheSysfs creates a sysfs tree of a single socket and NUMA node with
+// 8 CPUs, a private L2 cache per CPU and an L3 cache per 4 CPUs.
+func createCacheSysfs(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "topology-aware-sysfs")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	write := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	write("devices/system/node/node0/cpulist", "0-7")
+	write("devices/system/node/node0/distance", "10")
+	write("devices/system/node/node0/memory0/online", "1")
+	write("devices/system/cpu/isolated", "")
+	for id := 0; id < 8; id++ {
+		cpu := fmt.Sprintf("devices/system/cpu/cpu%d/", id)
+		l3 := map[bool]string{true: "0-3", false: "4-7"}[id < 4]
+		write(cpu+"topology/physical_package_id", "0")
+		write(cpu+"topology/core_id", fmt.Sprintf("%d", id))
+		write(cpu+"topology/thread_siblings_list", fmt.Sprintf("%d", id))
+		write(cpu+"node0/cpulist", "0-7")
+		write(cpu+"cache/index2/id", fmt.Sprintf("%d", id))
+		write(cpu+"cache/index2/level", "2")
+		write(cpu+"cache/index2/type", "Unified")
+		write(cpu+"cache/index2/size", "1024K")
+		write(cpu+"cache/index2/shared_cpu_list", fmt.Sprintf("%d", id))
+		write(cpu+"cache/index3/id", fmt.Sprintf("%d", id/4))
+		write(cpu+"cache/index3/level", "3")
+		write(cpu+"cache/index3/type", "Unified")
+		write(cpu+"cache/index3/size", "16384K")
+		write(cpu+"cache/index3/shared_cpu_list", l3)
+	}
+
+	return dir
+}
+
+// newCacheTestPolicy creates a policy for the given sysfs tree.
+func newCacheTestPolicy(t *testing.T, dir string, flags ...system.DiscoveryFlag) *policy {
+	sys, err := system.DiscoverSystemAt(dir, flags...)
+	if err != nil {
+		t.Fatalf("failed to discover test system: %v", err)
+	}
+	return &policy{
+		sys:   sys,
+		nodes: map[string]Node{},
+	}
+}
+
+func TestLastLevelCaches(t *testing.T) {
+	dir := createCacheSysfs(t)
+	defer os.RemoveAll(dir)
+
+	tcases := []struct {
+		name     string
+		flags    []system.DiscoveryFlag
+		cpus     string
+		expected []string
+	}{
+		{
+			name:     "all CPUs",
+			flags:    []system.DiscoveryFlag{system.DiscoverCPUTopology, system.DiscoverCache},
+			cpus:     "0-7",
+			expected: []string{"0-3", "4-7"},
+		},
+		{
+			name:     "CPUs of both caches",
+			flags:    []system.DiscoveryFlag{system.DiscoverCPUTopology, system.DiscoverCache},
+			cpus:     "3-4",
+			expected: []string{"0-3", "4-7"},
+		},
+		{
+			name:     "CPUs of a single cache",
+			flags:    []system.DiscoveryFlag{system.DiscoverCPUTopology, system.DiscoverCache},
+			cpus:     "5-7",
+			expected: []string{"4-7"},
+		},
+		{
+			name:  "no cache details",
+			flags: []system.DiscoveryFlag{system.DiscoverCPUTopology},
+			cpus:  "0-7",
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newCacheTestPolicy(t, dir, tc.flags...)
+			caches := p.lastLevelCaches(cpuset.MustParse(tc.cpus))
+			if len(caches) != len(tc.expected) {
+				t.Fatalf("expected %d caches, got %d", len(tc.expected), len(caches))
+			}
+			for i, c := range caches {
+				if c.Level() != 3 {
+					t.Errorf("cache #%d: expected L3 cache, got L%d", i, c.Level())
+				}
+				if cpus := c.SharedCPUSet().String(); cpus != tc.expected[i] {
+					t.Errorf("cache #%d: expected CPUs %s, got %s", i, tc.expected[i], cpus)
+				}
+			}
+		})
+	}
+}
+
+func TestAddCacheNodes(t *testing.T) {
+	dir := createCacheSysfs(t)
+	defer os.RemoveAll(dir)
+
+	tcases := []struct {
+		name     string
+		cpus     string
+		expected []string
+	}{
+		{
+			name:     "split by caches",
+			cpus:     "0-7",
+			expected: []string{"0-3", "4-7"},
+		},
+		{
+			name:     "partial caches",
+			cpus:     "2-5",
+			expected: []string{"2-3", "4-5"},
+		},
+		{
+			name: "single cache",
+			cpus: "4-7",
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newCacheTestPolicy(t, dir, system.DiscoverCPUTopology, system.DiscoverCache)
+			parent := p.NewSocketNode(0, nilnode)
+			p.addCacheNodes(cpuset.MustParse(tc.cpus), parent)
+
+			if len(p.nodes) != len(tc.expected) {
+				t.Fatalf("expected %d cache nodes, got %d", len(tc.expected), len(p.nodes))
+			}
+			for i, child := range parent.Children() {
+				n, ok := child.(*node).self.node.(*cachenode)
+				if !ok {
+					t.Fatalf("child #%d: expected a cache node, got %s", i, child.Kind())
+				}
+				if cpus := n.cpus.String(); cpus != tc.expected[i] {
+					t.Errorf("child #%d: expected CPUs %s, got %s", i, tc.expected[i], cpus)
+				}
+				if _, ok := p.nodes[n.Name()]; !ok {
+					t.Errorf("child #%d: cache node %s not registered", i, n.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCachePoolsWithoutCacheDiscovery(t *testing.T) {
+	dir := createCacheSysfs(t)
+	defer os.RemoveAll(dir)
+
+	// The default discovery leaves out caches, pool building opts in for them.
+	p := newCacheTestPolicy(t, dir)
+	if err := p.buildPoolsByTopology(); err != nil {
+		t.Fatalf("failed to build pools: %v", err)
+	}
+
+	caches := 0
+	for _, n := range p.nodes {
+		if n.Kind() == CacheNode {
+			caches++
+		}
+	}
+	if caches != 2 {
+		t.Errorf("expected 2 cache nodes, got %d", caches)
+	}
+}
+
+func TestCacheNodeHintScore(t *testing.T) {
+	dir := createCacheSysfs(t)
+	defer os.RemoveAll(dir)
+
+	p := newCacheTestPolicy(t, dir, system.DiscoverCPUTopology, system.DiscoverCache)
+	parent := p.NewSocketNode(0, nilnode)
+	p.addCacheNodes(cpuset.MustParse("0-7"), parent)
+	n := parent.Children()[0]
+	n.DiscoverMemset()
+
+	tcases := []struct {
+		name     string
+		hint     topology.Hint
+		expected float64
+	}{
+		{
+			name:     "CPUs of the cache",
+			hint:     topology.Hint{CPUs: "0-3"},
+			expected: 1.0,
+		},
+		{
+			name:     "CPUs partly in the cache",
+			hint:     topology.Hint{CPUs: "2-5"},
+			expected: 0.5,
+		},
+		{
+			name:     "CPUs of another cache",
+			hint:     topology.Hint{CPUs: "4-7"},
+			expected: 0.0,
+		},
+		{
+			name:     "NUMA node of the cache",
+			hint:     topology.Hint{NUMAs: "0"},
+			expected: 1.0,
+		},
+		{
+			name:     "another NUMA node",
+			hint:     topology.Hint{NUMAs: "1"},
+			expected: 0.0,
+		},
+		{
+			name:     "socket shared by two caches",
+			hint:     topology.Hint{Sockets: "0"},
+			expected: 0.5,
+		},
+		{
+			name:     "another socket",
+			hint:     topology.Hint{Sockets: "1"},
+			expected: 0.0,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if score := n.HintScore(tc.hint); score != tc.expected {
+				t.Errorf("expected score %f, got %f", tc.expected, score)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+//
+// Power-saving consolidation packs workloads onto as few NUMA nodes as possible
+// while the load is low, and puts the CPUs of the NUMA nodes left unused into
+// the lowest frequency or offline. Consolidation is done when rebalancing, with
+// hysteresis: it kicks in once the load drops below a low watermark, and all
+// CPUs are brought back once the load on the remaining CPUs would exceed a high
+// watermark. Reserved CPUs and CPUs with exclusive grants are never touched.
+//
+
+const (
+	// PowerSavingFrequency puts unused CPUs into their lowest frequency.
+	PowerSavingFrequency = "frequency"
+	// PowerSavingOffline puts unused CPUs offline.
+	PowerSavingOffline = "offline"
+
+	// cache key for CPUs we have put into power saving
+	keyPowerSavedCPUs = "powersaved-cpus"
+
+	// frequency limits (Hz) clamped by sysfs to the lowest and highest CPU frequency
+	lowestFrequency  = 1000
+	highestFrequency = math.MaxUint64
+)
+
+// powerNode is a NUMA node considered for power saving.
+type powerNode struct {
+	node   Node          // pool of the NUMA node
+	cpus   cpuset.CPUSet // CPUs of the node
+	load   int           // milli-CPU granted to containers in the node
+	pinned bool          // whether the node must stay awake
+}
+
+// powerSavingEnabled checks if power-saving consolidation is enabled.
+func powerSavingEnabled() bool {
+	switch strings.ToLower(opt.PowerSaving) {
+	case PowerSavingFrequency, PowerSavingOffline:
+		return true
+	}
+	return false
+}
+
+// checkPowerSavingOptions checks the power-saving options for invalid values.
+func checkPowerSavingOptions(o *options) error {
+	switch strings.ToLower(o.PowerSaving) {
+	case "", PowerSavingFrequency, PowerSavingOffline:
+	default:
+		return policyError("invalid power saving %q, expecting %q or %q",
+			o.PowerSaving, PowerSavingFrequency, PowerSavingOffline)
+	}
+	if o.PowerSavingLowLoad < 0 || o.PowerSavingLowLoad > 100 ||
+		o.PowerSavingHighLoad < 0 || o.PowerSavingHighLoad > 100 {
+		return policyError("invalid power saving load watermarks %d%% - %d%%",
+			o.PowerSavingLowLoad, o.PowerSavingHighLoad)
+	}
+	return nil
+}
+
+// totalLoad returns the milli-CPU granted to all containers.
+func (p *policy) totalLoad() int {
+	load := 0
+	for _, grant := range p.allocations.CPU {
+		load += 1000*grant.ExclusiveCPUs().Size() + grant.SharedPortion()
+	}
+	return load
+}
+
+// awakeCPUs returns the given CPUs without power-saved ones, unless none would remain.
+func (p *policy) awakeCPUs(cpus cpuset.CPUSet) cpuset.CPUSet {
+	if awake := cpus.Difference(p.powersaving); !awake.IsEmpty() {
+		return awake
+	}
+	return cpus
+}
+
+// isPowerSaving checks if a pool has any CPUs in power saving.
+func (p *policy) isPowerSaving(n Node) bool {
+	if p.powersaving.IsEmpty() {
+		return false
+	}
+	cpus := n.GetCPU()
+	return !cpus.SharableCPUs().Union(cpus.IsolatedCPUs()).Intersection(p.powersaving).IsEmpty()
+}
+
+// isInSubtree checks if node n is the given root or one of its descendants.
+func isInSubtree(n, root Node) bool {
+	for ; !n.IsNil(); n = n.Parent() {
+		if n.IsSameNode(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// powerNodes collects the NUMA nodes with their load and whether they must stay awake.
+func (p *policy) powerNodes() []*powerNode {
+	nodes := []*powerNode{}
+	for _, n := range p.pools {
+		if n.Kind() != NumaNode {
+			continue
+		}
+		cpus := n.GetCPU()
+		pn := &powerNode{
+			node: n,
+			cpus: cpus.SharableCPUs().Union(cpus.IsolatedCPUs()),
+		}
+		if !pn.cpus.Intersection(p.reserved).IsEmpty() {
+			pn.pinned = true
+		}
+		for _, grant := range p.allocations.CPU {
+			taken := grant.ExclusiveCPUs().Union(grant.IdleCPUs())
+			if !taken.Intersection(pn.cpus).IsEmpty() {
+				pn.pinned = true
+			}
+			if !isInSubtree(grant.GetNode(), n) {
+				continue
+			}
+			pn.load += 1000*grant.ExclusiveCPUs().Size() + grant.SharedPortion()
+			if grant.GetContainer().GetQOSClass() == corev1.PodQOSGuaranteed {
+				// only non-guaranteed containers are moved when rebalancing
+				pn.pinned = true
+			}
+		}
+		nodes = append(nodes, pn)
+	}
+	return nodes
+}
+
+// selectAwakeNodes selects the nodes to keep awake: the pinned ones, then the
+// most loaded ones until the total load stays below the high watermark.
+func selectAwakeNodes(nodes []*powerNode, load, high int) []*powerNode {
+	sorted := make([]*powerNode, len(nodes))
+	copy(sorted, nodes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ni, nj := sorted[i], sorted[j]
+		if ni.pinned != nj.pinned {
+			return ni.pinned
+		}
+		return ni.load > nj.load
+	})
+
+	awake := []*powerNode{}
+	capacity := 0
+	for _, n := range sorted {
+		if !n.pinned && len(awake) > 0 && 100*load < high*capacity {
+			break
+		}
+		awake = append(awake, n)
+		capacity += 1000 * n.cpus.Size()
+	}
+
+	return awake
+}
+
+// planPowerSaving decides the CPUs to avoid for placement, before containers
+// are reallocated when rebalancing.
+func (p *policy) planPowerSaving() {
+	if !powerSavingEnabled() {
+		p.wakeUpAll()
+		return
+	}
+
+	load := p.totalLoad()
+	capacity := 1000 * p.allowed.Size()
+	awakeCapacity := 1000 * p.allowed.Difference(p.powersaving).Size()
+
+	switch {
+	case !p.powersaving.IsEmpty() && 100*load > opt.PowerSavingHighLoad*awakeCapacity:
+		log.Info("load %d mCPU above %d%% of awake CPUs, stopping power saving",
+			load, opt.PowerSavingHighLoad)
+		p.wakeUpAll()
+		return
+	case 100*load >= opt.PowerSavingLowLoad*capacity:
+		return
+	}
+
+	nodes := p.powerNodes()
+	awake := cpuset.NewCPUSet()
+	for _, n := range selectAwakeNodes(nodes, load, opt.PowerSavingHighLoad) {
+		awake = awake.Union(n.cpus)
+	}
+
+	powersaving := cpuset.NewCPUSet()
+	for _, n := range nodes {
+		powersaving = powersaving.Union(n.cpus)
+	}
+	p.powersaving = powersaving.Difference(awake).Difference(p.reserved).Difference(p.parked)
+
+	if !p.powersaving.IsEmpty() {
+		log.Info("load %d mCPU below %d%% of all CPUs, consolidating to CPUs %s",
+			load, opt.PowerSavingLowLoad, p.allowed.Difference(p.powersaving))
+	}
+}
+
+// applyPowerSaving puts the planned CPUs into power saving, after containers
+// have been reallocated. CPUs of nodes that still have containers are woken up.
+func (p *policy) applyPowerSaving() {
+	if p.powersaving.IsEmpty() && p.powersaved.IsEmpty() {
+		return
+	}
+
+	for _, pn := range p.powerNodes() {
+		if pn.load > 0 || pn.pinned {
+			p.powersaving = p.powersaving.Difference(pn.cpus)
+		}
+	}
+
+	p.wakeUp(p.powersaved.Difference(p.powersaving))
+	p.sleep(p.powersaving.Difference(p.powersaved))
+	p.pinSharedAllocations()
+}
+
+// wakeUpForAllocation brings all CPUs back before a request that would push
+// the load on the awake CPUs over the high watermark.
+func (p *policy) wakeUpForAllocation(request CPURequest) {
+	if p.powersaving.IsEmpty() {
+		return
+	}
+
+	load := p.totalLoad() + 1000*request.FullCPUs() + request.CPUFraction()
+	awakeCapacity := 1000 * p.allowed.Difference(p.powersaving).Size()
+	if 100*load > opt.PowerSavingHighLoad*awakeCapacity {
+		log.Info("%s needs power-saved CPUs, stopping power saving", request)
+		p.wakeUpAll()
+	}
+}
+
+// wakeUpGrant brings back any power-saved CPUs taken by a grant.
+func (p *policy) wakeUpGrant(grant CPUGrant) {
+	taken := grant.ExclusiveCPUs().Union(grant.IdleCPUs()).Intersection(p.powersaving)
+	if taken.IsEmpty() {
+		return
+	}
+	p.powersaving = p.powersaving.Difference(taken)
+	p.wakeUp(taken.Intersection(p.powersaved))
+}
+
+// wakeUpAll stops power saving, bringing all CPUs back.
+func (p *policy) wakeUpAll() {
+	if p.powersaving.IsEmpty() && p.powersaved.IsEmpty() {
+		return
+	}
+	p.powersaving = cpuset.NewCPUSet()
+	p.wakeUp(p.powersaved)
+	p.pinSharedAllocations()
+}
+
+// sleep puts CPUs into power saving.
+func (p *policy) sleep(cpus cpuset.CPUSet) {
+	if cpus.IsEmpty() {
+		return
+	}
+
+	ids := system.NewIDSetFromIntSlice(cpus.ToSlice()...)
+	if strings.ToLower(opt.PowerSaving) == PowerSavingOffline {
+		if _, err := p.sys.SetCpusOnline(false, ids); err != nil {
+			log.Error("failed to put CPUs %s offline: %v", cpus, err)
+			return
+		}
+		log.Info("put unused CPUs %s offline", cpus)
+	} else {
+		if err := p.sys.SetCPUFrequencyLimits(lowestFrequency, lowestFrequency, ids); err != nil {
+			log.Error("failed to set CPUs %s to lowest frequency: %v", cpus, err)
+			return
+		}
+		log.Info("set unused CPUs %s to lowest frequency", cpus)
+	}
+
+	p.powersaved = p.powersaved.Union(cpus)
+	p.savePowerSavedCPUs()
+}
+
+// wakeUp brings CPUs back from power saving, both online and to full frequency.
+func (p *policy) wakeUp(cpus cpuset.CPUSet) {
+	if cpus.IsEmpty() {
+		return
+	}
+
+	ids := system.NewIDSetFromIntSlice(cpus.ToSlice()...)
+	if _, err := p.sys.SetCpusOnline(true, ids); err != nil {
+		log.Error("failed to put CPUs %s back online: %v", cpus, err)
+		return
+	}
+	if err := p.sys.SetCPUFrequencyLimits(lowestFrequency, highestFrequency, ids); err != nil {
+		log.Error("failed to restore frequency limits of CPUs %s: %v", cpus, err)
+	}
+
+	log.Info("brought CPUs %s back from power saving", cpus)
+	p.powersaved = p.powersaved.Difference(cpus)
+	p.savePowerSavedCPUs()
+}
+
+// restorePowerSavedCPUs brings back any CPUs put into power saving by a previous instance.
+func (p *policy) restorePowerSavedCPUs() {
+	p.powersaving = cpuset.NewCPUSet()
+	p.powersaved = cpuset.NewCPUSet()
+
+	saved := cpuset.NewCPUSet()
+	if !p.cache.GetPolicyEntry(keyPowerSavedCPUs, &saved) || saved.IsEmpty() {
+		return
+	}
+
+	p.powersaved = saved
+	p.wakeUp(saved)
+}
+
+// savePowerSavedCPUs saves the set of CPUs in power saving in the cache.
+func (p *policy) savePowerSavedCPUs() {
+	p.cache.SetPolicyEntry(keyPowerSavedCPUs, p.powersaved)
+	p.cache.Save()
+}
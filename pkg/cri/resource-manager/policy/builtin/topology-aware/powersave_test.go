@@ -0,0 +1,185 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func TestSelectAwakeNodes(t *testing.T) {
+	// four NUMA nodes with 4 CPUs each
+	newNodes := func() []*powerNode {
+		return []*powerNode{
+			{cpus: cpuset.MustParse("0-3"), load: 500},
+			{cpus: cpuset.MustParse("4-7"), load: 1500},
+			{cpus: cpuset.MustParse("8-11")},
+			{cpus: cpuset.MustParse("12-15"), load: 1000},
+		}
+	}
+	tcases := []struct {
+		name     string
+		pinned   []int
+		load     int
+		high     int
+		expected string
+	}{
+		{
+			name:     "most loaded node is enough",
+			load:     3000,
+			high:     80,
+			expected: "4-7",
+		},
+		{
+			name:     "high watermark needs more nodes",
+			load:     3000,
+			high:     60,
+			expected: "4-7,12-15",
+		},
+		{
+			name:     "pinned nodes stay awake",
+			pinned:   []int{2},
+			load:     3000,
+			high:     60,
+			expected: "4-11",
+		},
+		{
+			name:     "idle system keeps one node",
+			load:     0,
+			high:     60,
+			expected: "4-7",
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodes := newNodes()
+			for _, idx := range tc.pinned {
+				nodes[idx].pinned = true
+			}
+			awake := cpuset.NewCPUSet()
+			for _, n := range selectAwakeNodes(nodes, tc.load, tc.high) {
+				awake = awake.Union(n.cpus)
+			}
+			if awake.String() != tc.expected {
+				t.Errorf("expected awake CPUs %s, got %s", tc.expected, awake)
+			}
+		})
+	}
+}
+
+func TestPowerNodes(t *testing.T) {
+	p := newTestPolicy()
+	p.addTestGrant("burstable", p.pools[2], v1.PodQOSBurstable, cpuset.NewCPUSet(), 1500)
+	p.addTestGrant("guaranteed", p.pools[3], v1.PodQOSGuaranteed, cpuset.NewCPUSet(), 1000)
+	p.addTestGrant("exclusive", p.root, v1.PodQOSBurstable, cpuset.MustParse("12-13"), 0)
+
+	expected := []struct {
+		load   int
+		pinned bool
+	}{
+		{load: 0, pinned: true},     // reserved CPU
+		{load: 1500, pinned: false}, // only burstable containers
+		{load: 1000, pinned: true},  // guaranteed container
+		{load: 0, pinned: true},     // exclusive CPUs of a grant in the root
+	}
+	nodes := p.powerNodes()
+	if len(nodes) != len(expected) {
+		t.Fatalf("expected %d NUMA nodes, got %d", len(expected), len(nodes))
+	}
+	for i, pn := range nodes {
+		if pn.load != expected[i].load || pn.pinned != expected[i].pinned {
+			t.Errorf("expected %s with load %d, pinned %v, got load %d, pinned %v",
+				pn.node.Name(), expected[i].load, expected[i].pinned, pn.load, pn.pinned)
+		}
+	}
+}
+
+func TestPlanPowerSaving(t *testing.T) {
+	saved := *opt
+	defer func() { *opt = saved }()
+	opt.PowerSaving = PowerSavingFrequency
+	opt.PowerSavingLowLoad = 20  // 3200 mCPU of all 16 CPUs
+	opt.PowerSavingHighLoad = 90 // 3600 mCPU of 4 awake CPUs
+
+	p := newTestPolicy()
+	p.addTestGrant("ctr", p.pools[2], v1.PodQOSBurstable, cpuset.NewCPUSet(), 2000)
+
+	steps := []struct {
+		name     string
+		load     int
+		expected string
+	}{
+		{name: "consolidate below low watermark", load: 2000, expected: "4-15"},
+		{name: "stay consolidated above low watermark", load: 3400, expected: "4-15"},
+		{name: "wake up above high watermark", load: 3700, expected: ""},
+		{name: "stay awake above low watermark", load: 3400, expected: ""},
+		{name: "consolidate again below low watermark", load: 3000, expected: "4-15"},
+	}
+	for _, step := range steps {
+		p.allocations.CPU["ctr"].(*cpuGrant).portion = step.load
+		p.planPowerSaving()
+		if p.powersaving.String() != step.expected {
+			t.Errorf("%s: expected power-saving CPUs %q, got %q",
+				step.name, step.expected, p.powersaving)
+		}
+	}
+
+	opt.PowerSaving = ""
+	p.planPowerSaving()
+	if !p.powersaving.IsEmpty() {
+		t.Errorf("expected no power saving once disabled, got %s", p.powersaving)
+	}
+}
+
+func TestWakeUpForAllocation(t *testing.T) {
+	saved := *opt
+	defer func() { *opt = saved }()
+	opt.PowerSavingHighLoad = 60 // 2400 mCPU of 4 awake CPUs
+
+	p := newTestPolicy()
+	p.addTestGrant("ctr", p.pools[1], v1.PodQOSBurstable, cpuset.NewCPUSet(), 2000)
+	p.powersaving = cpuset.MustParse("4-15")
+
+	p.wakeUpForAllocation(&cpuRequest{container: &mockContainer{name: "small"}, fraction: 300})
+	if p.powersaving.String() != "4-15" {
+		t.Errorf("expected a small request to keep power saving, got %s", p.powersaving)
+	}
+
+	p.wakeUpForAllocation(&cpuRequest{container: &mockContainer{name: "large"}, full: 1})
+	if !p.powersaving.IsEmpty() {
+		t.Errorf("expected a large request to stop power saving, got %s", p.powersaving)
+	}
+}
+
+func TestCheckPowerSavingOptions(t *testing.T) {
+	for _, o := range []*options{
+		{PowerSaving: "Offline", PowerSavingLowLoad: 30, PowerSavingHighLoad: 60},
+		{PowerSaving: "", PowerSavingLowLoad: 30, PowerSavingHighLoad: 60},
+	} {
+		if err := checkPowerSavingOptions(o); err != nil {
+			t.Errorf("unexpected error for %+v: %v", o, err)
+		}
+	}
+	for _, o := range []*options{
+		{PowerSaving: "hibernate", PowerSavingLowLoad: 30, PowerSavingHighLoad: 60},
+		{PowerSaving: "frequency", PowerSavingLowLoad: 30, PowerSavingHighLoad: 160},
+	} {
+		if err := checkPowerSavingOptions(o); err == nil {
+			t.Errorf("expected an error for %+v", o)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"github.com/intel/cri-resource-manager/pkg/cpuallocator"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+//
+// Strict SMT isolation grants exclusive CPUs as full physical cores. No other
+// container is given the hyperthread siblings of such exclusive CPUs. If an odd
+// number of CPUs is requested, the leftover siblings are withheld from others
+// as idle CPUs of the grant, and optionally parked offline while the grant lasts.
+//
+
+const (
+	// cache key for CPUs we have parked offline
+	keyParkedCPUs = "parked-cpus"
+)
+
+// fullCoreFootprint estimates the number of CPUs taken by allocating cnt CPUs as full cores.
+func (cs *cpuSupply) fullCoreFootprint(cnt int) int {
+	return cpuallocator.FullCoreFootprint(cs.node.System(), cnt)
+}
+
+// fullCoreCapacity returns the idle full core capacity of cpus left after taking cnt CPUs.
+func (cs *cpuSupply) fullCoreCapacity(cpus cpuset.CPUSet, cnt int) int {
+	idle := cs.node.Policy().cpuAllocator.IdleCoreCpus(cpus)
+	return idle.Size() - cs.fullCoreFootprint(cnt)
+}
+
+// takeFullCores takes cnt exclusive CPUs as full cores, preferring isolated CPUs.
+// It returns the CPUs taken and the idle hyperthread siblings withheld with them.
+func (cs *cpuSupply) takeFullCores(cnt int, flags cpuallocator.AllocFlag) (cpuset.CPUSet, cpuset.CPUSet, error) {
+	ca := cs.node.Policy().cpuAllocator
+
+	for _, from := range []*cpuset.CPUSet{&cs.isolated, &cs.sharable} {
+		if cs.fullCoreCapacity(*from, cnt) < 0 {
+			continue
+		}
+
+		cores := ca.IdleCoreCpus(*from)
+		exclusive, err := cs.takeCPUs(&cores, nil, cnt, flags)
+		if err != nil {
+			return cpuset.NewCPUSet(), cpuset.NewCPUSet(), err
+		}
+		idle := ca.CoreSiblings(exclusive).Intersection(*from)
+		taken := exclusive.Union(idle)
+
+		// leave at least one full CPU of sharable capacity, like normal slicing does
+		if from == &cs.sharable && 1000*(cs.sharable.Size()-taken.Size())-cs.granted < 1000 {
+			break
+		}
+
+		*from = from.Difference(taken)
+		return exclusive, idle, nil
+	}
+
+	return cpuset.NewCPUSet(), cpuset.NewCPUSet(),
+		policyError("not enough idle full cores for %d CPUs", cnt)
+}
+
+// parkIdleSiblings puts the idle hyperthread siblings of a grant offline, if enabled.
+func (p *policy) parkIdleSiblings(grant CPUGrant) {
+	cpus := grant.IdleCPUs().Difference(p.parked)
+	if !opt.ParkIdleSiblings || cpus.IsEmpty() {
+		return
+	}
+
+	if _, err := p.sys.SetCpusOnline(false, system.NewIDSetFromIntSlice(cpus.ToSlice()...)); err != nil {
+		log.Error("failed to park idle siblings %s of %s: %v",
+			cpus, grant.GetContainer().PrettyName(), err)
+		return
+	}
+
+	log.Info("parked idle siblings %s of %s offline", cpus, grant.GetContainer().PrettyName())
+	p.parked = p.parked.Union(cpus)
+	p.saveParkedCPUs()
+}
+
+// unparkIdleSiblings puts any parked idle hyperthread siblings of a grant back online.
+func (p *policy) unparkIdleSiblings(grant CPUGrant) {
+	cpus := grant.IdleCPUs().Intersection(p.parked)
+	if cpus.IsEmpty() {
+		return
+	}
+
+	if _, err := p.sys.SetCpusOnline(true, system.NewIDSetFromIntSlice(cpus.ToSlice()...)); err != nil {
+		log.Error("failed to put parked siblings %s of %s back online: %v",
+			cpus, grant.GetContainer().PrettyName(), err)
+		return
+	}
+
+	log.Info("put parked siblings %s of %s back online", cpus, grant.GetContainer().PrettyName())
+	p.parked = p.parked.Difference(cpus)
+	p.saveParkedCPUs()
+}
+
+// restoreParkedCPUs puts any CPUs parked by a previous instance back online.
+func (p *policy) restoreParkedCPUs() {
+	parked := cpuset.NewCPUSet()
+	p.parked = cpuset.NewCPUSet()
+
+	if !p.cache.GetPolicyEntry(keyParkedCPUs, &parked) || parked.IsEmpty() {
+		return
+	}
+
+	if _, err := p.sys.SetCpusOnline(true, system.NewIDSetFromIntSlice(parked.ToSlice()...)); err != nil {
+		log.Error("failed to put previously parked CPUs %s back online: %v", parked, err)
+		p.parked = parked
+		return
+	}
+
+	log.Info("put previously parked CPUs %s back online", parked)
+	p.saveParkedCPUs()
+}
+
+// saveParkedCPUs saves the set of parked CPUs in the cache.
+func (p *policy) saveParkedCPUs() {
+	p.cache.SetPolicyEntry(keyParkedCPUs, p.parked)
+	p.cache.Save()
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+)
+
+//
+// Sticky allocations keep the exclusive CPUs and memory nodes of a released
+// container reserved for a grace period, keyed by pod UID and container name.
+// If kubelet recreates the container within the grace period, the replacement
+// gets the same pool, exclusive CPUs and memory nodes whenever they are still
+// free, keeping warm caches and NUMA-local memory.
+//
+
+// stickyAllocation is the reserved allocation of a released container.
+type stickyAllocation struct {
+	node      string        // name of the pool of the released grant
+	exclusive cpuset.CPUSet // exclusive CPUs of the released grant
+	memset    system.IDSet  // memory nodes of the released grant
+	expires   time.Time     // end of the grace period
+}
+
+// stickyKey returns the key of sticky allocations for a container.
+func stickyKey(c cache.Container) (string, bool) {
+	pod, ok := c.GetPod()
+	if !ok {
+		return "", false
+	}
+	return pod.GetUID() + "/" + c.GetName(), true
+}
+
+// saveStickyAllocation reserves the allocation of a released grant for the grace period.
+func (p *policy) saveStickyAllocation(grant CPUGrant) {
+	period := time.Duration(opt.StickyAllocationPeriod)
+	if period <= 0 {
+		return
+	}
+	key, ok := stickyKey(grant.GetContainer())
+	if !ok {
+		return
+	}
+
+	p.pruneStickyAllocations(time.Now())
+	p.sticky[key] = &stickyAllocation{
+		node:      grant.GetNode().Name(),
+		exclusive: grant.ExclusiveCPUs(),
+		memset:    grant.Memset().Clone(),
+		expires:   time.Now().Add(period),
+	}
+
+	log.Debug("  => keeping allocation of %s (%s) for %s", key, grant, period)
+}
+
+// takeStickyAllocation removes and returns the unexpired allocation reserved for key.
+func (p *policy) takeStickyAllocation(key string, now time.Time) *stickyAllocation {
+	p.pruneStickyAllocations(now)
+
+	sa, ok := p.sticky[key]
+	if !ok {
+		return nil
+	}
+	delete(p.sticky, key)
+
+	return sa
+}
+
+// pruneStickyAllocations removes the allocations with an expired grace period.
+func (p *policy) pruneStickyAllocations(now time.Time) {
+	for key, sa := range p.sticky {
+		if !now.Before(sa.expires) {
+			delete(p.sticky, key)
+		}
+	}
+}
+
+// stickyPool returns the pool reserved for the container of a request, if any,
+// updating the request to take the reserved exclusive CPUs and memory nodes.
+// It returns nil if the pool can no longer fit the request or the exclusive
+// CPUs are no longer free.
+func (p *policy) stickyPool(request CPURequest) Node {
+	key, ok := stickyKey(request.GetContainer())
+	if !ok {
+		return nil
+	}
+	sa := p.takeStickyAllocation(key, time.Now())
+	if sa == nil {
+		return nil
+	}
+
+	node, ok := p.nodes[sa.node]
+	if !ok {
+		return nil
+	}
+
+	if !poolFits(node, request) {
+		log.Debug("  => pool %s of sticky allocation of %s no longer fits", sa.node, key)
+		return nil
+	}
+
+	cr := request.(*cpuRequest)
+	if cr.full > 0 {
+		if cr.full != sa.exclusive.Size() {
+			return nil
+		}
+		cr.sticky = sa.exclusive
+		if !node.FreeCPU().(*cpuSupply).hasStickyCPUs(cr) {
+			log.Debug("  => sticky CPUs %s of %s are no longer free", sa.exclusive, key)
+			cr.sticky = cpuset.NewCPUSet()
+			return nil
+		}
+	}
+	cr.stickyMems = sa.memset
+
+	log.Debug("  => using sticky allocation of %s in pool %s", key, sa.node)
+
+	return node
+}
+
+// poolFits checks if a pool has enough isolated, shared and memory capacity for a request.
+func poolFits(node Node, request CPURequest) bool {
+	score := node.GetScore(request)
+	return score.IsolatedCapacity() >= 0 && score.SharedCapacity() >= 0 && score.MemoryFit()
+}
+
+// hasStickyCPUs checks if the sticky CPUs of a request can be taken from the supply.
+func (cs *cpuSupply) hasStickyCPUs(cr *cpuRequest) bool {
+	if cr.sticky.IsEmpty() || cr.sticky.Size() != cr.full {
+		return false
+	}
+	if !cr.sticky.IsSubsetOf(cs.isolated.Union(cs.sharable)) {
+		return false
+	}
+
+	// leave at least one full CPU of sharable capacity, like normal slicing does
+	sliced := cs.stickyTaken(cr).Intersection(cs.sharable).Size()
+	if sliced > 0 && 1000*(cs.sharable.Size()-sliced)-cs.granted < 1000 {
+		return false
+	}
+
+	return true
+}
+
+// stickyTaken returns the CPUs taken from the supply by the sticky CPUs of a request.
+func (cs *cpuSupply) stickyTaken(cr *cpuRequest) cpuset.CPUSet {
+	if !cr.strict {
+		return cr.sticky
+	}
+	free := cs.isolated.Union(cs.sharable)
+	idle := cs.node.Policy().cpuAllocator.CoreSiblings(cr.sticky).Intersection(free)
+	return cr.sticky.Union(idle)
+}
+
+// takeStickyCPUs takes the sticky CPUs of a request from the supply. It
+// returns the exclusive CPUs taken and, with strict SMT isolation, the idle
+// hyperthread siblings withheld with them.
+func (cs *cpuSupply) takeStickyCPUs(cr *cpuRequest) (cpuset.CPUSet, cpuset.CPUSet) {
+	taken := cs.stickyTaken(cr)
+	cs.isolated = cs.isolated.Difference(taken)
+	cs.sharable = cs.sharable.Difference(taken)
+	return cr.sticky, taken.Difference(cr.sticky)
+}
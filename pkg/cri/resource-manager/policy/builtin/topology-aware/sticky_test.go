@@ -0,0 +1,204 @@
+// Copyright 2021 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package topologyaware
+
+import (
+	"testing"
+	"time"
+
+	pkgcfg "github.com/intel/cri-resource-manager/pkg/config"
+	system "github.com/intel/cri-resource-manager/pkg/sysfs"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+// saveTestStickyAllocation saves the allocation of a released grant of
+// container ctr0 of pod0 with the given exclusive CPUs.
+func (p *policy) saveTestStickyAllocation(n Node, exclusive cpuset.CPUSet) *mockContainer {
+	c := &mockContainer{
+		name:                 "ctr0",
+		returnValueForGetPod: &mockPod{name: "pod0", uid: "pod0-uid"},
+	}
+	grant := newCPUGrant(n, c, exclusive, cpuset.NewCPUSet(), 0, 0, system.NewIDSet(1))
+	p.saveStickyAllocation(grant)
+	return c
+}
+
+func TestTakeStickyAllocation(t *testing.T) {
+	now := time.Now()
+	p := &policy{
+		sticky: map[string]*stickyAllocation{
+			"pod0/ctr0": {exclusive: cpuset.MustParse("2-3"), expires: now.Add(time.Second)},
+			"pod0/ctr1": {exclusive: cpuset.MustParse("4-5"), expires: now},
+		},
+	}
+
+	if sa := p.takeStickyAllocation("pod0/ctr1", now); sa != nil {
+		t.Errorf("expected expired allocation to be gone, got %v", sa)
+	}
+	if _, ok := p.sticky["pod0/ctr1"]; ok {
+		t.Errorf("expected expired allocation to be pruned")
+	}
+
+	sa := p.takeStickyAllocation("pod0/ctr0", now)
+	if sa == nil || !sa.exclusive.Equals(cpuset.MustParse("2-3")) {
+		t.Errorf("expected allocation with CPUs 2-3, got %v", sa)
+	}
+	if sa := p.takeStickyAllocation("pod0/ctr0", now); sa != nil {
+		t.Errorf("expected allocation to be taken only once, got %v", sa)
+	}
+}
+
+func TestStickyAllocationExpiry(t *testing.T) {
+	saved := *opt
+	defer func() { *opt = saved }()
+
+	p := newTestPolicy()
+	n := p.pools[2]
+
+	opt.StickyAllocationPeriod = 0
+	p.saveTestStickyAllocation(n, cpuset.MustParse("4-5"))
+	if len(p.sticky) != 0 {
+		t.Errorf("expected no sticky allocations with a zero period, got %v", p.sticky)
+	}
+
+	opt.StickyAllocationPeriod = pkgcfg.Duration(time.Minute)
+	p.saveTestStickyAllocation(n, cpuset.MustParse("4-5"))
+	if sa := p.takeStickyAllocation("pod0-uid/ctr0", time.Now().Add(30*time.Second)); sa == nil {
+		t.Errorf("expected allocation to be kept within the grace period")
+	}
+
+	p.saveTestStickyAllocation(n, cpuset.MustParse("4-5"))
+	if sa := p.takeStickyAllocation("pod0-uid/ctr0", time.Now().Add(2*time.Minute)); sa != nil {
+		t.Errorf("expected allocation to expire after the grace period, got %v", sa)
+	}
+	if len(p.sticky) != 0 {
+		t.Errorf("expected expired allocations to be pruned, got %v", p.sticky)
+	}
+}
+
+func TestStickyPool(t *testing.T) {
+	saved := *opt
+	defer func() { *opt = saved }()
+	opt.StickyAllocationPeriod = pkgcfg.Duration(time.Minute)
+
+	p := newTestPolicy()
+	n := p.pools[2]
+
+	c := p.saveTestStickyAllocation(n, cpuset.MustParse("4-5"))
+	cr := &cpuRequest{container: c, full: 2, anyKind: true}
+	if pool := p.stickyPool(cr); pool == nil || !pool.IsSameNode(n) {
+		t.Fatalf("expected sticky pool %s, got %v", n.Name(), pool)
+	}
+	if !cr.sticky.Equals(cpuset.MustParse("4-5")) || cr.stickyMems.String() != "1" {
+		t.Errorf("expected sticky CPUs 4-5 and memory node 1, got %s and %s",
+			cr.sticky, cr.stickyMems)
+	}
+	if pool := p.stickyPool(&cpuRequest{container: c, full: 2, anyKind: true}); pool != nil {
+		t.Errorf("expected sticky allocation to be used only once, got %s", pool.Name())
+	}
+
+	p.saveTestStickyAllocation(n, cpuset.MustParse("4-5"))
+	if pool := p.stickyPool(&cpuRequest{container: c, full: 3, anyKind: true}); pool != nil {
+		t.Errorf("expected no sticky pool for a different number of CPUs, got %s", pool.Name())
+	}
+
+	p.saveTestStickyAllocation(n, cpuset.MustParse("4-5"))
+	n.(*numanode).freecpu = newCPUSupply(n, cpuset.NewCPUSet(), cpuset.MustParse("4,6-7"), 0)
+	cr = &cpuRequest{container: c, full: 2, anyKind: true}
+	if pool := p.stickyPool(cr); pool != nil || !cr.sticky.IsEmpty() {
+		t.Errorf("expected no sticky pool once CPU 5 is taken, got %v with CPUs %s", pool, cr.sticky)
+	}
+}
+
+func TestHasStickyCPUs(t *testing.T) {
+	p := newTestPolicy()
+	n := p.pools[2]
+
+	tcases := []struct {
+		name     string
+		isolated string
+		granted  int
+		sticky   string
+		full     int
+		strict   bool
+		expected bool
+	}{
+		{
+			name:     "no sticky CPUs",
+			full:     2,
+			expected: false,
+		},
+		{
+			name:     "different number of CPUs",
+			sticky:   "4-5",
+			full:     3,
+			expected: false,
+		},
+		{
+			name:     "sticky CPUs not free",
+			sticky:   "3-4",
+			full:     2,
+			expected: false,
+		},
+		{
+			name:     "sharable CPUs",
+			sticky:   "4-5",
+			full:     2,
+			expected: true,
+		},
+		{
+			name:     "isolated CPUs",
+			isolated: "8-9",
+			sticky:   "8-9",
+			full:     2,
+			granted:  2000,
+			expected: true,
+		},
+		{
+			name:     "last full sharable CPU",
+			sticky:   "4-6",
+			full:     3,
+			granted:  500,
+			expected: false,
+		},
+		{
+			name:     "full cores with strict SMT isolation",
+			sticky:   "4-5",
+			full:     2,
+			strict:   true,
+			expected: true,
+		},
+		{
+			name:     "idle siblings with strict SMT isolation",
+			sticky:   "5-6",
+			full:     2,
+			strict:   true,
+			expected: false,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := newCPUSupply(n, cpuset.MustParse(tc.isolated), cpuset.MustParse("4-7"), tc.granted).(*cpuSupply)
+			cr := &cpuRequest{
+				full:   tc.full,
+				strict: tc.strict,
+				sticky: cpuset.MustParse(tc.sticky),
+			}
+			if has := cs.hasStickyCPUs(cr); has != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, has)
+			}
+		})
+	}
+}
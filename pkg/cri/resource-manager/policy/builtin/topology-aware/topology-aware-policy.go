@@ -15,6 +15,8 @@
 package topologyaware
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	resapi "k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
@@ -46,20 +48,28 @@ type allocations struct {
 
 // policy is our runtime state for the topology aware policy.
 type policy struct {
-	options      policyapi.BackendOptions  // options we were created or reconfigured with
-	cache        cache.Cache               // pod/container cache
-	sys          system.System             // system/HW topology info
-	allowed      cpuset.CPUSet             // bounding set of CPUs we're allowed to use
-	reserved     cpuset.CPUSet             // system-/kube-reserved CPUs
-	reserveCnt   int                       // number of CPUs to reserve if given as resource.Quantity
-	isolated     cpuset.CPUSet             // (our allowed set of) isolated CPUs
-	nodes        map[string]Node           // pool nodes by name
-	pools        []Node                    // pre-populated node slice for scoring, etc...
-	root         Node                      // root of our pool/partition tree
-	nodeCnt      int                       // number of pools
-	depth        int                       // tree depth
-	allocations  allocations               // container pool assignments
-	cpuAllocator cpuallocator.CPUAllocator // CPU allocator used by the policy
+	options      policyapi.BackendOptions     // options we were created or reconfigured with
+	cache        cache.Cache                  // pod/container cache
+	sys          system.System                // system/HW topology info
+	allowed      cpuset.CPUSet                // bounding set of CPUs we're allowed to use
+	reserved     cpuset.CPUSet                // system-/kube-reserved CPUs
+	reserveCnt   int                          // number of CPUs to reserve if given as resource.Quantity
+	isolated     cpuset.CPUSet                // (our allowed set of) isolated CPUs
+	nodes        map[string]Node              // pool nodes by name
+	pools        []Node                       // pre-populated node slice for scoring, etc...
+	root         Node                         // root of our pool/partition tree
+	nodeCnt      int                          // number of pools
+	depth        int                          // tree depth
+	allocations  allocations                  // container pool assignments
+	memory       memoryAccounting             // NUMA node memory capacity and grants
+	parked       cpuset.CPUSet                // idle hyperthread siblings parked offline
+	sticky       map[string]*stickyAllocation // allocations kept for restarted containers
+	inherited    map[string][]*inheritedCPUs  // CPUs of completed init containers, by pod ID
+	powersaving  cpuset.CPUSet                // CPUs avoided by placement to save power
+	powersaved   cpuset.CPUSet                // CPUs put into lowest frequency or offline
+	migrations   int                          // exclusive grants migrated in the current interval
+	migrationAt  time.Time                    // start of the current migration interval
+	cpuAllocator cpuallocator.CPUAllocator    // CPU allocator used by the policy
 }
 
 // Make sure policy implements the policy.Backend interface.
@@ -75,7 +85,13 @@ func CreateTopologyAwarePolicy(opts *policyapi.BackendOptions) policyapi.Backend
 	}
 
 	p.nodes = make(map[string]Node)
+	p.memory = newMemoryAccounting()
 	p.allocations = allocations{policy: p, CPU: make(map[string]CPUGrant, 32)}
+	p.sticky = make(map[string]*stickyAllocation)
+	p.inherited = make(map[string][]*inheritedCPUs)
+
+	p.restoreParkedCPUs()
+	p.restorePowerSavedCPUs()
 
 	if err := p.checkConstraints(); err != nil {
 		log.Fatal("failed to create topology-aware policy: %v", err)
@@ -85,6 +101,8 @@ func CreateTopologyAwarePolicy(opts *policyapi.BackendOptions) policyapi.Backend
 		log.Fatal("failed to create topology-aware policy: %v", err)
 	}
 
+	p.discoverMemory()
+
 	p.addImplicitAffinities()
 
 	config.GetModule(PolicyPath).AddNotify(p.configNotify)
@@ -132,19 +150,34 @@ func (p *policy) Sync(add []cache.Container, del []cache.Container) error {
 func (p *policy) AllocateResources(container cache.Container) error {
 	log.Debug("allocating resources for %s...", container.PrettyName())
 
+	if p.isCompletedInitContainer(container) {
+		log.Debug("  => not allocating completed init container %s", container.PrettyName())
+		return nil
+	}
+
+	p.releaseInitContainers(container)
+
+	p.wakeUpForAllocation(newCPURequest(container))
+
 	grant, err := p.allocatePool(container)
 	if err != nil {
 		return policyError("failed to allocate resources for %s: %v",
 			container.PrettyName(), err)
 	}
 
+	p.wakeUpGrant(grant)
+
 	if err := p.applyGrant(grant); err != nil {
-		if _, _, err = p.releasePool(container); err != nil {
-			log.Warn("failed to undo/release unapplicable grant %s: %v", grant, err)
-			return policyError("failed to undo/release unapplicable grant %s: %v", grant, err)
+		if _, _, relErr := p.releasePool(container); relErr != nil {
+			log.Warn("failed to undo/release unapplicable grant %s: %v", grant, relErr)
+			return policyError("failed to undo/release unapplicable grant %s: %v", grant, relErr)
 		}
+		return policyError("failed to apply grant %s to %s: %v", grant,
+			container.PrettyName(), err)
 	}
 
+	p.parkIdleSiblings(grant)
+
 	if err := p.updateSharedAllocations(grant); err != nil {
 		log.Warn("failed to update shared allocations affected by %s: %v",
 			container.PrettyName(), err)
@@ -157,6 +190,12 @@ func (p *policy) AllocateResources(container cache.Container) error {
 
 // ReleaseResources is a resource release request for this policy.
 func (p *policy) ReleaseResources(container cache.Container) error {
+	return p.releaseResources(container, true)
+}
+
+// releaseResources releases the resources of a container, optionally keeping
+// them as a sticky allocation for a restarted replacement container.
+func (p *policy) releaseResources(container cache.Container, sticky bool) error {
 	log.Debug("releasing resources of %s...", container.PrettyName())
 
 	grant, found, err := p.releasePool(container)
@@ -166,6 +205,9 @@ func (p *policy) ReleaseResources(container cache.Container) error {
 	}
 
 	if found {
+		if sticky {
+			p.saveStickyAllocation(grant)
+		}
 		if err = p.updateSharedAllocations(grant); err != nil {
 			log.Warn("failed to update shared allocations affected by %s: %v",
 				container.PrettyName(), err)
@@ -187,26 +229,35 @@ func (p *policy) UpdateResources(c cache.Container) error {
 func (p *policy) Rebalance() (bool, error) {
 	var errors error
 
+	p.planPowerSaving()
+
 	containers := p.cache.GetContainers()
 	movable := []cache.Container{}
 
 	for _, c := range containers {
 		if c.GetQOSClass() != corev1.PodQOSGuaranteed {
-			p.ReleaseResources(c)
+			p.releaseResources(c, false)
 			movable = append(movable, c)
 		}
 	}
 
+	// compact allocations by allocating the largest requests first
+	sortByCPURequest(movable)
+
 	for _, c := range movable {
 		if err := p.AllocateResources(c); err != nil {
-			if errors == nil {
-				errors = err
-			} else {
-				errors = policyError("%v, %v", errors, err)
-			}
+			errors = p.appendError(errors, err)
 		}
 	}
 
+	if opt.MigrateExclusive {
+		if _, err := p.migrateExclusiveGrants(time.Now()); err != nil {
+			errors = p.appendError(errors, err)
+		}
+	}
+
+	p.applyPowerSaving()
+
 	return true, errors
 }
 
@@ -224,7 +275,7 @@ func (p *policy) ExportResourceData(c cache.Container) map[string]string {
 	}
 
 	data := map[string]string{}
-	shared := grant.SharedCPUs().String()
+	shared := p.awakeCPUs(grant.SharedCPUs()).String()
 	isolated := grant.ExclusiveCPUs().Intersection(grant.GetNode().GetCPU().IsolatedCPUs())
 	exclusive := grant.ExclusiveCPUs().Difference(isolated).String()
 
@@ -243,13 +294,20 @@ func (p *policy) ExportResourceData(c cache.Container) map[string]string {
 
 // Introspect provides data for external introspection.
 func (p *policy) Introspect(state *introspect.State) {
+	idle := cpuset.NewCPUSet()
+	for _, g := range p.allocations.CPU {
+		idle = idle.Union(g.IdleCPUs())
+	}
+
 	pools := make(map[string]*introspect.Pool, len(p.pools))
 	for _, node := range p.nodes {
 		cpus := node.GetCPU()
+		all := cpus.SharableCPUs().Union(cpus.IsolatedCPUs())
 		pool := &introspect.Pool{
-			Name:   node.Name(),
-			CPUs:   cpus.SharableCPUs().Union(cpus.IsolatedCPUs()).String(),
-			Memory: node.GetMemset().String(),
+			Name:     node.Name(),
+			CPUs:     all.String(),
+			IdleCPUs: idle.Intersection(all).String(),
+			Memory:   node.GetMemset().String(),
 		}
 		if parent := node.Parent(); !parent.IsNil() {
 			pool.Parent = parent.Name()
@@ -270,8 +328,12 @@ func (p *policy) Introspect(state *introspect.State) {
 			ContainerID:   g.GetContainer().GetID(),
 			CPUShare:      g.SharedPortion(),
 			ExclusiveCPUs: g.ExclusiveCPUs().Union(g.IsolatedCPUs()).String(),
+			IdleCPUs:      g.IdleCPUs().String(),
 			Pool:          g.GetNode().Name(),
 		}
+		if !g.GetNode().IsRootNode() && opt.PinMemory {
+			a.Memory = g.Memset().String()
+		}
 		if g.SharedPortion() > 0 || a.ExclusiveCPUs == "" {
 			a.SharedCPUs = g.SharedCPUs().String()
 		}
@@ -282,10 +344,21 @@ func (p *policy) Introspect(state *introspect.State) {
 
 func (p *policy) configNotify(event config.Event, source config.Source) error {
 	log.Info("configuration %s:", event)
+
+	if err := checkPowerSavingOptions(opt); err != nil {
+		log.Error("invalid configuration: %v", err)
+		return err
+	}
+
 	log.Info("  - pin containers to CPUs: %v", opt.PinCPU)
 	log.Info("  - pin containers to memory: %v", opt.PinMemory)
 	log.Info("  - prefer isolated CPUs: %v", opt.PreferIsolated)
 	log.Info("  - prefer shared CPUs: %v", opt.PreferShared)
+	log.Info("  - strict SMT isolation: %v", opt.StrictSMTIsolation)
+	log.Info("  - park idle siblings: %v", opt.ParkIdleSiblings)
+	log.Info("  - sticky allocation period: %s", opt.StickyAllocationPeriod.String())
+	log.Info("  - power saving: %q (load %d%% - %d%%)", opt.PowerSaving,
+		opt.PowerSavingLowLoad, opt.PowerSavingHighLoad)
 
 	// TODO: We probably should release and reallocate resources for all containers
 	//   to honor the latest configuration. Depending on the changes that might be
@@ -347,6 +420,9 @@ func (p *policy) restoreCache() error {
 		p.saveAllocations()
 	} else {
 		p.allocations.Dump(log.Info, "restored ")
+		for _, grant := range p.allocations.CPU {
+			p.parkIdleSiblings(grant)
+		}
 	}
 
 	return nil
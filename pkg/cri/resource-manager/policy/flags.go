@@ -41,8 +41,27 @@ type options struct {
 	Available ConstraintSet `json:"AvailableResources,omitempty"`
 	// Reserved hardware resources, for system and kube tasks.
 	Reserved ConstraintSet `json:"ReservedResources,omitempty"`
+	// NoisyNeighbor configures detection and RDT demotion of noisy neighbors.
+	NoisyNeighbor noisyNeighborOptions `json:"NoisyNeighbor,omitempty"`
 }
 
+// noisyNeighborOptions captures the configurable parameters of noisy neighbor detection.
+type noisyNeighborOptions struct {
+	// Interval is the sampling interval, 0 disables detection.
+	Interval config.Duration `json:"Interval,omitempty"`
+	// Window is the number of samples averaged before demoting or promoting.
+	Window int `json:"Window,omitempty"`
+	// LLCOccupancy is the LLC occupancy threshold in bytes, 0 for no threshold.
+	LLCOccupancy uint64 `json:"LLCOccupancy,omitempty"`
+	// Bandwidth is the memory bandwidth threshold in MBps, 0 for no threshold.
+	Bandwidth uint64 `json:"Bandwidth,omitempty"`
+	// RestrictedClass is the RDT class noisy containers are demoted to.
+	RestrictedClass string `json:"RestrictedClass,omitempty"`
+}
+
+// configModule is the name of our configuration module.
+const configModule = "policy"
+
 // Our runtime configuration.
 var opt = defaultOptions().(*options)
 
@@ -174,10 +193,13 @@ func defaultOptions() interface{} {
 		Policy:    NullPolicy,
 		Available: ConstraintSet{},
 		Reserved:  ConstraintSet{},
+		NoisyNeighbor: noisyNeighborOptions{
+			Window: 5,
+		},
 	}
 }
 
 // Register us for configuration handling.
 func init() {
-	config.Register("policy", "Generic policy layer.", opt, defaultOptions)
+	config.Register(configModule, "Generic policy layer.", opt, defaultOptions)
 }
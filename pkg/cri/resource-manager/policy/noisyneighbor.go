@@ -0,0 +1,361 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
+	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/introspect"
+	"github.com/intel/cri-resource-manager/pkg/rdt"
+)
+
+const (
+	// NoisyNeighborSource is the source of noisy neighbor policy events.
+	NoisyNeighborSource = "noisy-neighbor"
+	// NoisyNeighborDemote is the event for demoting a container to the restricted RDT class.
+	NoisyNeighborDemote = "rdt-demote"
+	// NoisyNeighborPromote is the event for restoring the RDT class of a demoted container.
+	NoisyNeighborPromote = "rdt-promote"
+
+	// llcOccupancy is the monitoring feature for measuring LLC occupancy.
+	llcOccupancy = "llc_occupancy"
+	// mbmTotalBytes is the monitoring feature for measuring memory bandwidth.
+	mbmTotalBytes = "mbm_total_bytes"
+	// noisyNeighborHysteresis is the fraction of the thresholds a demoted
+	// container must stay below before it gets promoted back.
+	noisyNeighborHysteresis = 0.8
+	// maxNoisyNeighborTransitions is the number of transitions kept for introspection.
+	maxNoisyNeighborTransitions = 64
+)
+
+// NoisyNeighborEvent is the data of noisy neighbor policy events.
+type NoisyNeighborEvent struct {
+	// ContainerID is the ID of the container to demote or promote.
+	ContainerID string
+	// LLCOccupancy is the average LLC occupancy of the container in bytes.
+	LLCOccupancy uint64
+	// Bandwidth is the average memory bandwidth of the container in MBps.
+	Bandwidth uint64
+}
+
+// noisyNeighbor detects containers using excessive cache or memory bandwidth.
+type noisyNeighbor struct {
+	sync.Mutex
+	conf        noisyNeighborOptions
+	sendEvent   SendEventFn
+	stop        chan struct{}
+	history     map[string]*usageHistory    // per class/container usage samples
+	demoted     map[string]struct{}         // containers currently demoted
+	transitions []*introspect.RDTTransition // recent transitions
+}
+
+// usageHistory is the recent usage of a single container.
+type usageHistory struct {
+	time  time.Time // time of the last sample
+	bytes uint64    // last mbm_total_bytes reading
+	llc   []uint64  // LLC occupancy samples
+	bw    []uint64  // memory bandwidth samples
+}
+
+// newNoisyNeighbor creates a new noisy neighbor detector.
+func newNoisyNeighbor(sendEvent SendEventFn) *noisyNeighbor {
+	return &noisyNeighbor{
+		sendEvent: sendEvent,
+		history:   make(map[string]*usageHistory),
+		demoted:   make(map[string]struct{}),
+	}
+}
+
+// start starts noisy neighbor detection if it is configured.
+func (n *noisyNeighbor) start(containers []cache.Container) {
+	n.stopDetection()
+
+	n.Lock()
+	defer n.Unlock()
+
+	n.conf = opt.NoisyNeighbor
+	n.history = make(map[string]*usageHistory)
+	n.demoted = make(map[string]struct{})
+	for _, c := range containers {
+		if _, ok := c.GetRDTRestriction(); ok {
+			n.demoted[c.GetID()] = struct{}{}
+		}
+	}
+
+	switch {
+	case n.conf.Interval <= 0:
+		return
+	case n.sendEvent == nil:
+		log.Warn("noisy neighbor detection disabled: no event delivery")
+		return
+	case n.conf.RestrictedClass == "":
+		log.Warn("noisy neighbor detection disabled: no restricted RDT class")
+		return
+	case n.conf.LLCOccupancy == 0 && n.conf.Bandwidth == 0:
+		log.Warn("noisy neighbor detection disabled: no thresholds")
+		return
+	case !rdt.MonSupported():
+		log.Warn("noisy neighbor detection disabled: RDT monitoring not supported")
+		return
+	}
+	if _, ok := rdt.GetClass(n.conf.RestrictedClass); !ok {
+		log.Warn("noisy neighbor detection disabled: unknown RDT class %q", n.conf.RestrictedClass)
+		return
+	}
+	if n.conf.Window < 1 {
+		n.conf.Window = 1
+	}
+
+	log.Info("starting noisy neighbor detection (LLC %d bytes, bandwidth %d MBps, class %q)",
+		n.conf.LLCOccupancy, n.conf.Bandwidth, n.conf.RestrictedClass)
+
+	stop := make(chan struct{})
+	n.stop = stop
+	interval := time.Duration(n.conf.Interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case _ = <-stop:
+				return
+			case _ = <-ticker.C:
+				n.update()
+			}
+		}
+	}()
+}
+
+// stopDetection stops noisy neighbor detection, if running.
+func (n *noisyNeighbor) stopDetection() {
+	n.Lock()
+	defer n.Unlock()
+	if n.stop != nil {
+		close(n.stop)
+		n.stop = nil
+	}
+}
+
+// update takes a new sample of all monitored containers and sends events for transitions.
+func (n *noisyNeighbor) update() {
+	n.Lock()
+	now := time.Now()
+	seen := make(map[string]struct{})
+	pending := []*events.Policy{}
+
+	for _, cls := range rdt.GetClasses() {
+		restricted := cls.Name() == n.conf.RestrictedClass
+		for _, mg := range cls.GetMonGroups() {
+			id := mg.Name()
+			key := cls.Name() + "/" + id
+			seen[id] = struct{}{}
+			seen[key] = struct{}{}
+			if e := n.sample(key, id, restricted, now, mg.GetMonData()); e != nil {
+				pending = append(pending, e)
+			}
+		}
+	}
+	for key := range n.history {
+		if _, ok := seen[key]; !ok {
+			delete(n.history, key)
+		}
+	}
+	// Forget demoted containers which are gone.
+	for id := range n.demoted {
+		if _, ok := seen[id]; !ok {
+			delete(n.demoted, id)
+		}
+	}
+	n.Unlock()
+
+	for _, e := range pending {
+		if err := n.sendEvent(e); err != nil {
+			log.Error("failed to send %s.%s event: %v", e.Source, e.Type, err)
+		}
+	}
+}
+
+// sample records the usage of a container in a class, returning an event if it needs a transition.
+func (n *noisyNeighbor) sample(key, id string, restricted bool, now time.Time, data rdt.MonData) *events.Policy {
+	llc, bytes := uint64(0), uint64(0)
+	for _, leaf := range data.L3 {
+		llc += leaf[llcOccupancy]
+		bytes += leaf[mbmTotalBytes]
+	}
+
+	h, ok := n.history[key]
+	if !ok {
+		n.history[key] = &usageHistory{time: now, bytes: bytes}
+		return nil
+	}
+
+	seconds := now.Sub(h.time).Seconds()
+	if seconds <= 0 || bytes < h.bytes {
+		// Counters were reset, for instance by moving to another class.
+		h.time, h.bytes = now, bytes
+		return nil
+	}
+	bw := uint64(float64(bytes-h.bytes) / seconds / (1024 * 1024))
+	h.time, h.bytes = now, bytes
+
+	h.llc = append(h.llc, llc)
+	h.bw = append(h.bw, bw)
+	if len(h.llc) > n.conf.Window {
+		h.llc = h.llc[len(h.llc)-n.conf.Window:]
+		h.bw = h.bw[len(h.bw)-n.conf.Window:]
+	}
+	if len(h.llc) < n.conf.Window {
+		return nil
+	}
+
+	avgLLC, avgBw := average(h.llc), average(h.bw)
+	_, demoted := n.demoted[id]
+	if demoted != restricted {
+		// Stale group in a class the container is no longer assigned to.
+		return nil
+	}
+
+	var event string
+	switch {
+	case !demoted && n.exceeds(avgLLC, avgBw, 1.0):
+		event = NoisyNeighborDemote
+		n.demoted[id] = struct{}{}
+	case demoted && !n.exceeds(avgLLC, avgBw, noisyNeighborHysteresis):
+		event = NoisyNeighborPromote
+		delete(n.demoted, id)
+	default:
+		return nil
+	}
+
+	// Start collecting a full new window after each transition.
+	h.llc, h.bw = nil, nil
+
+	return &events.Policy{
+		Type:   event,
+		Source: NoisyNeighborSource,
+		Data: &NoisyNeighborEvent{
+			ContainerID:  id,
+			LLCOccupancy: avgLLC,
+			Bandwidth:    avgBw,
+		},
+	}
+}
+
+// exceeds checks if usage exceeds the given fraction of any configured threshold.
+func (n *noisyNeighbor) exceeds(llc, bw uint64, fraction float64) bool {
+	if n.conf.LLCOccupancy > 0 && float64(llc) > fraction*float64(n.conf.LLCOccupancy) {
+		return true
+	}
+	if n.conf.Bandwidth > 0 && float64(bw) > fraction*float64(n.conf.Bandwidth) {
+		return true
+	}
+	return false
+}
+
+// forget drops all state of a container.
+func (n *noisyNeighbor) forget(id string) {
+	n.Lock()
+	defer n.Unlock()
+	for key := range n.history {
+		if strings.HasSuffix(key, "/"+id) {
+			delete(n.history, key)
+		}
+	}
+	delete(n.demoted, id)
+}
+
+// record records a transition for introspection.
+func (n *noisyNeighbor) record(t *introspect.RDTTransition) {
+	n.Lock()
+	defer n.Unlock()
+	n.transitions = append(n.transitions, t)
+	if len(n.transitions) > maxNoisyNeighborTransitions {
+		n.transitions = n.transitions[len(n.transitions)-maxNoisyNeighborTransitions:]
+	}
+}
+
+// getTransitions returns the recorded transitions.
+func (n *noisyNeighbor) getTransitions() []*introspect.RDTTransition {
+	n.Lock()
+	defer n.Unlock()
+	transitions := make([]*introspect.RDTTransition, len(n.transitions))
+	copy(transitions, n.transitions)
+	return transitions
+}
+
+// handleNoisyNeighborEvent demotes or promotes a container as requested by the event.
+func (p *policy) handleNoisyNeighborEvent(e *events.Policy) (bool, error) {
+	data, ok := e.Data.(*NoisyNeighborEvent)
+	if !ok {
+		return false, policyError("invalid %s.%s event data %T", e.Source, e.Type, e.Data)
+	}
+
+	c, ok := p.cache.LookupContainer(data.ContainerID)
+	if !ok {
+		log.Warn("%s.%s: container %s not found", e.Source, e.Type, data.ContainerID)
+		p.noisy.forget(data.ContainerID)
+		return false, nil
+	}
+
+	from := c.GetRDTClass()
+	_, demoted := c.GetRDTRestriction()
+
+	switch e.Type {
+	case NoisyNeighborDemote:
+		if demoted {
+			return false, nil
+		}
+		c.SetRDTRestriction(opt.NoisyNeighbor.RestrictedClass)
+	case NoisyNeighborPromote:
+		if !demoted {
+			return false, nil
+		}
+		c.SetRDTRestriction("")
+	default:
+		return false, policyError("unknown %s event type %q", e.Source, e.Type)
+	}
+
+	to := c.GetRDTClass()
+	log.Info("%s: %s from RDT class %q to %q (LLC occupancy %d bytes, bandwidth %d MBps)",
+		c.PrettyName(), e.Type, from, to, data.LLCOccupancy, data.Bandwidth)
+
+	p.noisy.record(&introspect.RDTTransition{
+		Time:         time.Now().Format(time.RFC3339),
+		ContainerID:  c.GetID(),
+		Type:         e.Type,
+		FromClass:    from,
+		ToClass:      to,
+		LLCOccupancy: data.LLCOccupancy,
+		Bandwidth:    data.Bandwidth,
+	})
+
+	return true, nil
+}
+
+// average returns the average of the given samples.
+func average(samples []uint64) uint64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := uint64(0)
+	for _, s := range samples {
+		sum += s
+	}
+	return sum / uint64(len(samples))
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 Intel Corporation. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intel/cri-resource-manager/pkg/rdt"
+)
+
+func TestAverage(t *testing.T) {
+	tcases := []struct {
+		name     string
+		samples  []uint64
+		expected uint64
+	}{
+		{name: "no samples", samples: nil, expected: 0},
+		{name: "single sample", samples: []uint64{7}, expected: 7},
+		{name: "even average", samples: []uint64{2, 4, 6}, expected: 4},
+		{name: "rounded down", samples: []uint64{1, 2}, expected: 1},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if avg := average(tc.samples); avg != tc.expected {
+				t.Errorf("expected average %d, got %d", tc.expected, avg)
+			}
+		})
+	}
+}
+
+func TestExceeds(t *testing.T) {
+	tcases := []struct {
+		name     string
+		conf     noisyNeighborOptions
+		llc      uint64
+		bw       uint64
+		fraction float64
+		expected bool
+	}{
+		{
+			name:     "no thresholds",
+			llc:      1 << 30,
+			bw:       1 << 20,
+			fraction: 1.0,
+		},
+		{
+			name:     "below LLC threshold",
+			conf:     noisyNeighborOptions{LLCOccupancy: 1000},
+			llc:      1000,
+			fraction: 1.0,
+		},
+		{
+			name:     "above LLC threshold",
+			conf:     noisyNeighborOptions{LLCOccupancy: 1000},
+			llc:      1001,
+			fraction: 1.0,
+			expected: true,
+		},
+		{
+			name:     "above bandwidth threshold",
+			conf:     noisyNeighborOptions{LLCOccupancy: 1000, Bandwidth: 100},
+			llc:      10,
+			bw:       101,
+			fraction: 1.0,
+			expected: true,
+		},
+		{
+			name:     "above fraction of bandwidth threshold",
+			conf:     noisyNeighborOptions{Bandwidth: 100},
+			bw:       81,
+			fraction: noisyNeighborHysteresis,
+			expected: true,
+		},
+		{
+			name:     "below fraction of bandwidth threshold",
+			conf:     noisyNeighborOptions{Bandwidth: 100},
+			bw:       80,
+			fraction: noisyNeighborHysteresis,
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newNoisyNeighbor(nil)
+			n.conf = tc.conf
+			if result := n.exceeds(tc.llc, tc.bw, tc.fraction); result != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+// monData returns monitoring data with the given totals split over two cache ids.
+func monData(llc, mbs uint64) rdt.MonData {
+	bytes := mbs * 1024 * 1024
+	return rdt.MonData{
+		L3: rdt.MonL3Data{
+			0: rdt.MonLeafData{llcOccupancy: llc / 2, mbmTotalBytes: bytes / 2},
+			1: rdt.MonLeafData{llcOccupancy: llc - llc/2, mbmTotalBytes: bytes - bytes/2},
+		},
+	}
+}
+
+func TestSample(t *testing.T) {
+	type sample struct {
+		llc   uint64 // LLC occupancy
+		mbs   uint64 // total MBs transferred so far
+		event string // expected event, if any
+	}
+	tcases := []struct {
+		name       string
+		conf       noisyNeighborOptions
+		demoted    bool
+		restricted bool
+		samples    []sample
+	}{
+		{
+			name: "demote after a full window",
+			conf: noisyNeighborOptions{Window: 2, LLCOccupancy: 1000},
+			samples: []sample{
+				{llc: 2000},
+				{llc: 2000},
+				{llc: 2000, event: NoisyNeighborDemote},
+			},
+		},
+		{
+			name: "short spike averaged out",
+			conf: noisyNeighborOptions{Window: 2, LLCOccupancy: 1000},
+			samples: []sample{
+				{llc: 100},
+				{llc: 1500},
+				{llc: 100},
+				{llc: 1500},
+			},
+		},
+		{
+			name: "demote on bandwidth",
+			conf: noisyNeighborOptions{Window: 1, Bandwidth: 100},
+			samples: []sample{
+				{mbs: 0},
+				{mbs: 50},
+				{mbs: 250, event: NoisyNeighborDemote},
+			},
+		},
+		{
+			name:       "promote only below hysteresis",
+			conf:       noisyNeighborOptions{Window: 1, Bandwidth: 100},
+			demoted:    true,
+			restricted: true,
+			samples: []sample{
+				{mbs: 0},
+				{mbs: 90},
+				{mbs: 180},
+				{mbs: 250, event: NoisyNeighborPromote},
+			},
+		},
+		{
+			name:    "ignore stale group of demoted container",
+			conf:    noisyNeighborOptions{Window: 1, Bandwidth: 100},
+			demoted: true,
+			samples: []sample{
+				{mbs: 0},
+				{mbs: 10},
+			},
+		},
+		{
+			name: "counter reset restarts sampling",
+			conf: noisyNeighborOptions{Window: 1, Bandwidth: 100},
+			samples: []sample{
+				{mbs: 1000},
+				{mbs: 0},
+				{mbs: 50},
+			},
+		},
+	}
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newNoisyNeighbor(nil)
+			n.conf = tc.conf
+			if tc.demoted {
+				n.demoted["id"] = struct{}{}
+			}
+			now := time.Now()
+			for i, s := range tc.samples {
+				e := n.sample("class/id", "id", tc.restricted, now, monData(s.llc, s.mbs))
+				switch {
+				case e == nil && s.event != "":
+					t.Errorf("sample #%d: expected %s event, got none", i, s.event)
+				case e != nil && e.Type != s.event:
+					t.Errorf("sample #%d: expected event %q, got %q", i, s.event, e.Type)
+				}
+				now = now.Add(time.Second)
+			}
+		})
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 
 	"github.com/intel/cri-resource-manager/pkg/blockio"
+	"github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/agent"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/cache"
 	"github.com/intel/cri-resource-manager/pkg/cri/resource-manager/events"
@@ -162,6 +163,7 @@ type policy struct {
 	system    system.System      // system/HW/topology info
 	inspsys   *introspect.System // ditto for introspection
 	sendEvent SendEventFn        // function to send event up to the resource manager
+	noisy     *noisyNeighbor     // noisy neighbor detection
 }
 
 // backend is a registered Backend.
@@ -190,9 +192,11 @@ func NewPolicy(cache cache.Cache, o *Options) (Policy, error) {
 	}
 
 	p := &policy{
-		cache:   cache,
-		system:  sys,
-		options: *o,
+		cache:     cache,
+		system:    sys,
+		options:   *o,
+		sendEvent: o.SendEvent,
+		noisy:     newNoisyNeighbor(o.SendEvent),
 	}
 
 	if opt.Policy == NullPolicy {
@@ -234,18 +238,34 @@ func NewPolicy(cache cache.Cache, o *Options) (Policy, error) {
 		p.active = active.create(backendOpts)
 	}
 
+	config.GetModule(configModule).AddNotify(p.configNotify)
+
 	return p, nil
 }
 
 // Start starts up policy, preparing it for resving requests.
 func (p *policy) Start(add []cache.Container, del []cache.Container) error {
+	p.noisy.start(p.cache.GetContainers())
+
 	if p.Bypassed() {
 		log.Info("policy '%s' active, nothing to start...", opt.Policy)
 		return nil
 	}
 
 	log.Info("starting policy '%s'...", p.active.Name())
-	return p.active.Start(add, del)
+	if err := p.active.Start(add, del); err != nil {
+		return err
+	}
+
+	p.tagExclusiveCPUs()
+	return nil
+}
+
+// configNotify restarts noisy neighbor detection with the updated configuration.
+func (p *policy) configNotify(event config.Event, source config.Source) error {
+	log.Info("configuration %s", event)
+	p.noisy.start(p.cache.GetContainers())
+	return nil
 }
 
 func (p *policy) Bypassed() bool {
@@ -254,35 +274,72 @@ func (p *policy) Bypassed() bool {
 
 // Sync synchronizes the active policy state.
 func (p *policy) Sync(add []cache.Container, del []cache.Container) error {
-	return p.active.Sync(add, del)
+	if err := p.active.Sync(add, del); err != nil {
+		return err
+	}
+	for _, c := range del {
+		c.DeleteTag(cache.TagExclusiveCPUs)
+	}
+	p.tagExclusiveCPUs()
+	return nil
 }
 
 // AllocateResources allocates resources for a container.
 func (p *policy) AllocateResources(c cache.Container) error {
-	return p.active.AllocateResources(c)
+	if err := p.active.AllocateResources(c); err != nil {
+		return err
+	}
+	p.tagExclusiveCPUs()
+	return nil
 }
 
 // ReleaseResources release resources of a container.
 func (p *policy) ReleaseResources(c cache.Container) error {
-	return p.active.ReleaseResources(c)
+	if err := p.active.ReleaseResources(c); err != nil {
+		return err
+	}
+	c.DeleteTag(cache.TagExclusiveCPUs)
+	p.noisy.forget(c.GetID())
+	p.tagExclusiveCPUs()
+	return nil
 }
 
 // UpdateResources updates resource allocations of a container.
 func (p *policy) UpdateResources(c cache.Container) error {
-	return p.active.UpdateResources(c)
+	if err := p.active.UpdateResources(c); err != nil {
+		return err
+	}
+	p.tagExclusiveCPUs()
+	return nil
 }
 
 // Rebalance tries to find a more optimal allocation of resources for the current containers.
 func (p *policy) Rebalance() (bool, error) {
-	return p.active.Rebalance()
+	changes, err := p.active.Rebalance()
+	if changes {
+		p.tagExclusiveCPUs()
+	}
+	return changes, err
 }
 
 // HandleEvent passes on the given event to the active policy.
 func (p *policy) HandleEvent(e *events.Policy) (bool, error) {
+	noisy := false
+	if e.Source == NoisyNeighborSource {
+		changes, err := p.handleNoisyNeighborEvent(e)
+		if err != nil {
+			return changes, err
+		}
+		noisy = changes
+	}
 	if !p.Bypassed() {
-		return p.active.HandleEvent(e)
+		changes, err := p.active.HandleEvent(e)
+		if changes {
+			p.tagExclusiveCPUs()
+		}
+		return changes || noisy, err
 	}
-	return false, nil
+	return noisy, nil
 }
 
 // ExportResourceData exports/updates resource data for the container.
@@ -335,6 +392,8 @@ func (p *policy) Introspect() *introspect.State {
 				Args:    c.GetArgs(),
 				Hints:   introspect.TopologyHints(c.GetTopologyHints()),
 			}
+			container.RDTClass = c.GetRDTClass()
+			_, container.RDTRestricted = c.GetRDTRestriction()
 			resources := c.GetResourceRequirements()
 			if req, ok := resources.Requests[corev1.ResourceCPU]; ok {
 				if value := req.MilliValue(); value > 0 {
@@ -391,6 +450,7 @@ func (p *policy) Introspect() *introspect.State {
 	p.inspsys.Policy = opt.Policy
 
 	state.System = p.inspsys
+	state.Transitions = p.noisy.getTransitions()
 	if !p.Bypassed() {
 		p.active.Introspect(state)
 	}
@@ -398,6 +458,37 @@ func (p *policy) Introspect() *introspect.State {
 	return state
 }
 
+// tagExclusiveCPUs updates the exclusive CPU tags of all containers with pending changes.
+func (p *policy) tagExclusiveCPUs() {
+	for _, c := range p.cache.GetPendingContainers() {
+		switch c.GetState() {
+		case cache.ContainerStateCreating, cache.ContainerStateCreated, cache.ContainerStateRunning:
+		default:
+			continue
+		}
+
+		data := p.active.ExportResourceData(c)
+		cpus := cpuset.NewCPUSet()
+		for _, key := range []string{ExportExclusiveCPUs, ExportIsolatedCPUs} {
+			if value, ok := data[key]; ok {
+				cset, err := cpuset.Parse(value)
+				if err != nil {
+					log.Error("container %s: invalid exported %s %q: %v",
+						c.PrettyName(), key, value, err)
+					continue
+				}
+				cpus = cpus.Union(cset)
+			}
+		}
+
+		if cpus.IsEmpty() {
+			c.DeleteTag(cache.TagExclusiveCPUs)
+		} else {
+			c.SetTag(cache.TagExclusiveCPUs, cpus.String())
+		}
+	}
+}
+
 // Register registers a policy backend.
 func Register(name, description string, create CreateFn) error {
 	log.Info("registering policy '%s'...", name)
@@ -30,11 +30,15 @@ import (
 
 // options represents the raw RDT configuration data from the configmap
 type options struct {
-	Options    schemaOptions `json:"options"`
-	Partitions map[string]struct {
+	Options          schemaOptions    `json:"options"`
+	DynamicClasses   dynamicOptions   `json:"dynamicClasses"`
+	BandwidthControl bandwidthOptions `json:"bandwidthControl"`
+	Partitions       map[string]struct {
+		L2Allocation rawAllocations `json:"l2Allocation"`
 		L3Allocation rawAllocations `json:"l3Allocation"`
 		MBAllocation rawAllocations `json:"mbAllocation"`
 		Classes      map[string]struct {
+			L2Schema rawAllocations `json:"l2Schema"`
 			L3Schema rawAllocations `json:"l3Schema"`
 			MBSchema rawAllocations `json:"mbSchema"`
 		} `json:"classes"`
@@ -51,6 +55,8 @@ type config struct {
 	Options    schemaOptions
 	Partitions partitionSet
 	Classes    classSet
+	Dynamic    dynamicOptions
+	Bandwidth  bandwidthOptions
 }
 
 // partitionSet represents the pool of rdt partitions
@@ -61,7 +67,8 @@ type classSet map[string]classConfig
 
 // partitionConfig is the final configuration of one partition
 type partitionConfig struct {
-	L3 l3Schema
+	L2 catSchema
+	L3 catSchema
 	MB mbSchema
 }
 
@@ -69,18 +76,20 @@ type partitionConfig struct {
 // the Linux resctrl interface
 type classConfig struct {
 	Partition string
-	L3Schema  l3Schema
+	L2Schema  catSchema
+	L3Schema  catSchema
 	MBSchema  mbSchema
 }
 
 // schemaOptions contains the common settings for all classes
 type schemaOptions struct {
-	L3 l3Options `json:"l3"`
-	MB mbOptions `json:"mb"`
+	L2 catOptions `json:"l2"`
+	L3 catOptions `json:"l3"`
+	MB mbOptions  `json:"mb"`
 }
 
-// l3Options contains the common settings for L3 cache allocation
-type l3Options struct {
+// catOptions contains the common settings for L2 or L3 cache allocation
+type catOptions struct {
 	Optional bool
 }
 
@@ -89,14 +98,54 @@ type mbOptions struct {
 	Optional bool
 }
 
-// l3Schema represents the L3 part of the schemata of a class (i.e. resctrl group)
-type l3Schema map[uint64]l3Allocation
+// dynamicOptions contains the settings for dynamically created per-container classes
+type dynamicOptions struct {
+	// Partition to carve the L3 allocations of dynamic classes from
+	Partition string `json:"partition"`
+	// Classes whose containers get a dynamic class instead
+	Classes []string `json:"classes"`
+	// FallbackClass to use when no dynamic class can be created
+	FallbackClass string `json:"fallbackClass"`
+	// MaxClasses limits the number of dynamic classes, 0 for no limit
+	MaxClasses int `json:"maxClasses"`
+}
+
+// bandwidthOptions contains the settings for closed-loop memory bandwidth control
+type bandwidthOptions struct {
+	// Interval between adjustments, 0 disables bandwidth control
+	Interval pkgcfg.Duration `json:"interval"`
+	// Capacity is the total memory bandwidth (MBps) of one cache id
+	Capacity uint64 `json:"capacity"`
+	// Budget is the bandwidth (MBps) per cache id kept for the priority classes
+	Budget uint64 `json:"budget"`
+	// PriorityClasses are the classes to keep the bandwidth budget for
+	PriorityClasses []string `json:"priorityClasses"`
+	// ThrottledClasses are the classes with adjusted memory bandwidth allocation
+	ThrottledClasses []string `json:"throttledClasses"`
+	// Step is the percentage by which allocations are adjusted at a time
+	Step uint64 `json:"step"`
+	// Min is the lowest percentage throttled classes are adjusted to
+	Min uint64 `json:"min"`
+}
+
+// cacheLevel is the level (L2 or L3) of cache allocation
+type cacheLevel string
+
+const (
+	// cacheLevelL2 is the L2 cache
+	cacheLevelL2 cacheLevel = "L2"
+	// cacheLevelL3 is the L3 cache
+	cacheLevelL3 cacheLevel = "L3"
+)
+
+// catSchema represents the L2 or L3 part of the schemata of a class (i.e. resctrl group)
+type catSchema map[uint64]catAllocation
 
 // mbSchema represents the MB part of the schemata of a class (i.e. resctrl group)
 type mbSchema map[uint64]uint64
 
-// l3Allocation describes the L3 allocation configuration for one cache id
-type l3Allocation struct {
+// catAllocation describes the cache allocation configuration for one cache id
+type catAllocation struct {
 	Unified cacheAllocation
 	Code    cacheAllocation `json:",omitempty"`
 	Data    cacheAllocation `json:",omitempty"`
@@ -105,37 +154,37 @@ type l3Allocation struct {
 // cacheAllocation is the basic interface for handling cache allocations of one
 // type (unified, code, data)
 type cacheAllocation interface {
-	Overlay(Bitmask) (Bitmask, error)
+	Overlay(baseMask Bitmask, minBits uint64) (Bitmask, error)
 }
 
-// l3AbsoluteAllocation represents an explicitly specified cache allocation
+// catAbsoluteAllocation represents an explicitly specified cache allocation
 // bitmask
-type l3AbsoluteAllocation Bitmask
+type catAbsoluteAllocation Bitmask
 
-// l3PctAllocation represents a relative (percentage) share of the available
+// catPctAllocation represents a relative (percentage) share of the available
 // bitmask
-type l3PctAllocation uint64
+type catPctAllocation uint64
 
-// l3PctRangeAllocation represents a percentage range of the available bitmask
-type l3PctRangeAllocation struct {
+// catPctRangeAllocation represents a percentage range of the available bitmask
+type catPctRangeAllocation struct {
 	lowPct  uint64
 	highPct uint64
 }
 
-// L3SchemaType represents different L3 cache allocation schemes
-type l3SchemaType string
+// catSchemaType represents different cache allocation schemes
+type catSchemaType string
 
 const (
-	// l3SchemaTypeUnified is the schema type when CDP is not enabled
-	l3SchemaTypeUnified l3SchemaType = "unified"
-	// l3SchemaTypeCode is the 'code' part of CDP schema
-	l3SchemaTypeCode l3SchemaType = "code"
-	// l3SchemaTypeData is the 'data' part of CDP schema
-	l3SchemaTypeData l3SchemaType = "data"
+	// catSchemaTypeUnified is the schema type when CDP is not enabled
+	catSchemaTypeUnified catSchemaType = "unified"
+	// catSchemaTypeCode is the 'code' part of CDP schema
+	catSchemaTypeCode catSchemaType = "code"
+	// catSchemaTypeData is the 'data' part of CDP schema
+	catSchemaTypeData catSchemaType = "data"
 )
 
-func (t l3SchemaType) ToResctrlStr() string {
-	if t == l3SchemaTypeUnified {
+func (t catSchemaType) ToResctrlStr() string {
+	if t == catSchemaTypeUnified {
 		return ""
 	}
 	return strings.ToUpper(string(t))
@@ -146,10 +195,10 @@ const (
 	mbSuffixMbps = "MBps"
 )
 
-// ToStr returns the L3 schema in a format accepted by the Linux kernel
+// ToStr returns the L2 or L3 schema in a format accepted by the Linux kernel
 // resctrl (schemata) interface
-func (s l3Schema) ToStr(typ l3SchemaType, baseSchema l3Schema) (string, error) {
-	schema := "L3" + typ.ToResctrlStr() + ":"
+func (s catSchema) ToStr(level cacheLevel, typ catSchemaType, baseSchema catSchema) (string, error) {
+	schema := string(level) + typ.ToResctrlStr() + ":"
 	sep := ""
 
 	// Get a sorted slice of cache ids for deterministic output
@@ -160,9 +209,9 @@ func (s l3Schema) ToStr(typ l3SchemaType, baseSchema l3Schema) (string, error) {
 	utils.SortUint64s(ids)
 
 	for _, id := range ids {
-		baseMask, ok := baseSchema[id].getEffective(typ).(l3AbsoluteAllocation)
+		baseMask, ok := baseSchema[id].getEffective(typ).(catAbsoluteAllocation)
 		if !ok {
-			return "", fmt.Errorf("BUG: basemask not of type l3AbsoluteAllocation")
+			return "", fmt.Errorf("BUG: basemask not of type catAbsoluteAllocation")
 		}
 		bitmask := Bitmask(baseMask)
 
@@ -172,7 +221,7 @@ func (s l3Schema) ToStr(typ l3SchemaType, baseSchema l3Schema) (string, error) {
 			masks := s[id]
 			overlayMask := masks.getEffective(typ)
 
-			bitmask, err = overlayMask.Overlay(bitmask)
+			bitmask, err = overlayMask.Overlay(bitmask, rdt.info.minCbmBits(level))
 			if err != nil {
 				return "", err
 			}
@@ -184,21 +233,21 @@ func (s l3Schema) ToStr(typ l3SchemaType, baseSchema l3Schema) (string, error) {
 	return schema + "\n", nil
 }
 
-func (a l3Allocation) get(typ l3SchemaType) cacheAllocation {
+func (a catAllocation) get(typ catSchemaType) cacheAllocation {
 	switch typ {
-	case l3SchemaTypeCode:
+	case catSchemaTypeCode:
 		return a.Code
-	case l3SchemaTypeData:
+	case catSchemaTypeData:
 		return a.Data
 	}
 	return a.Unified
 }
 
-func (a l3Allocation) set(typ l3SchemaType, v cacheAllocation) l3Allocation {
+func (a catAllocation) set(typ catSchemaType, v cacheAllocation) catAllocation {
 	switch typ {
-	case l3SchemaTypeCode:
+	case catSchemaTypeCode:
 		a.Code = v
-	case l3SchemaTypeData:
+	case catSchemaTypeData:
 		a.Data = v
 	}
 	a.Unified = v
@@ -206,13 +255,13 @@ func (a l3Allocation) set(typ l3SchemaType, v cacheAllocation) l3Allocation {
 	return a
 }
 
-func (a l3Allocation) getEffective(typ l3SchemaType) cacheAllocation {
+func (a catAllocation) getEffective(typ catSchemaType) cacheAllocation {
 	switch typ {
-	case l3SchemaTypeCode:
+	case catSchemaTypeCode:
 		if a.Code != nil {
 			return a.Code
 		}
-	case l3SchemaTypeData:
+	case catSchemaTypeData:
 		if a.Data != nil {
 			return a.Data
 		}
@@ -222,7 +271,7 @@ func (a l3Allocation) getEffective(typ l3SchemaType) cacheAllocation {
 }
 
 // Overlay function of the cacheAllocation interface
-func (a l3AbsoluteAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
+func (a catAbsoluteAllocation) Overlay(baseMask Bitmask, minBits uint64) (Bitmask, error) {
 	shiftWidth := baseMask.lsbOne()
 	if shiftWidth < 0 {
 		return 0, rdtError("empty basemask not allowed")
@@ -240,17 +289,17 @@ func (a l3AbsoluteAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
 }
 
 // MarshalJSON implements the Marshaler interface of "encoding/json"
-func (a l3AbsoluteAllocation) MarshalJSON() ([]byte, error) {
+func (a catAbsoluteAllocation) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%#x\"", a)), nil
 }
 
 // Overlay function of the cacheAllocation interface
-func (a l3PctAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
-	return l3PctRangeAllocation{highPct: uint64(a)}.Overlay(baseMask)
+func (a catPctAllocation) Overlay(baseMask Bitmask, minBits uint64) (Bitmask, error) {
+	return catPctRangeAllocation{highPct: uint64(a)}.Overlay(baseMask, minBits)
 }
 
 // Overlay function of the cacheAllocation interface
-func (a l3PctRangeAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
+func (a catPctRangeAllocation) Overlay(baseMask Bitmask, minBits uint64) (Bitmask, error) {
 	baseMaskMsb := uint64(baseMask.msbOne())
 	baseMaskLsb := uint64(baseMask.lsbOne())
 	baseMaskNumBits := baseMaskMsb - baseMaskLsb + 1
@@ -260,8 +309,8 @@ func (a l3PctRangeAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
 	if bits.OnesCount64(uint64(baseMask)) != int(baseMaskNumBits) {
 		return 0, rdtError("invalid basemask %#x: more than one block of bits set", baseMask)
 	}
-	if uint64(bits.OnesCount64(uint64(baseMask))) < rdt.info.l3MinCbmBits() {
-		return 0, rdtError("invalid basemask %#x: fewer than %d bits set", baseMask, rdt.info.l3MinCbmBits())
+	if uint64(bits.OnesCount64(uint64(baseMask))) < minBits {
+		return 0, rdtError("invalid basemask %#x: fewer than %d bits set", baseMask, minBits)
 	}
 
 	low, high := a.lowPct, a.highPct
@@ -280,8 +329,8 @@ func (a l3PctRangeAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
 
 	// Make sure the number of bits set satisfies the minimum requirement
 	numBits := msb - lsb + 1
-	if numBits < rdt.info.l3MinCbmBits() {
-		gap := rdt.info.l3MinCbmBits() - numBits
+	if numBits < minBits {
+		gap := minBits - numBits
 
 		// First, widen the mask from the "lsb end"
 		lsbAvailable := lsb - baseMaskLsb
@@ -292,7 +341,7 @@ func (a l3PctRangeAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
 		}
 		// If needed, widen the mask from the "msb end"
 		numBits = msb - lsb + 1
-		gap = rdt.info.l3MinCbmBits() - numBits
+		gap = minBits - numBits
 		msbAvailable := baseMaskMsb - msb
 		if gap <= msbAvailable {
 			msb += gap
@@ -307,12 +356,12 @@ func (a l3PctRangeAllocation) Overlay(baseMask Bitmask) (Bitmask, error) {
 }
 
 // MarshalJSON implements the Marshaler interface of "encoding/json"
-func (a l3PctAllocation) MarshalJSON() ([]byte, error) {
+func (a catPctAllocation) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%d%%\"", a)), nil
 }
 
 // MarshalJSON implements the Marshaler interface of "encoding/json"
-func (a l3PctRangeAllocation) MarshalJSON() ([]byte, error) {
+func (a catPctRangeAllocation) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%d-%d%%\"", a.lowPct, a.highPct)), nil
 }
 
@@ -417,6 +466,16 @@ func (raw options) resolve() (config, error) {
 		return conf, err
 	}
 
+	conf.Dynamic, err = raw.resolveDynamic(conf)
+	if err != nil {
+		return conf, err
+	}
+
+	conf.Bandwidth, err = raw.resolveBandwidth(conf)
+	if err != nil {
+		return conf, err
+	}
+
 	return conf, nil
 }
 
@@ -426,19 +485,22 @@ func (raw options) resolvePartitions() (partitionSet, error) {
 	// Initialize empty partition configuration
 	conf := make(partitionSet, len(raw.Partitions))
 	numCacheIds := len(rdt.info.cacheIds)
+	numL2CacheIds := len(rdt.info.l2CacheIds)
 	for name := range raw.Partitions {
-		conf[name] = partitionConfig{L3: make(l3Schema, numCacheIds),
+		conf[name] = partitionConfig{L2: make(catSchema, numL2CacheIds),
+			L3: make(catSchema, numCacheIds),
 			MB: make(mbSchema, numCacheIds)}
 	}
 
-	// Try to resolve L3 partition allocations
-	err := raw.resolveL3Partitions(conf)
-	if err != nil {
-		return nil, err
+	// Try to resolve L2 and L3 partition allocations
+	for _, level := range []cacheLevel{cacheLevelL2, cacheLevelL3} {
+		if err := raw.resolveCatPartitions(level, conf); err != nil {
+			return nil, err
+		}
 	}
 
 	// Try to resolve MB partition allocations
-	err = raw.resolveMBPartitions(conf)
+	err := raw.resolveMBPartitions(conf)
 	if err != nil {
 		return nil, err
 	}
@@ -446,22 +508,27 @@ func (raw options) resolvePartitions() (partitionSet, error) {
 	return conf, nil
 }
 
-// resolveL3Partitions tries to resolve requested L3 allocations between partitions
-func (raw options) resolveL3Partitions(conf partitionSet) error {
-	allocationsPerCacheID := make(map[uint64][]l3PartitionAllocation, len(rdt.info.cacheIds))
-	for _, id := range rdt.info.cacheIds {
-		allocationsPerCacheID[id] = make([]l3PartitionAllocation, 0, len(raw.Partitions))
+// resolveCatPartitions tries to resolve requested L2 or L3 allocations between partitions
+func (raw options) resolveCatPartitions(level cacheLevel, conf partitionSet) error {
+	cacheIds := rdt.info.catCacheIds(level)
+	allocationsPerCacheID := make(map[uint64][]catPartitionAllocation, len(cacheIds))
+	for _, id := range cacheIds {
+		allocationsPerCacheID[id] = make([]catPartitionAllocation, 0, len(raw.Partitions))
 	}
 	// Helper structure for printing out human-readable info in the end
-	requests := map[string]map[uint64]l3Allocation{}
+	requests := map[string]map[uint64]catAllocation{}
 
 	// Parse requested allocations from raw config and transfer them to our
 	// per-cache-id structure
 	numNils := 0
 	for name, partition := range raw.Partitions {
-		allocations, err := partition.L3Allocation.parseL3()
+		rawAllocation := partition.L3Allocation
+		if level == cacheLevelL2 {
+			rawAllocation = partition.L2Allocation
+		}
+		allocations, err := rawAllocation.parseCat(level)
 		if err != nil {
-			return fmt.Errorf("failed to parse L3 allocation request for partition %q: %v", name, err)
+			return fmt.Errorf("failed to parse %s allocation request for partition %q: %v", level, name, err)
 		}
 
 		requests[name] = allocations
@@ -471,38 +538,38 @@ func (raw options) resolveL3Partitions(conf partitionSet) error {
 		}
 
 		for id, val := range allocations {
-			allocationsPerCacheID[id] = append(allocationsPerCacheID[id], l3PartitionAllocation{name: name, allocation: val})
+			allocationsPerCacheID[id] = append(allocationsPerCacheID[id], catPartitionAllocation{name: name, allocation: val})
 		}
 	}
 
 	if numNils == len(raw.Partitions) {
-		log.Debug("L3 allocation disabled for all partitions")
+		log.Debug("%s allocation disabled for all partitions", level)
 		return nil
 	} else if numNils != 0 {
-		return fmt.Errorf("L3 allocation only specified for a subset of partitions")
+		return fmt.Errorf("%s allocation only specified for a subset of partitions", level)
 	}
 
 	// Next, try to resolve partition allocations, separately for each cache-id
-	fullBitmaskNumBits := uint64(rdt.info.l3CbmMask().lsbZero())
+	fullBitmaskNumBits := uint64(rdt.info.cbmMask(level).lsbZero())
 	for id, partitions := range allocationsPerCacheID {
-		err := conf.resolveCacheID(id, partitions)
+		err := conf.resolveCacheID(level, id, partitions)
 		if err != nil {
 			return err
 		}
 	}
 
-	log.Info("actual (and requested) L3 allocations per partition and cache id:")
+	log.Info("actual (and requested) %s allocations per partition and cache id:", level)
 	infoStr := ""
 	for name, partition := range requests {
 		infoStr += name + "\n    "
 		for id, allocationReq := range partition {
-			for _, typ := range []l3SchemaType{l3SchemaTypeUnified, l3SchemaTypeCode, l3SchemaTypeData} {
+			for _, typ := range []catSchemaType{catSchemaTypeUnified, catSchemaTypeCode, catSchemaTypeData} {
 				requested := allocationReq.get(typ)
 				switch v := requested.(type) {
-				case l3AbsoluteAllocation:
+				case catAbsoluteAllocation:
 					infoStr += fmt.Sprintf("%2d: <absolute allocation>", id)
-				case l3PctRangeAllocation:
-					granted := conf[name].L3[id].get(typ).(l3AbsoluteAllocation)
+				case catPctRangeAllocation:
+					granted := conf[name].cat(level)[id].get(typ).(catAbsoluteAllocation)
 					requestedPct := fmt.Sprintf("(%d%%)", v.highPct)
 					truePct := float64(bits.OnesCount64(uint64(granted))) * 100 / float64(fullBitmaskNumBits)
 					infoStr += fmt.Sprintf("%2d: %5.1f%% %-6s", id, truePct, requestedPct)
@@ -516,16 +583,24 @@ func (raw options) resolveL3Partitions(conf partitionSet) error {
 	return nil
 }
 
-type l3PartitionAllocation struct {
+// cat returns the L2 or L3 cache allocation of a partition
+func (p partitionConfig) cat(level cacheLevel) catSchema {
+	if level == cacheLevelL2 {
+		return p.L2
+	}
+	return p.L3
+}
+
+type catPartitionAllocation struct {
 	name       string
-	allocation l3Allocation
+	allocation catAllocation
 }
 
 // resolveCacheID resolves the partition allocations for one cache id
-func (s partitionSet) resolveCacheID(id uint64, partitions []l3PartitionAllocation) error {
-	for _, typ := range []l3SchemaType{l3SchemaTypeUnified, l3SchemaTypeCode, l3SchemaTypeData} {
-		log.Debug("resolving partitions for %q schema for cache id %d", typ, id)
-		err := s.resolveCacheIDPerType(id, partitions, typ)
+func (s partitionSet) resolveCacheID(level cacheLevel, id uint64, partitions []catPartitionAllocation) error {
+	for _, typ := range []catSchemaType{catSchemaTypeUnified, catSchemaTypeCode, catSchemaTypeData} {
+		log.Debug("resolving partitions for %s %q schema for cache id %d", level, typ, id)
+		err := s.resolveCacheIDPerType(level, id, partitions, typ)
 		if err != nil {
 			return err
 		}
@@ -533,62 +608,62 @@ func (s partitionSet) resolveCacheID(id uint64, partitions []l3PartitionAllocati
 	return nil
 }
 
-func (s partitionSet) resolveCacheIDPerType(id uint64, partitions []l3PartitionAllocation, typ l3SchemaType) error {
-	// Sanity check: if any partition has l3 allocation of this schema type
+func (s partitionSet) resolveCacheIDPerType(level cacheLevel, id uint64, partitions []catPartitionAllocation, typ catSchemaType) error {
+	// Sanity check: if any partition has cache allocation of this schema type
 	// configured check that all other partitions have it, too
 	a := partitions[0].allocation.get(typ)
 	isNil := a == nil
 	for _, partition := range partitions {
 		if (partition.allocation.get(typ) == nil) != isNil {
-			return fmt.Errorf("some partition(s) missing l3 %q allocation request for cache id %d", typ, id)
+			return fmt.Errorf("some partition(s) missing %s %q allocation request for cache id %d", level, typ, id)
 		}
 	}
 
 	// Act depending on the type of the first request in the list
 	switch a.(type) {
-	case l3AbsoluteAllocation:
-		return s.resolveCacheIDAbsolute(id, partitions, typ)
+	case catAbsoluteAllocation:
+		return s.resolveCacheIDAbsolute(level, id, partitions, typ)
 	case nil:
 	default:
-		return s.resolveCacheIDRelative(id, partitions, typ)
+		return s.resolveCacheIDRelative(level, id, partitions, typ)
 	}
 	return nil
 }
 
-func (s partitionSet) resolveCacheIDRelative(id uint64, partitions []l3PartitionAllocation, typ l3SchemaType) error {
+func (s partitionSet) resolveCacheIDRelative(level cacheLevel, id uint64, partitions []catPartitionAllocation, typ catSchemaType) error {
 	// Sanity check:
 	// 1. allocation requests are of the same type (relative)
 	// 2. total allocation requested for this cache id does not exceed 100 percent
 	total := uint64(0)
 	for _, partition := range partitions {
 		switch a := partition.allocation.get(typ).(type) {
-		case l3PctAllocation:
+		case catPctAllocation:
 			total += uint64(a)
-		case l3AbsoluteAllocation:
-			return fmt.Errorf("error resolving L3 allocation for cached id %d: mixing relative and absolute allocations between partitions not supported", id)
-		case l3PctRangeAllocation:
+		case catAbsoluteAllocation:
+			return fmt.Errorf("error resolving %s allocation for cached id %d: mixing relative and absolute allocations between partitions not supported", level, id)
+		case catPctRangeAllocation:
 			return fmt.Errorf("percentage ranges in partition allocation not supported")
 		default:
 			return fmt.Errorf("BUG: unknown cacheAllocation type %T", a)
 		}
 	}
 	if total < 100 {
-		log.Info("requested total L3 %q partition allocation for cache id %d <100%% (%d%%)", typ, id, total)
+		log.Info("requested total %s %q partition allocation for cache id %d <100%% (%d%%)", level, typ, id, total)
 	} else if total > 100 {
-		return fmt.Errorf("accumulated L3 %q partition allocation requests for cache id %d exceed 100%% (%d%%)", typ, id, total)
+		return fmt.Errorf("accumulated %s %q partition allocation requests for cache id %d exceed 100%% (%d%%)", level, typ, id, total)
 	}
 
 	// Sort partition allocations. We want to resolve smallest allocations
 	// first in order to try to ensure that all allocations can be satisfied
 	// because small percentages might need to be rounded up
 	sort.Slice(partitions, func(i, j int) bool {
-		return partitions[i].allocation.get(typ).(l3PctAllocation) <
-			partitions[j].allocation.get(typ).(l3PctAllocation)
+		return partitions[i].allocation.get(typ).(catPctAllocation) <
+			partitions[j].allocation.get(typ).(catPctAllocation)
 	})
 
 	bitID := uint64(0)
-	minCbmBits := rdt.info.l3MinCbmBits()
-	fullBitmaskNumBits := uint64(rdt.info.l3CbmMask().lsbZero())
+	minCbmBits := rdt.info.minCbmBits(level)
+	fullBitmaskNumBits := uint64(rdt.info.cbmMask(level).lsbZero())
 	for i, partition := range partitions {
 		bitsAvailable := fullBitmaskNumBits - bitID
 		percentageAvailable := bitsAvailable * 100 / fullBitmaskNumBits
@@ -596,13 +671,13 @@ func (s partitionSet) resolveCacheIDRelative(id uint64, partitions []l3Partition
 		// This might happen e.g. if number of partitions would be greater
 		// than the total number of bits
 		if bitsAvailable < minCbmBits {
-			return fmt.Errorf("unable to resolve L3 allocation for cache id %d, not enough exlusive bits available", id)
+			return fmt.Errorf("unable to resolve %s allocation for cache id %d, not enough exlusive bits available", level, id)
 		}
 
 		// Calculate number of bits allocated for this partition.
 		// Use integer arithmetics, effectively always rounding down
 		// fractional allocations i.e. trying to avoid over-allocation
-		allocation := uint64(partition.allocation.get(typ).(l3PctAllocation))
+		allocation := uint64(partition.allocation.get(typ).(catPctAllocation))
 		numBits := allocation * bitsAvailable / percentageAvailable
 
 		// Guarantee a non-zero allocation
@@ -615,8 +690,8 @@ func (s partitionSet) resolveCacheIDRelative(id uint64, partitions []l3Partition
 		}
 
 		// Compose the actual bitmask
-		v := s[partition.name].L3[id].set(typ, l3AbsoluteAllocation(Bitmask(((1<<numBits)-1)<<bitID)))
-		s[partition.name].L3[id] = v
+		schema := s[partition.name].cat(level)
+		schema[id] = schema[id].set(typ, catAbsoluteAllocation(Bitmask(((1<<numBits)-1)<<bitID)))
 
 		bitID += numBits
 	}
@@ -624,22 +699,23 @@ func (s partitionSet) resolveCacheIDRelative(id uint64, partitions []l3Partition
 	return nil
 }
 
-func (s partitionSet) resolveCacheIDAbsolute(id uint64, partitions []l3PartitionAllocation, typ l3SchemaType) error {
+func (s partitionSet) resolveCacheIDAbsolute(level cacheLevel, id uint64, partitions []catPartitionAllocation, typ catSchemaType) error {
 	// Just sanity check:
 	// 1. allocation requests of the correct type (absolute)
 	// 2. allocations do not overlap
 	mask := Bitmask(0)
 	for _, partition := range partitions {
-		a, ok := partition.allocation.get(typ).(l3AbsoluteAllocation)
+		a, ok := partition.allocation.get(typ).(catAbsoluteAllocation)
 		if !ok {
-			return fmt.Errorf("error resolving L3 allocation for cached id %d: mixing absolute and relative allocations between partitions not supported", id)
+			return fmt.Errorf("error resolving %s allocation for cached id %d: mixing absolute and relative allocations between partitions not supported", level, id)
 		}
 		if Bitmask(a)&mask > 0 {
-			return fmt.Errorf("overlapping L3 partition allocation requests for cache id %d", id)
+			return fmt.Errorf("overlapping %s partition allocation requests for cache id %d", level, id)
 		}
 		mask |= Bitmask(a)
 
-		s[partition.name].L3[id] = s[partition.name].L3[id].set(typ, a)
+		schema := s[partition.name].cat(level)
+		schema[id] = schema[id].set(typ, a)
 	}
 
 	return nil
@@ -678,7 +754,15 @@ func (raw options) resolveClasses() (classSet, error) {
 			var err error
 			gc := classConfig{Partition: bname}
 
-			gc.L3Schema, err = class.L3Schema.parseL3()
+			gc.L2Schema, err = class.L2Schema.parseCat(cacheLevelL2)
+			if err != nil {
+				return classes, fmt.Errorf("failed to resolve L2 allocation for class %q: %v", gname, err)
+			}
+			if gc.L2Schema != nil && partition.L2Allocation == nil {
+				return classes, fmt.Errorf("L2 allocation missing from partition %q but class %q specifies L2 schema", bname, gname)
+			}
+
+			gc.L3Schema, err = class.L3Schema.parseCat(cacheLevelL3)
 			if err != nil {
 				return classes, fmt.Errorf("failed to resolve L3 allocation for class %q: %v", gname, err)
 			}
@@ -701,9 +785,87 @@ func (raw options) resolveClasses() (classSet, error) {
 	return classes, nil
 }
 
+// resolveDynamic checks the configuration of dynamic classes
+func (raw options) resolveDynamic(conf config) (dynamicOptions, error) {
+	dyn := raw.DynamicClasses
+
+	if dyn.Partition == "" {
+		if len(dyn.Classes) > 0 || dyn.FallbackClass != "" {
+			return dyn, fmt.Errorf("dynamic classes configured without a partition")
+		}
+		return dyn, nil
+	}
+
+	partition, ok := raw.Partitions[dyn.Partition]
+	if !ok {
+		return dyn, fmt.Errorf("unknown partition %q for dynamic classes", dyn.Partition)
+	}
+	if partition.L3Allocation == nil {
+		return dyn, fmt.Errorf("L3 allocation missing from partition %q used for dynamic classes", dyn.Partition)
+	}
+	if dyn.MaxClasses < 0 {
+		return dyn, fmt.Errorf("invalid maximum number of dynamic classes %d", dyn.MaxClasses)
+	}
+
+	if dyn.FallbackClass == "" {
+		dyn.FallbackClass = RootClassName
+	} else if _, ok := conf.Classes[dyn.FallbackClass]; !ok && dyn.FallbackClass != RootClassName {
+		return dyn, fmt.Errorf("unknown fallback class %q for dynamic classes", dyn.FallbackClass)
+	}
+
+	return dyn, nil
+}
+
+// resolveBandwidth checks the configuration of memory bandwidth control
+func (raw options) resolveBandwidth(conf config) (bandwidthOptions, error) {
+	bw := raw.BandwidthControl
+
+	if bw.Interval <= 0 {
+		return bw, nil
+	}
+
+	if bw.Capacity == 0 {
+		return bw, fmt.Errorf("bandwidth control: missing bandwidth capacity")
+	}
+	if bw.Budget > bw.Capacity {
+		return bw, fmt.Errorf("bandwidth control: budget %d exceeds capacity %d", bw.Budget, bw.Capacity)
+	}
+	if len(bw.PriorityClasses) == 0 || len(bw.ThrottledClasses) == 0 {
+		return bw, fmt.Errorf("bandwidth control: both priority and throttled classes are needed")
+	}
+
+	throttled := make(map[string]struct{}, len(bw.ThrottledClasses))
+	for _, name := range bw.ThrottledClasses {
+		if _, ok := conf.Classes[name]; !ok && name != RootClassName {
+			return bw, fmt.Errorf("bandwidth control: unknown throttled class %q", name)
+		}
+		throttled[name] = struct{}{}
+	}
+	for _, name := range bw.PriorityClasses {
+		if _, ok := conf.Classes[name]; !ok && name != RootClassName {
+			return bw, fmt.Errorf("bandwidth control: unknown priority class %q", name)
+		}
+		if _, ok := throttled[name]; ok {
+			return bw, fmt.Errorf("bandwidth control: class %q both priority and throttled", name)
+		}
+	}
+
+	if bw.Step == 0 {
+		bw.Step = 10
+	}
+	if bw.Min < rdt.info.mb.minBandwidth {
+		bw.Min = rdt.info.mb.minBandwidth
+	}
+	if bw.Step > 100 || bw.Min > 100 {
+		return bw, fmt.Errorf("bandwidth control: invalid step %d%% or minimum %d%%", bw.Step, bw.Min)
+	}
+
+	return bw, nil
+}
+
 // parsePercentage parses a percentage value
 func (raw rawAllocations) parsePercentage() (map[uint64]uint64, error) {
-	rawValues, err := raw.rawParse("100%", true)
+	rawValues, err := raw.rawParse("100%", true, rdt.info.cacheIds)
 	if err != nil || rawValues == nil {
 		return nil, err
 	}
@@ -723,16 +885,16 @@ func (raw rawAllocations) parsePercentage() (map[uint64]uint64, error) {
 	return allocations, nil
 }
 
-// parse parses a raw L3 cache allocation
-func (raw rawAllocations) parseL3() (l3Schema, error) {
-	rawValues, err := raw.rawParse("100%", false)
+// parseCat parses a raw L2 or L3 cache allocation
+func (raw rawAllocations) parseCat(level cacheLevel) (catSchema, error) {
+	rawValues, err := raw.rawParse("100%", false, rdt.info.catCacheIds(level))
 	if err != nil || rawValues == nil {
 		return nil, err
 	}
 
-	allocations := make(l3Schema, len(rawValues))
+	allocations := make(catSchema, len(rawValues))
 	for id, rawVal := range rawValues {
-		allocations[id], err = parseL3Allocation(rawVal)
+		allocations[id], err = parseCatAllocation(rawVal, rdt.info.minCbmBits(level))
 		if err != nil {
 			return nil, err
 		}
@@ -743,7 +905,7 @@ func (raw rawAllocations) parseL3() (l3Schema, error) {
 
 // parseMB parses a raw MB allocation
 func (raw rawAllocations) parseMB() (mbSchema, error) {
-	rawValues, err := raw.rawParse(map[string]interface{}{}, false)
+	rawValues, err := raw.rawParse(map[string]interface{}{}, false, rdt.info.cacheIds)
 	if err != nil || rawValues == nil {
 		return nil, err
 	}
@@ -764,8 +926,8 @@ func (raw rawAllocations) parseMB() (mbSchema, error) {
 }
 
 // rawParse "pre-parses" the rawAllocations per each cache id. I.e. it assigns
-// a raw (string) allocation for each cache id
-func (raw rawAllocations) rawParse(defaultVal interface{}, initEmpty bool) (map[uint64]interface{}, error) {
+// a raw (string) allocation for each of the given cache ids
+func (raw rawAllocations) rawParse(defaultVal interface{}, initEmpty bool, cacheIds []uint64) (map[uint64]interface{}, error) {
 	if raw == nil && !initEmpty {
 		return nil, nil
 	}
@@ -776,8 +938,8 @@ func (raw rawAllocations) rawParse(defaultVal interface{}, initEmpty bool) (map[
 		return nil, fmt.Errorf("'all' is missing")
 	}
 
-	allocations := make(map[uint64]interface{}, len(rdt.info.cacheIds))
-	for _, i := range rdt.info.cacheIds {
+	allocations := make(map[uint64]interface{}, len(cacheIds))
+	for _, i := range cacheIds {
 		allocations[i] = defaultVal
 	}
 
@@ -814,14 +976,14 @@ func parsePercentage(s string) (uint64, error) {
 	return val, nil
 }
 
-// parseL3Allocation parses a generic string map into l3Allocation struct
-func parseL3Allocation(raw interface{}) (l3Allocation, error) {
+// parseCatAllocation parses a generic string map into catAllocation struct
+func parseCatAllocation(raw interface{}, minBits uint64) (catAllocation, error) {
 	var err error
-	allocation := l3Allocation{}
+	allocation := catAllocation{}
 
 	switch value := raw.(type) {
 	case string:
-		allocation.Unified, err = parseCacheAllocation(value)
+		allocation.Unified, err = parseCacheAllocation(value, minBits)
 		if err != nil {
 			return allocation, err
 		}
@@ -832,37 +994,37 @@ func parseL3Allocation(raw interface{}) (l3Allocation, error) {
 				return allocation, fmt.Errorf("not a string value %q", v)
 			}
 			switch strings.ToLower(k) {
-			case string(l3SchemaTypeUnified):
-				allocation.Unified, err = parseCacheAllocation(s)
-			case string(l3SchemaTypeCode):
-				allocation.Code, err = parseCacheAllocation(s)
-			case string(l3SchemaTypeData):
-				allocation.Data, err = parseCacheAllocation(s)
+			case string(catSchemaTypeUnified):
+				allocation.Unified, err = parseCacheAllocation(s, minBits)
+			case string(catSchemaTypeCode):
+				allocation.Code, err = parseCacheAllocation(s, minBits)
+			case string(catSchemaTypeData):
+				allocation.Data, err = parseCacheAllocation(s, minBits)
 			}
 			if err != nil {
 				return allocation, err
 			}
 		}
 	default:
-		return allocation, fmt.Errorf("invalid structure of l3Schema %q", raw)
+		return allocation, fmt.Errorf("invalid structure of cache schema %q", raw)
 	}
 
 	// Sanity check for the configuration
 	if allocation.Unified == nil {
-		return allocation, fmt.Errorf("'unified' not specified in l3Schema %s", raw)
+		return allocation, fmt.Errorf("'unified' not specified in cache schema %s", raw)
 	}
 	if allocation.Code != nil && allocation.Data == nil {
-		return allocation, fmt.Errorf("'code' specified but missing 'data' from l3Schema %s", raw)
+		return allocation, fmt.Errorf("'code' specified but missing 'data' from cache schema %s", raw)
 	}
 	if allocation.Code == nil && allocation.Data != nil {
-		return allocation, fmt.Errorf("'data' specified but missing 'code' from l3Schema %s", raw)
+		return allocation, fmt.Errorf("'data' specified but missing 'code' from cache schema %s", raw)
 	}
 
 	return allocation, nil
 }
 
 // parseCacheAllocation parses a string value into cacheAllocation type
-func parseCacheAllocation(data string) (cacheAllocation, error) {
+func parseCacheAllocation(data string, minBits uint64) (cacheAllocation, error) {
 	if data[len(data)-1] == '%' {
 		// Percentages of the max number of bits
 		split := strings.SplitN(data[0:len(data)-1], "-", 2)
@@ -876,7 +1038,7 @@ func parseCacheAllocation(data string) (cacheAllocation, error) {
 			if pct > 100 {
 				return allocation, fmt.Errorf("invalid percentage value %q", data)
 			}
-			allocation = l3PctAllocation(pct)
+			allocation = catPctAllocation(pct)
 		} else {
 			low, err := strconv.ParseUint(split[0], 10, 7)
 			if err != nil {
@@ -889,7 +1051,7 @@ func parseCacheAllocation(data string) (cacheAllocation, error) {
 			if low > high || low > 100 || high > 100 {
 				return allocation, fmt.Errorf("invalid percentage range %q", data)
 			}
-			allocation = l3PctRangeAllocation{lowPct: low, highPct: high}
+			allocation = catPctRangeAllocation{lowPct: low, highPct: high}
 		}
 
 		return allocation, nil
@@ -919,11 +1081,11 @@ func parseCacheAllocation(data string) (cacheAllocation, error) {
 	if numOnes != 64-bits.LeadingZeros64(value)-bits.TrailingZeros64(value) {
 		return nil, fmt.Errorf("invalid cache bitmask %q: more than one continuous block of ones", data)
 	}
-	if uint64(numOnes) < rdt.info.l3MinCbmBits() {
-		return nil, fmt.Errorf("invalid cache bitmask %q: number of bits less than %d", data, rdt.info.l3MinCbmBits())
+	if uint64(numOnes) < minBits {
+		return nil, fmt.Errorf("invalid cache bitmask %q: number of bits less than %d", data, minBits)
 	}
 
-	return l3AbsoluteAllocation(value), nil
+	return catAbsoluteAllocation(value), nil
 }
 
 // parseMBAllocation parses a generic string map into MB allocation value
@@ -0,0 +1,289 @@
+/*
+Copyright 2020 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rdt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const (
+	// DynamicClassName is the reserved class name for requesting a dynamic
+	// (dedicated, per-container) class
+	DynamicClassName = "DYNAMIC"
+
+	dynamicClassPrefix = "dynamic."
+)
+
+// ErrDynamicClassesExhausted is returned when no more dynamic classes can be
+// created, either because of running out of CLOSids or cache space
+var ErrDynamicClassesExhausted = errors.New("dynamic classes exhausted")
+
+// dynamicClass is a class created on the fly for a single container. Its L3
+// allocation is a percentage range of the dynamic partition, not overlapping
+// with other dynamic classes.
+type dynamicClass struct {
+	*ctrlGroup
+
+	lowPct  uint64
+	highPct uint64
+}
+
+// DynamicClassesEnabled returns true if dynamic classes have been configured
+func DynamicClassesEnabled() bool {
+	return rdt.conf.Dynamic.Partition != ""
+}
+
+// WantsDynamicClass returns true if containers assigned to the given class
+// should get a dynamic class instead
+func WantsDynamicClass(class string) bool {
+	if !DynamicClassesEnabled() {
+		return false
+	}
+	if class == DynamicClassName {
+		return true
+	}
+	for _, name := range rdt.conf.Dynamic.Classes {
+		if name == class {
+			return true
+		}
+	}
+	return false
+}
+
+// DynamicFallbackClass returns the class to use for a container of the given
+// class if no dynamic class can be created for it
+func DynamicFallbackClass(class string) string {
+	if _, ok := rdt.conf.Classes[class]; ok {
+		return class
+	}
+	if rdt.conf.Dynamic.FallbackClass != "" {
+		return rdt.conf.Dynamic.FallbackClass
+	}
+	return RootClassName
+}
+
+// CreateDynamicClass creates a dynamic class for a container, with an L3
+// allocation of the given percentage of the dynamic partition. If the class
+// already exists it is resized, if possible.
+func CreateDynamicClass(id string, share uint64) (CtrlGroup, error) {
+	return rdt.createDynamicClass(id, share)
+}
+
+// DeleteDynamicClass deletes the dynamic class of a container, if any
+func DeleteDynamicClass(id string) error {
+	return rdt.deleteDynamicClass(id)
+}
+
+func (c *control) createDynamicClass(id string, share uint64) (CtrlGroup, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conf.Dynamic.Partition == "" {
+		return nil, rdtError("dynamic classes not configured")
+	}
+
+	if share < 1 {
+		share = 1
+	} else if share > 100 {
+		share = 100
+	}
+
+	name := dynamicClassPrefix + id
+	dc, exists := c.dynamic[name]
+	if exists && dc.highPct-dc.lowPct+1 == share {
+		return dc.ctrlGroup, nil
+	}
+
+	if !exists {
+		if max := c.conf.Dynamic.MaxClasses; max > 0 && len(c.dynamic) >= max {
+			return nil, rdtError("cannot create class %q, limit of %d reached: %w",
+				name, max, ErrDynamicClassesExhausted)
+		}
+		if c.info.numClosids > 0 && uint64(len(c.classes)) >= c.info.numClosids {
+			return nil, rdtError("cannot create class %q, all %d CLOSids in use: %w",
+				name, c.info.numClosids, ErrDynamicClassesExhausted)
+		}
+	}
+
+	low, ok := c.findDynamicSlot(name, share)
+	if !ok {
+		if exists {
+			log.Warn("cannot resize dynamic class %q to %d%%, keeping %d%%",
+				name, share, dc.highPct-dc.lowPct+1)
+			return dc.ctrlGroup, nil
+		}
+		return nil, rdtError("cannot create class %q, no room for %d%% of partition %q: %w",
+			name, share, c.conf.Dynamic.Partition, ErrDynamicClassesExhausted)
+	}
+
+	if !exists {
+		cg, err := newCtrlGroup(name)
+		if err != nil {
+			if errors.Is(err, syscall.ENOSPC) {
+				return nil, rdtError("cannot create class %q: %w", name, ErrDynamicClassesExhausted)
+			}
+			return nil, rdtError("failed to create class %q: %v", name, err)
+		}
+		dc = &dynamicClass{ctrlGroup: cg}
+	}
+
+	oldLow, oldHigh := dc.lowPct, dc.highPct
+	dc.lowPct, dc.highPct = low, low+share-1
+	if err := dc.configure(c.conf); err != nil {
+		if exists {
+			dc.lowPct, dc.highPct = oldLow, oldHigh
+		} else {
+			os.Remove(dc.path(""))
+		}
+		return nil, rdtError("failed to configure class %q: %v", name, err)
+	}
+
+	if c.dynamic == nil {
+		c.dynamic = make(map[string]*dynamicClass)
+	}
+	c.dynamic[name] = dc
+	c.classes[name] = dc.ctrlGroup
+
+	log.Info("dynamic class %q set to %d-%d%% of partition %q",
+		name, dc.lowPct, dc.highPct, c.conf.Dynamic.Partition)
+
+	return dc.ctrlGroup, nil
+}
+
+func (c *control) deleteDynamicClass(id string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	name := dynamicClassPrefix + id
+	dc, ok := c.dynamic[name]
+	if !ok {
+		return nil
+	}
+
+	// Removing the resctrl group moves any remaining tasks to the root class
+	if err := os.Remove(dc.path("")); err != nil && !os.IsNotExist(err) {
+		return rdtError("failed to remove dynamic class %q: %v", name, err)
+	}
+
+	delete(c.dynamic, name)
+	delete(c.classes, name)
+
+	log.Info("dynamic class %q removed", name)
+
+	return nil
+}
+
+// PruneDynamicClasses removes the dynamic classes left behind by a previous
+// run which have not been re-created since. It should be called once the
+// containers of those classes have been reassigned.
+func PruneDynamicClasses() error {
+	return rdt.pruneDynamicClasses()
+}
+
+func (c *control) pruneDynamicClasses() error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.orphans = false
+
+	existingClasses, err := c.classesFromResctrlFs()
+	if err != nil {
+		return err
+	}
+
+	for _, cls := range existingClasses {
+		if !isDynamicClassName(cls.name) {
+			continue
+		}
+		if _, ok := c.dynamic[cls.name]; ok {
+			continue
+		}
+		// Removal moves any remaining tasks to the root class
+		if err := os.Remove(cls.path("")); err != nil && !os.IsNotExist(err) {
+			return rdtError("failed to remove stale dynamic resctrl group %q: %v", cls.relPath(""), err)
+		}
+		log.Info("stale dynamic class %q removed", cls.name)
+	}
+
+	return nil
+}
+
+// findDynamicSlot finds the lowest free percentage range of the given size
+// in the dynamic partition, ignoring the current range of the named class
+func (c *control) findDynamicSlot(name string, share uint64) (uint64, bool) {
+	used := make([]*dynamicClass, 0, len(c.dynamic))
+	for n, dc := range c.dynamic {
+		if n != name {
+			used = append(used, dc)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].lowPct < used[j].lowPct })
+
+	low := uint64(1)
+	for _, dc := range used {
+		if low+share-1 < dc.lowPct {
+			return low, true
+		}
+		if dc.highPct >= low {
+			low = dc.highPct + 1
+		}
+	}
+	if low+share-1 <= 100 {
+		return low, true
+	}
+	return 0, false
+}
+
+// reconfigureDynamicClasses re-applies the schemata of all dynamic classes
+func (c *control) reconfigureDynamicClasses(conf config) {
+	for name, dc := range c.dynamic {
+		if err := dc.configure(conf); err != nil {
+			log.Warn("failed to reconfigure dynamic class %q: %v", name, err)
+		}
+		c.classes[name] = dc.ctrlGroup
+	}
+}
+
+// configure writes the schemata of a dynamic class
+func (d *dynamicClass) configure(conf config) error {
+	partition, ok := conf.Partitions[conf.Dynamic.Partition]
+	if !ok {
+		return fmt.Errorf("dynamic partition %q not found", conf.Dynamic.Partition)
+	}
+
+	class := classConfig{
+		Partition: conf.Dynamic.Partition,
+		L3Schema:  make(catSchema, len(partition.L3)),
+	}
+	for id := range partition.L3 {
+		class.L3Schema[id] = catAllocation{
+			Unified: catPctRangeAllocation{lowPct: d.lowPct, highPct: d.highPct},
+		}
+	}
+
+	return d.ctrlGroup.configure(d.name, class, partition, conf.Options)
+}
+
+// isDynamicClassName returns true if the class name is that of a dynamic class
+func isDynamicClassName(name string) bool {
+	return strings.HasPrefix(name, dynamicClassPrefix)
+}
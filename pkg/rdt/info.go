@@ -33,14 +33,18 @@ type info struct {
 	resctrlMountOpts map[string]struct{}
 	numClosids       uint64
 	cacheIds         []uint64
-	l3               l3Info
-	l3code           l3Info
-	l3data           l3Info
+	l2CacheIds       []uint64
+	l2               catInfo
+	l2code           catInfo
+	l2data           catInfo
+	l3               catInfo
+	l3code           catInfo
+	l3data           catInfo
 	l3mon            l3MonInfo
 	mb               mbInfo
 }
 
-type l3Info struct {
+type catInfo struct {
 	cbmMask       Bitmask
 	minCbmBits    uint64
 	shareableBits Bitmask
@@ -60,27 +64,39 @@ type mbInfo struct {
 
 var mountInfoPath string = "/proc/mounts"
 
-// l3Info is a helper method for a "unified API" for getting L3 information
-func (i info) l3Info() l3Info {
+// cat is a helper method for a "unified API" for getting L2 or L3 information
+func (i info) cat(level cacheLevel) catInfo {
+	unified, code, data := i.l3, i.l3code, i.l3data
+	if level == cacheLevelL2 {
+		unified, code, data = i.l2, i.l2code, i.l2data
+	}
 	switch {
-	case i.l3code.Supported():
-		return i.l3code
-	case i.l3data.Supported():
-		return i.l3data
+	case code.Supported():
+		return code
+	case data.Supported():
+		return data
 	}
-	return i.l3
+	return unified
 }
 
-func (i info) l3CbmMask() Bitmask {
-	mask := i.l3Info().cbmMask
+func (i info) cbmMask(level cacheLevel) Bitmask {
+	mask := i.cat(level).cbmMask
 	if mask != 0 {
 		return mask
 	}
 	return Bitmask(^uint64(0))
 }
 
-func (i info) l3MinCbmBits() uint64 {
-	return i.l3Info().minCbmBits
+func (i info) minCbmBits(level cacheLevel) uint64 {
+	return i.cat(level).minCbmBits
+}
+
+// catCacheIds returns the cache ids of the given cache level
+func (i info) catCacheIds(level cacheLevel) []uint64 {
+	if level == cacheLevelL2 {
+		return i.l2CacheIds
+	}
+	return i.cacheIds
 }
 
 func getRdtInfo() (info, error) {
@@ -99,9 +115,22 @@ func getRdtInfo() (info, error) {
 		return info, rdtError("failed to read RDT info from %q: %v", infopath, err)
 	}
 
+	for _, sub := range []struct {
+		name string
+		info *catInfo
+	}{{"L2", &info.l2}, {"L2CODE", &info.l2code}, {"L2DATA", &info.l2data}} {
+		subpath := filepath.Join(infopath, sub.name)
+		if _, err = os.Stat(subpath); err == nil {
+			*sub.info, info.numClosids, err = getCatInfo(subpath)
+			if err != nil {
+				return info, rdtError("failed to get %s info from %q: %v", sub.name, subpath, err)
+			}
+		}
+	}
+
 	subpath := filepath.Join(infopath, "L3")
 	if _, err = os.Stat(subpath); err == nil {
-		info.l3, info.numClosids, err = getL3Info(subpath)
+		info.l3, info.numClosids, err = getCatInfo(subpath)
 		if err != nil {
 			return info, rdtError("failed to get L3 info from %q: %v", subpath, err)
 		}
@@ -109,7 +138,7 @@ func getRdtInfo() (info, error) {
 
 	subpath = filepath.Join(infopath, "L3CODE")
 	if _, err = os.Stat(subpath); err == nil {
-		info.l3code, info.numClosids, err = getL3Info(subpath)
+		info.l3code, info.numClosids, err = getCatInfo(subpath)
 		if err != nil {
 			return info, rdtError("failed to get L3CODE info from %q: %v", subpath, err)
 		}
@@ -117,7 +146,7 @@ func getRdtInfo() (info, error) {
 
 	subpath = filepath.Join(infopath, "L3DATA")
 	if _, err = os.Stat(subpath); err == nil {
-		info.l3data, info.numClosids, err = getL3Info(subpath)
+		info.l3data, info.numClosids, err = getCatInfo(subpath)
 		if err != nil {
 			return info, rdtError("failed to get L3DATA info from %q: %v", subpath, err)
 		}
@@ -139,18 +168,27 @@ func getRdtInfo() (info, error) {
 		}
 	}
 
-	info.cacheIds, err = getCacheIds(info.resctrlPath)
-	if err != nil {
-		return info, rdtError("failed to get cache IDs: %v", err)
+	if info.cat(cacheLevelL3).Supported() || info.mb.Supported() || !info.cat(cacheLevelL2).Supported() {
+		info.cacheIds, err = getCacheIds(info.resctrlPath, "L3", "MB")
+		if err != nil {
+			return info, rdtError("failed to get cache IDs: %v", err)
+		}
+	}
+
+	if info.cat(cacheLevelL2).Supported() {
+		info.l2CacheIds, err = getCacheIds(info.resctrlPath, "L2")
+		if err != nil {
+			return info, rdtError("failed to get L2 cache IDs: %v", err)
+		}
 	}
 
 	return info, nil
 }
 
-func getL3Info(basepath string) (l3Info, uint64, error) {
+func getCatInfo(basepath string) (catInfo, uint64, error) {
 	var err error
 	var numClosids uint64
-	info := l3Info{}
+	info := catInfo{}
 
 	info.cbmMask, err = readFileBitmask(filepath.Join(basepath, "cbm_mask"))
 	if err != nil {
@@ -172,8 +210,8 @@ func getL3Info(basepath string) (l3Info, uint64, error) {
 	return info, numClosids, nil
 }
 
-// Supported returns true if L3 cache allocation has is supported and enabled in the system
-func (i l3Info) Supported() bool {
+// Supported returns true if cache allocation has is supported and enabled in the system
+func (i catInfo) Supported() bool {
 	return i.cbmMask != 0
 }
 
@@ -241,7 +279,9 @@ func (i mbInfo) Supported() bool {
 	return i.minBandwidth != 0
 }
 
-func getCacheIds(basepath string) ([]uint64, error) {
+// getCacheIds parses the cache IDs from the first root schemata line of any
+// of the given resources (e.g. "L3" also matching "L3CODE")
+func getCacheIds(basepath string, resources ...string) ([]uint64, error) {
 	var ids []uint64
 
 	// Parse cache IDs from the root schemata
@@ -253,16 +293,23 @@ func getCacheIds(basepath string) ([]uint64, error) {
 	for _, line := range strings.Split(data, "\n") {
 		trimmed := strings.TrimSpace(line)
 
-		// Find line with L3 or MB schema
-		if strings.HasPrefix(trimmed, "L3") || strings.HasPrefix(trimmed, "MB:") {
-			schema := strings.Split(trimmed[3:], ";")
+		// Find line with the schema of a requested resource
+		sep := strings.Index(trimmed, ":")
+		if sep < 0 {
+			continue
+		}
+		for _, resource := range resources {
+			if !strings.HasPrefix(trimmed[:sep], resource) {
+				continue
+			}
+			schema := strings.Split(trimmed[sep+1:], ";")
 			ids = make([]uint64, len(schema))
 
 			// Get individual cache configurations from the schema
 			for idx, definition := range schema {
 				split := strings.Split(definition, "=")
 				if len(split) != 2 {
-					return ids, rdtError("looks like an invalid L3 %q", trimmed)
+					return ids, rdtError("looks like an invalid %s %q", resource, trimmed)
 				}
 				ids[idx], err = strconv.ParseUint(split[0], 10, 64)
 				if err != nil {
@@ -274,7 +321,7 @@ func getCacheIds(basepath string) ([]uint64, error) {
 			return ids, nil
 		}
 	}
-	return ids, rdtError("no resources in root schemata")
+	return ids, rdtError("no %s resources in root schemata", strings.Join(resources, "/"))
 }
 
 func getResctrlMountInfo() (string, map[string]struct{}, error) {
@@ -0,0 +1,361 @@
+/*
+Copyright 2020 Intel Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rdt
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// mbmTotalBytes is the monitoring feature used for measuring bandwidth
+	mbmTotalBytes = "mbm_total_bytes"
+	// bandwidthHysteresis is the fraction of the target bandwidth which
+	// throttled classes must drop below before their allocation is raised
+	bandwidthHysteresis = 0.9
+)
+
+// bandwidthController is a feedback loop which periodically measures the
+// memory bandwidth of classes and monitoring groups and adjusts the MB
+// allocation of throttled classes to keep a bandwidth budget for the
+// priority classes. It is much like the kernel mba_sc but policy-driven.
+type bandwidthController struct {
+	sync.Mutex
+
+	conf     bandwidthOptions
+	stop     chan struct{}
+	samples  map[string]bandwidthSample    // previous counters, per class or class/group
+	classBw  map[string]map[uint64]float64 // measured class bandwidth (MBps)
+	groupBw  map[string]map[uint64]float64 // measured monitoring group bandwidth (MBps)
+	throttle map[string]map[uint64]uint64  // current MB allocation of throttled classes (%)
+}
+
+// bandwidthSample is one reading of the mbm_total_bytes counters of a group
+type bandwidthSample struct {
+	time  time.Time
+	bytes map[uint64]uint64
+}
+
+// BandwidthMetrics contains the latest measurements and adjustments of
+// memory bandwidth control
+type BandwidthMetrics struct {
+	// Classes is the measured bandwidth (MBps) per class and cache id
+	Classes map[string]map[uint64]float64
+	// Groups is the measured bandwidth (MBps) per monitoring group and cache id
+	Groups map[MonGroup]map[uint64]float64
+	// Throttle is the current MB allocation (%) per throttled class and cache id
+	Throttle map[string]map[uint64]uint64
+}
+
+// GetBandwidthMetrics returns the latest memory bandwidth control metrics, or
+// nil if bandwidth control is not active
+func GetBandwidthMetrics() *BandwidthMetrics {
+	return rdt.getBandwidthMetrics()
+}
+
+// startBandwidthControl starts the bandwidth control loop, if configured
+func (c *control) startBandwidthControl() {
+	c.stopBandwidthControl()
+
+	conf := c.conf.Bandwidth
+	if conf.Interval <= 0 {
+		return
+	}
+
+	switch {
+	case !c.info.mb.Supported():
+		log.Warn("bandwidth control disabled: memory bandwidth allocation not supported")
+		return
+	case c.info.mb.mbpsEnabled:
+		log.Warn("bandwidth control disabled: conflicts with mba_MBps")
+		return
+	case !c.hasMonFeature(MonResourceL3, mbmTotalBytes):
+		log.Warn("bandwidth control disabled: %s monitoring not supported", mbmTotalBytes)
+		return
+	}
+
+	b := &bandwidthController{
+		conf:     conf,
+		stop:     make(chan struct{}),
+		samples:  make(map[string]bandwidthSample),
+		classBw:  make(map[string]map[uint64]float64),
+		groupBw:  make(map[string]map[uint64]float64),
+		throttle: make(map[string]map[uint64]uint64),
+	}
+	c.bandwidth = b
+
+	log.Info("starting bandwidth control, budget %d of %d MBps for classes %v",
+		conf.Budget, conf.Capacity, conf.PriorityClasses)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(conf.Interval))
+		defer ticker.Stop()
+		for {
+			select {
+			case _ = <-b.stop:
+				return
+			case _ = <-ticker.C:
+				b.update(c)
+			}
+		}
+	}()
+}
+
+// stopBandwidthControl stops the bandwidth control loop, if running
+func (c *control) stopBandwidthControl() {
+	if c == nil || c.bandwidth == nil {
+		return
+	}
+	close(c.bandwidth.stop)
+	c.bandwidth = nil
+}
+
+func (c *control) hasMonFeature(resource MonResource, feature string) bool {
+	for _, f := range c.getMonFeatures()[resource] {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *control) getBandwidthMetrics() *BandwidthMetrics {
+	c.RLock()
+	b := c.bandwidth
+	groups := make(map[string]MonGroup)
+	for _, cls := range c.classes {
+		for _, mg := range cls.monGroups {
+			groups[cls.name+"/"+mg.name] = mg
+		}
+	}
+	c.RUnlock()
+
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	m := &BandwidthMetrics{
+		Classes:  make(map[string]map[uint64]float64, len(b.classBw)),
+		Groups:   make(map[MonGroup]map[uint64]float64, len(b.groupBw)),
+		Throttle: make(map[string]map[uint64]uint64, len(b.throttle)),
+	}
+	for name, bw := range b.classBw {
+		m.Classes[name] = copyBandwidth(bw)
+	}
+	for name, bw := range b.groupBw {
+		if mg, ok := groups[name]; ok {
+			m.Groups[mg] = copyBandwidth(bw)
+		}
+	}
+	for name, pcts := range b.throttle {
+		m.Throttle[name] = make(map[uint64]uint64, len(pcts))
+		for id, pct := range pcts {
+			m.Throttle[name][id] = pct
+		}
+	}
+
+	return m
+}
+
+// update takes a new bandwidth sample and adjusts throttled classes
+func (b *bandwidthController) update(c *control) {
+	c.RLock()
+	classes := make(map[string]ResctrlGroup, len(c.classes))
+	groups := make(map[string]ResctrlGroup)
+	for name, cls := range c.classes {
+		classes[name] = cls
+		for _, mg := range cls.monGroups {
+			groups[name+"/"+mg.name] = mg
+		}
+	}
+	cacheIds := append([]uint64{}, c.info.cacheIds...)
+	maxMB := make(map[string]map[uint64]uint64, len(b.conf.ThrottledClasses))
+	for _, name := range b.conf.ThrottledClasses {
+		maxMB[name] = make(map[uint64]uint64, len(cacheIds))
+		for _, id := range cacheIds {
+			maxMB[name][id] = c.configuredMB(name, id)
+		}
+	}
+	c.RUnlock()
+
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	classBw := make(map[string]map[uint64]float64, len(classes))
+	groupBw := make(map[string]map[uint64]float64, len(groups))
+	for name, cls := range classes {
+		if bw, ok := b.sample(name, now, cls.GetMonData()); ok {
+			classBw[name] = bw
+		}
+	}
+	for key, mg := range groups {
+		if bw, ok := b.sample(key, now, mg.GetMonData()); ok {
+			groupBw[key] = bw
+		}
+	}
+	b.classBw = classBw
+	b.groupBw = groupBw
+
+	// Forget samples of groups that are gone
+	for key, s := range b.samples {
+		if s.time != now {
+			delete(b.samples, key)
+		}
+	}
+
+	b.adjust(c, cacheIds, maxMB)
+}
+
+// sample records the bandwidth counters of a group, returning the bandwidth
+// since the previous sample
+func (b *bandwidthController) sample(key string, now time.Time, data MonData) (map[uint64]float64, bool) {
+	current := bandwidthSample{time: now, bytes: make(map[uint64]uint64, len(data.L3))}
+	for id, leaf := range data.L3 {
+		if bytes, ok := leaf[mbmTotalBytes]; ok {
+			current.bytes[id] = bytes
+		}
+	}
+
+	prev, ok := b.samples[key]
+	b.samples[key] = current
+	if !ok {
+		return nil, false
+	}
+
+	seconds := now.Sub(prev.time).Seconds()
+	if seconds <= 0 {
+		return nil, false
+	}
+
+	bw := make(map[uint64]float64, len(current.bytes))
+	for id, bytes := range current.bytes {
+		prevBytes, ok := prev.bytes[id]
+		if !ok || bytes < prevBytes {
+			// New cache id or counter wrapped around
+			continue
+		}
+		bw[id] = float64(bytes-prevBytes) / seconds / (1024 * 1024)
+	}
+
+	return bw, true
+}
+
+// adjust raises or lowers the MB allocation of throttled classes, up to the
+// configured maximum allocations of the classes
+func (b *bandwidthController) adjust(c *control, cacheIds []uint64, maxMB map[string]map[uint64]uint64) {
+	target := float64(b.conf.Capacity - b.conf.Budget)
+	changed := make(map[string]struct{})
+
+	for _, id := range cacheIds {
+		priority, throttled := 0.0, 0.0
+		for _, name := range b.conf.PriorityClasses {
+			priority += b.classBw[name][id]
+		}
+		for _, name := range b.conf.ThrottledClasses {
+			throttled += b.classBw[name][id]
+		}
+
+		for _, name := range b.conf.ThrottledClasses {
+			max := maxMB[name][id]
+			if _, ok := b.throttle[name]; !ok {
+				b.throttle[name] = make(map[uint64]uint64)
+			}
+			current, ok := b.throttle[name][id]
+			if !ok {
+				current = max
+			}
+
+			value := current
+			switch {
+			case priority > 0 && throttled > target:
+				// Keep the budget only while priority classes are active
+				if current > b.conf.Min+b.conf.Step {
+					value = current - b.conf.Step
+				} else {
+					value = b.conf.Min
+				}
+			case priority == 0 || throttled < target*bandwidthHysteresis:
+				if current+b.conf.Step < max {
+					value = current + b.conf.Step
+				} else {
+					value = max
+				}
+			}
+
+			b.throttle[name][id] = value
+			if value != current {
+				log.Debug("cache id %d: class %q throttled to %d%% (%.1f MBps, priority %.1f MBps)",
+					id, name, value, throttled, priority)
+				changed[name] = struct{}{}
+			}
+		}
+	}
+
+	for name := range changed {
+		if err := c.writeMBThrottle(name, b.throttle[name]); err != nil {
+			log.Error("failed to adjust memory bandwidth of class %q: %v", name, err)
+		}
+	}
+}
+
+// configuredMB returns the configured MB allocation (%) of a class, the
+// caller must hold c.RLock()
+func (c *control) configuredMB(name string, id uint64) uint64 {
+	if class, ok := c.conf.Classes[name]; ok && class.MBSchema != nil {
+		if pct, ok := class.MBSchema[id]; ok {
+			return pct
+		}
+	}
+	return 100
+}
+
+// writeMBThrottle writes the MB schemata of a class with the given allocations
+func (c *control) writeMBThrottle(name string, pcts map[uint64]uint64) error {
+	c.Lock()
+	defer c.Unlock()
+
+	cls, ok := c.classes[name]
+	if !ok {
+		return rdtError("class %q not found", name)
+	}
+
+	base := make(map[uint64]uint64, len(c.info.cacheIds))
+	partition := c.conf.Partitions[c.conf.Classes[name].Partition]
+	for _, id := range c.info.cacheIds {
+		base[id] = 100
+		if pct, ok := partition.MB[id]; ok {
+			base[id] = pct
+		}
+	}
+
+	schemata := mbSchema(pcts).ToStr(base)
+	log.Debug("writing schemata %q to %q", schemata, cls.relPath(""))
+
+	return c.writeRdtFile(cls.relPath("schemata"), []byte(schemata))
+}
+
+func copyBandwidth(bw map[uint64]float64) map[uint64]float64 {
+	ret := make(map[uint64]float64, len(bw))
+	for id, v := range bw {
+		ret[id] = v
+	}
+	return ret
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package rdt
 
 import (
+	"strconv"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -61,6 +62,9 @@ func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 			}
 		}
 	}
+	for _, name := range []string{"mb_bandwidth_mbps", "mb_mon_group_bandwidth_mbps", "mb_throttle_percent"} {
+		ch <- c.describeBandwidth(name)
+	}
 }
 
 // Collect method of the prometheus.Collector interface
@@ -78,6 +82,64 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 	wg.Wait()
+
+	c.collectBandwidthMetrics(ch)
+}
+
+func (c *collector) describeBandwidth(name string) *prometheus.Desc {
+	d, ok := c.descriptors[name]
+	if !ok {
+		var help string
+		var labels []string
+
+		switch name {
+		case "mb_bandwidth_mbps":
+			help = "memory bandwidth of an RDT class, in MBps"
+			labels = []string{"rdt_class", "cache_id"}
+		case "mb_mon_group_bandwidth_mbps":
+			help = "memory bandwidth of an RDT monitoring group, in MBps"
+			labels = append([]string{"rdt_class", "rdt_mon_group", "cache_id"}, customLabels...)
+		case "mb_throttle_percent":
+			help = "memory bandwidth allocation of a throttled RDT class, in percent"
+			labels = []string{"rdt_class", "cache_id"}
+		}
+		d = prometheus.NewDesc(name, help, labels, nil)
+		c.descriptors[name] = d
+	}
+	return d
+}
+
+func (c *collector) collectBandwidthMetrics(ch chan<- prometheus.Metric) {
+	m := GetBandwidthMetrics()
+	if m == nil {
+		return
+	}
+
+	for class, bw := range m.Classes {
+		for id, value := range bw {
+			ch <- prometheus.MustNewConstMetric(c.describeBandwidth("mb_bandwidth_mbps"),
+				prometheus.GaugeValue, value, class, strconv.FormatUint(id, 10))
+		}
+	}
+
+	for mg, bw := range m.Groups {
+		annotations := mg.GetAnnotations()
+		for id, value := range bw {
+			labels := []string{mg.Parent().Name(), mg.Name(), strconv.FormatUint(id, 10)}
+			for _, name := range customLabels {
+				labels = append(labels, annotations[name])
+			}
+			ch <- prometheus.MustNewConstMetric(c.describeBandwidth("mb_mon_group_bandwidth_mbps"),
+				prometheus.GaugeValue, value, labels...)
+		}
+	}
+
+	for class, pcts := range m.Throttle {
+		for id, pct := range pcts {
+			ch <- prometheus.MustNewConstMetric(c.describeBandwidth("mb_throttle_percent"),
+				prometheus.GaugeValue, float64(pct), class, strconv.FormatUint(id, 10))
+		}
+	}
 }
 
 func (c *collector) describeL3(feature string) *prometheus.Desc {
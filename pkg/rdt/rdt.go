@@ -25,6 +25,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	pkgcfg "github.com/intel/cri-resource-manager/pkg/config"
@@ -44,10 +45,14 @@ const (
 
 type control struct {
 	logger.Logger
+	sync.RWMutex
 
-	conf    config
-	info    info
-	classes map[string]*ctrlGroup
+	conf      config
+	info      info
+	classes   map[string]*ctrlGroup
+	dynamic   map[string]*dynamicClass
+	orphans   bool // keep stale dynamic groups until PruneDynamicClasses
+	bandwidth *bandwidthController
 }
 
 var log logger.Logger = logger.NewLogger("rdt")
@@ -142,7 +147,8 @@ type resctrlGroup struct {
 func Initialize() error {
 	var err error
 
-	rdt = &control{Logger: log}
+	rdt.stopBandwidthControl()
+	rdt = &control{Logger: log, orphans: true}
 
 	// Get info from the resctrl filesystem
 	rdt.info, err = getRdtInfo()
@@ -160,6 +166,8 @@ func Initialize() error {
 		return rdtError("configuration failed: %v", err)
 	}
 
+	rdt.startBandwidthControl()
+
 	pkgcfg.GetModule("rdt").AddNotify(rdt.configNotify)
 
 	return nil
@@ -186,11 +194,17 @@ func GetMonFeatures() map[MonResource][]string {
 }
 
 func (c *control) getClass(name string) (CtrlGroup, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
 	cls, ok := c.classes[name]
 	return cls, ok
 }
 
 func (c *control) getClasses() []CtrlGroup {
+	c.RLock()
+	defer c.RUnlock()
+
 	ret := make([]CtrlGroup, 0, len(c.classes))
 
 	for _, v := range c.classes {
@@ -222,12 +236,21 @@ func (c *control) configNotify(event pkgcfg.Event, source pkgcfg.Source) error {
 		return rdtError("invalid configuration: %v", err)
 	}
 
+	c.stopBandwidthControl()
+
+	c.Lock()
 	err = c.configureResctrl(conf)
+	if err == nil {
+		c.conf = conf
+	}
+	c.Unlock()
+
+	c.startBandwidthControl()
+
 	if err != nil {
 		return rdtError("resctrl configuration failed: %v", err)
 	}
 
-	c.conf = conf
 	c.Info("configuration finished")
 
 	return nil
@@ -243,6 +266,16 @@ func (c *control) configureResctrl(conf config) error {
 	}
 
 	for _, cls := range existingClasses {
+		if isDynamicClassName(cls.name) {
+			if _, ok := c.dynamic[cls.name]; ok || c.orphans {
+				continue
+			}
+			// Stale dynamic class, removal moves any tasks to the root class
+			if err := os.Remove(cls.path("")); err != nil {
+				return rdtError("failed to remove stale dynamic resctrl group %q: %v", cls.relPath(""), err)
+			}
+			continue
+		}
 		if _, ok := conf.Classes[cls.name]; !ok {
 			tasks, err := cls.GetPids()
 			if err != nil {
@@ -280,6 +313,9 @@ func (c *control) configureResctrl(conf config) error {
 		c.classes[name] = cg
 	}
 
+	// Retain dynamic classes, re-carving them from the (new) partition
+	c.reconfigureDynamicClasses(conf)
+
 	return nil
 }
 
@@ -344,6 +380,9 @@ func newCtrlGroup(name string) (*ctrlGroup, error) {
 }
 
 func (c *ctrlGroup) CreateMonGroup(name string, annotations map[string]string) (MonGroup, error) {
+	rdt.Lock()
+	defer rdt.Unlock()
+
 	if mg, ok := c.monGroups[name]; ok {
 		return mg, nil
 	}
@@ -360,6 +399,9 @@ func (c *ctrlGroup) CreateMonGroup(name string, annotations map[string]string) (
 }
 
 func (c *ctrlGroup) DeleteMonGroup(name string) error {
+	rdt.Lock()
+	defer rdt.Unlock()
+
 	mg, ok := c.monGroups[name]
 	if !ok {
 		log.Warn("trying to delete non-existent mon group %s/%s", c.name, name)
@@ -377,11 +419,17 @@ func (c *ctrlGroup) DeleteMonGroup(name string) error {
 }
 
 func (c *ctrlGroup) GetMonGroup(name string) (MonGroup, bool) {
+	rdt.RLock()
+	defer rdt.RUnlock()
+
 	mg, ok := c.monGroups[name]
 	return mg, ok
 }
 
 func (c *ctrlGroup) GetMonGroups() []MonGroup {
+	rdt.RLock()
+	defer rdt.RUnlock()
+
 	ret := make([]MonGroup, 0, len(c.monGroups))
 
 	for _, v := range c.monGroups {
@@ -396,31 +444,27 @@ func (c *ctrlGroup) configure(name string, class classConfig,
 	partition partitionConfig, options schemaOptions) error {
 	schemata := ""
 
-	// Handle L3 cache allocation
-	switch {
-	case rdt.info.l3.Supported():
-		schema, err := class.L3Schema.ToStr(l3SchemaTypeUnified, partition.L3)
-		if err != nil {
-			return err
-		}
-		schemata += schema
-	case rdt.info.l3data.Supported() || rdt.info.l3code.Supported():
-		schema, err := class.L3Schema.ToStr(l3SchemaTypeCode, partition.L3)
-		if err != nil {
-			return err
-		}
-		schemata += schema
+	// Handle L2 cache allocation
+	schema, err := catSchemata(cacheLevelL2, class.L2Schema, partition.L2,
+		rdt.info.l2, rdt.info.l2code, rdt.info.l2data)
+	if err != nil {
+		return err
+	}
+	if schema == "" && class.L2Schema != nil && !options.L2.Optional {
+		return rdtError("L2 cache allocation for %q specified in configuration but not supported by system", name)
+	}
+	schemata += schema
 
-		schema, err = class.L3Schema.ToStr(l3SchemaTypeData, partition.L3)
-		if err != nil {
-			return err
-		}
-		schemata += schema
-	default:
-		if class.L3Schema != nil && !options.L3.Optional {
-			return rdtError("L3 cache allocation for %q specified in configuration but not supported by system", name)
-		}
+	// Handle L3 cache allocation
+	schema, err = catSchemata(cacheLevelL3, class.L3Schema, partition.L3,
+		rdt.info.l3, rdt.info.l3code, rdt.info.l3data)
+	if err != nil {
+		return err
+	}
+	if schema == "" && class.L3Schema != nil && !options.L3.Optional {
+		return rdtError("L3 cache allocation for %q specified in configuration but not supported by system", name)
 	}
+	schemata += schema
 
 	// Handle memory bandwidth allocation
 	switch {
@@ -444,6 +488,29 @@ func (c *ctrlGroup) configure(name string, class classConfig,
 	return nil
 }
 
+// catSchemata returns the L2 or L3 schemata lines of a class, or an empty
+// string if the cache allocation is not supported by the system or configured
+func catSchemata(level cacheLevel, schema, base catSchema, unified, code, data catInfo) (string, error) {
+	if len(base) == 0 {
+		return "", nil
+	}
+	switch {
+	case unified.Supported():
+		return schema.ToStr(level, catSchemaTypeUnified, base)
+	case code.Supported() || data.Supported():
+		codeSchema, err := schema.ToStr(level, catSchemaTypeCode, base)
+		if err != nil {
+			return "", err
+		}
+		dataSchema, err := schema.ToStr(level, catSchemaTypeData, base)
+		if err != nil {
+			return "", err
+		}
+		return codeSchema + dataSchema, nil
+	}
+	return "", nil
+}
+
 func (c *ctrlGroup) monGroupsFromResctrlFs() ([]*monGroup, error) {
 	r, err := resctrlGroupsFromFs(c.path("mon_groups"))
 	if err != nil && !os.IsNotExist(err) {
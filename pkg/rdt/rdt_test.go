@@ -17,16 +17,21 @@ limitations under the License.
 package rdt
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sigs.k8s.io/yaml"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
+	pkgcfg "github.com/intel/cri-resource-manager/pkg/config"
 	"github.com/intel/cri-resource-manager/pkg/utils"
 	testdata "github.com/intel/cri-resource-manager/test/data/rdt"
 )
@@ -328,6 +333,304 @@ func TestRdt(t *testing.T) {
 	}
 }
 
+// TestDynamicClasses tests creating and deleting dynamic classes
+func TestDynamicClasses(t *testing.T) {
+	mockFs, err := newMockResctrlFs(t, "resctrl.full", "")
+	if err != nil {
+		t.Fatalf("failed to set up mock resctrl fs: %v", err)
+	}
+	defer mockFs.delete()
+
+	opt = defaultOptions().(*options)
+	setTestConfig(t, rdtTestConfig+`
+dynamicClasses:
+  partition: priority
+  classes: [Guaranteed]
+  fallbackClass: Burstable
+`)
+	defer func() { opt = defaultOptions().(*options) }()
+
+	if err := Initialize(); err != nil {
+		t.Fatalf("rdt initialization failed: %v", err)
+	}
+
+	if !WantsDynamicClass("Guaranteed") || !WantsDynamicClass(DynamicClassName) {
+		t.Errorf("expected dynamic classes for Guaranteed and %s", DynamicClassName)
+	}
+	if WantsDynamicClass("BestEffort") {
+		t.Errorf("unexpected dynamic class for BestEffort")
+	}
+	if f := DynamicFallbackClass("Guaranteed"); f != "Guaranteed" {
+		t.Errorf("unexpected fallback class %q for Guaranteed", f)
+	}
+	if f := DynamicFallbackClass(DynamicClassName); f != "Burstable" {
+		t.Errorf("unexpected fallback class %q for %s", f, DynamicClassName)
+	}
+
+	// Carve two non-overlapping halves of the partition
+	a, err := CreateDynamicClass("a", 50)
+	if err != nil {
+		t.Fatalf("failed to create dynamic class: %v", err)
+	}
+	b, err := CreateDynamicClass("b", 50)
+	if err != nil {
+		t.Fatalf("failed to create dynamic class: %v", err)
+	}
+	verifyTextFile(t, rdt.classes[a.Name()].path("schemata"),
+		"L3:0=3f00;1=3f00;2=3f00;3=3f00\nMB:0=100;1=100;2=100;3=100\n")
+	verifyTextFile(t, rdt.classes[b.Name()].path("schemata"),
+		"L3:0=fc000;1=fc000;2=fc000;3=fc000\nMB:0=100;1=100;2=100;3=100\n")
+
+	// Partition is full
+	if _, err := CreateDynamicClass("c", 10); !errors.Is(err, ErrDynamicClassesExhausted) {
+		t.Errorf("expected exhaustion error, got %v", err)
+	}
+
+	// Dynamic classes survive reconfiguration
+	if err := rdt.configNotify(pkgcfg.UpdateEvent, pkgcfg.ConfigFile); err != nil {
+		t.Fatalf("reconfiguration failed: %v", err)
+	}
+	if _, ok := GetClass(b.Name()); !ok {
+		t.Errorf("dynamic class %q lost in reconfiguration", b.Name())
+	}
+
+	// Delete one and reuse the freed space. Unlike resctrl, the mock fs
+	// needs the group emptied before it can be removed.
+	os.Remove(rdt.classes[a.Name()].path("schemata"))
+	if err := DeleteDynamicClass("a"); err != nil {
+		t.Errorf("failed to delete dynamic class: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mockFs.baseDir, "resctrl", resctrlGroupPrefix+a.Name())); !os.IsNotExist(err) {
+		t.Errorf("dynamic class directory not removed: %v", err)
+	}
+	c, err := CreateDynamicClass("c", 10)
+	if err != nil {
+		t.Fatalf("failed to create dynamic class: %v", err)
+	}
+	verifyTextFile(t, rdt.classes[c.Name()].path("schemata"),
+		"L3:0=300;1=300;2=300;3=300\nMB:0=100;1=100;2=100;3=100\n")
+}
+
+// TestPruneDynamicClasses tests that dynamic classes of a previous run are
+// kept until pruned, and that re-created ones survive pruning
+func TestPruneDynamicClasses(t *testing.T) {
+	mockFs, err := newMockResctrlFs(t, "resctrl.full", "")
+	if err != nil {
+		t.Fatalf("failed to set up mock resctrl fs: %v", err)
+	}
+	defer mockFs.delete()
+
+	opt = defaultOptions().(*options)
+	setTestConfig(t, rdtTestConfig+`
+dynamicClasses:
+  partition: priority
+  classes: [Guaranteed]
+`)
+	defer func() { opt = defaultOptions().(*options) }()
+
+	groupDir := func(id string) string {
+		return filepath.Join(mockFs.baseDir, "resctrl", resctrlGroupPrefix+dynamicClassPrefix+id)
+	}
+	for _, id := range []string{"kept", "gone"} {
+		if err := os.Mkdir(groupDir(id), 0755); err != nil {
+			t.Fatalf("failed to create stale dynamic group: %v", err)
+		}
+	}
+
+	if err := Initialize(); err != nil {
+		t.Fatalf("rdt initialization failed: %v", err)
+	}
+	for _, id := range []string{"kept", "gone"} {
+		if _, err := os.Stat(groupDir(id)); err != nil {
+			t.Errorf("stale dynamic group %q removed before pruning: %v", id, err)
+		}
+	}
+
+	if _, err := CreateDynamicClass("kept", 10); err != nil {
+		t.Fatalf("failed to re-create dynamic class: %v", err)
+	}
+	if err := PruneDynamicClasses(); err != nil {
+		t.Fatalf("failed to prune dynamic classes: %v", err)
+	}
+	if _, err := os.Stat(groupDir("kept")); err != nil {
+		t.Errorf("re-created dynamic group removed: %v", err)
+	}
+	if _, err := os.Stat(groupDir("gone")); !os.IsNotExist(err) {
+		t.Errorf("stale dynamic group not removed: %v", err)
+	}
+}
+
+const rdtL2TestConfig string = `
+partitions:
+  priority:
+    l2Allocation:
+      all: 60%
+    l3Allocation:
+      all: 60%
+    mbAllocation:
+      all: [100%]
+    classes:
+      Guaranteed:
+        l2schema:
+          all:
+            unified: 50%
+            code: 100%
+            data: 50%
+  default:
+    l2Allocation:
+      all: 40%
+    l3Allocation:
+      all: 40%
+    mbAllocation:
+      all: [100%]
+    classes:
+      Burstable:
+        l2schema:
+          all: 100%
+          1: "0x6"
+        mbschema:
+          all: [50%]
+`
+
+// TestL2 tests L2 cache allocation, with and without CDP
+func TestL2(t *testing.T) {
+	defer func() { opt = defaultOptions().(*options) }()
+
+	tcs := []struct {
+		name       string
+		guaranteed string
+		burstable  string
+	}{
+		{
+			name:       "resctrl.l2",
+			guaranteed: "L2:0=38;1=38;2=38;3=38\nL3:0=ff0\nMB:0=100\n",
+			burstable:  "L2:0=7;1=6;2=7;3=7\nL3:0=f\nMB:0=50\n",
+		},
+		{
+			name: "resctrl.l2cdp",
+			guaranteed: "L2CODE:0=f8;1=f8;2=f8;3=f8\nL2DATA:0=38;1=38;2=38;3=38\n" +
+				"L3:0=ff0\nMB:0=100\n",
+			burstable: "L2CODE:0=7;1=6;2=7;3=7\nL2DATA:0=7;1=6;2=7;3=7\n" +
+				"L3:0=f\nMB:0=50\n",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockFs, err := newMockResctrlFs(t, tc.name, "")
+			if err != nil {
+				t.Fatalf("failed to set up mock resctrl fs: %v", err)
+			}
+			defer mockFs.delete()
+
+			opt = defaultOptions().(*options)
+			setTestConfig(t, rdtL2TestConfig)
+
+			if err := Initialize(); err != nil {
+				t.Fatalf("rdt initialization failed: %v", err)
+			}
+
+			verifyTextFile(t, rdt.classes["Guaranteed"].path("schemata"), tc.guaranteed)
+			verifyTextFile(t, rdt.classes["Burstable"].path("schemata"), tc.burstable)
+		})
+	}
+
+	// L2 allocation on a system without L2 support
+	mockFs, err := newMockResctrlFs(t, "resctrl.full", "")
+	if err != nil {
+		t.Fatalf("failed to set up mock resctrl fs: %v", err)
+	}
+	defer mockFs.delete()
+
+	opt = defaultOptions().(*options)
+	setTestConfig(t, rdtL2TestConfig)
+	if err := Initialize(); err == nil {
+		t.Errorf("unexpected success configuring L2 allocation without L2 support")
+	}
+
+	opt = defaultOptions().(*options)
+	setTestConfig(t, rdtL2TestConfig+`
+options:
+  l2:
+    optional: true
+`)
+	if err := Initialize(); err != nil {
+		t.Errorf("rdt initialization with optional L2 failed: %v", err)
+	}
+}
+
+// TestBandwidthControl tests the memory bandwidth feedback loop
+func TestBandwidthControl(t *testing.T) {
+	mockFs, err := newMockResctrlFs(t, "resctrl.full", "")
+	if err != nil {
+		t.Fatalf("failed to set up mock resctrl fs: %v", err)
+	}
+	defer mockFs.delete()
+
+	opt = defaultOptions().(*options)
+	setTestConfig(t, rdtTestConfig+`
+bandwidthControl:
+  interval: 1h
+  capacity: 1000
+  budget: 400
+  priorityClasses: [Guaranteed]
+  throttledClasses: [BestEffort]
+`)
+	defer func() { opt = defaultOptions().(*options) }()
+
+	if err := Initialize(); err != nil {
+		t.Fatalf("rdt initialization failed: %v", err)
+	}
+	defer rdt.stopBandwidthControl()
+
+	b := rdt.bandwidth
+	if b == nil {
+		t.Fatalf("bandwidth control not started")
+	}
+
+	// setBytes sets the mbm_total_bytes counters of a class, in MBs
+	setBytes := func(class string, mbs uint64) {
+		for id := 0; id < 4; id++ {
+			dir := rdt.classes[class].path("mon_data", fmt.Sprintf("mon_L3_%02d", id))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("failed to create mock mon data: %v", err)
+			}
+			data := []byte(strconv.FormatUint(mbs*1024*1024, 10) + "\n")
+			if err := ioutil.WriteFile(filepath.Join(dir, "mbm_total_bytes"), data, 0644); err != nil {
+				t.Fatalf("failed to write mock mon data: %v", err)
+			}
+		}
+	}
+	// step takes a sample, pretending a second has passed since the previous one
+	step := func() {
+		for key, s := range b.samples {
+			s.time = s.time.Add(-time.Second)
+			b.samples[key] = s
+		}
+		b.update(rdt)
+	}
+
+	setBytes("Guaranteed", 0)
+	setBytes("BestEffort", 0)
+	b.update(rdt)
+
+	// Throttled class exceeds capacity-budget while priority class is active
+	setBytes("Guaranteed", 100)
+	setBytes("BestEffort", 1000)
+	step()
+	verifyTextFile(t, rdt.classes["BestEffort"].path("schemata"), "MB:0=23;1=23;2=23;3=23\n")
+	if m := GetBandwidthMetrics(); m == nil || m.Throttle["BestEffort"][0] != 23 {
+		t.Errorf("unexpected bandwidth metrics %v", m)
+	} else if bw := m.Classes["BestEffort"][0]; bw < 900 || bw > 1000 {
+		t.Errorf("unexpected measured bandwidth %f", bw)
+	}
+
+	// Throttled class calms down to 100MBps, allocation raised by one step
+	setBytes("Guaranteed", 200)
+	setBytes("BestEffort", 1100)
+	step()
+	verifyTextFile(t, rdt.classes["BestEffort"].path("schemata"), "MB:0=33;1=33;2=33;3=33\n")
+}
+
 func TestBitMap(t *testing.T) {
 	// Test ListStr()
 	testSet := map[Bitmask]string{
@@ -34,6 +34,14 @@ const (
 	sysfsCPUPath = "devices/system/cpu"
 	// sysfs device/node subdirectory path
 	sysfsNumaNodePath = "devices/system/node"
+	// sysfs PMU device listing the performance cores of hybrid CPUs
+	sysfsCoreCPUsPath = "devices/cpu_core/cpus"
+	// sysfs PMU device listing the efficient cores of hybrid CPUs
+	sysfsAtomCPUsPath = "devices/cpu_atom/cpus"
+	// sysfs node subdirectory with heterogeneous memory attributes for any initiator
+	sysfsNodeAccessPath = "access0/initiators"
+	// sysfs glob for the target nodes of DAX devices of CXL memory regions
+	sysfsCXLTargetNodes = "bus/cxl/devices/region*/dax_region*/dax*/target_node"
 )
 
 // DiscoveryFlag controls what hardware details to discover.
@@ -66,6 +74,16 @@ const (
 	MemoryTypeHBM
 )
 
+// CoreKind is the kind of a CPU core in hybrid CPU architectures.
+type CoreKind int
+
+const (
+	// PerformanceCore is a core optimized for performance (a P-core).
+	PerformanceCore CoreKind = iota
+	// EfficientCore is a core optimized for power efficiency (an E-core).
+	EfficientCore
+)
+
 // System devices
 type System interface {
 	Discover(flags DiscoveryFlag) error
@@ -85,6 +103,7 @@ type System interface {
 	CPU(id ID) CPU
 	Offlined() cpuset.CPUSet
 	Isolated() cpuset.CPUSet
+	CoreKindCPUs(CoreKind) cpuset.CPUSet
 }
 
 // System devices
@@ -95,7 +114,7 @@ type system struct {
 	packages      map[ID]*cpuPackage // physical packages
 	nodes         map[ID]*node       // NUMA nodes
 	cpus          map[ID]*cpu        // CPUs
-	cache         map[ID]*Cache      // Cache
+	caches        []*Cache           // CPU caches
 	offline       IDSet              // offlined CPUs
 	isolated      IDSet              // isolated CPUs
 	threads       int                // hyperthreads per core
@@ -106,12 +125,15 @@ type CPUPackage interface {
 	ID() ID
 	CPUSet() cpuset.CPUSet
 	NodeIDs() []ID
+	DieIDs() []ID
+	DieCPUSet(id ID) cpuset.CPUSet
 }
 
 type cpuPackage struct {
-	id    ID    // package id
-	cpus  IDSet // CPUs in this package
-	nodes IDSet // nodes in this package
+	id    ID           // package id
+	cpus  IDSet        // CPUs in this package
+	nodes IDSet        // nodes in this package
+	dies  map[ID]IDSet // CPUs of dies in this package
 }
 
 // Node represents a NUMA node.
@@ -123,15 +145,19 @@ type Node interface {
 	DistanceFrom(id ID) int
 	MemoryInfo() (*MemInfo, error)
 	GetMemoryType() MemoryType
+	MemoryAttributes() *MemoryAttributes
+	IsCXL() bool
 }
 
 type node struct {
-	path       string     // sysfs path
-	id         ID         // node id
-	pkg        ID         // package id
-	cpus       IDSet      // cpus in this node
-	memoryType MemoryType // node memory type
-	distance   []int      // distance/cost to other NUMA nodes
+	path       string            // sysfs path
+	id         ID                // node id
+	pkg        ID                // package id
+	cpus       IDSet             // cpus in this node
+	memoryType MemoryType        // node memory type
+	distance   []int             // distance/cost to other NUMA nodes
+	attrs      *MemoryAttributes // heterogeneous memory attributes, if known
+	cxl        bool              // whether memory is from a CXL region
 }
 
 // CPU is a CPU core.
@@ -140,25 +166,32 @@ type CPU interface {
 	PackageID() ID
 	NodeID() ID
 	CoreID() ID
+	DieID() ID
 	ThreadCPUSet() cpuset.CPUSet
+	GetCaches() []*Cache
+	GetLastLevelCache() *Cache
 	BaseFrequency() uint64
 	FrequencyRange() CPUFreq
+	CoreKind() CoreKind
 	Online() bool
 	Isolated() bool
 	SetFrequencyLimits(min, max uint64) error
 }
 
 type cpu struct {
-	path     string  // sysfs path
-	id       ID      // CPU id
-	pkg      ID      // package id
-	node     ID      // node id
-	core     ID      // core id
-	threads  IDSet   // sibling/hyper-threads
-	baseFreq uint64  // CPU base frequency
-	freq     CPUFreq // CPU frequencies
-	online   bool    // whether this CPU is online
-	isolated bool    // whether this CPU is isolated
+	path     string   // sysfs path
+	id       ID       // CPU id
+	pkg      ID       // package id
+	node     ID       // node id
+	core     ID       // core id
+	die      ID       // die id
+	threads  IDSet    // sibling/hyper-threads
+	caches   []*Cache // caches used by this CPU
+	baseFreq uint64   // CPU base frequency
+	freq     CPUFreq  // CPU frequencies
+	kind     CoreKind // core kind in hybrid CPUs
+	online   bool     // whether this CPU is online
+	isolated bool     // whether this CPU is isolated
 }
 
 // CPUFreq is a CPU frequency scaling range
@@ -168,6 +201,17 @@ type CPUFreq struct {
 	all []uint64 // discrete set of frequencies if applicable/known
 }
 
+// MemoryAttributes are the heterogeneous memory attributes of a NUMA node, as
+// reported by the kernel (typically from ACPI HMAT) for accesses from the
+// initiators with the best performance.
+type MemoryAttributes struct {
+	Initiators     IDSet  // nodes with the best access performance
+	ReadBandwidth  uint64 // read bandwidth (MB/s)
+	WriteBandwidth uint64 // write bandwidth (MB/s)
+	ReadLatency    uint64 // read latency (ns)
+	WriteLatency   uint64 // write latency (ns)
+}
+
 // MemInfo contains data read from a NUMA node meminfo file.
 type MemInfo struct {
 	MemTotal uint64
@@ -176,9 +220,8 @@ type MemInfo struct {
 }
 
 // CPU cache.
-//   Notes: cache-discovery is forced off now (by forcibly clearing the related discovery bit)
-//      Can't seem to make sense of the cache information exposed under sysfs. The cache ids
-//      do not seem to be unique, which IIUC is contrary to the documentation.
+//   Notes: cache ids are only unique among caches of the same level and type. Caches are
+//      identified by their level, type, and the set of CPUs sharing them instead.
 
 // CacheType specifies a cache type.
 type CacheType string
@@ -201,6 +244,58 @@ type Cache struct {
 	cpus  IDSet     // CPUs sharing this cache
 }
 
+// ID returns the id of this cache, unique among caches of the same level and type.
+func (c *Cache) ID() ID {
+	return c.id
+}
+
+// Kind returns the type of this cache.
+func (c *Cache) Kind() CacheType {
+	return c.kind
+}
+
+// Size returns the size of this cache in bytes.
+func (c *Cache) Size() uint64 {
+	return c.size
+}
+
+// Level returns the level of this cache.
+func (c *Cache) Level() uint8 {
+	return c.level
+}
+
+// SharedCPUSet returns the set of CPUs sharing this cache.
+func (c *Cache) SharedCPUSet() cpuset.CPUSet {
+	return c.cpus.CPUSet()
+}
+
+// String returns a printable representation of this cache.
+func (c *Cache) String() string {
+	return fmt.Sprintf("L%d %s cache #%d (%d bytes, CPUs %s)", c.level, c.kind, c.id, c.size, c.cpus)
+}
+
+// String returns the core kind as a string.
+func (k CoreKind) String() string {
+	switch k {
+	case PerformanceCore:
+		return "performance"
+	case EfficientCore:
+		return "efficient"
+	}
+	return fmt.Sprintf("<unknown core kind %d>", int(k))
+}
+
+// ParseCoreKind parses a core kind, "performance" or "efficient".
+func ParseCoreKind(value string) (CoreKind, error) {
+	switch value {
+	case "performance":
+		return PerformanceCore, nil
+	case "efficient":
+		return EfficientCore, nil
+	}
+	return PerformanceCore, fmt.Errorf("invalid core kind %q", value)
+}
+
 // DiscoverSystem performs discovery of the running systems details.
 func DiscoverSystem(args ...DiscoveryFlag) (System, error) {
 	return DiscoverSystemAt(SysfsRootPath, args...)
@@ -234,7 +329,7 @@ func DiscoverSystemAt(path string, args ...DiscoveryFlag) (System, error) {
 
 // Discover performs system/hardware discovery.
 func (sys *system) Discover(flags DiscoveryFlag) error {
-	sys.flags |= (flags &^ DiscoverCache)
+	sys.flags |= flags
 
 	if (sys.flags & (DiscoverCPUTopology | DiscoverCache)) != 0 {
 		if err := sys.discoverCPUs(); err != nil {
@@ -248,6 +343,13 @@ func (sys *system) Discover(flags DiscoveryFlag) error {
 		}
 	}
 
+	if (flags & DiscoverCache) != 0 {
+		// CPUs discovered earlier without cache details
+		for _, cpu := range sys.cpus {
+			sys.discoverCPUCaches(cpu)
+		}
+	}
+
 	if (sys.flags & DiscoverMemTopology) != 0 {
 		if err := sys.discoverNodes(); err != nil {
 			return err
@@ -282,6 +384,7 @@ func (sys *system) Discover(flags DiscoveryFlag) error {
 			sys.Debug("        pkg: %d", cpu.pkg)
 			sys.Debug("       node: %d", cpu.node)
 			sys.Debug("       core: %d", cpu.core)
+			sys.Debug("        die: %d", cpu.die)
 			sys.Debug("    threads: %s", cpu.threads)
 			sys.Debug("  base freq: %d", cpu.baseFreq)
 			sys.Debug("       freq: %d - %d", cpu.freq.min, cpu.freq.max)
@@ -290,8 +393,8 @@ func (sys *system) Discover(flags DiscoveryFlag) error {
 		sys.Debug("offline CPUs: %s", sys.offline)
 		sys.Debug("isolated CPUs: %s", sys.isolated)
 
-		for id, cch := range sys.cache {
-			sys.Debug("cache #%d:", id)
+		for _, cch := range sys.caches {
+			sys.Debug("cache #%d:", cch.id)
 			sys.Debug("   type: %v", cch.kind)
 			sys.Debug("   size: %d", cch.size)
 			sys.Debug("  level: %d", cch.level)
@@ -461,6 +564,17 @@ func (sys *system) CPU(id ID) CPU {
 	return sys.cpus[id]
 }
 
+// CoreKindCPUs gets the set of CPUs with the given kind of core.
+func (sys *system) CoreKindCPUs(kind CoreKind) cpuset.CPUSet {
+	cpus := NewIDSet()
+	for id, cpu := range sys.cpus {
+		if cpu.kind == kind {
+			cpus.Add(id)
+		}
+	}
+	return cpus.CPUSet()
+}
+
 // Offlined gets the set of offlined CPUs.
 func (sys *system) Offlined() cpuset.CPUSet {
 	return sys.offline.CPUSet()
@@ -491,9 +605,50 @@ func (sys *system) discoverCPUs() error {
 		}
 	}
 
+	sys.discoverCoreKinds()
+
 	return nil
 }
 
+// Discover the kinds of CPU cores in hybrid CPUs.
+func (sys *system) discoverCoreKinds() {
+	// Hybrid x86 CPUs have separate PMU devices for performance and efficient cores.
+	if atom, err := readCPUsetFile(sys.path, sysfsAtomCPUsPath); err == nil {
+		if core, err := readCPUsetFile(sys.path, sysfsCoreCPUsPath); err == nil {
+			sys.Info("performance cores: %s", core)
+		}
+		sys.Info("efficient cores: %s", atom)
+		for _, id := range atom.ToSlice() {
+			if cpu, ok := sys.cpus[ID(id)]; ok {
+				cpu.kind = EfficientCore
+			}
+		}
+		return
+	}
+
+	// Otherwise, consider cores with less than the maximum capacity efficient.
+	capacity := map[ID]uint64{}
+	max := uint64(0)
+	for id, cpu := range sys.cpus {
+		var c uint64
+		if _, err := readSysfsEntry(cpu.path, "cpu_capacity", &c); err != nil {
+			return
+		}
+		capacity[id] = c
+		if c > max {
+			max = c
+		}
+	}
+	for id, c := range capacity {
+		if c < max {
+			sys.cpus[id].kind = EfficientCore
+		}
+	}
+	if efficient := sys.CoreKindCPUs(EfficientCore); !efficient.IsEmpty() {
+		sys.Info("efficient cores (by CPU capacity): %s", efficient)
+	}
+}
+
 // Discover details of the given CPU.
 func (sys *system) discoverCPU(path string) error {
 	cpu := &cpu{path: path, id: getEnumeratedID(path), online: true}
@@ -514,6 +669,9 @@ func (sys *system) discoverCPU(path string) error {
 		if _, err := readSysfsEntry(path, "topology/thread_siblings_list", &cpu.threads, ","); err != nil {
 			return err
 		}
+		if _, err := readSysfsEntry(path, "topology/die_id", &cpu.die); err != nil {
+			cpu.die = 0
+		}
 	} else {
 		sys.offline.Add(cpu.id)
 	}
@@ -543,17 +701,28 @@ func (sys *system) discoverCPU(path string) error {
 	sys.cpus[cpu.id] = cpu
 
 	if (sys.flags & DiscoverCache) != 0 {
-		entries, _ := filepath.Glob(filepath.Join(path, "cache/index[0-9]*"))
-		for _, entry := range entries {
-			if err := sys.discoverCache(entry); err != nil {
-				return err
-			}
-		}
+		sys.discoverCPUCaches(cpu)
 	}
 
 	return nil
 }
 
+// discoverCPUCaches discovers the caches of an online CPU, unless already done.
+func (sys *system) discoverCPUCaches(cpu *cpu) {
+	if !cpu.online || cpu.caches != nil {
+		return
+	}
+	entries, _ := filepath.Glob(filepath.Join(cpu.path, "cache/index[0-9]*"))
+	for _, entry := range entries {
+		c, err := sys.discoverCache(entry)
+		if err != nil {
+			sys.Warn("ignoring cache of CPU #%d: %v", cpu.id, err)
+			continue
+		}
+		cpu.caches = append(cpu.caches, c)
+	}
+}
+
 // ID returns the id of this CPU.
 func (c *cpu) ID() ID {
 	return c.id
@@ -574,6 +743,32 @@ func (c *cpu) CoreID() ID {
 	return c.core
 }
 
+// DieID returns the die id of this CPU.
+func (c *cpu) DieID() ID {
+	return c.die
+}
+
+// GetCaches returns the caches used by this CPU.
+func (c *cpu) GetCaches() []*Cache {
+	caches := make([]*Cache, len(c.caches))
+	copy(caches, c.caches)
+	return caches
+}
+
+// GetLastLevelCache returns the highest level data or unified cache of this CPU.
+func (c *cpu) GetLastLevelCache() *Cache {
+	var llc *Cache
+	for _, cch := range c.caches {
+		if cch.kind == InstructionCache {
+			continue
+		}
+		if llc == nil || cch.level > llc.level {
+			llc = cch
+		}
+	}
+	return llc
+}
+
 // ThreadCPUSet returns the CPUSet for all threads in this core.
 func (c *cpu) ThreadCPUSet() cpuset.CPUSet {
 	return c.threads.CPUSet()
@@ -589,6 +784,11 @@ func (c *cpu) FrequencyRange() CPUFreq {
 	return c.freq
 }
 
+// CoreKind returns the kind of this CPU core.
+func (c *cpu) CoreKind() CoreKind {
+	return c.kind
+}
+
 // Online returns if this CPU is online.
 func (c *cpu) Online() bool {
 	return c.online
@@ -704,13 +904,30 @@ func (sys *system) discoverNodes() error {
 		}
 	}
 
+	sys.discoverCXLNodes()
+	dramBandwidth := sys.averageBandwidth(dramNodeIds)
+
 	for _, node := range sys.nodes {
 		if _, ok := pmemOrHbmNodeIds[node.id]; ok {
 			mem, ok := infos[node.id]
 			if !ok {
 				return fmt.Errorf("not able to determine system special memory types")
 			}
-			if mem.MemTotal < dramAvg {
+			// Prefer what we know about the memory over guessing by its amount:
+			// CXL memory is slower than DRAM, and with memory attributes available
+			// HBM is the memory with more bandwidth than DRAM.
+			if node.cxl {
+				sys.Logger.Info("node %d has CXL memory", node.id)
+				node.memoryType = MemoryTypePMEM
+			} else if node.attrs != nil && node.attrs.ReadBandwidth > 0 && dramBandwidth > 0 {
+				if node.attrs.ReadBandwidth > dramBandwidth {
+					sys.Logger.Info("node %d has HBM memory (%d MB/s)", node.id, node.attrs.ReadBandwidth)
+					node.memoryType = MemoryTypeHBM
+				} else {
+					sys.Logger.Info("node %d has PMEM memory (%d MB/s)", node.id, node.attrs.ReadBandwidth)
+					node.memoryType = MemoryTypePMEM
+				}
+			} else if mem.MemTotal < dramAvg {
 				sys.Logger.Info("node %d has HBM memory", node.id)
 				node.memoryType = MemoryTypeHBM
 			} else {
@@ -738,12 +955,68 @@ func (sys *system) discoverNode(path string) error {
 	if _, err := readSysfsEntry(path, "distance", &node.distance); err != nil {
 		return err
 	}
+	node.attrs = discoverMemoryAttributes(filepath.Join(path, sysfsNodeAccessPath))
 
 	sys.nodes[node.id] = node
 
 	return nil
 }
 
+// Discover the heterogeneous memory attributes of a node, if the kernel provides them.
+func discoverMemoryAttributes(path string) *MemoryAttributes {
+	attrs := &MemoryAttributes{Initiators: NewIDSet()}
+
+	for entry, ptr := range map[string]*uint64{
+		"read_bandwidth":  &attrs.ReadBandwidth,
+		"write_bandwidth": &attrs.WriteBandwidth,
+		"read_latency":    &attrs.ReadLatency,
+		"write_latency":   &attrs.WriteLatency,
+	} {
+		if _, err := readSysfsEntry(path, entry, ptr); err != nil {
+			return nil
+		}
+	}
+
+	initiators, _ := filepath.Glob(filepath.Join(path, "node[0-9]*"))
+	for _, initiator := range initiators {
+		attrs.Initiators.Add(getEnumeratedID(initiator))
+	}
+
+	return attrs
+}
+
+// Discover NUMA nodes with memory from CXL memory regions.
+func (sys *system) discoverCXLNodes() {
+	entries, _ := filepath.Glob(filepath.Join(sys.path, sysfsCXLTargetNodes))
+	for _, entry := range entries {
+		var id ID
+		if _, err := readSysfsEntry(filepath.Dir(entry), filepath.Base(entry), &id); err != nil {
+			sys.Logger.Warn("failed to read CXL target node: %v", err)
+			continue
+		}
+		if node, ok := sys.nodes[id]; ok {
+			sys.Logger.Info("node %d is a CXL memory node", id)
+			node.cxl = true
+		}
+	}
+}
+
+// Calculate the average read bandwidth of the given nodes, 0 if unknown for any of them.
+func (sys *system) averageBandwidth(ids IDSet) uint64 {
+	if len(ids) == 0 {
+		return 0
+	}
+	total := uint64(0)
+	for id := range ids {
+		node, ok := sys.nodes[id]
+		if !ok || node.attrs == nil || node.attrs.ReadBandwidth == 0 {
+			return 0
+		}
+		total += node.attrs.ReadBandwidth
+	}
+	return total / uint64(len(ids))
+}
+
 // ID returns id of this node.
 func (n *node) ID() ID {
 	return n.id
@@ -808,6 +1081,16 @@ func (n *node) GetMemoryType() MemoryType {
 	return n.memoryType
 }
 
+// MemoryAttributes returns the heterogeneous memory attributes of this node, nil if not known.
+func (n *node) MemoryAttributes() *MemoryAttributes {
+	return n.attrs
+}
+
+// IsCXL returns true if the memory of this node is from a CXL memory region.
+func (n *node) IsCXL() bool {
+	return n.cxl
+}
+
 // Discover physical packages (CPU sockets) present in the system.
 func (sys *system) discoverPackages() error {
 	if sys.packages != nil {
@@ -823,11 +1106,16 @@ func (sys *system) discoverPackages() error {
 				id:    cpu.pkg,
 				cpus:  NewIDSet(),
 				nodes: NewIDSet(),
+				dies:  make(map[ID]IDSet),
 			}
 			sys.packages[cpu.pkg] = pkg
 		}
 		pkg.cpus.Add(cpu.id)
 		pkg.nodes.Add(cpu.node)
+		if _, found := pkg.dies[cpu.die]; !found {
+			pkg.dies[cpu.die] = NewIDSet()
+		}
+		pkg.dies[cpu.die].Add(cpu.id)
 	}
 
 	return nil
@@ -848,36 +1136,48 @@ func (p *cpuPackage) NodeIDs() []ID {
 	return p.nodes.SortedMembers()
 }
 
-// Discover cache associated with the given CPU.
-// Notes:
-//     I'm not sure how to interpret the cache information under sysfs. This code is now effectively
-//     disabled by forcing the associated discovery bit off in the discovery flags.
-func (sys *system) discoverCache(path string) error {
-	var id ID
-
-	if _, err := readSysfsEntry(path, "id", &id); err != nil {
-		return sysfsError(path, "can't read cache id: %v", err)
+// DieIDs returns the die ids for this package.
+func (p *cpuPackage) DieIDs() []ID {
+	ids := make([]ID, 0, len(p.dies))
+	for id := range p.dies {
+		ids = append(ids, id)
 	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
 
-	if sys.cache == nil {
-		sys.cache = make(map[ID]*Cache)
+// DieCPUSet returns the CPUSet for all cores/threads in the given die of this package.
+func (p *cpuPackage) DieCPUSet(id ID) cpuset.CPUSet {
+	if cpus, ok := p.dies[id]; ok {
+		return cpus.CPUSet()
 	}
+	return cpuset.NewCPUSet()
+}
 
-	if _, found := sys.cache[id]; found {
-		return nil
+// Discover cache associated with the given CPU.
+func (sys *system) discoverCache(path string) (*Cache, error) {
+	var id ID
+
+	if _, err := readSysfsEntry(path, "id", &id); err != nil {
+		// some platforms (for instance VMs) do not expose cache ids
+		id = 0
 	}
 
 	c := &Cache{id: id}
 
 	if _, err := readSysfsEntry(path, "level", &c.level); err != nil {
-		return sysfsError(path, "can't read cache level: %v", err)
+		return nil, sysfsError(path, "can't read cache level: %v", err)
 	}
-	if _, err := readSysfsEntry(path, "shared_cpu_list", &c.cpus, ","); err != nil {
-		return sysfsError(path, "can't read shared CPUs: %v", err)
+	cpus, err := readCPUsetFile(path, "shared_cpu_list")
+	if err != nil {
+		return nil, sysfsError(path, "can't read shared CPUs: %v", err)
 	}
+	c.cpus = FromCPUSet(cpus)
 	kind := ""
 	if _, err := readSysfsEntry(path, "type", &kind); err != nil {
-		return sysfsError(path, "can't read cache type: %v", err)
+		return nil, sysfsError(path, "can't read cache type: %v", err)
 	}
 	switch kind {
 	case "Data":
@@ -887,30 +1187,42 @@ func (sys *system) discoverCache(path string) error {
 	case "Unified":
 		c.kind = UnifiedCache
 	default:
-		return sysfsError(path, "unknown cache type: %s", kind)
+		return nil, sysfsError(path, "unknown cache type: %s", kind)
+	}
+
+	for _, cch := range sys.caches {
+		if cch.level == c.level && cch.kind == c.kind && cch.cpus.String() == c.cpus.String() {
+			return cch, nil
+		}
 	}
 
 	size := ""
 	if _, err := readSysfsEntry(path, "size", &size); err != nil {
-		return sysfsError(path, "can't read cache size: %v", err)
+		return nil, sysfsError(path, "can't read cache size: %v", err)
+	}
+	if size == "" {
+		return nil, sysfsError(path, "empty cache size")
 	}
 
 	base := size[0 : len(size)-1]
 	suff := size[len(size)-1]
 	unit := map[byte]uint64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30}
 
-	val, err := strconv.ParseUint(base, 10, 0)
-	if err != nil {
-		return sysfsError(path, "can't parse cache size '%s': %v", size, err)
-	}
-
 	if u, ok := unit[suff]; ok {
+		val, err := strconv.ParseUint(base, 10, 0)
+		if err != nil {
+			return nil, sysfsError(path, "can't parse cache size '%s': %v", size, err)
+		}
 		c.size = val * u
 	} else {
-		c.size = val*1000 + u - '0'
+		val, err := strconv.ParseUint(size, 10, 0)
+		if err != nil {
+			return nil, sysfsError(path, "can't parse cache size '%s': %v", size, err)
+		}
+		c.size = val
 	}
 
-	sys.cache[c.id] = c
+	sys.caches = append(sys.caches, c)
 
-	return nil
+	return c, nil
 }